@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// apiError is a non-2xx reply from the server.
+type apiError struct {
+	Status int
+	Msg    string
+	JQL    string
+}
+
+func (e *apiError) Error() string {
+	if e.JQL != "" {
+		return fmt.Sprintf("server: %s (status %d, jql: %s)", e.Msg, e.Status, e.JQL)
+	}
+	return fmt.Sprintf("server: %s (status %d)", e.Msg, e.Status)
+}
+
+type client struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+func newClient(opts *options) *client {
+	// Searches with analysis can take minutes.
+	return &client{base: strings.TrimRight(opts.server, "/"), token: opts.token, http: &http.Client{Timeout: 10 * time.Minute}}
+}
+
+func (c *client) get(path string, params url.Values, out any) error {
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	return c.do(http.MethodGet, path, nil, out)
+}
+
+func (c *client) post(path string, body, out any) error {
+	return c.do(http.MethodPost, path, body, out)
+}
+
+// do sends a request and decodes the JSON reply into out. A 422 reply is
+// decoded too and returned as an *apiError, so callers can read a
+// clarification from out.
+func (c *client) do(method, path string, body, out any) error {
+	var rd io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.base+path, rd)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnprocessableEntity && out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return err
+		}
+		return &apiError{Status: resp.StatusCode, Msg: "clarification needed"}
+	}
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+			JQL   string `json:"jql"`
+		}
+		if json.Unmarshal(data, &e) != nil || e.Error == "" {
+			e.Error = strings.TrimSpace(string(data))
+		}
+		return &apiError{Status: resp.StatusCode, Msg: e.Error, JQL: e.JQL}
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+func isStatus(err error, status int) bool {
+	var e *apiError
+	return errors.As(err, &e) && e.Status == status
+}
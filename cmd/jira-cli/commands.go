@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/history"
+)
+
+func cmdSearch(args []string) error {
+	fs, opts := newFlagSet("search")
+	jql := fs.String("jql", "", "explicit JQL instead of the query")
+	projects := fs.String("projects", "", "comma-separated project keys")
+	users := fs.String("users", "", "comma-separated assignee logins")
+	sprint := fs.Int("sprint", 0, "sprint id")
+	max := fs.Int("max", 0, "max results")
+	analysis := fs.Bool("analysis", false, "summarize the result with the LLM")
+	provider := fs.String("provider", "", "LLM provider")
+	model := fs.String("model", "", "LLM model")
+	dryRun := fs.Bool("dry-run", false, "only print the JQL")
+	yes := fs.Bool("yes", false, "run even if the derived JQL has low confidence")
+	args, err := parseArgs(fs, opts, args)
+	if err != nil {
+		return err
+	}
+	query := strings.Join(args, " ")
+	if strings.TrimSpace(query) == "" && *jql == "" {
+		return errors.New("search: query or -jql is required")
+	}
+	req := map[string]any{
+		"query":      query,
+		"jql":        *jql,
+		"projects":   splitList(*projects),
+		"users":      splitList(*users),
+		"sprintId":   *sprint,
+		"maxResults": *max,
+		"analysis":   *analysis,
+		"provider":   *provider,
+		"model":      *model,
+		"dryRun":     *dryRun,
+		"confirmed":  *yes,
+	}
+	var resp struct {
+		JQL               string                  `json:"jql"`
+		Total             int                     `json:"total"`
+		Issues            []history.IssueSnapshot `json:"issues"`
+		Analysis          string                  `json:"analysis,omitempty"`
+		HistoryID         string                  `json:"historyId,omitempty"`
+		NeedsConfirmation bool                    `json:"needsConfirmation,omitempty"`
+	}
+	if err := newClient(opts).post("/api/search", req, &resp); err != nil {
+		return err
+	}
+	if resp.NeedsConfirmation {
+		return fmt.Errorf("low-confidence JQL was not run, repeat with -yes: %s", resp.JQL)
+	}
+
+	t := table{header: []string{"key", "summary", "status", "assignee", "url"}}
+	for _, is := range resp.Issues {
+		t.add(is.Key, is.Title, is.Status, is.Assignee, is.URL)
+	}
+	if opts.format == "table" {
+		fmt.Printf("JQL: %s\nFound: %d\n\n", resp.JQL, resp.Total)
+	}
+	if err := write(os.Stdout, opts.format, t, resp); err != nil {
+		return err
+	}
+	if opts.format == "table" && resp.Analysis != "" {
+		fmt.Printf("\n%s\n", resp.Analysis)
+	}
+	return nil
+}
+
+// worklogResult mirrors the server's worklog command reply.
+type worklogResult struct {
+	Kind      string          `json:"kind"`
+	IssueKey  string          `json:"issueKey"`
+	DryRun    bool            `json:"dryRun"`
+	Date      string          `json:"date,omitempty"`
+	TimeSpent string          `json:"timeSpent,omitempty"`
+	Started   string          `json:"started,omitempty"`
+	WorklogID string          `json:"worklogId,omitempty"`
+	Autofill  *autofillResult `json:"autofill,omitempty"`
+	Question  string          `json:"question,omitempty"`
+	Need      string          `json:"need,omitempty"`
+	Default   string          `json:"default,omitempty"`
+}
+
+type autofillResult struct {
+	IssueKey string `json:"issueKey"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	DryRun   bool   `json:"dryRun"`
+	Days     []struct {
+		Date      string `json:"date"`
+		Weekday   string `json:"weekday"`
+		TimeSpent string `json:"timeSpent"`
+		Action    string `json:"action"`
+		Reason    string `json:"reason,omitempty"`
+		WorklogID string `json:"worklogId,omitempty"`
+	} `json:"days"`
+	Created int `json:"created"`
+	Skipped int `json:"skipped"`
+}
+
+func cmdLog(args []string) error {
+	fs, opts := newFlagSet("log")
+	dryRun := fs.Bool("dry-run", false, "show what would be logged")
+	comment := fs.String("comment", "", "worklog comment")
+	args, err := parseArgs(fs, opts, args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New(`log: want an issue, a duration and a day, e.g. "log QA-959 30m вчера"`)
+	}
+	req := map[string]any{
+		"query":   strings.Join(args, " "),
+		"dryRun":  *dryRun,
+		"comment": *comment,
+	}
+	c := newClient(opts)
+	in := bufio.NewReader(os.Stdin)
+	var resp worklogResult
+	for {
+		resp = worklogResult{}
+		err := c.post("/api/worklog/command", req, &resp)
+		if err == nil {
+			break
+		}
+		if !isStatus(err, http.StatusUnprocessableEntity) || resp.Question == "" {
+			return err
+		}
+		// Ask like the UI does; without an answer there is nothing to log.
+		prompt := resp.Question
+		if resp.Default != "" {
+			prompt += fmt.Sprintf(" [%s]", resp.Default)
+		}
+		fmt.Fprint(os.Stderr, prompt+" ")
+		answer, rerr := in.ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		if answer == "" {
+			answer = resp.Default
+		}
+		if answer == "" {
+			if rerr == io.EOF {
+				fmt.Fprintln(os.Stderr)
+				return fmt.Errorf("log: %s", resp.Question)
+			}
+			return errors.New("log: no answer")
+		}
+		switch resp.Need {
+		case "duration":
+			req["durationText"] = answer
+		case "date":
+			req["dateText"] = answer
+		default:
+			return fmt.Errorf("log: unexpected clarification %q", resp.Need)
+		}
+	}
+	if resp.Autofill != nil {
+		return writeAutofill(opts.format, *resp.Autofill)
+	}
+	t := table{header: []string{"issue", "date", "time", "worklog", "dry_run"}}
+	t.add(resp.IssueKey, resp.Date, resp.TimeSpent, resp.WorklogID, strconv.FormatBool(resp.DryRun))
+	return write(os.Stdout, opts.format, t, resp)
+}
+
+func cmdAutofill(args []string) error {
+	fs, opts := newFlagSet("autofill")
+	dryRun := fs.Bool("dry-run", false, "show the days without logging")
+	comment := fs.String("comment", "", "worklog comment")
+	args, err := parseArgs(fs, opts, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errors.New("autofill: want one issue key or browse URL")
+	}
+	var resp autofillResult
+	req := map[string]any{"issue": args[0], "dryRun": *dryRun, "comment": *comment}
+	if err := newClient(opts).post("/api/worklog/autofill", req, &resp); err != nil {
+		return err
+	}
+	return writeAutofill(opts.format, resp)
+}
+
+func writeAutofill(format string, resp autofillResult) error {
+	t := table{header: []string{"date", "weekday", "time", "action", "reason", "worklog"}}
+	for _, d := range resp.Days {
+		t.add(d.Date, d.Weekday, d.TimeSpent, d.Action, d.Reason, d.WorklogID)
+	}
+	if err := write(os.Stdout, format, t, resp); err != nil {
+		return err
+	}
+	if format == "table" {
+		verb := "created"
+		if resp.DryRun {
+			verb = "to create"
+		}
+		fmt.Printf("\n%s %s..%s: %d %s, %d skipped\n", resp.IssueKey, resp.From, resp.To, resp.Created, verb, resp.Skipped)
+	}
+	return nil
+}
+
+func cmdHistoryList(args []string) error {
+	fs, opts := newFlagSet("history ls")
+	q := fs.String("q", "", "text in the query or title")
+	jql := fs.String("jql", "", "text in the JQL")
+	tag := fs.String("tag", "", "tag")
+	pinned := fs.Bool("pinned", false, "only pinned entries")
+	from := fs.String("from", "", "first day, YYYY-MM-DD")
+	to := fs.String("to", "", "last day, YYYY-MM-DD")
+	limit := fs.Int("limit", 0, "page size")
+	cursor := fs.String("cursor", "", "nextCursor of the previous page")
+	if _, err := parseArgs(fs, opts, args); err != nil {
+		return err
+	}
+	params := url.Values{}
+	for k, v := range map[string]string{"q": *q, "jql": *jql, "tag": *tag, "from": *from, "to": *to, "cursor": *cursor} {
+		if v != "" {
+			params.Set(k, v)
+		}
+	}
+	if *pinned {
+		params.Set("pinned", "1")
+	}
+	if *limit > 0 {
+		params.Set("limit", strconv.Itoa(*limit))
+	}
+	var page history.Page
+	if err := newClient(opts).get("/api/history", params, &page); err != nil {
+		return err
+	}
+	t := table{header: []string{"id", "created", "title", "issues", "tags", "pinned"}}
+	for _, e := range page.Entries {
+		title := e.Title
+		if title == "" {
+			title = e.Query
+		}
+		t.add(e.ID, e.CreatedAt.Local().Format("2006-01-02 15:04"), title, strconv.Itoa(len(e.Issues)), strings.Join(e.Tags, ","), strconv.FormatBool(e.Pinned))
+	}
+	if err := write(os.Stdout, opts.format, t, page); err != nil {
+		return err
+	}
+	if opts.format == "table" && page.NextCursor != "" {
+		fmt.Fprintf(os.Stderr, "\nmore: jira-cli history ls -cursor %s\n", page.NextCursor)
+	}
+	return nil
+}
+
+func cmdHistoryShow(args []string) error {
+	fs, opts := newFlagSet("history show")
+	args, err := parseArgs(fs, opts, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errors.New("history show: want an entry id")
+	}
+	var e history.Entry
+	if err := newClient(opts).get("/api/history/"+url.PathEscape(args[0]), nil, &e); err != nil {
+		return err
+	}
+	t := table{header: []string{"key", "summary", "status", "assignee", "url"}}
+	for _, is := range e.Issues {
+		t.add(is.Key, is.Title, is.Status, is.Assignee, is.URL)
+	}
+	if opts.format == "table" {
+		fmt.Printf("ID:      %s\nCreated: %s\n", e.ID, e.CreatedAt.Local().Format(time.RFC3339))
+		if e.Title != "" {
+			fmt.Printf("Title:   %s\n", e.Title)
+		}
+		fmt.Printf("Query:   %s\nJQL:     %s\n", e.Query, e.JQL)
+		if len(e.Tags) > 0 {
+			fmt.Printf("Tags:    %s\n", strings.Join(e.Tags, ", "))
+		}
+		for _, s := range e.Steps {
+			line := fmt.Sprintf("  [%s] %s", s.Status, s.Name)
+			if s.Error != "" {
+				line += ": " + s.Error
+			}
+			fmt.Println(line)
+		}
+		fmt.Println()
+	}
+	if err := write(os.Stdout, opts.format, t, e); err != nil {
+		return err
+	}
+	if opts.format == "table" && e.Analysis != "" {
+		fmt.Printf("\n%s\n", e.Analysis)
+	}
+	return nil
+}
+
+func cmdTimesheet(args []string) error {
+	fs, opts := newFlagSet("report timesheet")
+	from := fs.String("from", "", "first day, YYYY-MM-DD (default: start of month)")
+	to := fs.String("to", "", "last day, YYYY-MM-DD (default: today)")
+	user := fs.String("user", "", "Jira login (default: the server account)")
+	if _, err := parseArgs(fs, opts, args); err != nil {
+		return err
+	}
+	params := url.Values{}
+	for k, v := range map[string]string{"from": *from, "to": *to, "user": *user} {
+		if v != "" {
+			params.Set(k, v)
+		}
+	}
+	var resp struct {
+		User     string `json:"user"`
+		From     string `json:"from"`
+		To       string `json:"to"`
+		TimeZone string `json:"timeZone"`
+		Rows     []struct {
+			Date             string `json:"date"`
+			Issue            string `json:"issue"`
+			Summary          string `json:"summary,omitempty"`
+			TimeSpent        string `json:"timeSpent"`
+			TimeSpentSeconds int    `json:"timeSpentSeconds"`
+		} `json:"rows"`
+		Total        string `json:"total"`
+		TotalSeconds int    `json:"totalSeconds"`
+	}
+	if err := newClient(opts).get("/api/worklog/timesheet", params, &resp); err != nil {
+		return err
+	}
+	t := table{header: []string{"date", "issue", "summary", "time", "hours"}}
+	for _, r := range resp.Rows {
+		t.add(r.Date, r.Issue, r.Summary, r.TimeSpent, strconv.FormatFloat(float64(r.TimeSpentSeconds)/3600, 'f', 2, 64))
+	}
+	if err := write(os.Stdout, opts.format, t, resp); err != nil {
+		return err
+	}
+	if opts.format == "table" {
+		fmt.Printf("\n%s, %s..%s: %s\n", resp.User, resp.From, resp.To, resp.Total)
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
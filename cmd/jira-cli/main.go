@@ -0,0 +1,142 @@
+// Command jira-cli runs searches, logs time and prints history and
+// timesheets from the shell. It talks to a running server (ADDR from the
+// same env, or JIRA_CLI_SERVER), so searches and worklogs go through exactly
+// the same code as the web UI and land in the same history. The CLI itself
+// holds no domain logic: it only borrows the wire types of internal/history,
+// and even -dry-run asks the server, which may fall back to the LLM.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alekseymerzlyakov/jira/internal/config"
+)
+
+const usage = `Usage: jira-cli <command> [flags] [args]
+
+Commands:
+  search "<query>"            natural language or JQL search
+  log QA-959 30m вчера        log time to an issue
+  autofill QA-959 [-dry-run]  fill the working days of this month
+  history ls                  list history entries
+  history show <id>           show one entry
+  report timesheet            time logged per day and issue
+
+Common flags:
+  -o table|json|csv           output format (default table)
+  -server URL                 server address (default JIRA_CLI_SERVER or http://localhost$ADDR)
+  -token TOKEN                API token (default JIRA_CLI_TOKEN), see POST /api/tokens
+
+Run "jira-cli <command> -h" for the flags of a command.
+`
+
+// options are the flags every command accepts.
+type options struct {
+	format string
+	server string
+	token  string
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "jira-cli:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(os.Stderr, usage)
+		return nil
+	}
+	cmd, rest := args[0], args[1:]
+	switch cmd {
+	case "search":
+		return cmdSearch(rest)
+	case "log":
+		return cmdLog(rest)
+	case "autofill":
+		return cmdAutofill(rest)
+	case "history":
+		if len(rest) == 0 {
+			return errors.New("history: want ls or show <id>")
+		}
+		switch rest[0] {
+		case "ls", "list":
+			return cmdHistoryList(rest[1:])
+		case "show":
+			return cmdHistoryShow(rest[1:])
+		}
+		return fmt.Errorf("history: unknown subcommand %q", rest[0])
+	case "report":
+		if len(rest) == 0 || rest[0] != "timesheet" {
+			return errors.New("report: want timesheet")
+		}
+		return cmdTimesheet(rest[1:])
+	}
+	return fmt.Errorf("unknown command %q (see jira-cli -h)", cmd)
+}
+
+// newFlagSet returns a flag set with the common flags registered.
+func newFlagSet(name string) (*flag.FlagSet, *options) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	opts := &options{}
+	fs.StringVar(&opts.format, "o", "table", "output format: table, json or csv")
+	fs.StringVar(&opts.server, "server", "", "server address")
+	fs.StringVar(&opts.token, "token", os.Getenv("JIRA_CLI_TOKEN"), "API token")
+	return fs, opts
+}
+
+// parseArgs parses flags that may appear before, between or after the
+// positional arguments ("autofill QA-959 --dry-run") and returns the
+// positional ones.
+func parseArgs(fs *flag.FlagSet, opts *options, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		if args[0] == "--" {
+			positional = append(positional, args[1:]...)
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	switch opts.format {
+	case "table", "json", "csv":
+	default:
+		return nil, fmt.Errorf("unknown output format %q", opts.format)
+	}
+	if opts.server == "" {
+		opts.server = defaultServer()
+	}
+	return positional, nil
+}
+
+func defaultServer() string {
+	if v := strings.TrimSpace(os.Getenv("JIRA_CLI_SERVER")); v != "" {
+		return v
+	}
+	// Only the env files are read: config.Load would resolve secrets and
+	// require the JIRA_* variables just to learn the port.
+	config.LoadEnvFiles()
+	addr := strings.TrimSpace(os.Getenv("ADDR"))
+	if addr == "" {
+		addr = ":8080"
+	}
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	return "http://" + addr
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/alekseymerzlyakov/jira/internal/auth"
+	"github.com/alekseymerzlyakov/jira/internal/users"
+)
+
+const csrfHeader = "X-CSRF-Token"
+
+// principal is who made a request: a UI session or an API token.
+type principal struct {
+	Login   string
+	Scopes  []string
+	Via     string // "session" or "token"
+	TokenID string
+}
+
+type principalKey struct{}
+
+func principalFrom(ctx context.Context) (principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(principal)
+	return p, ok
+}
+
+// authenticator holds what withAuth checks requests against.
+type authenticator struct {
+	required bool // reject anonymous API requests
+	sessions *users.Sessions
+	tokens   *auth.TokenStore
+	allow    auth.Allowlist
+}
+
+// publicPaths are API endpoints open without a session or token.
+var publicPaths = map[string]bool{
+	"/api/health":  true,
+	"/api/login":   true,
+	"/api/logout":  true,
+	"/api/session": true,
+}
+
+// withAuth rejects clients outside the allowlist, identifies the caller by
+// "Authorization: Bearer <token>" or the session cookie, and checks the
+// scope of API requests. Session requests that change something must carry
+// the session's CSRF token; tokens are not sent by browsers on their own and
+// need none.
+func withAuth(next http.Handler, a *authenticator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow.Allows(r.RemoteAddr) {
+			log.Printf("auth: %s not in allowlist", r.RemoteAddr)
+			respondError(w, http.StatusForbidden, errors.New("forbidden"), "")
+			return
+		}
+		p, ok, err := a.identify(r)
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, err, "")
+			return
+		}
+		if ok {
+			r = r.WithContext(context.WithValue(r.Context(), principalKey{}, p))
+		}
+		if unsafeMethod(r.Method) && (!ok || p.Via == "session") && !sameOrigin(r) {
+			respondError(w, http.StatusForbidden, errors.New("cross-origin request rejected"), "")
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/api/") || publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !ok {
+			if a.required {
+				respondError(w, http.StatusUnauthorized, errors.New("login required"), "")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if p.Via == "session" && unsafeMethod(r.Method) {
+			sess, _ := a.sessions.Get(sessionID(r))
+			if sess.CSRF == "" || r.Header.Get(csrfHeader) != sess.CSRF {
+				respondError(w, http.StatusForbidden, errors.New("missing or invalid CSRF token"), "")
+				return
+			}
+		}
+		if scope := requiredScope(r.Method, r.URL.Path); !auth.HasScope(p.Scopes, scope) {
+			respondError(w, http.StatusForbidden, fmt.Errorf("token has no %q scope", scope), "")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// identify returns the caller, if any. A presented but unknown token is an
+// error rather than an anonymous request.
+func (a *authenticator) identify(r *http.Request) (principal, bool, error) {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		t, ok := a.tokens.Verify(strings.TrimSpace(strings.TrimPrefix(h, "Bearer ")))
+		if !ok {
+			return principal{}, false, errors.New("invalid API token")
+		}
+		return principal{Login: t.Login, Scopes: t.Scopes, Via: "token", TokenID: t.ID}, true, nil
+	}
+	if sess, ok := a.sessions.Get(sessionID(r)); ok {
+		return principal{Login: sess.Login, Scopes: auth.AllScopes, Via: "session"}, true, nil
+	}
+	return principal{}, false, nil
+}
+
+// requiredScope maps an API request to the scope it needs. Searches only
+// read Jira, so they need read even though they are POSTs.
+func requiredScope(method, path string) string {
+	switch {
+	case strings.HasPrefix(path, "/api/tokens"), path == "/api/config":
+		return auth.ScopeAdmin
+	case method == http.MethodGet || method == http.MethodHead:
+		return auth.ScopeRead
+	case path == "/api/search" || path == "/api/search/stream" || path == "/api/history/search":
+		return auth.ScopeRead
+	case path == "/api/worklog/autofill":
+		return auth.ScopeBulk
+	case path == "/api/worklog/command":
+		return auth.ScopeWorklog
+	}
+	return auth.ScopeWrite
+}
+
+// requireScope checks a scope the path alone does not decide, e.g. a
+// worklog command that turns out to be an autofill. Anonymous requests
+// (auth disabled) pass.
+func requireScope(r *http.Request, scope string) error {
+	p, ok := principalFrom(r.Context())
+	if !ok || auth.HasScope(p.Scopes, scope) {
+		return nil
+	}
+	return fmt.Errorf("token has no %q scope", scope)
+}
+
+func unsafeMethod(m string) bool {
+	return m != http.MethodGet && m != http.MethodHead && m != http.MethodOptions
+}
+
+// sameOrigin rejects browser requests sent from another site; requests
+// without Origin (curl, scripts) pass.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func sessionID(r *http.Request) string {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+type tokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type tokenResponse struct {
+	Token  auth.Token `json:"token"`
+	Secret string     `json:"secret,omitempty"` // shown once, on creation
+}
+
+// apiTokens handles /api/tokens: GET lists the caller's tokens, POST creates
+// one with at most the caller's scopes. Tokens belong to a login, so an
+// anonymous caller (auth disabled) cannot manage them.
+func (h *apiHandler) apiTokens() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		login, ok := callerLogin(w, r)
+		if !ok {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			list := h.tokens.List(login)
+			for i := range list {
+				list[i].Hash = ""
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]any{"tokens": list, "scopes": auth.AllScopes})
+		case http.MethodPost:
+			var req tokenRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				respondError(w, http.StatusBadRequest, errors.New("invalid json"), "")
+				return
+			}
+			if strings.TrimSpace(req.Name) == "" {
+				respondError(w, http.StatusBadRequest, errors.New("name is required"), "")
+				return
+			}
+			for _, s := range req.Scopes {
+				if err := requireScope(r, strings.ToLower(strings.TrimSpace(s))); err != nil {
+					respondError(w, http.StatusForbidden, err, "")
+					return
+				}
+			}
+			t, secret, err := h.tokens.Create(req.Name, login, req.Scopes)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, err, "")
+				return
+			}
+			t.Hash = ""
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(tokenResponse{Token: t, Secret: secret})
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// apiToken handles DELETE /api/tokens/{id}.
+func (h *apiHandler) apiToken() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		login, ok := callerLogin(w, r)
+		if !ok {
+			return
+		}
+		id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/tokens/"), "/")
+		if err := h.tokens.Delete(id, login); err != nil {
+			if errors.Is(err, auth.ErrNotFound) {
+				http.NotFound(w, r)
+				return
+			}
+			respondError(w, http.StatusInternalServerError, err, "")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// callerLogin returns the login of the session or token behind r, or
+// answers 401 when there is none.
+func callerLogin(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if p, ok := principalFrom(r.Context()); ok && p.Login != "" {
+		return p.Login, true
+	}
+	respondError(w, http.StatusUnauthorized, errors.New("login required"), "")
+	return "", false
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/jira"
+)
+
+// boardCacheTTL is how long the scrum boards Jira reports for a project are
+// reused before asking again.
+const boardCacheTTL = time.Hour
+
+// Board sources, in the order they are tried.
+const (
+	boardFromConfig  = "config"  // sprints.boards in CONFIG_FILE
+	boardFromChoice  = "choice"  // picked by a user, see boardChoices
+	boardFromOnly    = "only"    // the project's only scrum board
+	boardFromDefault = "default" // JIRA_BOARD_ID, when Jira reports none
+)
+
+// boardResolution is the board used for a project and how it was found.
+// Boards lists the project's scrum boards when Jira was asked.
+type boardResolution struct {
+	Project string       `json:"project"`
+	BoardID int          `json:"boardId,omitempty"`
+	Source  string       `json:"source,omitempty"`
+	Boards  []jira.Board `json:"boards"`
+}
+
+// errBoardChoice means the project has several scrum boards and nobody has
+// picked one yet.
+type errBoardChoice struct {
+	Project string
+	Boards  []jira.Board
+}
+
+func (e *errBoardChoice) Error() string {
+	names := make([]string, len(e.Boards))
+	for i, b := range e.Boards {
+		names[i] = fmt.Sprintf("%d %s", b.ID, b.Name)
+	}
+	return fmt.Sprintf("у проекта %s несколько бордов (%s): выбери один", e.Project, strings.Join(names, ", "))
+}
+
+// errNoBoard means Jira reports no scrum board for the project and there is
+// no JIRA_BOARD_ID to fall back to.
+var errNoBoard = errors.New("нет scrum-борда")
+
+type boardCacheEntry struct {
+	boards  []jira.Board
+	fetched time.Time
+}
+
+// boardResolver caches the scrum boards Jira reports per Jira account and
+// project: what a project's boards are depends on who asks. Which board a
+// user picked for a project lives in boardChoices.
+type boardResolver struct {
+	mu    sync.Mutex
+	cache map[string]boardCacheEntry // account + "\x00" + project
+}
+
+func newBoardResolver() *boardResolver {
+	return &boardResolver{cache: map[string]boardCacheEntry{}}
+}
+
+// boards returns the project's scrum boards as client sees them, from the
+// cache when fresh.
+func (r *boardResolver) boards(ctx context.Context, client *jira.Client, project string) ([]jira.Board, error) {
+	key := client.User() + "\x00" + project
+	r.mu.Lock()
+	e, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok && time.Since(e.fetched) < boardCacheTTL {
+		return e.boards, nil
+	}
+	boards, status, err := client.BoardsForProject(ctx, project)
+	if err != nil {
+		return nil, fmt.Errorf("boards for %s status %d: %w", project, status, err)
+	}
+	sort.Slice(boards, func(i, j int) bool { return boards[i].ID < boards[j].ID })
+	r.mu.Lock()
+	r.cache[key] = boardCacheEntry{boards: boards, fetched: time.Now()}
+	r.mu.Unlock()
+	return boards, nil
+}
+
+// boardChoices are the boards picked for projects with several, kept in a
+// JSON file: DATA_DIR/board_choices.json, or the user's own file in
+// multi-user mode so one user's pick does not change anybody else's sprints.
+type boardChoices struct {
+	path string
+
+	mu sync.Mutex
+	m  map[string]int
+}
+
+func loadBoardChoices(path string) (*boardChoices, error) {
+	c := &boardChoices{path: path, m: map[string]int{}}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, &c.m); err != nil {
+			return nil, fmt.Errorf("board choices: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return c, nil
+}
+
+// set remembers boardID for project; zero forgets the choice.
+func (c *boardChoices) set(project string, boardID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if boardID == 0 {
+		delete(c.m, project)
+	} else {
+		c.m[project] = boardID
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c.m, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Written atomically: an interrupted write must not lose the choices.
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+func (c *boardChoices) get(project string) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id, ok := c.m[project]
+	return id, ok
+}
+
+// resolveBoard returns the board for project. A project with several boards
+// and no override or choice yields *errBoardChoice.
+func (h *apiHandler) resolveBoard(ctx context.Context, project string) (boardResolution, error) {
+	project = strings.ToUpper(strings.TrimSpace(project))
+	res := boardResolution{Project: project, Boards: []jira.Board{}}
+	if id, ok := h.policy.Get().BoardFor(project); ok {
+		res.BoardID, res.Source = id, boardFromConfig
+		return res, nil
+	}
+	if id, ok := h.boardChoices.get(project); ok {
+		res.BoardID, res.Source = id, boardFromChoice
+		return res, nil
+	}
+	boards, err := h.boards.boards(ctx, h.jira, project)
+	if err != nil {
+		return res, err
+	}
+	res.Boards = boards
+	switch {
+	case len(boards) == 1:
+		res.BoardID, res.Source = boards[0].ID, boardFromOnly
+	case len(boards) > 1:
+		return res, &errBoardChoice{Project: project, Boards: boards}
+	case h.boardID > 0:
+		res.BoardID, res.Source = h.boardID, boardFromDefault
+	default:
+		return res, fmt.Errorf("у проекта %s %w", project, errNoBoard)
+	}
+	return res, nil
+}
+
+// sprintBoard returns the board sprint questions in a search refer to: the
+// board of the only project in projects, else of sprints.defaultProject,
+// else JIRA_BOARD_ID. Zero means none.
+func (h *apiHandler) sprintBoard(ctx context.Context, projects []string) int {
+	project := ""
+	if len(projects) == 1 {
+		project = projects[0]
+	} else if p := h.policy.Get().Sprints.DefaultProject; p != "" {
+		project = p
+	}
+	if project == "" {
+		return h.boardID
+	}
+	res, err := h.resolveBoard(ctx, project)
+	if err != nil {
+		return 0
+	}
+	return res.BoardID
+}
+
+// projectBoards serves /api/projects/{key}/boards: GET shows the project's
+// boards and the one in use; PUT {"boardId": N} chooses a board and DELETE
+// forgets the choice. A sprints.boards override in the config wins over a
+// choice.
+func (h *apiHandler) projectBoards(w http.ResponseWriter, r *http.Request, project string) {
+	project = strings.ToUpper(project)
+	switch r.Method {
+	case http.MethodGet:
+		h.writeBoards(r.Context(), w, project)
+	case http.MethodPut, http.MethodPost:
+		var req struct {
+			BoardID int `json:"boardId"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.BoardID <= 0 {
+			respondError(w, http.StatusBadRequest, errors.New("boardId is required"), "")
+			return
+		}
+		boards, err := h.boards.boards(r.Context(), h.jira, project)
+		if err != nil {
+			respondError(w, http.StatusBadGateway, err, "")
+			return
+		}
+		if !hasBoard(boards, req.BoardID) {
+			respondError(w, http.StatusBadRequest, fmt.Errorf("board %d is not a scrum board of %s", req.BoardID, project), "")
+			return
+		}
+		if err := h.boardChoices.set(project, req.BoardID); err != nil {
+			respondError(w, http.StatusInternalServerError, err, "")
+			return
+		}
+		h.writeBoards(r.Context(), w, project)
+	case http.MethodDelete:
+		if err := h.boardChoices.set(project, 0); err != nil {
+			respondError(w, http.StatusInternalServerError, err, "")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// writeBoards responds with the project's board resolution; needing a
+// choice is not an error here.
+func (h *apiHandler) writeBoards(ctx context.Context, w http.ResponseWriter, project string) {
+	res, err := h.resolveBoard(ctx, project)
+	var choice *errBoardChoice
+	if err != nil && !errors.As(err, &choice) && !errors.Is(err, errNoBoard) {
+		respondError(w, http.StatusBadGateway, err, "")
+		return
+	}
+	if res.Source == boardFromConfig || res.Source == boardFromChoice {
+		// Show the alternatives too; failing to list them is not fatal.
+		if boards, err := h.boards.boards(ctx, h.jira, project); err == nil {
+			res.Boards = boards
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func hasBoard(boards []jira.Board, id int) bool {
+	for _, b := range boards {
+		if b.ID == id {
+			return true
+		}
+	}
+	return false
+}
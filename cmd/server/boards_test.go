@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alekseymerzlyakov/jira/internal/jira"
+)
+
+// TestBoardsPerAccount checks that one account's board list is not served
+// to another.
+func TestBoardsPerAccount(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _, _ := r.BasicAuth()
+		id := 1
+		if user == "bob" {
+			id = 2
+		}
+		fmt.Fprintf(w, `{"values":[{"id":%d,"name":"board of %s"}]}`, id, user)
+	}))
+	defer srv.Close()
+	res := newBoardResolver()
+	for _, c := range []struct {
+		user string
+		want int
+	}{{"ann", 1}, {"bob", 2}, {"ann", 1}} {
+		boards, err := res.boards(context.Background(), jira.NewClient(srv.URL, c.user, "pw"), "CE")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(boards) != 1 || boards[0].ID != c.want {
+			t.Errorf("%s sees %+v, want board %d", c.user, boards, c.want)
+		}
+	}
+}
+
+func TestBoardChoicesPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users", "ann", "board_choices.json")
+	c, err := loadBoardChoices(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.set("CE", 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.set("QA", 9); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.set("QA", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+	again, err := loadBoardChoices(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := again.get("CE"); !ok || id != 7 {
+		t.Errorf("CE = %d, %v", id, ok)
+	}
+	if _, ok := again.get("QA"); ok {
+		t.Error("forgotten choice came back")
+	}
+}
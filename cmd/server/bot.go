@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/alekseymerzlyakov/jira/internal/bot"
+	"github.com/alekseymerzlyakov/jira/internal/config"
+	"github.com/alekseymerzlyakov/jira/internal/jira"
+	"github.com/alekseymerzlyakov/jira/internal/secrets"
+)
+
+// botBackend runs bot commands through the same code as
+// /api/worklog/command and /api/search.
+type botBackend struct {
+	h *apiHandler
+	// clients holds the handlers of accounts with a password secret, built
+	// once at startup.
+	clients map[string]*apiHandler
+}
+
+// botAccountKey identifies an account in botBackend.clients.
+func botAccountKey(acc bot.Account) string { return acc.Transport + "|" + acc.ChatUser }
+
+// forAccount returns the handler acting as the account's Jira user: the
+// server's own client, the client built at startup from the account's
+// password secret, or in multi-user mode the credentials the user logged in
+// with.
+func (b botBackend) forAccount(acc bot.Account) (*apiHandler, error) {
+	if acc.JiraUser == "" {
+		return b.h, nil
+	}
+	if h, ok := b.clients[botAccountKey(acc)]; ok {
+		return h, nil
+	}
+	if b.h.users != nil {
+		if _, ok := b.h.users.Get(acc.JiraUser); ok {
+			return b.h.forUser(acc.JiraUser)
+		}
+	}
+	return nil, fmt.Errorf("%s не входил в веб-интерфейс: войдите там, чтобы бот работал от вашей учётки", acc.JiraUser)
+}
+
+func (b botBackend) Worklog(ctx context.Context, acc bot.Account, req bot.WorklogRequest) (bot.Reply, error) {
+	h, err := b.forAccount(acc)
+	if err != nil {
+		return bot.Reply{}, err
+	}
+	resp, _, err := h.runWorklogCommand(ctx, worklogCommandRequest{
+		Query:        req.Query,
+		DryRun:       req.DryRun,
+		DurationText: req.DurationText,
+		DateText:     req.DateText,
+	})
+	if err != nil {
+		return bot.Reply{}, err
+	}
+	if resp.Question != "" {
+		return bot.Reply{Question: resp.Question, Need: resp.Need, Default: resp.Default}, nil
+	}
+	return bot.Reply{Text: formatWorklogResult(resp)}, nil
+}
+
+func (b botBackend) Search(ctx context.Context, acc bot.Account, query string) (bot.Reply, error) {
+	// Nobody can confirm a low-confidence JQL in a chat round-trip.
+	h, err := b.forAccount(acc)
+	if err != nil {
+		return bot.Reply{}, err
+	}
+	resp, serr := h.runSearch(ctx, searchRequest{Query: query, Confirmed: true}, nil)
+	if serr != nil {
+		if serr.jql != "" {
+			return bot.Reply{}, fmt.Errorf("%w (JQL: %s)", serr.err, serr.jql)
+		}
+		return bot.Reply{}, serr.err
+	}
+	var sb strings.Builder
+	if resp.Analysis != "" {
+		sb.WriteString(resp.Analysis)
+		sb.WriteString("\n\n")
+	}
+	fmt.Fprintf(&sb, "JQL: %s\nНайдено задач: %d\n", resp.JQL, resp.Total)
+	sb.WriteString(formatIssueLinks(resp.Issues))
+	return bot.Reply{Text: strings.TrimRight(sb.String(), "\n")}, nil
+}
+
+// formatWorklogResult describes a completed (or previewed) worklog command.
+func formatWorklogResult(resp worklogCommandResponse) string {
+	if af := resp.Autofill; af != nil {
+		var sb strings.Builder
+		verb := "Создано"
+		if af.DryRun {
+			verb = "Будет создано"
+		}
+		fmt.Fprintf(&sb, "%s, %s — %s: %s %d, пропущено %d\n", af.IssueKey, af.From, af.To, verb, af.Created, af.Skipped)
+		for _, d := range af.Days {
+			if d.Action == "create" {
+				fmt.Fprintf(&sb, "+ %s %s\n", d.Date, d.TimeSpent)
+			}
+		}
+		return strings.TrimRight(sb.String(), "\n")
+	}
+	if resp.DryRun {
+		return fmt.Sprintf("Проверка: спишу %s в %s за %s.", resp.TimeSpent, resp.IssueKey, resp.Date)
+	}
+	return fmt.Sprintf("Списано %s в %s за %s (worklog %s).", resp.TimeSpent, resp.IssueKey, resp.Date, resp.WorklogID)
+}
+
+// newBot builds the chat bot for the configured transport, or returns nil
+// when the bot is off.
+func newBot(transport, token, apiURL, usersFile string, h *apiHandler) (*bot.Bot, error) {
+	if transport == "" {
+		return nil, nil
+	}
+	accounts, err := bot.LoadAccounts(usersFile)
+	if err != nil {
+		return nil, err
+	}
+	var t bot.Transport
+	switch transport {
+	case "telegram":
+		if token == "" {
+			return nil, errors.New("BOT_TRANSPORT=telegram needs TELEGRAM_BOT_TOKEN")
+		}
+		t = &bot.Telegram{Token: token, BaseURL: apiURL}
+	default:
+		return nil, fmt.Errorf("unknown BOT_TRANSPORT %q", transport)
+	}
+	if accounts.Len() == 0 {
+		return nil, fmt.Errorf("no bot users in %s", usersFile)
+	}
+	backend, err := newBotBackend(h, accounts.All())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", usersFile, err)
+	}
+	return &bot.Bot{Transport: t, Backend: backend, Accounts: accounts}, nil
+}
+
+// newBotBackend checks the accounts and builds the Jira clients of those
+// with a password secret. In multi-user mode the server's own client is not
+// meant to act for anyone, so every account needs a jiraUser; in single-user
+// mode an account with a jiraUser needs its password secret.
+func newBotBackend(h *apiHandler, accounts []bot.Account) (botBackend, error) {
+	b := botBackend{h: h, clients: map[string]*apiHandler{}}
+	var provider secrets.Provider
+	for _, acc := range accounts {
+		switch {
+		case acc.JiraUser == "" && h.users != nil:
+			return b, fmt.Errorf("account %s/%s has no jiraUser, which MULTI_USER does not allow", acc.Transport, acc.ChatUser)
+		case acc.JiraUser == "":
+			continue
+		case acc.PasswordKey == "" && h.users == nil:
+			return b, fmt.Errorf("account %s/%s (%s) needs passwordKey", acc.Transport, acc.ChatUser, acc.JiraUser)
+		case acc.PasswordKey == "":
+			continue
+		}
+		if provider == nil {
+			p, err := config.SecretsProvider()
+			if err != nil {
+				return b, err
+			}
+			provider = p
+		}
+		password, ok, err := provider.Get(acc.PasswordKey)
+		if err != nil {
+			return b, fmt.Errorf("account %s: %w", acc.JiraUser, err)
+		}
+		if !ok {
+			return b, fmt.Errorf("account %s: secret %s not found in %s", acc.JiraUser, acc.PasswordKey, provider.Name())
+		}
+		b.clients[botAccountKey(acc)] = h.withJira(jira.NewClient(h.jira.BaseURL(), acc.JiraUser, password))
+	}
+	return b, nil
+}
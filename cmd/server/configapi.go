@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/config"
+)
+
+type configResponse struct {
+	File     string         `json:"file,omitempty"` // empty: built-in defaults
+	LoadedAt time.Time      `json:"loadedAt"`
+	Policy   *config.Policy `json:"policy"`
+	Settings config.Config  `json:"settings"` // env settings, secrets shown as ***
+}
+
+// configView serves GET /api/config: the current policy, which is reloaded
+// on SIGHUP or when the file changes, and the env settings with secrets
+// redacted. It is read-only; edit the file to change the policy.
+func (h *apiHandler) configView() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(configResponse{
+			File:     h.policy.Path(),
+			LoadedAt: h.policy.LoadedAt(),
+			Policy:   h.policy.Get(),
+			Settings: h.settings,
+		})
+	})
+}
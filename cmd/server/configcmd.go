@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alekseymerzlyakov/jira/internal/config"
+	"github.com/alekseymerzlyakov/jira/internal/secrets"
+	"github.com/alekseymerzlyakov/jira/internal/users"
+)
+
+const configUsage = `Usage: server config <command>
+
+Manages the encrypted secrets file (SECRETS_FILE, default DATA_DIR/secrets.enc)
+unlocked by SECRETS_MASTER_KEY or SECRETS_MASTER_KEY_FILE.
+
+  init                 generate a master key (into SECRETS_MASTER_KEY_FILE if set)
+  set KEY [VALUE]      store a secret; without VALUE it is read from stdin
+  get KEY              print a secret as the server would resolve it
+  delete KEY           remove a secret from the file
+  list                 show where each known secret comes from
+  import               copy secrets found in env/env.local into the file
+  rotate [-key KEY]    re-encrypt the file with a new master key
+`
+
+// runConfigCommand implements "server config ...".
+func runConfigCommand(args []string) error {
+	config.LoadEnvFiles()
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, configUsage)
+		return errors.New("config: command required")
+	}
+	switch cmd, rest := args[0], args[1:]; cmd {
+	case "init":
+		return configInit()
+	case "set":
+		return configSet(rest)
+	case "get":
+		return configGet(rest)
+	case "delete", "rm":
+		return configDelete(rest)
+	case "list", "ls":
+		return configList()
+	case "import":
+		return configImport()
+	case "rotate":
+		return configRotate(rest)
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stderr, configUsage)
+		return nil
+	default:
+		return fmt.Errorf("config: unknown command %q", cmd)
+	}
+}
+
+func configInit() error {
+	if _, err := config.MasterKey(); err == nil {
+		return errors.New("config init: a master key is already configured")
+	}
+	key, err := secrets.NewKey()
+	if err != nil {
+		return err
+	}
+	if path := os.Getenv("SECRETS_MASTER_KEY_FILE"); path != "" {
+		if err := os.WriteFile(path, []byte(key+"\n"), 0o600); err != nil {
+			return err
+		}
+		fmt.Printf("master key written to %s\n", path)
+		return nil
+	}
+	fmt.Printf("SECRETS_MASTER_KEY=%s\n", key)
+	fmt.Fprintln(os.Stderr, "keep this key outside env.local, e.g. in your shell profile or a key file (SECRETS_MASTER_KEY_FILE)")
+	return nil
+}
+
+func configSet(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("config set: want KEY [VALUE]")
+	}
+	key := args[0]
+	var value string
+	if len(args) == 2 {
+		value = args[1]
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: ", key)
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		value = strings.TrimRight(line, "\r\n")
+	}
+	if value == "" {
+		return errors.New("config set: empty value")
+	}
+	f, err := config.OpenSecretsFile()
+	if err != nil {
+		return err
+	}
+	if err := f.Set(key, value); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s saved to %s\n", key, config.SecretsFilePath())
+	if os.Getenv(key) != "" {
+		fmt.Fprintf(os.Stderr, "note: %s is also set in the environment or env.local, which takes precedence\n", key)
+	}
+	return nil
+}
+
+func configGet(args []string) error {
+	if len(args) != 1 {
+		return errors.New("config get: want KEY")
+	}
+	p, err := config.SecretsProvider()
+	if err != nil {
+		return err
+	}
+	v, ok, err := p.Get(args[0])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s is not set", args[0])
+	}
+	fmt.Println(v)
+	return nil
+}
+
+func configDelete(args []string) error {
+	if len(args) != 1 {
+		return errors.New("config delete: want KEY")
+	}
+	f, err := config.OpenSecretsFile()
+	if err != nil {
+		return err
+	}
+	return f.Delete(args[0])
+}
+
+// configList prints, for every known secret and every secret in the file,
+// which provider supplies it; values are never printed.
+func configList() error {
+	p, err := config.SecretsProvider()
+	if err != nil {
+		return err
+	}
+	names := append([]string(nil), config.SecretKeys...)
+	if f, err := config.OpenSecretsFile(); err == nil {
+		for _, k := range f.Keys() {
+			if !containsString(names, k) {
+				names = append(names, k)
+			}
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		source := "-"
+		for _, sp := range p.(secrets.Chain) {
+			if _, ok, err := sp.Get(name); err == nil && ok {
+				source = sp.Name()
+				break
+			}
+		}
+		fmt.Printf("%-24s %s\n", name, source)
+	}
+	return nil
+}
+
+// configImport copies the known secrets that are set in the environment
+// (usually from env.local) into the encrypted file, so they can be removed
+// from env.local afterwards.
+func configImport() error {
+	f, err := config.OpenSecretsFile()
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, key := range config.SecretKeys {
+		v := os.Getenv(key)
+		if v == "" {
+			continue
+		}
+		if err := f.Set(key, v); err != nil {
+			return err
+		}
+		fmt.Printf("imported %s\n", key)
+		n++
+	}
+	if n == 0 {
+		fmt.Println("nothing to import")
+		return nil
+	}
+	fmt.Println("remove these lines from env.local and set SECRETS_PROVIDER=file")
+	return nil
+}
+
+func configRotate(args []string) error {
+	fs := flag.NewFlagSet("config rotate", flag.ContinueOnError)
+	newKey := fs.String("key", "", "new master key (hex or base64); generated when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	f, err := config.OpenSecretsFile()
+	if err != nil {
+		return err
+	}
+	encoded := *newKey
+	if encoded == "" {
+		if encoded, err = secrets.NewKey(); err != nil {
+			return err
+		}
+	}
+	key, err := secrets.DecodeKey(encoded)
+	if err != nil {
+		return err
+	}
+	if err := keepUsersKey(f); err != nil {
+		return err
+	}
+	if err := f.Rotate(key); err != nil {
+		return err
+	}
+	if path := os.Getenv("SECRETS_MASTER_KEY_FILE"); path != "" && os.Getenv("SECRETS_MASTER_KEY") == "" {
+		if err := os.WriteFile(path, []byte(encoded+"\n"), 0o600); err != nil {
+			// The file is already re-encrypted: the new key must not be lost.
+			fmt.Printf("SECRETS_MASTER_KEY=%s\n", encoded)
+			return fmt.Errorf("secrets re-encrypted, but writing %s failed: %w", path, err)
+		}
+		fmt.Printf("secrets re-encrypted; new key written to %s\n", path)
+		return nil
+	}
+	fmt.Printf("SECRETS_MASTER_KEY=%s\n", encoded)
+	fmt.Fprintln(os.Stderr, "secrets re-encrypted; update SECRETS_MASTER_KEY wherever the server runs")
+	return nil
+}
+
+// keepUsersKey stores the credentials key derived from the current master
+// key as USERS_KEY in f before a rotation: without it the Jira passwords in
+// users.json could not be decrypted under the new master key. Nothing is
+// done when USERS_KEY is already set or there is no users.json. The server
+// only reads the file with SECRETS_PROVIDER=file, so otherwise the rotation
+// is refused until USERS_KEY is set where the server runs.
+func keepUsersKey(f *secrets.File) error {
+	dataDir := os.Getenv("DATA_DIR")
+	if dataDir == "" {
+		dataDir = filepath.Join(".", "data")
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "users.json")); err != nil {
+		return nil
+	}
+	if p, err := config.SecretsProvider(); err == nil {
+		if _, ok, _ := p.Get("USERS_KEY"); ok {
+			return nil
+		}
+	}
+	master, err := config.MasterKey()
+	if err != nil {
+		return err
+	}
+	derived := hex.EncodeToString(users.DeriveKey(master))
+	if os.Getenv("SECRETS_PROVIDER") != "file" {
+		fmt.Printf("USERS_KEY=%s\n", derived)
+		return errors.New("users.json is encrypted with a key derived from the master key: set USERS_KEY as printed where the server runs, then rotate again")
+	}
+	if err := f.Set("USERS_KEY", derived); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "USERS_KEY was derived from the master key; stored it in the secrets file so users.json stays readable")
+	return nil
+}
@@ -12,8 +12,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/alekseymerzlyakov/jira/internal/analysis"
+	"github.com/alekseymerzlyakov/jira/internal/auth"
+	"github.com/alekseymerzlyakov/jira/internal/config"
 	"github.com/alekseymerzlyakov/jira/internal/history"
 	"github.com/alekseymerzlyakov/jira/internal/jira"
+	"github.com/alekseymerzlyakov/jira/internal/llm"
+	"github.com/alekseymerzlyakov/jira/internal/nlq"
 	"github.com/alekseymerzlyakov/jira/internal/phrases"
 )
 
@@ -27,6 +32,9 @@ type searchRequest struct {
 	DryRun     bool     `json:"dryRun"`     // if true, return JQL only
 	Analysis   bool     `json:"analysis"`   // if true, LLM summarizes results
 	SprintID   int      `json:"sprintId"`   // optional sprint id
+	Provider   string   `json:"provider"`   // optional LLM provider (openai, local, anthropic, fake)
+	Model      string   `json:"model"`      // optional LLM model override
+	Confirmed  bool     `json:"confirmed"`  // run even if the derived JQL has low confidence
 }
 
 type searchResponse struct {
@@ -39,6 +47,11 @@ type searchResponse struct {
 	Issues    []issueLink     `json:"issues,omitempty"`
 	Steps     []history.Step  `json:"steps,omitempty"`
 	HistoryID string          `json:"historyId,omitempty"`
+
+	Derivation        *llm.JQLResult    `json:"derivation,omitempty"`        // how the LLM arrived at the JQL
+	Report            *llm.Analysis     `json:"report,omitempty"`            // structured LLM analysis
+	Reviews           []llm.IssueReview `json:"reviews,omitempty"`           // per-issue deep analysis
+	NeedsConfirmation bool              `json:"needsConfirmation,omitempty"` // JQL not executed: low confidence
 }
 
 type worklogAutofillRequest struct {
@@ -48,11 +61,11 @@ type worklogAutofillRequest struct {
 }
 
 type worklogAutofillDay struct {
-	Date             string `json:"date"` // YYYY-MM-DD (Europe/Kiev)
+	Date             string `json:"date"` // YYYY-MM-DD in the policy time zone
 	Weekday          string `json:"weekday"`
 	TimeSpent        string `json:"timeSpent"`
 	TimeSpentSeconds int    `json:"timeSpentSeconds"`
-	Started          string `json:"started"` // RFC3339 in Europe/Kiev
+	Started          string `json:"started"` // RFC3339 in the policy time zone
 	Action           string `json:"action"`  // "skip" | "create"
 	Reason           string `json:"reason,omitempty"`
 	WorklogID        string `json:"worklogId,omitempty"`
@@ -104,7 +117,7 @@ func (h *apiHandler) projects() http.Handler {
 			http.Error(w, "cannot parse projects", http.StatusInternalServerError)
 			return
 		}
-		raw = filterProjects(raw)
+		raw = filterProjects(raw, h.policy.Get())
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(raw); err != nil {
 			http.Error(w, "encode response", http.StatusInternalServerError)
@@ -126,7 +139,7 @@ type worklogCommandResponse struct {
 	DryRun   bool   `json:"dryRun"`
 
 	// Single
-	Date             string `json:"date,omitempty"` // YYYY-MM-DD (Europe/Kiev)
+	Date             string `json:"date,omitempty"` // YYYY-MM-DD in the policy time zone
 	TimeZone         string `json:"timeZone,omitempty"`
 	TimeSpent        string `json:"timeSpent,omitempty"`
 	TimeSpentSeconds int    `json:"timeSpentSeconds,omitempty"`
@@ -181,127 +194,130 @@ func (h *apiHandler) worklogCommand() http.Handler {
 			respondError(w, http.StatusBadRequest, errors.New("invalid json"), "")
 			return
 		}
-		q := strings.TrimSpace(req.Query)
-		if q == "" {
-			respondError(w, http.StatusBadRequest, errors.New("query is required"), "")
-			return
-		}
-
-		// If query contains monthly/autofill hints - route to autofill.
-		if isAutofillText(q) {
-			issue := extractIssueFromTextAny(q)
-			if issue == "" {
-				respondError(w, http.StatusBadRequest, errors.New("cannot find issue key/url in query"), "")
-				return
-			}
-			issueKey := extractIssueKey(issue)
-			if issueKey == "" {
-				respondError(w, http.StatusBadRequest, errors.New("invalid issue key/url"), "")
-				return
-			}
-			af, status, err := h.runWorklogAutofill(r.Context(), issueKey, req.DryRun, req.Comment)
-			if err != nil {
-				respondError(w, status, err, "")
+		// An autofill command writes many worklogs at once.
+		if isAutofillText(req.Query) {
+			if err := requireScope(r, auth.ScopeBulk); err != nil {
+				respondError(w, http.StatusForbidden, err, "")
 				return
 			}
-			resp := worklogCommandResponse{
-				Kind:     "autofill",
-				IssueKey: af.IssueKey,
-				DryRun:   req.DryRun,
-				Autofill: &af,
-			}
-			w.Header().Set("Content-Type", "application/json")
-			_ = json.NewEncoder(w).Encode(resp)
+		}
+		resp, status, err := h.runWorklogCommand(r.Context(), req)
+		if err != nil {
+			respondError(w, status, err, "")
 			return
 		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// runWorklogCommand logs time from a one-line command, or runs the monthly
+// autofill when the text asks for it. When the duration or date is missing
+// it returns a clarification (Question/Need/Default) with status 422; the
+// caller repeats the request with DurationText or DateText filled in.
+func (h *apiHandler) runWorklogCommand(ctx context.Context, req worklogCommandRequest) (worklogCommandResponse, int, error) {
+	q := strings.TrimSpace(req.Query)
+	if q == "" {
+		return worklogCommandResponse{}, http.StatusBadRequest, errors.New("query is required")
+	}
 
+	// If query contains monthly/autofill hints - route to autofill.
+	if isAutofillText(q) {
 		issue := extractIssueFromTextAny(q)
 		if issue == "" {
-			respondError(w, http.StatusBadRequest, errors.New("cannot find issue key/url in query"), "")
-			return
+			return worklogCommandResponse{}, http.StatusBadRequest, errors.New("cannot find issue key/url in query")
 		}
 		issueKey := extractIssueKey(issue)
 		if issueKey == "" {
-			respondError(w, http.StatusBadRequest, errors.New("invalid issue key/url"), "")
-			return
-		}
-
-		durSource := q
-		if strings.TrimSpace(req.DurationText) != "" {
-			durSource = req.DurationText
-		}
-		secs, ok := parseDurationSeconds(durSource)
-		if !ok || secs <= 0 {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnprocessableEntity)
-			_ = json.NewEncoder(w).Encode(worklogCommandResponse{
-				Kind:     "single",
-				IssueKey: issueKey,
-				DryRun:   req.DryRun,
-				Question: "Сколько времени списать? (например: 10m, 30 минут, 1h 30m)",
-				Need:     "duration",
-			})
-			return
+			return worklogCommandResponse{}, http.StatusBadRequest, errors.New("invalid issue key/url")
 		}
-
-		loc, err := time.LoadLocation("Europe/Kiev")
+		af, status, err := h.runWorklogAutofill(ctx, issueKey, req.DryRun, req.Comment)
 		if err != nil {
-			respondError(w, http.StatusInternalServerError, fmt.Errorf("load tz: %w", err), "")
-			return
+			return worklogCommandResponse{}, status, err
 		}
-		now := time.Now().In(loc)
+		return worklogCommandResponse{
+			Kind:     "autofill",
+			IssueKey: af.IssueKey,
+			DryRun:   req.DryRun,
+			Autofill: &af,
+		}, http.StatusOK, nil
+	}
 
-		// Date resolution: from query text or explicit UI override; otherwise ask.
-		dateSource := q
-		if strings.TrimSpace(req.DateText) != "" {
-			dateSource = req.DateText
-		}
-		dayDate, ok := parseDateKiev(dateSource, now, loc)
-		if !ok && strings.TrimSpace(req.DateText) == "" {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnprocessableEntity)
-			_ = json.NewEncoder(w).Encode(worklogCommandResponse{
-				Kind:     "single",
-				IssueKey: issueKey,
-				DryRun:   req.DryRun,
-				Question: "За какой день списать? (сегодня / вчера / YYYY-MM-DD / DD.MM.YYYY)",
-				Need:     "date",
-				Default:  "сегодня",
-			})
-			return
-		}
-		if !ok {
-			dayDate = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
-		}
-		started := time.Date(dayDate.Year(), dayDate.Month(), dayDate.Day(), 9, 0, 0, 0, loc)
+	issue := extractIssueFromTextAny(q)
+	if issue == "" {
+		return worklogCommandResponse{}, http.StatusBadRequest, errors.New("cannot find issue key/url in query")
+	}
+	issueKey := extractIssueKey(issue)
+	if issueKey == "" {
+		return worklogCommandResponse{}, http.StatusBadRequest, errors.New("invalid issue key/url")
+	}
 
-		resp := worklogCommandResponse{
-			Kind:             "single",
-			IssueKey:         issueKey,
-			DryRun:           req.DryRun,
-			Date:             started.Format("2006-01-02"),
-			TimeZone:         "Europe/Kiev",
-			TimeSpentSeconds: secs,
-			TimeSpent:        formatDuration(secs),
-			Started:          started.Format(time.RFC3339),
-		}
+	durSource := q
+	if strings.TrimSpace(req.DurationText) != "" {
+		durSource = req.DurationText
+	}
+	secs, ok := parseDurationSeconds(durSource)
+	if !ok || secs <= 0 {
+		return worklogCommandResponse{
+			Kind:     "single",
+			IssueKey: issueKey,
+			DryRun:   req.DryRun,
+			Question: "Сколько времени списать? (например: 10m, 30 минут, 1h 30m)",
+			Need:     "duration",
+		}, http.StatusUnprocessableEntity, nil
+	}
 
-		if !req.DryRun {
-			body, st, err := h.jira.AddWorklog(r.Context(), issueKey, started, secs, req.Comment)
-			if err != nil {
-				respondErrorWithBody(w, st, fmt.Errorf("add worklog: %w", err), body, "")
-				return
-			}
-			var created struct {
-				ID string `json:"id"`
-			}
-			_ = json.Unmarshal(body, &created)
-			resp.WorklogID = created.ID
-		}
+	policy := h.policy.Get()
+	loc := policy.Location()
+	now := time.Now().In(loc)
 
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(resp)
-	})
+	// Date resolution: from query text or explicit UI override; otherwise ask.
+	dateSource := q
+	if strings.TrimSpace(req.DateText) != "" {
+		dateSource = req.DateText
+	}
+	dayDate, ok := parseDateKiev(dateSource, now, loc)
+	if !ok && strings.TrimSpace(req.DateText) == "" {
+		return worklogCommandResponse{
+			Kind:     "single",
+			IssueKey: issueKey,
+			DryRun:   req.DryRun,
+			Question: "За какой день списать? (сегодня / вчера / YYYY-MM-DD / DD.MM.YYYY)",
+			Need:     "date",
+			Default:  "сегодня",
+		}, http.StatusUnprocessableEntity, nil
+	}
+	if !ok {
+		dayDate = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	}
+	started := policy.StartOf(dayDate)
+
+	resp := worklogCommandResponse{
+		Kind:             "single",
+		IssueKey:         issueKey,
+		DryRun:           req.DryRun,
+		Date:             started.Format("2006-01-02"),
+		TimeZone:         policy.TimeZone,
+		TimeSpentSeconds: secs,
+		TimeSpent:        formatDuration(secs),
+		Started:          started.Format(time.RFC3339),
+	}
+
+	if !req.DryRun {
+		body, st, err := h.jira.AddWorklog(ctx, issueKey, started, secs, req.Comment)
+		if err != nil {
+			err = withBody(fmt.Errorf("add worklog: %w", err), body)
+			h.notifyEvent(ctx, worklogFailedMessage(issueKey, resp.Date, err))
+			return worklogCommandResponse{}, st, err
+		}
+		var created struct {
+			ID string `json:"id"`
+		}
+		_ = json.Unmarshal(body, &created)
+		resp.WorklogID = created.ID
+	}
+	return resp, http.StatusOK, nil
 }
 
 func (h *apiHandler) worklogAutofill() http.Handler {
@@ -332,10 +348,8 @@ func (h *apiHandler) worklogAutofill() http.Handler {
 }
 
 func (h *apiHandler) runWorklogAutofill(ctx context.Context, issueKey string, dryRun bool, comment string) (worklogAutofillResponse, int, error) {
-	loc, err := time.LoadLocation("Europe/Kiev")
-	if err != nil {
-		return worklogAutofillResponse{}, http.StatusInternalServerError, fmt.Errorf("load tz: %w", err)
-	}
+	policy := h.policy.Get()
+	loc := policy.Location()
 	now := time.Now().In(loc)
 	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
 	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
@@ -346,7 +360,7 @@ func (h *apiHandler) runWorklogAutofill(ctx context.Context, issueKey string, dr
 	}
 
 	currentUser := strings.TrimSpace(h.jira.User())
-	// existingDays: YYYY-MM-DD (Europe/Kiev) -> true
+	// existingDays: YYYY-MM-DD (policy time zone) -> true
 	existingDays := map[string]bool{}
 	for _, wl := range worklogs {
 		if currentUser != "" && !strings.EqualFold(strings.TrimSpace(wl.Author.Name), currentUser) {
@@ -363,30 +377,22 @@ func (h *apiHandler) runWorklogAutofill(ctx context.Context, issueKey string, dr
 		existingDays[day] = true
 	}
 
-	weekdaySeconds := map[time.Weekday]int{
-		time.Monday:    30 * 60,
-		time.Tuesday:   45 * 60,
-		time.Wednesday: 30 * 60,
-		time.Thursday:  90 * 60,
-		time.Friday:    30 * 60,
-	}
-
 	var resp worklogAutofillResponse
 	resp.IssueKey = issueKey
 	resp.From = from.Format("2006-01-02")
 	resp.To = to.Format("2006-01-02")
-	resp.TimeZone = "Europe/Kiev"
+	resp.TimeZone = policy.TimeZone
 	resp.DryRun = dryRun
 
 	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
-		secs, ok := weekdaySeconds[d.Weekday()]
+		secs, ok := policy.WorkSeconds(d.Weekday())
 		dayStr := d.Format("2006-01-02")
 		day := worklogAutofillDay{
 			Date:             dayStr,
 			Weekday:          d.Weekday().String(),
 			TimeSpentSeconds: secs,
 			TimeSpent:        formatDuration(secs),
-			Started:          time.Date(d.Year(), d.Month(), d.Day(), 9, 0, 0, 0, loc).Format(time.RFC3339),
+			Started:          policy.StartOf(d).Format(time.RFC3339),
 		}
 		if !ok {
 			day.Action = "skip"
@@ -405,10 +411,12 @@ func (h *apiHandler) runWorklogAutofill(ctx context.Context, issueKey string, dr
 
 		day.Action = "create"
 		if !dryRun {
-			started := time.Date(d.Year(), d.Month(), d.Day(), 9, 0, 0, 0, loc)
+			started := policy.StartOf(d)
 			createdBody, st, err := h.jira.AddWorklog(ctx, issueKey, started, secs, comment)
 			if err != nil {
-				return worklogAutofillResponse{}, st, fmt.Errorf("add worklog %s: %w body=%s", dayStr, err, string(createdBody))
+				err = fmt.Errorf("add worklog %s: %w body=%s", dayStr, err, string(createdBody))
+				h.notifyEvent(ctx, worklogFailedMessage(issueKey, dayStr, err))
+				return worklogAutofillResponse{}, st, err
 			}
 			var created struct {
 				ID string `json:"id"`
@@ -422,6 +430,9 @@ func (h *apiHandler) runWorklogAutofill(ctx context.Context, issueKey string, dr
 		resp.Days = append(resp.Days, day)
 	}
 
+	if !dryRun && resp.Created > 0 {
+		h.notifyEvent(ctx, autofillMessage(resp))
+	}
 	return resp, http.StatusOK, nil
 }
 
@@ -522,22 +533,26 @@ func parseDateKiev(text string, now time.Time, loc *time.Location) (time.Time, b
 }
 func (h *apiHandler) projectSprints() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
-		}
 		if !strings.HasPrefix(r.URL.Path, "/api/projects/") {
 			http.NotFound(w, r)
 			return
 		}
 		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/projects/"), "/")
+		if len(parts) == 2 && parts[1] == "boards" {
+			h.projectBoards(w, r, parts[0])
+			return
+		}
 		if len(parts) < 2 || parts[1] != "sprints" {
 			http.NotFound(w, r)
 			return
 		}
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
 		projectKey := parts[0]
-		if strings.ToUpper(projectKey) != "CE" {
-			// временно поддерживаем спринты только для CE (Simulator.Company)
+		if !h.policy.Get().SprintsEnabled(projectKey) {
+			// спринты включены только для проектов из sprints.projects
 			w.Header().Set("Content-Type", "application/json")
 			_, _ = w.Write([]byte("[]"))
 			return
@@ -549,12 +564,28 @@ func (h *apiHandler) projectSprints() http.Handler {
 			}
 		}
 
-		// жёстко используем борд 209 (рабочий для CE), чтобы не зависеть от env
-		boardID := 209
-		if boardID == 0 {
-			http.Error(w, "board not found for project", http.StatusBadGateway)
+		board, err := h.resolveBoard(r.Context(), projectKey)
+		var choice *errBoardChoice
+		if errors.As(err, &choice) {
+			// UI asks which board to use and saves it via /boards.
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			_ = json.NewEncoder(w).Encode(struct {
+				Error  string       `json:"error"`
+				Need   string       `json:"need"`
+				Boards []jira.Board `json:"boards"`
+			}{choice.Error(), "board", choice.Boards})
+			return
+		}
+		if errors.Is(err, errNoBoard) {
+			respondError(w, http.StatusNotFound, err, "")
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusBadGateway, err, "")
 			return
 		}
+		boardID := board.BoardID
 
 		maxFetch := 50
 		all := make([]struct {
@@ -657,18 +688,6 @@ func formatDuration(seconds int) string {
 	return fmt.Sprintf("%dm", m)
 }
 
-func (h *apiHandler) historyList() http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
-		}
-		entries := h.history.Latest(20)
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(entries)
-	})
-}
-
 func (h *apiHandler) historyItem() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !strings.HasPrefix(r.URL.Path, "/api/history/") {
@@ -689,12 +708,7 @@ func (h *apiHandler) historyItem() http.Handler {
 			return
 		}
 		if len(parts) == 1 {
-			if r.Method != http.MethodGet {
-				w.WriteHeader(http.StatusMethodNotAllowed)
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			_ = json.NewEncoder(w).Encode(entry)
+			h.handleHistoryEntry(w, r, entry)
 			return
 		}
 		switch parts[1] {
@@ -702,7 +716,42 @@ func (h *apiHandler) historyItem() http.Handler {
 			h.handleHistorySearch(w, r, entry)
 			return
 		case "action":
-			h.handleHistoryAction(w, r, entry)
+			stream := len(parts) > 2 && parts[2] == "stream"
+			h.handleHistoryAction(w, r, entry, stream)
+			return
+		case "run":
+			stream := len(parts) > 2 && parts[2] == "stream"
+			h.handlePlanRun(w, r, entry, "", stream)
+			return
+		case "rerun":
+			h.handleRerun(w, r, entry)
+			return
+		case "children":
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(h.history.Children(entry.ID))
+			return
+		case "thread":
+			action := ""
+			if len(parts) > 2 {
+				action = parts[2]
+			}
+			h.handleThread(w, r, entry, action)
+			return
+		case "testcases":
+			h.handleTestCaseExport(w, r, entry)
+			return
+		case "steps":
+			// /api/history/{id}/steps/{stepID}/run[/stream]
+			if len(parts) < 4 || parts[3] != "run" {
+				http.NotFound(w, r)
+				return
+			}
+			stream := len(parts) > 4 && parts[4] == "stream"
+			h.handlePlanRun(w, r, entry, parts[2], stream)
 			return
 		default:
 			http.NotFound(w, r)
@@ -744,46 +793,86 @@ func (h *apiHandler) handleHistorySearch(w http.ResponseWriter, r *http.Request,
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
-func (h *apiHandler) handleHistoryAction(w http.ResponseWriter, r *http.Request, entry history.Entry) {
-	if h.llm == nil {
-		respondError(w, http.StatusNotImplemented, errors.New("LLM not configured"), "")
-		return
-	}
+// handleHistoryAction runs a follow-up command over a stored entry. With stream
+// set the answer is delivered as Server-Sent Events (see stream.go).
+func (h *apiHandler) handleHistoryAction(w http.ResponseWriter, r *http.Request, entry history.Entry, stream bool) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 	var req struct {
-		Command string `json:"command"`
+		Command  string `json:"command"`
+		Mode     string `json:"mode"` // "", "answer" or "requery"
+		Provider string `json:"provider"`
+		Model    string `json:"model"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, errors.New("invalid json"), "")
 		return
 	}
+	provider, err := h.llmFor(req.Provider, req.Model)
+	if err != nil {
+		respondError(w, http.StatusNotImplemented, err, "")
+		return
+	}
 	command := strings.TrimSpace(req.Command)
 	if command == "" {
 		respondError(w, http.StatusBadRequest, errors.New("command is required"), "")
 		return
 	}
-	contextText := buildFollowUpContext(entry)
-	if strings.TrimSpace(contextText) == "" {
+	var requery bool
+	switch req.Mode {
+	case modeAuto:
+		requery = entry.JQL != "" && h.wantsRequery(command)
+	case modeAnswer:
+	case modeRequery:
+		if entry.JQL == "" {
+			respondError(w, http.StatusUnprocessableEntity, errors.New("entry has no JQL to refine"), "")
+			return
+		}
+		requery = true
+	default:
+		respondError(w, http.StatusBadRequest, fmt.Errorf("unknown mode %q", req.Mode), "")
+		return
+	}
+	if !requery && strings.TrimSpace(buildFollowUpContext(entry)) == "" {
 		respondError(w, http.StatusUnprocessableEntity, errors.New("no context available for follow-up"), "")
 		return
 	}
-	answer, err := h.llm.FollowUp(r.Context(), contextText, command)
-	if err != nil {
-		respondError(w, http.StatusBadGateway, fmt.Errorf("llm: %w", err), "")
+	if stream {
+		h.streamHistoryAction(w, r, provider, entry, command, requery)
 		return
 	}
-	resp := struct {
-		Result string `json:"result"`
-	}{
-		Result: answer,
+	var resp followUpResponse
+	if requery {
+		resp, err = h.requery(r.Context(), provider, entry, command, nil)
+	} else if resp, err = h.followUp(r.Context(), provider, entry, command); err != nil {
+		err = fmt.Errorf("llm: %w", err)
+	}
+	if err != nil {
+		respondError(w, http.StatusBadGateway, err, resp.JQL)
+		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
+// llmFor returns the provider requested by the client, falling back to the server default.
+func (h *apiHandler) llmFor(provider, model string) (llm.Provider, error) {
+	return h.llm.Get(strings.TrimSpace(provider), strings.TrimSpace(model))
+}
+
+func (h *apiHandler) llmProviders() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(h.llm.List())
+	})
+}
+
 func buildFollowUpContext(entry history.Entry) string {
 	var b strings.Builder
 	if entry.Query != "" {
@@ -811,13 +900,23 @@ func buildFollowUpContext(entry history.Entry) string {
 		}
 	}
 	if raw := findStepResult(entry.Steps, "Execute Jira search"); len(raw) > 0 {
-		b.WriteString("Raw JSON:\n")
-		b.WriteString(truncateString(string(raw), 2000))
+		budget := followUpContextTokens - llm.EstimateTokens(b.String())
+		if issues, total, err := analysis.Compact(raw); err == nil && len(issues) > 0 {
+			fit := analysis.Fit(issues, budget)
+			b.WriteString(fmt.Sprintf("Issues JSON (%d of %d):\n", len(fit), total))
+			b.Write(analysis.Encode(fit, total))
+		} else {
+			b.WriteString("Raw JSON:\n")
+			b.WriteString(truncateString(string(raw), budget*3))
+		}
 		b.WriteString("\n")
 	}
-	return truncateString(b.String(), 4000)
+	return b.String()
 }
 
+// followUpContextTokens bounds the context sent with follow-up commands.
+const followUpContextTokens = 6000
+
 func findStepResult(steps []history.Step, name string) json.RawMessage {
 	for _, step := range steps {
 		if step.Name == name && len(step.Result) > 0 {
@@ -849,225 +948,258 @@ func (h *apiHandler) search() http.Handler {
 			http.Error(w, "invalid json", http.StatusBadRequest)
 			return
 		}
-
-		titleMatch, hasTitle := extractTitleFromQuery(req.Query)
-
-		jql := strings.TrimSpace(req.JQL)
-		if jql == "" {
-			if hasTitle {
-				jql = fmt.Sprintf(`summary ~ "\"%s\""`, escapeQuotes(titleMatch))
-			} else {
-				// Prefer LLM if configured.
-				if h.llm != nil {
-					if derived, err := h.llm.DeriveJQL(r.Context(), req.Query); err == nil && strings.TrimSpace(derived) != "" {
-						jql = strings.TrimSpace(derived)
-					}
-				}
-				if jql == "" {
-					jql = deriveJQL(req.Query)
-				}
-			}
-		}
-		if jql == "" {
-			http.Error(w, "empty jql", http.StatusBadRequest)
+		resp, serr := h.runSearch(r.Context(), req, nil)
+		if serr != nil {
+			respondError(w, serr.status, serr.err, serr.jql)
 			return
 		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "encode response", http.StatusInternalServerError)
+		}
+	})
+}
 
-		max := req.MaxResults
-		if max <= 0 || max > 300 {
-			max = 300
+// deriveJQL turns a natural query into JQL: an explicit title directive wins,
+// then the LLM (when configured), then the offline rule engine.
+func (h *apiHandler) deriveJQL(ctx context.Context, provider llm.Provider, query string) (string, *llm.JQLResult) {
+	if title, ok := extractTitleFromQuery(query); ok {
+		return fmt.Sprintf(`summary ~ "\"%s\""`, nlq.EscapeQuotes(title)), nil
+	}
+	if provider != nil {
+		if derived, err := provider.DeriveJQL(ctx, query); err == nil {
+			return derived.JQL, &derived
 		}
+	}
+	return h.nlq.DeriveJQL(query), nil
+}
 
-		intentWorklog := hasWorklogIntent(req.Query, jql)
-		intentBug := hasBugIntent(req.Query, jql)
-		intentSprint := strings.Contains(strings.ToLower(req.Query+" "+jql), "спринт") || strings.Contains(strings.ToLower(req.Query+" "+jql), "sprint")
-		var sprintRange *dateRange
-		if intentSprint || req.SprintID > 0 {
-			if len(req.Projects) > 1 {
-				http.Error(w, "для спринта выбери один проект", http.StatusBadRequest)
-				return
-			}
-			// жёстко используем борд 209 для спринтов CE
-			boardID := 209
-			if boardID > 0 {
-				if req.SprintID > 0 {
-					if dr, err := h.fetchSprintByID(r.Context(), req.SprintID); err == nil {
-						sprintRange = dr
-					}
-				} else {
-					sprintNum := parseSprintNumber(req.Query + " " + jql)
-					if sprintNum > 0 {
-						if dr, err := h.fetchSprintByNumber(r.Context(), boardID, sprintNum); err == nil {
-							sprintRange = dr
-						}
-					} else {
-						if dr, err := h.fetchActiveSprintRange(r.Context(), boardID); err == nil {
-							sprintRange = dr
-						}
-					}
-				}
-			}
-			if sprintRange == nil {
-				sprintRange = fallbackSprintRange(time.Now().UTC())
-			}
+// sprintRange resolves the sprint a query refers to: an explicit sprint ID, a
+// sprint number from the text, or the active sprint, on the board of the
+// selected project (or the one named in the query). It never returns nil.
+func (h *apiHandler) sprintRange(ctx context.Context, projects []string, intents nlq.Query, sprintID int) *dateRange {
+	if len(projects) == 0 {
+		projects = intents.Projects
+	}
+	boardID := 0
+	if sprintID == 0 {
+		boardID = h.sprintBoard(ctx, projects)
+	}
+	if sprintID > 0 {
+		if dr, err := h.fetchSprintByID(ctx, sprintID); err == nil {
+			return dr
 		}
-		if sprintRange != nil {
-			jql = applySprintRange(jql, sprintRange)
+	} else if boardID == 0 {
+		return fallbackSprintRange(time.Now().UTC())
+	} else if intents.SprintNumber > 0 {
+		if dr, err := h.fetchSprintByNumber(ctx, boardID, intents.SprintNumber); err == nil {
+			return dr
 		}
-		allowedAuthors := req.Users
+	} else if dr, err := h.fetchActiveSprintRange(ctx, boardID); err == nil {
+		return dr
+	}
+	return fallbackSprintRange(time.Now().UTC())
+}
 
-		// If user selected specific users and this is a worklog query, replace currentUser with explicit users
-		if intentWorklog && len(req.Users) > 0 {
-			jql = overrideWorklogAuthor(jql, req.Users)
-			if intentBug {
-				jql = overrideReporterClause(jql, req.Users)
-			}
-			// prevent adding assignee filter later
-			if len(req.Projects) > 0 {
-				jql = overrideProjectsClause(jql, req.Projects)
-			}
-			jql = applyFilters(jql, nil, nil)
-		} else if intentBug {
-			// For bugs we treat users as reporters.
-			if len(req.Users) > 0 {
-				jql = overrideReporterClause(jql, req.Users)
-			}
-			if len(req.Projects) > 0 {
-				jql = overrideProjectsClause(jql, req.Projects)
-			}
-			jql = applyFilters(jql, nil, nil) // do not add assignee filter
-		} else {
-			if len(req.Projects) > 0 {
-				jql = overrideProjectsClause(jql, req.Projects)
-			}
-			if len(req.Users) > 0 {
-				jql = overrideAssigneeClause(jql, req.Users)
-			}
-			jql = applyFilters(jql, nil, req.Users)
-		}
+// searchError is a failed search: the HTTP status and the JQL that was tried.
+type searchError struct {
+	status int
+	err    error
+	jql    string
+}
 
-		jql = cleanJQL(jql)
+// runSearch derives the JQL, queries Jira, optionally analyses the results and
+// stores a history entry. progress may be nil; when set it receives step
+// updates and LLM tokens as they happen.
+func (h *apiHandler) runSearch(ctx context.Context, req searchRequest, progress *searchProgress) (searchResponse, *searchError) {
+	titleMatch, hasTitle := extractTitleFromQuery(req.Query)
+	// A missing provider is not fatal: search falls back to heuristics.
+	provider, providerErr := h.llmFor(req.Provider, req.Model)
+	if providerErr != nil && (req.Provider != "" || req.Model != "") {
+		return searchResponse{}, &searchError{status: http.StatusBadRequest, err: providerErr}
+	}
 
-		if req.DryRun {
-			resp := searchResponse{
-				JQL:      jql,
-				Raw:      json.RawMessage(`[]`),
-				History:  h.history.Latest(10),
-				Executed: time.Now().UTC(),
-			}
-			w.Header().Set("Content-Type", "application/json")
-			_ = json.NewEncoder(w).Encode(resp)
-			return
-		}
+	jql := strings.TrimSpace(req.JQL)
+	var derivation *llm.JQLResult
+	if jql == "" {
+		jql, derivation = h.deriveJQL(ctx, provider, req.Query)
+	}
+	if jql == "" {
+		return searchResponse{}, &searchError{status: http.StatusBadRequest, err: errors.New("empty jql")}
+	}
 
-		fields := ensureValidFields(req.Fields)
-		if intentWorklog && !containsField(fields, "worklog") {
-			fields = append(fields, "worklog")
-		}
+	max := req.MaxResults
+	if max <= 0 || max > 300 {
+		max = 300
+	}
 
-		raw, status, err := h.jira.Search(r.Context(), jql, max, fields)
-		if err != nil {
-			respondErrorWithBody(w, status, err, raw, jql)
-			return
-		}
-		total := extractTotal(raw)
-		links := extractIssueLinks(raw, h.jira.BaseURL())
-		firstIssueKey := ""
-		if len(links) > 0 {
-			firstIssueKey = links[0].Key
-		}
-		var issueDetail json.RawMessage
-		if hasTitle && firstIssueKey != "" {
-			if detail, err := fetchIssueDetail(r.Context(), h.jira, firstIssueKey); err == nil {
-				issueDetail = detail
-			}
+	intents := h.nlq.Parse(req.Query + " " + jql)
+	intentWorklog := hasWorklogIntent(intents)
+	intentBug := intents.Bug
+	intentSprint := intents.Sprint
+	var sprintRange *dateRange
+	if intentSprint || req.SprintID > 0 {
+		if len(req.Projects) > 1 {
+			return searchResponse{}, &searchError{status: http.StatusBadRequest, err: errors.New("для спринта выбери один проект"), jql: jql}
 		}
+		sprintRange = h.sprintRange(ctx, req.Projects, intents, req.SprintID)
+	}
+	if sprintRange != nil {
+		jql = applySprintRange(jql, sprintRange)
+	}
+	allowedAuthors := req.Users
 
-		analysisText := ""
-		if intentWorklog {
-			if hours, err := sumWorklogHoursFullAcrossPages(r.Context(), h.jira, jql, allowedAuthors); err == nil {
-				analysisText = fmt.Sprintf("Списано за текущий месяц: %.2f ч", hours)
-			}
+	// If user selected specific users and this is a worklog query, replace currentUser with explicit users
+	if intentWorklog && len(req.Users) > 0 {
+		jql = overrideWorklogAuthor(jql, req.Users)
+		if intentBug {
+			jql = overrideReporterClause(jql, req.Users)
 		}
-		if req.Analysis && h.llm != nil && analysisText == "" {
-			if summary, err := h.llm.Analyze(r.Context(), req.Query, jql, raw); err == nil {
-				analysisText = summary
-			}
+		// prevent adding assignee filter later
+		if len(req.Projects) > 0 {
+			jql = overrideProjectsClause(jql, req.Projects)
 		}
-
-		// Persist history.
-		steps := buildHistorySteps(jql, raw, total, links, analysisText, titleMatch, firstIssueKey, issueDetail)
-		entry := history.Entry{
-			ID:         history.NewID(),
-			Query:      strings.TrimSpace(req.Query),
-			JQL:        jql,
-			CreatedAt:  time.Now().UTC(),
-			MaxResults: max,
-			Steps:      steps,
-			Issues:     issueLinksToSnapshots(links),
-			Analysis:   analysisText,
+		jql = applyFilters(jql, nil, nil)
+	} else if intentBug {
+		// For bugs we treat users as reporters.
+		if len(req.Users) > 0 {
+			jql = overrideReporterClause(jql, req.Users)
 		}
-		_ = h.history.Append(entry)
-
-		resp := searchResponse{
-			JQL:       jql,
-			Raw:       raw,
-			History:   h.history.Latest(10),
-			Executed:  entry.CreatedAt,
-			Analysis:  analysisText,
-			Total:     total,
-			Issues:    links,
-			Steps:     steps,
-			HistoryID: entry.ID,
+		if len(req.Projects) > 0 {
+			jql = overrideProjectsClause(jql, req.Projects)
 		}
-
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			http.Error(w, "encode response", http.StatusInternalServerError)
+		jql = applyFilters(jql, nil, nil) // do not add assignee filter
+	} else {
+		if len(req.Projects) > 0 {
+			jql = overrideProjectsClause(jql, req.Projects)
 		}
-	})
-}
-
-func deriveJQL(query string) string {
-	query = strings.TrimSpace(query)
-	if query == "" {
-		return ""
+		if len(req.Users) > 0 {
+			jql = overrideAssigneeClause(jql, req.Users)
+		}
+		jql = applyFilters(jql, nil, req.Users)
 	}
-	lq := strings.ToLower(query)
 
-	// Bugs/defects intent.
-	if strings.Contains(lq, "ошиб") || strings.Contains(lq, "bug") || strings.Contains(lq, "баг") || strings.Contains(lq, "дефект") || strings.Contains(lq, "заведен") {
-		// Здесь спринт ещё не определён; при обработке запроса он будет подставлен (search())
-		return creationDateRangeClause(query, nil) + " AND issuetype = Bug AND reporter = currentUser()"
-	}
+	jql = cleanJQL(jql)
+	progress.step(history.Step{
+		Name:        "Generate JQL",
+		Description: buildJQLStepDescription(titleMatch),
+		Status:      "completed",
+		Result:      jqlStepResult(jql, derivation),
+	})
 
-	// Worklog/time-tracking intent.
-	if strings.Contains(lq, "сколько времени") ||
-		strings.Contains(lq, "затрек") ||
-		strings.Contains(lq, "списал") ||
-		strings.Contains(lq, "списан") ||
-		strings.Contains(lq, "списанное") ||
-		strings.Contains(lq, "затрачен") ||
-		strings.Contains(lq, "worklog") ||
-		strings.Contains(lq, "time spent") {
-		return worklogDateRangeClause(query) + " AND worklogAuthor = currentUser()"
+	needsConfirmation := derivation != nil && derivation.NeedsConfirmation() && !req.Confirmed
+	if req.DryRun || needsConfirmation {
+		resp := searchResponse{
+			JQL:               jql,
+			Raw:               json.RawMessage(`[]`),
+			History:           h.history.Latest(10),
+			Executed:          time.Now().UTC(),
+			Derivation:        derivation,
+			NeedsConfirmation: needsConfirmation,
+		}
+		return resp, nil
 	}
 
-	// Heuristic: if user already wrote "project =" or "assignee =" treat as JQL.
-	if strings.Contains(lq, "project ") || strings.Contains(lq, "assignee ") || strings.Contains(lq, "status ") {
-		return query
+	fields := ensureValidFields(req.Fields)
+	if intentWorklog && !containsField(fields, "worklog") {
+		fields = append(fields, "worklog")
 	}
-	// fallback: simple text search in summary/description
-	return `text ~ "` + escapeQuotes(query) + `"`
-}
 
-func buildHistorySteps(jql string, raw json.RawMessage, total int, links []issueLink, analysis string, titleSearch string, firstIssueKey string, issueDetail json.RawMessage) []history.Step {
+	searchStep := history.Step{Name: "Execute Jira search", Description: "Querying Jira", Status: "running"}
+	progress.step(searchStep)
+	raw, status, err := h.jira.Search(ctx, jql, max, fields)
+	if err != nil {
+		searchStep.Status = "failed"
+		searchStep.Description = err.Error()
+		progress.step(searchStep)
+		return searchResponse{}, &searchError{status: status, err: withBody(err, raw), jql: jql}
+	}
+	total := extractTotal(raw)
+	links := extractIssueLinks(raw, h.jira.BaseURL())
+	searchStep.Status = "completed"
+	searchStep.Description = fmt.Sprintf("Fetched %d issues via Jira", total)
+	searchStep.Result = marshalStepResult(map[string]any{"total": total, "issues": links})
+	progress.step(searchStep)
+	firstIssueKey := ""
+	if len(links) > 0 {
+		firstIssueKey = links[0].Key
+	}
+	var issueDetail json.RawMessage
+	if hasTitle && firstIssueKey != "" {
+		if detail, err := fetchIssueDetail(ctx, h.jira, firstIssueKey); err == nil {
+			issueDetail = detail
+		}
+	}
+
+	analysisText := ""
+	var report *llm.Analysis
+	var analysisSteps []history.Step
+	if intentWorklog {
+		if hours, err := sumWorklogHoursFullAcrossPages(ctx, h.jira, jql, allowedAuthors); err == nil {
+			analysisText = fmt.Sprintf("Списано за текущий месяц: %.2f ч", hours)
+		}
+	}
+	var reviews []llm.IssueReview
+	if req.Analysis && provider != nil && analysisText == "" && intents.PerIssue {
+		deep := h.deepPipeline(provider)
+		deep.Progress = progress.stepFunc()
+		result, err := deep.Run(progress.tokens(ctx), req.Query, issueKeys(links))
+		analysisSteps = result.Steps
+		if err == nil {
+			analysisText = result.Report.Text()
+			report = &result.Report
+			reviews = result.Reviews
+		}
+	} else if req.Analysis && provider != nil && analysisText == "" {
+		pipeline := analysis.Pipeline{Provider: provider, ChunkTokens: h.chunkTokens, Progress: progress.stepFunc()}
+		result, err := pipeline.Run(progress.tokens(ctx), req.Query, jql, raw)
+		analysisSteps = result.Steps
+		if err == nil {
+			analysisText = result.Analysis.Text()
+			report = &result.Analysis
+		}
+	}
+
+	// Persist history.
+	steps := buildHistorySteps(jql, derivation, raw, total, links, analysisSteps, analysisText, report, titleMatch, firstIssueKey, issueDetail)
+	entry := history.Entry{
+		ID:         history.NewID(),
+		Query:      strings.TrimSpace(req.Query),
+		JQL:        jql,
+		CreatedAt:  time.Now().UTC(),
+		MaxResults: max,
+		Steps:      steps,
+		Issues:     issueLinksToSnapshots(links),
+		Analysis:   analysisText,
+	}
+	_ = h.history.Append(entry)
+
+	resp := searchResponse{
+		JQL:       jql,
+		Raw:       raw,
+		History:   h.history.Latest(10),
+		Executed:  entry.CreatedAt,
+		Analysis:  analysisText,
+		Total:     total,
+		Issues:    links,
+		Steps:     steps,
+		HistoryID: entry.ID,
+
+		Derivation: derivation,
+		Report:     report,
+		Reviews:    reviews,
+	}
+
+	return resp, nil
+}
+
+func buildHistorySteps(jql string, derivation *llm.JQLResult, raw json.RawMessage, total int, links []issueLink, analysisSteps []history.Step, analysis string, report *llm.Analysis, titleSearch string, firstIssueKey string, issueDetail json.RawMessage) []history.Step {
 	steps := []history.Step{
 		{
 			Name:        "Generate JQL",
 			Description: buildJQLStepDescription(titleSearch),
 			Status:      "completed",
-			Result:      marshalStepResult(map[string]string{"jql": jql}),
+			Result:      jqlStepResult(jql, derivation),
 		},
 		{
 			Name:        "Execute Jira search",
@@ -1076,12 +1208,20 @@ func buildHistorySteps(jql string, raw json.RawMessage, total int, links []issue
 			Result:      marshalStepResult(raw),
 		},
 	}
+	steps = append(steps, analysisSteps...)
 	if analysis != "" {
+		result := marshalStepResult(map[string]string{"analysis": analysis})
+		if report != nil {
+			result = marshalStepResult(struct {
+				Analysis string        `json:"analysis"`
+				Report   *llm.Analysis `json:"report"`
+			}{Analysis: analysis, Report: report})
+		}
 		steps = append(steps, history.Step{
 			Name:        "Analysis",
 			Description: "Summary generated by worklog aggregation or the LLM",
 			Status:      "completed",
-			Result:      marshalStepResult(map[string]string{"analysis": analysis}),
+			Result:      result,
 		})
 	}
 	if len(issueDetail) > 0 {
@@ -1099,6 +1239,16 @@ func buildHistorySteps(jql string, raw json.RawMessage, total int, links []issue
 	return steps
 }
 
+func jqlStepResult(jql string, derivation *llm.JQLResult) json.RawMessage {
+	if derivation == nil {
+		return marshalStepResult(map[string]string{"jql": jql})
+	}
+	return marshalStepResult(struct {
+		JQL string `json:"jql"`
+		*llm.JQLResult
+	}{JQL: jql, JQLResult: derivation})
+}
+
 func marshalStepResult(value any) json.RawMessage {
 	if value == nil {
 		return nil
@@ -1160,24 +1310,36 @@ func fetchIssueDetail(ctx context.Context, client *jira.Client, key string) (jso
 	return json.RawMessage(body), nil
 }
 
+func issueKeys(links []issueLink) []string {
+	keys := make([]string, 0, len(links))
+	for _, l := range links {
+		keys = append(keys, l.Key)
+	}
+	return keys
+}
+
+// deepPipeline returns the per-issue analysis configured for this server.
+func (h *apiHandler) deepPipeline(provider llm.Provider) analysis.DeepPipeline {
+	deep := h.deep
+	deep.Provider = provider
+	deep.Fetcher = h.jira
+	return deep
+}
+
 func issueLinksToSnapshots(links []issueLink) []history.IssueSnapshot {
 	snapshots := make([]history.IssueSnapshot, 0, len(links))
 	for _, link := range links {
 		snapshots = append(snapshots, history.IssueSnapshot{
-			Key:   link.Key,
-			Title: link.Title,
-			URL:   link.URL,
+			Key:      link.Key,
+			Title:    link.Title,
+			URL:      link.URL,
+			Status:   link.Status,
+			Assignee: link.Assignee,
 		})
 	}
 	return snapshots
 }
 
-func escapeQuotes(s string) string {
-	s = strings.ReplaceAll(s, `\`, `\\`)
-	s = strings.ReplaceAll(s, `"`, `\"`)
-	return s
-}
-
 func applyFilters(jql string, projects, users []string) string {
 	var clauses []string
 	base := normalizeClause(jql)
@@ -1187,12 +1349,12 @@ func applyFilters(jql string, projects, users []string) string {
 	lower := strings.ToLower(jql)
 	projects = ensureValidFields(projects)
 	if len(projects) > 0 && !strings.Contains(lower, "project in") && !strings.Contains(lower, "project=") && !strings.Contains(lower, "project ") {
-		clauses = append(clauses, "project in ("+quoteList(projects)+")")
+		clauses = append(clauses, "project in ("+nlq.QuoteList(projects)+")")
 	}
 	users = ensureValidFields(users)
 	// Avoid adding assignee filter if JQL already constrains assignee/worklogAuthor (to not break worklog queries).
 	if len(users) > 0 && !strings.Contains(lower, "assignee") && !strings.Contains(lower, "worklogauthor") {
-		clauses = append(clauses, "assignee in ("+quoteList(users)+")")
+		clauses = append(clauses, "assignee in ("+nlq.QuoteList(users)+")")
 	}
 	if len(clauses) == 0 {
 		return jql
@@ -1200,54 +1362,10 @@ func applyFilters(jql string, projects, users []string) string {
 	return strings.Join(clauses, " AND ")
 }
 
-func quoteList(items []string) string {
-	quoted := make([]string, 0, len(items))
-	for _, it := range items {
-		quoted = append(quoted, `"`+escapeQuotes(it)+`"`)
-	}
-	return strings.Join(quoted, ",")
-}
-
-func hasWorklogIntent(query, jql string) bool {
-	lq := strings.ToLower(query + " " + jql)
-	return strings.Contains(lq, "worklog") ||
-		strings.Contains(lq, "time spent") ||
-		strings.Contains(lq, "сколько времени") ||
-		strings.Contains(lq, "затрек") ||
-		strings.Contains(lq, "списал") ||
-		strings.Contains(lq, "списан") ||
-		strings.Contains(lq, "списанное") ||
-		strings.Contains(lq, "затрачен") ||
-		strings.Contains(lq, "недел") ||
-		strings.Contains(lq, "week")
-}
-
-func hasBugIntent(query, jql string) bool {
-	lq := strings.ToLower(query + " " + jql)
-	return strings.Contains(lq, "ошиб") ||
-		strings.Contains(lq, "bug") ||
-		strings.Contains(lq, "баг") ||
-		strings.Contains(lq, "дефект") ||
-		strings.Contains(lq, "заведен")
-}
-
-func worklogDateRangeClause(query string) string {
-	lq := strings.ToLower(query)
-	if strings.Contains(lq, "недел") || strings.Contains(lq, "week") || strings.Contains(lq, "спринт") || strings.Contains(lq, "sprint") {
-		return "worklogDate >= startOfWeek() AND worklogDate <= endOfWeek()"
-	}
-	return "worklogDate >= startOfMonth() AND worklogDate <= endOfMonth()"
-}
-
-func creationDateRangeClause(query string, sprint *dateRange) string {
-	if sprint != nil {
-		return fmt.Sprintf("created >= \"%s\" AND created <= \"%s\"", sprint.Start.Format("2006-01-02"), sprint.End.Format("2006-01-02"))
-	}
-	lq := strings.ToLower(query)
-	if strings.Contains(lq, "недел") || strings.Contains(lq, "week") || strings.Contains(lq, "спринт") || strings.Contains(lq, "sprint") {
-		return "created >= startOfWeek() AND created <= endOfWeek()"
-	}
-	return "created >= startOfMonth() AND created <= endOfMonth()"
+// hasWorklogIntent reports whether worklog hours should be summed. Week-scoped
+// questions count too: "что я делал на этой неделе" is answered from worklogs.
+func hasWorklogIntent(q nlq.Query) bool {
+	return q.Worklog || q.Week
 }
 
 func containsField(fields []string, target string) bool {
@@ -1405,7 +1523,7 @@ func overrideWorklogAuthor(jql string, users []string) string {
 	if len(users) == 0 {
 		return jql
 	}
-	newClause := "worklogAuthor in (" + quoteList(users) + ")"
+	newClause := "worklogAuthor in (" + nlq.QuoteList(users) + ")"
 	// If a worklogAuthor clause exists, replace it.
 	clean := reWorklogAuthorClause.ReplaceAllString(jql, "")
 	clean = normalizeClause(clean)
@@ -1419,7 +1537,7 @@ func overrideProjectsClause(jql string, projects []string) string {
 	if len(projects) == 0 {
 		return jql
 	}
-	newClause := "project in (" + quoteList(projects) + ")"
+	newClause := "project in (" + nlq.QuoteList(projects) + ")"
 	if reProjectClause.MatchString(jql) {
 		return reProjectClause.ReplaceAllString(jql, newClause)
 	}
@@ -1434,7 +1552,7 @@ func overrideReporterClause(jql string, reporters []string) string {
 	if len(reporters) == 0 {
 		return jql
 	}
-	newClause := "reporter in (" + quoteList(reporters) + ")"
+	newClause := "reporter in (" + nlq.QuoteList(reporters) + ")"
 	clean := reReporterClause.ReplaceAllString(jql, "")
 	clean = normalizeClause(clean)
 	if clean == "" {
@@ -1447,7 +1565,7 @@ func overrideAssigneeClause(jql string, assignees []string) string {
 	if len(assignees) == 0 {
 		return jql
 	}
-	newClause := "assignee in (" + quoteList(assignees) + ")"
+	newClause := "assignee in (" + nlq.QuoteList(assignees) + ")"
 	clean := reAssigneeClause.ReplaceAllString(jql, "")
 	clean = normalizeClause(clean)
 	if clean == "" {
@@ -1456,15 +1574,6 @@ func overrideAssigneeClause(jql string, assignees []string) string {
 	return clean + " AND " + newClause
 }
 
-// boardForProject returns the first scrum board id for the project, if any.
-func (h *apiHandler) boardForProject(ctx context.Context, projectKey string) (int, bool) {
-	boards, status, err := h.jira.BoardsForProject(ctx, projectKey)
-	if err != nil || status >= 400 || len(boards) == 0 {
-		return 0, false
-	}
-	return boards[0].ID, true
-}
-
 func trimLeadingLogical(s string) string {
 	s = strings.TrimSpace(s)
 	for {
@@ -1516,9 +1625,11 @@ func extractTotal(raw json.RawMessage) int {
 }
 
 type issueLink struct {
-	Key   string `json:"key"`
-	Title string `json:"title"`
-	URL   string `json:"url"`
+	Key      string `json:"key"`
+	Title    string `json:"title"`
+	URL      string `json:"url"`
+	Status   string `json:"status,omitempty"`
+	Assignee string `json:"assignee,omitempty"`
 }
 
 func extractIssueLinks(raw json.RawMessage, base string) []issueLink {
@@ -1528,6 +1639,12 @@ func extractIssueLinks(raw json.RawMessage, base string) []issueLink {
 			Key    string `json:"key"`
 			Fields struct {
 				Summary string `json:"summary"`
+				Status  struct {
+					Name string `json:"name"`
+				} `json:"status"`
+				Assignee *struct {
+					DisplayName string `json:"displayName"`
+				} `json:"assignee"`
 			} `json:"fields"`
 		} `json:"issues"`
 	}
@@ -1537,11 +1654,16 @@ func extractIssueLinks(raw json.RawMessage, base string) []issueLink {
 	out := make([]issueLink, 0, len(tmp.Issues))
 	for _, iss := range tmp.Issues {
 		url := strings.TrimRight(base, "/") + "/browse/" + iss.Key
-		out = append(out, issueLink{
-			Key:   iss.Key,
-			Title: iss.Fields.Summary,
-			URL:   url,
-		})
+		link := issueLink{
+			Key:    iss.Key,
+			Title:  iss.Fields.Summary,
+			URL:    url,
+			Status: iss.Fields.Status.Name,
+		}
+		if iss.Fields.Assignee != nil {
+			link.Assignee = iss.Fields.Assignee.DisplayName
+		}
+		out = append(out, link)
 	}
 	return out
 }
@@ -1637,23 +1759,6 @@ func cleanJQL(jql string) string {
 	return strings.TrimSpace(jql)
 }
 
-func parseSprintNumber(text string) int {
-	re := regexp.MustCompile(`(?i)(спринт|sprint)\s*([0-9]+)|([0-9]+)\s*(спринт|sprint)`)
-	m := re.FindStringSubmatch(text)
-	if len(m) == 0 {
-		return 0
-	}
-	if m[2] != "" {
-		n, _ := strconv.Atoi(m[2])
-		return n
-	}
-	if m[3] != "" {
-		n, _ := strconv.Atoi(m[3])
-		return n
-	}
-	return 0
-}
-
 // fetchSprintByNumber finds a sprint by numeric hint (id or number in the name) across active/future/closed.
 func (h *apiHandler) fetchSprintByNumber(ctx context.Context, boardID, num int) (*dateRange, error) {
 	states := []string{"active", "future", "closed"}
@@ -1685,36 +1790,20 @@ func (h *apiHandler) fetchSprintByID(ctx context.Context, sprintID int) (*dateRa
 	return &dateRange{Start: sp.StartDate, End: sp.EndDate}, nil
 }
 
-// filterProjects removes projects by key.
+// filterProjects removes the projects listed in projects.hidden.
 func filterProjects(raw []struct {
 	Key  string `json:"key"`
 	Name string `json:"name"`
-}) []struct {
+}, policy *config.Policy) []struct {
 	Key  string `json:"key"`
 	Name string `json:"name"`
 } {
-	block := map[string]struct{}{
-		"AMP":   {},
-		"CONE":  {},
-		"COR":   {},
-		"CRED":  {},
-		"DEEP":  {},
-		"TP":    {},
-		"IC":    {},
-		"SEC":   {},
-		"MS":    {},
-		"QAD":   {},
-		"SEN":   {},
-		"SIMTW": {},
-		"TDS":   {},
-		"WU":    {},
-	}
 	out := make([]struct {
 		Key  string `json:"key"`
 		Name string `json:"name"`
 	}, 0, len(raw))
 	for _, p := range raw {
-		if _, banned := block[p.Key]; banned {
+		if policy.ProjectHidden(p.Key) {
 			continue
 		}
 		out = append(out, p)
@@ -1747,11 +1836,15 @@ func respondError(w http.ResponseWriter, status int, err error, jql string) {
 }
 
 func respondErrorWithBody(w http.ResponseWriter, status int, err error, body []byte, jql string) {
-	msg := err.Error()
-	if len(body) > 0 {
-		msg = fmt.Sprintf("%s: %s", msg, trimBody(body, 400))
+	respondError(w, status, withBody(err, body), jql)
+}
+
+// withBody appends the start of an upstream response body to err.
+func withBody(err error, body []byte) error {
+	if len(body) == 0 {
+		return err
 	}
-	respondError(w, status, errors.New(msg), jql)
+	return fmt.Errorf("%s: %s", err.Error(), trimBody(body, 400))
 }
 
 func trimBody(b []byte, max int) string {
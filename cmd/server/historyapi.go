@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/history"
+)
+
+// historyList handles GET /api/history: one page of entries, newest first.
+// Parameters: limit, cursor (nextCursor of the previous page), q (query or
+// title substring), jql, tag, pinned=1, from/to (YYYY-MM-DD, inclusive).
+func (h *apiHandler) historyList() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		params := r.URL.Query()
+		f := history.Filter{
+			Query:  strings.TrimSpace(params.Get("q")),
+			JQL:    strings.TrimSpace(params.Get("jql")),
+			Tag:    strings.TrimSpace(params.Get("tag")),
+			Cursor: params.Get("cursor"),
+		}
+		f.Pinned, _ = strconv.ParseBool(params.Get("pinned"))
+		f.Limit, _ = strconv.Atoi(params.Get("limit"))
+		var err error
+		if f.From, f.To, err = dayRange(params); err != nil {
+			respondError(w, http.StatusBadRequest, err, "")
+			return
+		}
+		page, err := h.history.List(f)
+		if errors.Is(err, history.ErrBadCursor) {
+			respondError(w, http.StatusBadRequest, err, "")
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err, "")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(page)
+	})
+}
+
+// historyPatch is the body of PATCH /api/history/{id}; omitted fields are
+// left as they are.
+type historyPatch struct {
+	Title  *string   `json:"title"`
+	Pinned *bool     `json:"pinned"`
+	Tags   *[]string `json:"tags"`
+}
+
+// handleHistoryEntry serves /api/history/{id}: GET returns the entry, PATCH
+// renames, pins or re-tags it and DELETE removes it.
+func (h *apiHandler) handleHistoryEntry(w http.ResponseWriter, r *http.Request, entry history.Entry) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(entry)
+	case http.MethodPatch:
+		var req historyPatch
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, err, "")
+			return
+		}
+		saved, err := h.history.Modify(entry.ID, func(e *history.Entry) error {
+			if req.Title != nil {
+				e.Title = strings.TrimSpace(*req.Title)
+			}
+			if req.Pinned != nil {
+				e.Pinned = *req.Pinned
+			}
+			if req.Tags != nil {
+				e.Tags = history.NormalizeTags(*req.Tags)
+			}
+			return nil
+		})
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err, "")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(saved)
+	case http.MethodDelete:
+		if err := h.history.Delete(entry.ID); err != nil {
+			respondError(w, http.StatusInternalServerError, err, "")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// dayRange parses the from/to query parameters (YYYY-MM-DD) into a
+// half-open range; to is inclusive, so the range ends a day after it.
+func dayRange(params url.Values) (from, to time.Time, err error) {
+	for name, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		v := params.Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("%s must be YYYY-MM-DD", name)
+		}
+		*dst = t
+	}
+	if !to.IsZero() {
+		to = to.AddDate(0, 0, 1)
+	}
+	return from, to, nil
+}
@@ -1,49 +1,166 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"path/filepath"
 	"time"
 
+	"github.com/alekseymerzlyakov/jira/internal/analysis"
+	"github.com/alekseymerzlyakov/jira/internal/auth"
 	"github.com/alekseymerzlyakov/jira/internal/config"
+	"github.com/alekseymerzlyakov/jira/internal/conversation"
 	"github.com/alekseymerzlyakov/jira/internal/history"
 	"github.com/alekseymerzlyakov/jira/internal/jira"
 	"github.com/alekseymerzlyakov/jira/internal/llm"
+	"github.com/alekseymerzlyakov/jira/internal/meta"
+	"github.com/alekseymerzlyakov/jira/internal/nlq"
+	"github.com/alekseymerzlyakov/jira/internal/notify"
 	"github.com/alekseymerzlyakov/jira/internal/phrases"
+	"github.com/alekseymerzlyakov/jira/internal/plan"
+	"github.com/alekseymerzlyakov/jira/internal/saved"
+	"github.com/alekseymerzlyakov/jira/internal/semantic"
+	"github.com/alekseymerzlyakov/jira/internal/users"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := runConfigCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("load config: %v", err)
 	}
+	policy, err := config.OpenPolicy(cfg.ConfigFile)
+	if err != nil {
+		log.Fatalf("config file: %v", err)
+	}
+	if cfg.ConfigFile != "" {
+		log.Printf("policy loaded from %s", cfg.ConfigFile)
+	}
 
 	jiraClient := jira.NewClient(cfg.JiraHost, cfg.JiraUser, cfg.JiraPassword)
-	historyStore := history.NewStore(filepath.Join(cfg.DataDir, "history.json"))
+	historyStore, err := openHistory(cfg, cfg.DataDir)
+	if err != nil {
+		log.Fatalf("history: %v", err)
+	}
+	defer historyStore.Close()
 	phrasesStore := phrases.NewStore(filepath.Join(cfg.DataDir, "phrases.json"))
-	llmClient := llm.NewOpenAI(cfg.OpenAIKey, cfg.OpenAIModel)
+	catalog, err := meta.LoadCatalog(cfg.DataDir)
+	if err != nil {
+		log.Printf("metadata catalog unavailable: %v", err)
+	}
+	dict, err := nlq.LoadDictionary(filepath.Join(cfg.DataDir, "nlq_synonyms.json"))
+	if err != nil {
+		log.Printf("nlq synonyms: %v (using defaults)", err)
+	}
+	llmRegistry := newLLMRegistry(cfg)
+	if catalog != nil {
+		llmRegistry.SetGrounding(catalog)
+	}
 
 	mux := http.NewServeMux()
 	api := &apiHandler{
 		jira:         jiraClient,
-		history:      historyStore,
 		phrasesStore: phrasesStore,
-		llm:          llmClient,
+		llm:          llmRegistry,
+		catalog:      catalog,
+		nlq:          nlq.New(dict, catalog),
 		boardID:      cfg.BoardID,
+		chunkTokens:  cfg.AnalysisChunkTokens,
+		deep: analysis.DeepPipeline{
+			Concurrency: cfg.DeepConcurrency,
+			MaxIssues:   cfg.DeepMaxIssues,
+			StaleDays:   cfg.StaleDays,
+		},
+		testCaseMaxIssues: cfg.TestCaseMaxIssues,
+		memory:            conversation.Memory{MaxTokens: cfg.ThreadMaxTokens},
+		semanticFallback:  semantic.NewIndex(semantic.NewHashing(0), ""),
+		saved:             saved.NewStore(filepath.Join(cfg.DataDir, "saved_searches.json")),
+		notifiers:         newNotifiers(cfg),
+		savedRuns:         &runLocks{},
+		notifyEvents:      cfg.NotifyEvents,
+		policy:            policy,
+		settings:          cfg.Redacted(),
+	}
+	emb := newEmbedder(cfg)
+	if emb != nil {
+		api.semantic = semantic.NewIndex(emb, filepath.Join(cfg.DataDir, "semantic_index.json"))
 	}
+	api.history = withIndexes(historyStore, api.semantic, api.semanticFallback)
+	if cfg.MultiUser {
+		key, err := usersKey(cfg)
+		if err != nil {
+			log.Fatalf("users key: %v", err)
+		}
+		api.users, err = users.OpenStore(filepath.Join(cfg.DataDir, "users.json"), key)
+		if err != nil {
+			log.Fatalf("users: %v", err)
+		}
+		migrateUserDirs(cfg.DataDir, api.users.List())
+		api.spaces = &userSpaces{cfg: cfg, embedder: emb}
+		defer api.spaces.close()
+		log.Printf("multi-user mode: %d known users", len(api.users.List()))
+	}
+	api.sessions = users.NewSessions(time.Duration(cfg.SessionTTLHours) * time.Hour)
+	api.authRequired = cfg.AuthRequired
+	api.tokens, err = auth.NewTokenStore(cfg.APITokensFile)
+	if err != nil {
+		log.Fatalf("api tokens: %v", err)
+	}
+	allow, err := auth.ParseAllowlist(cfg.AuthAllowIPs)
+	if err != nil {
+		log.Fatalf("AUTH_ALLOW_IPS: %v", err)
+	}
+	if !cfg.AuthRequired {
+		log.Printf("AUTH_REQUIRED is off: the API is open to anyone who can reach %s", cfg.Addr)
+	}
+	authn := &authenticator{required: cfg.AuthRequired, sessions: api.sessions, tokens: api.tokens, allow: allow}
+
+	api.boards = newBoardResolver()
+	api.boardChoices, err = loadBoardChoices(filepath.Join(cfg.DataDir, "board_choices.json"))
+	if err != nil {
+		log.Fatalf("boards: %v", err)
+	}
+
+	api.plans = api.newPlanRegistry()
+	user := api.perUser
 	mux.Handle("/api/health", api.health())
-	mux.Handle("/api/myself", api.myself())
-	mux.Handle("/api/projects", api.projects())
-	mux.Handle("/api/search", api.search())
-	mux.Handle("/api/phrases", api.phrases())
-	mux.Handle("/api/worklog/command", api.worklogCommand())
-	mux.Handle("/api/worklog/autofill", api.worklogAutofill())
-	mux.Handle("/api/projects/", api.projectSprints())
-	mux.Handle("/api/history", api.historyList())
-	mux.Handle("/api/history/", api.historyItem())
+	mux.Handle("/api/login", api.loginHandler())
+	mux.Handle("/api/logout", api.logoutHandler())
+	mux.Handle("/api/session", api.sessionInfo())
+	mux.Handle("/api/tokens", api.apiTokens())
+	mux.Handle("/api/tokens/", api.apiToken())
+	mux.Handle("/api/config", api.configView())
+	mux.Handle("/api/myself", user((*apiHandler).myself))
+	mux.Handle("/api/projects", user((*apiHandler).projects))
+	mux.Handle("/api/search", user((*apiHandler).search))
+	mux.Handle("/api/search/stream", user((*apiHandler).searchStream))
+	mux.Handle("/api/phrases", user((*apiHandler).phrases))
+	mux.Handle("/api/worklog/command", user((*apiHandler).worklogCommand))
+	mux.Handle("/api/worklog/autofill", user((*apiHandler).worklogAutofill))
+	mux.Handle("/api/worklog/timesheet", user((*apiHandler).worklogTimesheet))
+	mux.Handle("/api/projects/", user((*apiHandler).projectSprints))
+	mux.Handle("/api/sprints/", user((*apiHandler).sprintReport))
+	mux.Handle("/api/history", user((*apiHandler).historyList))
+	mux.Handle("/api/history/", user((*apiHandler).historyItem))
+	mux.Handle("/api/history/search", user((*apiHandler).historySemanticSearch))
+	mux.Handle("/api/llm/providers", api.llmProviders())
+	mux.Handle("/api/plan", user((*apiHandler).planPreview))
+	mux.Handle("/api/testcases", user((*apiHandler).testCases))
+	mux.Handle("/api/saved", user((*apiHandler).savedSearches))
+	mux.Handle("/api/saved/", user((*apiHandler).savedSearchItem))
 
 	// Static files from web directory.
 	fs := http.FileServer(http.Dir(cfg.WebDir))
@@ -57,16 +174,144 @@ func main() {
 
 	server := &http.Server{
 		Addr:              cfg.Addr,
-		Handler:           withLogging(mux),
+		Handler:           withLogging(withAuth(mux, authn)),
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
+	go api.runScheduler(context.Background())
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go policy.Watch(context.Background(), 2*time.Second, hup)
+	chatBot, err := newBot(cfg.BotTransport, cfg.TelegramBotToken, cfg.TelegramAPIURL, cfg.BotUsersFile, api)
+	if err != nil {
+		log.Printf("bot disabled: %v", err)
+	} else if chatBot != nil {
+		go func() { _ = chatBot.Run(context.Background()) }()
+		log.Printf("bot: listening on %s", cfg.BotTransport)
+	}
+
 	log.Printf("listening on %s", cfg.Addr)
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("server: %v", err)
 	}
 }
 
+// newLLMRegistry registers every provider and picks the default: LLM_PROVIDER if
+// set, otherwise the first one with credentials. The fake is always available
+// for per-request use but never chosen implicitly.
+func newLLMRegistry(cfg config.Config) *llm.Registry {
+	reg := llm.NewRegistry()
+	reg.Register("openai", cfg.OpenAIModel, llm.OpenAIFactory(cfg.OpenAIBaseURL, cfg.OpenAIKey))
+	reg.Register("anthropic", cfg.AnthropicModel, llm.AnthropicFactory(cfg.AnthropicKey))
+	reg.Register("local", cfg.LocalLLMModel, llm.OpenAIFactory(cfg.LocalLLMURL, ""))
+	reg.Register("fake", "", llm.FakeFactory())
+
+	switch {
+	case cfg.LLMProvider != "":
+		reg.SetDefault(cfg.LLMProvider)
+	case cfg.OpenAIKey != "":
+		reg.SetDefault("openai")
+	case cfg.AnthropicKey != "":
+		reg.SetDefault("anthropic")
+	case cfg.LocalLLMURL != "":
+		reg.SetDefault("local")
+	}
+	return reg
+}
+
+// newEmbedder returns the model-backed embedder for semantic history search,
+// or nil when the offline hashing embedder is configured.
+func newEmbedder(cfg config.Config) semantic.Embedder {
+	switch cfg.EmbeddingsProvider {
+	case "openai":
+		if cfg.OpenAIKey == "" {
+			log.Printf("EMBEDDINGS_PROVIDER=openai needs OPENAI_API_KEY; using hashing")
+			return nil
+		}
+		return semantic.NewOpenAIEmbedder(cfg.OpenAIBaseURL, cfg.OpenAIKey, cfg.EmbeddingsModel)
+	case "local":
+		if cfg.LocalLLMURL == "" {
+			log.Printf("EMBEDDINGS_PROVIDER=local needs LOCAL_LLM_BASE_URL; using hashing")
+			return nil
+		}
+		model := cfg.EmbeddingsModel
+		if model == "" {
+			model = "nomic-embed-text"
+		}
+		return semantic.NewOpenAIEmbedder(cfg.LocalLLMURL, "", model)
+	case "", "hash":
+		return nil
+	}
+	log.Printf("unknown EMBEDDINGS_PROVIDER %q; using hashing", cfg.EmbeddingsProvider)
+	return nil
+}
+
+// newNotifiers registers the outbox and whichever other channels are
+// configured.
+func newNotifiers(cfg config.Config) *notify.Registry {
+	reg := notify.NewRegistry()
+	reg.Register("outbox", notify.Outbox{Dir: cfg.NotifyOutboxDir})
+	if cfg.SMTPAddr != "" && len(cfg.SMTPTo) > 0 {
+		reg.Register("smtp", notify.SMTP{
+			Addr:     cfg.SMTPAddr,
+			From:     cfg.SMTPFrom,
+			To:       cfg.SMTPTo,
+			Username: cfg.SMTPUser,
+			Password: cfg.SMTPPassword,
+		})
+	}
+	if cfg.NotifyWebhookURL != "" {
+		reg.Register("webhook", notify.Webhook{URL: cfg.NotifyWebhookURL, Secret: cfg.NotifyWebhookSecret})
+	}
+	if cfg.SlackWebhookURL != "" {
+		reg.Register("slack", notify.Slack{URL: cfg.SlackWebhookURL, Channel: cfg.SlackChannel})
+	}
+	if cfg.TelegramBotToken != "" && cfg.TelegramChatID != "" {
+		reg.Register("telegram", notify.Telegram{
+			Token:   cfg.TelegramBotToken,
+			ChatID:  cfg.TelegramChatID,
+			BaseURL: cfg.TelegramAPIURL,
+		})
+	}
+	return reg
+}
+
+// openHistory opens the configured history backend in dir. The bolt backend
+// imports an existing history.json on first start.
+func openHistory(cfg config.Config, dir string) (history.Storage, error) {
+	retention := history.Retention{
+		MaxEntries: cfg.HistoryMaxEntries,
+		MaxAge:     time.Duration(cfg.HistoryMaxAgeDays) * 24 * time.Hour,
+	}
+	jsonPath := filepath.Join(dir, "history.json")
+	switch cfg.HistoryBackend {
+	case "json":
+		return history.NewStore(jsonPath, retention), nil
+	case "", "bolt":
+	default:
+		return nil, fmt.Errorf("unknown HISTORY_BACKEND %q", cfg.HistoryBackend)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	store, err := history.OpenBolt(filepath.Join(dir, "history.db"), retention)
+	if err != nil {
+		return nil, err
+	}
+	n, err := history.MigrateJSON(jsonPath, store)
+	if err != nil {
+		log.Printf("history migration: %v", err)
+	} else if n > 0 {
+		log.Printf("history: imported %d entries from %s", n, jsonPath)
+	}
+	if n, err := store.Prune(); err != nil {
+		log.Printf("history retention: %v", err)
+	} else if n > 0 {
+		log.Printf("history: removed %d entries by retention policy", n)
+	}
+	return store, nil
+}
+
 func withLogging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -77,8 +322,55 @@ func withLogging(next http.Handler) http.Handler {
 
 type apiHandler struct {
 	jira         *jira.Client
-	history      *history.Store
+	history      history.Storage
 	phrasesStore *phrases.Store
-	llm          *llm.OpenAI
-	boardID      int
+	llm          *llm.Registry
+	catalog      *meta.Catalog
+	nlq          *nlq.Engine
+	boardID      int            // JIRA_BOARD_ID, used when a project has no board
+	boards       *boardResolver // project -> scrum boards, see resolveBoard
+	boardChoices *boardChoices  // boards picked by the user, see projectBoards
+	chunkTokens  int
+	deep         analysis.DeepPipeline // per-issue analysis settings
+	plans        *plan.Registry
+
+	testCaseMaxIssues int
+	memory            conversation.Memory // follow-up thread budget
+	// semantic indexes history with the configured embedder (nil for the
+	// hashing one); semanticFallback always uses hashing and serves searches
+	// when the embedder is unavailable.
+	semantic         *semantic.Index
+	semanticFallback *semantic.Index
+
+	saved     *saved.Store // saved searches, run on demand or by runScheduler
+	savedRuns *runLocks
+	notifiers *notify.Registry
+	// notifyEvents limits the server events sent by notifyEvent; empty
+	// means all.
+	notifyEvents []string
+
+	// Multi-user mode (nil users means single-user): login is the user a
+	// per-request copy acts for, see forUser.
+	users    *users.Store
+	sessions *users.Sessions
+	spaces   *userSpaces
+	login    string
+
+	authRequired bool             // see withAuth
+	tokens       *auth.TokenStore // API tokens for scripts
+
+	// policy is the reloadable team policy (CONFIG_FILE); settings are the
+	// env settings with secrets redacted, shown by /api/config.
+	policy   *config.PolicyStore
+	settings config.Config
+}
+
+// withJira returns a copy of h that talks to Jira through client, for
+// requests made on behalf of another Jira account. Everything else,
+// including the stores, is shared.
+func (h *apiHandler) withJira(client *jira.Client) *apiHandler {
+	cp := *h
+	cp.jira = client
+	cp.plans = cp.newPlanRegistry()
+	return &cp
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/notify"
+)
+
+// Server events pushed through the notifiers.
+const (
+	eventWorklogAutofill = "worklog_autofill"
+	eventWorklogFailed   = "worklog_failed"
+)
+
+// notifyEvent sends msg to every notifier in the background, unless
+// NOTIFY_EVENTS excludes its event. Delivery problems are only logged: they
+// must not fail the request that caused the event.
+func (h *apiHandler) notifyEvent(ctx context.Context, msg notify.Message) {
+	if h.notifiers == nil {
+		return
+	}
+	if len(h.notifyEvents) > 0 && !containsString(h.notifyEvents, msg.Event) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	go func() {
+		defer cancel()
+		if err := h.notifiers.Send(ctx, nil, msg); err != nil {
+			log.Printf("notify %s: %v", msg.Event, err)
+		}
+	}()
+}
+
+// autofillMessage summarises an autofill run that created worklogs.
+func autofillMessage(resp worklogAutofillResponse) notify.Message {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s, %s — %s: создано %d, пропущено %d\n", resp.IssueKey, resp.From, resp.To, resp.Created, resp.Skipped)
+	for _, d := range resp.Days {
+		if d.Action == "create" {
+			fmt.Fprintf(&b, "+ %s %s\n", d.Date, d.TimeSpent)
+		}
+	}
+	return notify.Message{
+		Event:   eventWorklogAutofill,
+		Subject: fmt.Sprintf("Автосписание %s: %d дн.", resp.IssueKey, resp.Created),
+		Text:    strings.TrimRight(b.String(), "\n"),
+		Fields: map[string]string{
+			"issue":   resp.IssueKey,
+			"from":    resp.From,
+			"to":      resp.To,
+			"created": fmt.Sprint(resp.Created),
+		},
+	}
+}
+
+// worklogFailedMessage reports a worklog Jira refused to create.
+func worklogFailedMessage(issueKey, date string, err error) notify.Message {
+	return notify.Message{
+		Event:   eventWorklogFailed,
+		Subject: fmt.Sprintf("Не удалось списать время в %s", issueKey),
+		Text:    fmt.Sprintf("%s за %s: %v", issueKey, date, err),
+		Fields: map[string]string{
+			"issue": issueKey,
+			"date":  date,
+			"error": err.Error(),
+		},
+	}
+}
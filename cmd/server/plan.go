@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/analysis"
+	"github.com/alekseymerzlyakov/jira/internal/history"
+	"github.com/alekseymerzlyakov/jira/internal/llm"
+	"github.com/alekseymerzlyakov/jira/internal/plan"
+)
+
+// issueDetailsLimit bounds how many issues the issue_details step fetches.
+const issueDetailsLimit = 10
+
+// newPlanRegistry registers the step kinds of the stepwise workflow.
+func (h *apiHandler) newPlanRegistry() *plan.Registry {
+	reg := plan.NewRegistry()
+	reg.Register(plan.Kind{
+		Name:        plan.KindDeriveJQL,
+		Title:       "Generate JQL",
+		Description: "derive JQL from the instruction",
+		Run:         h.stepDeriveJQL,
+	})
+	reg.Register(plan.Kind{
+		Name:        plan.KindSearch,
+		Title:       "Execute Jira search",
+		Description: "run the JQL in Jira and collect matching issues",
+		Requires:    []string{plan.KindDeriveJQL},
+		Run:         h.stepSearch,
+	})
+	reg.Register(plan.Kind{
+		Name:        plan.KindIssueDetails,
+		Title:       "Issue details",
+		Description: fmt.Sprintf("fetch description and comments of the first %d issues", issueDetailsLimit),
+		Requires:    []string{plan.KindSearch},
+		Run:         h.stepIssueDetails,
+	})
+	reg.Register(plan.Kind{
+		Name:        plan.KindAnalyze,
+		Title:       "Analysis",
+		Description: "summarize the found issues (LLM)",
+		Requires:    []string{plan.KindSearch},
+		Run:         h.stepAnalyze,
+	})
+	reg.Register(plan.Kind{
+		Name:        plan.KindDeepAnalyze,
+		Title:       "Per-issue analysis",
+		Description: "review every found issue with comments, changelog and links: risks, missing acceptance criteria, staleness, plus an aggregate report (LLM)",
+		Requires:    []string{plan.KindSearch},
+		Run:         h.stepDeepAnalyze,
+	})
+	// No Requires for test cases: the step only needs Entry.Issues, so it can
+	// be re-run on entries created by /api/testcases for a single issue.
+	reg.Register(plan.Kind{
+		Name:        plan.KindTestCases,
+		Title:       "Test cases",
+		Description: "write structured test cases (preconditions, steps, expected result, priority) for the found issues; runs after search (LLM)",
+		Run:         h.stepTestCases,
+	})
+	reg.Register(plan.Kind{
+		Name:        plan.KindFollowUp,
+		Title:       "Follow-up",
+		Description: "produce free-form output from earlier results as the instruction says: test cases, advice, HTML list (LLM)",
+		Requires:    []string{plan.KindSearch},
+		Run:         h.stepFollowUp,
+	})
+	return reg
+}
+
+func (h *apiHandler) stepDeriveJQL(ctx context.Context, st *plan.State, step *history.Step) error {
+	jql, derivation := h.deriveJQL(ctx, st.LLM, st.Entry.Query)
+	if jql == "" {
+		return errors.New("empty jql")
+	}
+	if intents := h.nlq.Parse(st.Entry.Query + " " + jql); intents.Sprint {
+		jql = applySprintRange(jql, h.sprintRange(ctx, nil, intents, 0))
+	}
+	jql = cleanJQL(jql)
+	st.Entry.JQL = jql
+	step.Result = jqlStepResult(jql, derivation)
+	return nil
+}
+
+func (h *apiHandler) stepSearch(ctx context.Context, st *plan.State, step *history.Step) error {
+	max := st.Entry.MaxResults
+	if max <= 0 || max > 300 {
+		max = 300
+	}
+	raw, _, err := h.jira.Search(ctx, st.Entry.JQL, max, nil)
+	if err != nil {
+		return withBody(err, raw)
+	}
+	links := extractIssueLinks(raw, h.jira.BaseURL())
+	st.Entry.Issues = issueLinksToSnapshots(links)
+	step.Description = fmt.Sprintf("Fetched %d issues via Jira", extractTotal(raw))
+	step.Result = raw
+	return nil
+}
+
+func (h *apiHandler) stepIssueDetails(ctx context.Context, st *plan.State, step *history.Step) error {
+	type detail struct {
+		Key    string          `json:"key"`
+		Fields json.RawMessage `json:"fields,omitempty"`
+		Error  string          `json:"error,omitempty"`
+	}
+	issues := st.Entry.Issues
+	if len(issues) > issueDetailsLimit {
+		issues = issues[:issueDetailsLimit]
+	}
+	out := make([]detail, 0, len(issues))
+	for _, iss := range issues {
+		body, err := h.jira.Get(ctx, fmt.Sprintf("/rest/api/2/issue/%s?fields=summary,description,status,issuetype,comment", iss.Key))
+		if err != nil {
+			out = append(out, detail{Key: iss.Key, Error: err.Error()})
+			continue
+		}
+		var payload struct {
+			Fields json.RawMessage `json:"fields"`
+		}
+		_ = json.Unmarshal(body, &payload)
+		out = append(out, detail{Key: iss.Key, Fields: payload.Fields})
+	}
+	step.Description = fmt.Sprintf("Details of %d issue(s)", len(out))
+	step.Result = marshalStepResult(out)
+	return nil
+}
+
+func (h *apiHandler) stepAnalyze(ctx context.Context, st *plan.State, step *history.Step) error {
+	if st.LLM == nil {
+		return llm.ErrNoProvider
+	}
+	pipeline := analysis.Pipeline{Provider: st.LLM, ChunkTokens: h.chunkTokens}
+	res, err := pipeline.Run(ctx, st.Entry.Query, st.Entry.JQL, st.Result(plan.KindSearch))
+	step.Usage = analysis.StepUsage(res.Usage)
+	if err != nil {
+		return err
+	}
+	st.Entry.Analysis = res.Analysis.Text()
+	step.Result = marshalStepResult(res.Analysis)
+	return nil
+}
+
+func (h *apiHandler) stepDeepAnalyze(ctx context.Context, st *plan.State, step *history.Step) error {
+	if st.LLM == nil {
+		return llm.ErrNoProvider
+	}
+	res, err := h.deepPipeline(st.LLM).Run(ctx, st.Entry.Query, snapshotKeys(st.Entry.Issues))
+	step.Usage = analysis.StepUsage(res.Usage)
+	if err != nil {
+		return err
+	}
+	st.Entry.Analysis = res.Report.Text()
+	step.Description = fmt.Sprintf("Reviewed %d issue(s)", len(res.Reviews))
+	step.Result = marshalStepResult(struct {
+		Report  llm.Analysis      `json:"report"`
+		Reviews []llm.IssueReview `json:"reviews"`
+	}{Report: res.Report, Reviews: res.Reviews})
+	return nil
+}
+
+func (h *apiHandler) stepTestCases(ctx context.Context, st *plan.State, step *history.Step) error {
+	if st.LLM == nil {
+		return llm.ErrNoProvider
+	}
+	if len(st.Entry.Issues) == 0 {
+		return errors.New("no issues: run the search step first")
+	}
+	instruction := step.Instruction
+	if instruction == "" {
+		instruction = st.Entry.Query
+	}
+	res, err := h.testCaseGenerator(st.LLM).Run(ctx, instruction, snapshotKeys(st.Entry.Issues))
+	step.Usage = res.Step.Usage
+	step.Description = res.Step.Description
+	step.Result = res.Step.Result
+	return err
+}
+
+func (h *apiHandler) stepFollowUp(ctx context.Context, st *plan.State, step *history.Step) error {
+	if st.LLM == nil {
+		return llm.ErrNoProvider
+	}
+	command := step.Instruction
+	if command == "" {
+		command = st.Entry.Query
+	}
+	var m llm.Meter
+	answer, err := st.LLM.FollowUp(llm.WithMeter(ctx, &m), buildFollowUpContext(*st.Entry), nil, command)
+	step.Usage = analysis.StepUsage(m.Total())
+	if err != nil {
+		return err
+	}
+	step.Result = marshalStepResult(map[string]string{"answer": answer})
+	return nil
+}
+
+type planRequest struct {
+	Query      string `json:"query"`
+	JQL        string `json:"jql"`        // optional: skip JQL derivation
+	MaxResults int    `json:"maxResults"` // optional limit for the search step
+	Provider   string `json:"provider"`
+	Model      string `json:"model"`
+}
+
+type planResponse struct {
+	Entry  history.Entry  `json:"entry"`
+	Source string         `json:"source,omitempty"` // "llm" or "heuristic"
+	Kinds  []llm.StepKind `json:"kinds,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// planPreview handles POST /api/plan: it stores a history entry with pending
+// steps that can be reviewed before POST /api/history/{id}/run executes them.
+// GET lists the registered step kinds.
+func (h *apiHandler) planPreview() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(h.plans.Kinds())
+			return
+		case http.MethodPost:
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var req planRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, errors.New("invalid json"), "")
+			return
+		}
+		req.Query = strings.TrimSpace(req.Query)
+		if req.Query == "" {
+			respondError(w, http.StatusBadRequest, errors.New("query is required"), "")
+			return
+		}
+		provider, err := h.llmFor(req.Provider, req.Model)
+		if err != nil && (req.Provider != "" || req.Model != "") {
+			respondError(w, http.StatusBadRequest, err, "")
+			return
+		}
+		jql := strings.TrimSpace(req.JQL)
+		steps, source := h.plans.Plan(r.Context(), provider, req.Query, jql != "")
+		entry := history.Entry{
+			ID:         history.NewID(),
+			Query:      req.Query,
+			JQL:        jql,
+			MaxResults: req.MaxResults,
+			Steps:      steps,
+			CreatedAt:  time.Now().UTC(),
+		}
+		if err := h.history.Append(entry); err != nil {
+			respondError(w, http.StatusInternalServerError, err, "")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(planResponse{Entry: entry, Source: source, Kinds: h.plans.Kinds()})
+	})
+}
+
+// handlePlanRun executes the pending steps of an entry (stepID empty) or
+// re-runs one step. With stream set, progress is sent as Server-Sent Events.
+func (h *apiHandler) handlePlanRun(w http.ResponseWriter, r *http.Request, entry history.Entry, stepID string, stream bool) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Provider string `json:"provider"`
+		Model    string `json:"model"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, errors.New("invalid json"), "")
+			return
+		}
+	}
+	provider, err := h.llmFor(req.Provider, req.Model)
+	if err != nil && (req.Provider != "" || req.Model != "") {
+		respondError(w, http.StatusBadRequest, err, "")
+		return
+	}
+	exec := plan.Executor{Registry: h.plans, LLM: provider, Save: h.savePlanProgress}
+	ctx := r.Context()
+	var progress *searchProgress
+	if stream {
+		sse, err := newSSEWriter(w)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err, "")
+			return
+		}
+		progress = &searchProgress{sse: sse}
+		exec.Progress = progress.step
+		ctx = progress.tokens(ctx)
+	}
+	if stepID == "" {
+		err = exec.Run(ctx, &entry)
+	} else {
+		err = exec.RunStep(ctx, &entry, stepID)
+	}
+	if stored, ok := h.history.Get(entry.ID); ok {
+		// Pins, renames or thread turns saved during the run.
+		entry = stored
+	}
+	resp := planResponse{Entry: entry}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	if stream {
+		if errors.Is(err, plan.ErrStepNotFound) {
+			progress.sse.fail(err, entry.JQL)
+			return
+		}
+		progress.sse.send(eventResult, resp)
+		return
+	}
+	if errors.Is(err, plan.ErrStepNotFound) {
+		respondError(w, http.StatusNotFound, err, "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// savePlanProgress stores what a plan step produced. Only the fields the
+// executor writes are replaced, so a pin, rename, tag or follow-up saved
+// while the run was in progress survives.
+func (h *apiHandler) savePlanProgress(e history.Entry) error {
+	_, err := h.history.Modify(e.ID, func(stored *history.Entry) error {
+		stored.Steps, stored.JQL, stored.Issues, stored.Analysis = e.Steps, e.JQL, e.Issues, e.Analysis
+		return nil
+	})
+	return err
+}
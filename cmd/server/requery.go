@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/analysis"
+	"github.com/alekseymerzlyakov/jira/internal/history"
+	"github.com/alekseymerzlyakov/jira/internal/llm"
+)
+
+// Follow-up modes of POST /api/history/{id}/action.
+const (
+	modeAuto    = ""        // requery when the command narrows the result down
+	modeAnswer  = "answer"  // answer from the stored snapshot
+	modeRequery = "requery" // refine the JQL and search Jira again
+)
+
+// wantsRequery reports whether a follow-up command filters the earlier result
+// ("покажи только те, что в статусе Done") rather than reshaping it, so it
+// should be answered from fresh Jira data.
+func (h *apiHandler) wantsRequery(command string) bool {
+	q := h.nlq.Parse(command)
+	return q.Refine && q.Structured()
+}
+
+// requery refines the JQL of parent with command, runs it and stores the
+// result as a child entry of parent. The command and a short answer are also
+// added to the parent's thread, so later follow-ups know about the child.
+func (h *apiHandler) requery(ctx context.Context, provider llm.Provider, parent history.Entry, command string, progress *searchProgress) (followUpResponse, error) {
+	asked := time.Now().UTC()
+	var m llm.Meter
+	ctx = llm.WithMeter(ctx, &m)
+	refine := history.Step{Name: "Refine JQL", Description: parent.JQL, Status: "running"}
+	progress.step(refine)
+	jql, derivation := h.refineJQL(ctx, provider, parent.JQL, command)
+	jql = cleanJQL(jql)
+	refine.Description = jql
+	refine.Result = jqlStepResult(jql, derivation)
+	refine.Usage = analysis.StepUsage(m.Total())
+	refine.Status = "completed"
+	progress.step(refine)
+
+	max := parent.MaxResults
+	if max <= 0 || max > 300 {
+		max = 300
+	}
+	search := history.Step{Name: "Execute Jira search", Description: jql, Status: "running"}
+	progress.step(search)
+	raw, _, err := h.jira.Search(ctx, jql, max, nil)
+	if err != nil {
+		search.Status = "failed"
+		progress.step(search)
+		return followUpResponse{JQL: jql}, withBody(err, raw)
+	}
+	links := extractIssueLinks(raw, h.jira.BaseURL())
+	total := extractTotal(raw)
+	search.Description = fmt.Sprintf("Fetched %d issues via Jira", total)
+	search.Result = raw
+	search.Status = "completed"
+	progress.step(search)
+
+	child := history.Entry{
+		ID:         history.NewID(),
+		Query:      command,
+		JQL:        jql,
+		MaxResults: parent.MaxResults,
+		ParentID:   parent.ID,
+		Steps:      []history.Step{refine, search},
+		Issues:     issueLinksToSnapshots(links),
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := h.history.Append(child); err != nil {
+		return followUpResponse{JQL: jql}, err
+	}
+
+	resp := followUpResponse{
+		Result: fmt.Sprintf("Уточнённый JQL: %s\nНайдено задач: %d (новая запись %s)\n%s", jql, total, child.ID, formatIssueLinks(links)),
+		JQL:    jql,
+		Child:  &child,
+		Usage:  analysis.StepUsage(m.Total()),
+	}
+	resp.Thread = h.recordTurns(parent.ID, nil, command, resp.Result, resp.Usage, asked)
+	return resp, nil
+}
+
+// refineJQL narrows baseJQL with the LLM; without one, or when it fails, the
+// command is parsed by nlq and ANDed onto the base query.
+func (h *apiHandler) refineJQL(ctx context.Context, provider llm.Provider, baseJQL, command string) (string, *llm.JQLResult) {
+	if provider != nil {
+		if refined, err := provider.RefineJQL(ctx, baseJQL, command); err == nil {
+			return refined.JQL, &refined
+		}
+	}
+	return andJQL(baseJQL, h.nlq.DeriveJQL(command)), nil
+}
+
+var orderByClause = regexp.MustCompile(`(?i)(^|\s+)order\s+by\s+`)
+
+// findOrderBy returns the position of the ORDER BY clause of jql, ignoring
+// "order by" inside quoted strings, or nil.
+func findOrderBy(jql string) []int {
+	masked := []byte(jql)
+	var quote byte
+	for i := 0; i < len(masked); i++ {
+		c := masked[i]
+		switch {
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote != 0 && c == '\\' && i+1 < len(masked):
+			masked[i], masked[i+1] = '_', '_'
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			masked[i] = '_'
+		}
+	}
+	return orderByClause.FindIndex(masked)
+}
+
+// andJQL combines two queries with AND, keeping the ORDER BY of base.
+func andJQL(base, extra string) string {
+	base, extra = strings.TrimSpace(base), strings.TrimSpace(extra)
+	order := ""
+	if loc := findOrderBy(base); loc != nil {
+		base, order = base[:loc[0]], " ORDER BY "+base[loc[1]:]
+	}
+	if loc := findOrderBy(extra); loc != nil {
+		extra = extra[:loc[0]]
+	}
+	switch {
+	case extra == "":
+		return base + order
+	case base == "":
+		return extra + order
+	}
+	return "(" + base + ") AND (" + extra + ")" + order
+}
+
+func formatIssueLinks(links []issueLink) string {
+	var b strings.Builder
+	for i, l := range links {
+		if i >= 20 {
+			fmt.Fprintf(&b, "… ещё %d\n", len(links)-i)
+			break
+		}
+		fmt.Fprintf(&b, "- %s: %s\n", l.Key, l.Title)
+	}
+	return b.String()
+}
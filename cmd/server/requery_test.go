@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestAndJQL(t *testing.T) {
+	for _, c := range []struct{ base, extra, want string }{
+		{"project = CE", "status = Open", "(project = CE) AND (status = Open)"},
+		{"project = CE ORDER BY created DESC", "status = Open", "(project = CE) AND (status = Open) ORDER BY created DESC"},
+		{"project = CE order  by rank", "assignee = ann ORDER BY key", "(project = CE) AND (assignee = ann) ORDER BY rank"},
+		{"a = 1 OR b = 2", "c = 3", "(a = 1 OR b = 2) AND (c = 3)"},
+		{"  project = CE  ", "", "project = CE"},
+		{"", "status = Open", "status = Open"},
+		{"project = CE ORDER BY created", "  ", "project = CE ORDER BY created"},
+		{"summary ~ \"order by\"", "c = 3", "(summary ~ \"order by\") AND (c = 3)"},
+		{`summary ~ "foo order by bar" ORDER BY key`, "c = 3", `(summary ~ "foo order by bar") AND (c = 3) ORDER BY key`},
+		{`summary ~ 'it\'s order by me'`, `text ~ "a \" order by b"`, `(summary ~ 'it\'s order by me') AND (text ~ "a \" order by b")`},
+		{"ORDER BY created DESC", "status = Open", "status = Open ORDER BY created DESC"},
+	} {
+		if got := andJQL(c.base, c.extra); got != c.want {
+			t.Errorf("andJQL(%q, %q) = %q, want %q", c.base, c.extra, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/history"
+)
+
+// rerunFields are enough to rebuild issue snapshots with their state.
+var rerunFields = []string{"summary", "status", "assignee"}
+
+type rerunResponse struct {
+	Entry   history.Entry     `json:"entry"`
+	Diff    history.IssueDiff `json:"diff"`
+	Since   time.Time         `json:"since"` // when the compared snapshot was taken
+	Summary string            `json:"summary"`
+}
+
+// handleRerun serves POST /api/history/{id}/rerun: it executes the entry's
+// JQL again, diffs the result against the stored snapshot and saves it as a
+// new entry linked through RerunOf.
+func (h *apiHandler) handleRerun(w http.ResponseWriter, r *http.Request, entry history.Entry) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if strings.TrimSpace(entry.JQL) == "" {
+		respondError(w, http.StatusBadRequest, fmt.Errorf("entry %s has no JQL", entry.ID), "")
+		return
+	}
+	resp, status, err := h.rerun(r.Context(), entry)
+	if err != nil {
+		respondError(w, status, err, entry.JQL)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (h *apiHandler) rerun(ctx context.Context, entry history.Entry) (rerunResponse, int, error) {
+	max := entry.MaxResults
+	if max <= 0 || max > 300 {
+		max = 300
+	}
+	raw, status, err := h.jira.Search(ctx, entry.JQL, max, rerunFields)
+	if err != nil {
+		return rerunResponse{}, status, withBody(err, raw)
+	}
+	links := extractIssueLinks(raw, h.jira.BaseURL())
+	current := issueLinksToSnapshots(links)
+	baseline := baselineIssues(entry, h.jira.BaseURL())
+	diff := history.DiffIssues(baseline, current)
+	// Either side cut at the page size cannot tell an issue that left the
+	// result from one that moved past the page.
+	total, baseTotal := extractTotal(raw), extractTotal(findStepResult(entry.Steps, "Execute Jira search"))
+	diff.Truncated = total > len(current) || baseTotal > len(baseline)
+	summary := formatIssueDiff(diff, entry.CreatedAt, len(current), total)
+
+	now := time.Now().UTC()
+	rerun := history.Entry{
+		ID:         history.NewID(),
+		Query:      entry.Query,
+		JQL:        entry.JQL,
+		MaxResults: entry.MaxResults,
+		RerunOf:    entry.ID,
+		Steps: []history.Step{
+			{
+				Name:        "Execute Jira search",
+				Description: fmt.Sprintf("Fetched %d issues via Jira", extractTotal(raw)),
+				Status:      "completed",
+				Result:      raw,
+			},
+			{
+				Name:        "Compare with snapshot",
+				Description: diffStepDescription(diff, entry.CreatedAt),
+				Status:      "completed",
+				Result:      marshalStepResult(diff),
+			},
+		},
+		Issues:    current,
+		Analysis:  summary,
+		CreatedAt: now,
+	}
+	if err := h.history.Append(rerun); err != nil {
+		return rerunResponse{}, http.StatusInternalServerError, err
+	}
+	return rerunResponse{Entry: rerun, Diff: diff, Since: entry.CreatedAt, Summary: summary}, http.StatusOK, nil
+}
+
+// baselineIssues returns the snapshot to compare against. Entries stored
+// before snapshots carried the issue state fall back to the raw search result
+// kept in their steps.
+func baselineIssues(entry history.Entry, base string) []history.IssueSnapshot {
+	for _, iss := range entry.Issues {
+		if iss.Status != "" {
+			return entry.Issues
+		}
+	}
+	if raw := findStepResult(entry.Steps, "Execute Jira search"); len(raw) > 0 {
+		if links := extractIssueLinks(raw, base); len(links) > 0 {
+			return issueLinksToSnapshots(links)
+		}
+	}
+	return entry.Issues
+}
+
+func diffStepDescription(diff history.IssueDiff, since time.Time) string {
+	d := fmt.Sprintf("+%d / -%d / ~%d since %s", len(diff.Added), len(diff.Removed), len(diff.Changed), since.Format(time.RFC3339))
+	if diff.Truncated {
+		d += " (partial result: added/removed unconfirmed)"
+	}
+	return d
+}
+
+// formatIssueDiff renders the diff for the entry's analysis text; fetched
+// and total describe the current page when the diff is truncated.
+func formatIssueDiff(diff history.IssueDiff, since time.Time, fetched, total int) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Изменения с %s UTC: новых %d, пропало %d, изменилось %d\n",
+		since.UTC().Format("02.01.2006 15:04"), len(diff.Added), len(diff.Removed), len(diff.Changed)))
+	if diff.Truncated {
+		b.WriteString(fmt.Sprintf("Выборка неполная (%d из %d): «новые» и «пропавшие» могли просто пересечь границу выборки, это не подтверждено.\n", fetched, total))
+	}
+	if diff.Empty() {
+		b.WriteString("Ничего не изменилось.")
+		return b.String()
+	}
+	for _, s := range diff.Added {
+		b.WriteString(fmt.Sprintf("+ %s %s [%s]\n", s.Key, s.Title, s.Status))
+	}
+	removed := "-"
+	if diff.Truncated {
+		removed = "?"
+	}
+	for _, s := range diff.Removed {
+		b.WriteString(fmt.Sprintf("%s %s %s\n", removed, s.Key, s.Title))
+	}
+	for _, c := range diff.Changed {
+		parts := make([]string, 0, len(c.Changes))
+		for _, ch := range c.Changes {
+			parts = append(parts, fmt.Sprintf("%s: %s → %s", ch.Field, orDash(ch.From), orDash(ch.To)))
+		}
+		b.WriteString(fmt.Sprintf("~ %s %s (%s)\n", c.Issue.Key, c.Issue.Title, strings.Join(parts, ", ")))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "—"
+	}
+	return s
+}
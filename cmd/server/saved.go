@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/history"
+	"github.com/alekseymerzlyakov/jira/internal/notify"
+	"github.com/alekseymerzlyakov/jira/internal/saved"
+)
+
+// savedSearchTag marks history entries produced by saved searches.
+const savedSearchTag = "saved-search"
+
+type savedRunResponse struct {
+	Search  saved.Search `json:"search"`
+	EntryID string       `json:"entryId,omitempty"`
+	Total   int          `json:"total"`
+	Notify  string       `json:"notifyError,omitempty"`
+}
+
+// savedSearches handles /api/saved: GET lists saved searches with the
+// configured notifiers, POST creates one.
+func (h *apiHandler) savedSearches() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"searches":  h.saved.List(),
+				"notifiers": h.notifiers.Names(),
+			})
+		case http.MethodPost:
+			var s saved.Search
+			if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+				respondError(w, http.StatusBadRequest, err, "")
+				return
+			}
+			s.ID = history.NewID()
+			s.CreatedAt = time.Now().UTC()
+			s.LastRun, s.LastEntryID, s.LastError = nil, "", ""
+			h.putSavedSearch(w, s, http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// savedSearchItem handles /api/saved/{id} (GET, PUT, DELETE) and
+// POST /api/saved/{id}/run.
+func (h *apiHandler) savedSearchItem() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/saved/"), "/"), "/")
+		current, ok := h.saved.Get(parts[0])
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if len(parts) == 2 && parts[1] == "run" {
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			resp, err := h.runSavedSearch(r.Context(), current)
+			if err != nil {
+				respondError(w, http.StatusBadGateway, err, "")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(resp)
+			return
+		}
+		if len(parts) != 1 {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(current)
+		case http.MethodPut:
+			var s saved.Search
+			if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+				respondError(w, http.StatusBadRequest, err, "")
+				return
+			}
+			s.ID, s.CreatedAt = current.ID, current.CreatedAt
+			s.LastRun, s.LastEntryID, s.LastError = current.LastRun, current.LastEntryID, current.LastError
+			h.putSavedSearch(w, s, http.StatusOK)
+		case http.MethodDelete:
+			if err := h.saved.Delete(current.ID); err != nil {
+				respondError(w, http.StatusInternalServerError, err, "")
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (h *apiHandler) putSavedSearch(w http.ResponseWriter, s saved.Search, status int) {
+	s.Name = strings.TrimSpace(s.Name)
+	s.Schedule = strings.TrimSpace(s.Schedule)
+	if err := s.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err, "")
+		return
+	}
+	for _, name := range s.Notify {
+		if !containsString(h.notifiers.Names(), name) {
+			respondError(w, http.StatusBadRequest, fmt.Errorf("notifier %q is not configured", name), "")
+			return
+		}
+	}
+	if err := h.saved.Put(s); err != nil {
+		respondError(w, http.StatusInternalServerError, err, "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(s)
+}
+
+// runSavedSearch executes a saved search like /api/search, labels the history
+// entry with the search name and sends the result to the notifiers. A failed
+// delivery is reported but does not fail the run.
+func (h *apiHandler) runSavedSearch(ctx context.Context, s saved.Search) (savedRunResponse, error) {
+	unlock, ok := h.savedRuns.lock(s.ID)
+	if !ok {
+		return savedRunResponse{}, fmt.Errorf("saved search %q is already running", s.Name)
+	}
+	defer unlock()
+
+	req := searchRequest{
+		Query:    s.Query,
+		JQL:      s.JQL,
+		Projects: s.Projects,
+		Users:    s.Users,
+		SprintID: s.SprintID,
+		Analysis: s.Analysis,
+		Provider: s.Provider,
+		Model:    s.Model,
+		// Nobody is there to confirm a low-confidence JQL.
+		Confirmed: true,
+	}
+	started := time.Now().UTC()
+	resp, serr := h.runSearch(ctx, req, nil)
+	if serr != nil {
+		err := serr.err
+		if serr.jql != "" {
+			err = fmt.Errorf("%w (jql: %s)", serr.err, serr.jql)
+		}
+		_ = h.saved.MarkRun(s.ID, started, "", err)
+		notifyErr := h.notifiers.Send(ctx, s.Notify, notify.Message{
+			Event:   "saved_search_failed",
+			Subject: fmt.Sprintf("%s: ошибка", s.Name),
+			Text:    err.Error(),
+			Fields:  map[string]string{"savedSearchId": s.ID},
+		})
+		if notifyErr != nil {
+			log.Printf("saved search %s: notify: %v", s.ID, notifyErr)
+		}
+		return savedRunResponse{}, err
+	}
+	if _, err := h.history.Modify(resp.HistoryID, func(e *history.Entry) error {
+		e.Title = s.Name
+		e.Tags = history.NormalizeTags(append(e.Tags, savedSearchTag))
+		return nil
+	}); err != nil {
+		log.Printf("saved search %s: label entry: %v", s.ID, err)
+	}
+	out := savedRunResponse{EntryID: resp.HistoryID, Total: resp.Total}
+	if err := h.notifiers.Send(ctx, s.Notify, savedSearchMessage(s, resp)); err != nil {
+		log.Printf("saved search %s: notify: %v", s.ID, err)
+		out.Notify = err.Error()
+	}
+	_ = h.saved.MarkRun(s.ID, started, resp.HistoryID, nil)
+	out.Search, _ = h.saved.Get(s.ID)
+	return out, nil
+}
+
+func savedSearchMessage(s saved.Search, resp searchResponse) notify.Message {
+	var b strings.Builder
+	if resp.Analysis != "" {
+		b.WriteString(resp.Analysis)
+		b.WriteString("\n\n")
+	}
+	fmt.Fprintf(&b, "Найдено задач: %d\n", resp.Total)
+	b.WriteString(formatIssueLinks(resp.Issues))
+	fmt.Fprintf(&b, "\nJQL: %s\nЗапись истории: %s", resp.JQL, resp.HistoryID)
+	return notify.Message{
+		Event:   "saved_search",
+		Subject: fmt.Sprintf("%s: %d задач", s.Name, resp.Total),
+		Text:    b.String(),
+		Fields: map[string]string{
+			"savedSearchId": s.ID,
+			"historyId":     resp.HistoryID,
+			"jql":           resp.JQL,
+			"total":         fmt.Sprint(resp.Total),
+		},
+	}
+}
+
+// runScheduler checks the saved searches every minute and runs the due ones,
+// one at a time, until ctx is cancelled. Schedules are evaluated in the
+// policy time zone like the rest of the worklog logic; in multi-user mode
+// each user's searches run with that user's credentials.
+func (h *apiHandler) runScheduler(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			loc := h.policy.Get().Location()
+			for _, uh := range h.scheduledHandlers() {
+				for _, s := range uh.saved.List() {
+					if !s.Due(now, loc) {
+						continue
+					}
+					if _, err := uh.runSavedSearch(ctx, s); err != nil {
+						log.Printf("scheduler: %s: %v", s.Name, err)
+					}
+				}
+			}
+		}
+	}
+}
+
+// runLocks keeps one run per saved search at a time.
+type runLocks struct {
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+func (l *runLocks) lock(id string) (unlock func(), ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.running[id] {
+		return nil, false
+	}
+	if l.running == nil {
+		l.running = make(map[string]bool)
+	}
+	l.running[id] = true
+	return func() {
+		l.mu.Lock()
+		delete(l.running, id)
+		l.mu.Unlock()
+	}, true
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
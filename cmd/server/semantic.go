@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alekseymerzlyakov/jira/internal/history"
+	"github.com/alekseymerzlyakov/jira/internal/semantic"
+)
+
+type semanticHit struct {
+	semantic.Hit
+	Query string `json:"query"`
+	Title string `json:"title,omitempty"`
+	JQL   string `json:"jql"`
+}
+
+type semanticResponse struct {
+	Hits     []semanticHit `json:"hits"`
+	Embedder string        `json:"embedder"`          // index that answered
+	Warning  string        `json:"warning,omitempty"` // why the fallback was used
+}
+
+// historySemanticSearch handles GET /api/history/search?q=...&limit=&from=&to=:
+// it finds history entries by meaning across queries, analyses, follow-up
+// threads and issue titles/descriptions. from/to are YYYY-MM-DD; without them
+// a time phrase in q ("в прошлом месяце") limits the dates.
+func (h *apiHandler) historySemanticSearch() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		params := r.URL.Query()
+		query := strings.TrimSpace(params.Get("q"))
+		if query == "" {
+			respondError(w, http.StatusBadRequest, errors.New("q is required"), "")
+			return
+		}
+		opts := semantic.Options{}
+		opts.Limit, _ = strconv.Atoi(params.Get("limit"))
+		var err error
+		if opts.From, opts.To, err = dayRange(params); err != nil {
+			respondError(w, http.StatusBadRequest, err, "")
+			return
+		}
+
+		resp := semanticResponse{Embedder: h.semanticFallback.Embedder()}
+		var hits []semantic.Hit
+		if h.semantic != nil {
+			if err = h.semantic.Refresh(r.Context(), h.history); err == nil {
+				hits, err = h.semantic.Search(r.Context(), query, opts)
+			}
+			if err == nil {
+				resp.Embedder = h.semantic.Embedder()
+			} else {
+				log.Printf("semantic search: %v (falling back to hashing)", err)
+				resp.Warning = "embedder unavailable, used the offline index: " + err.Error()
+			}
+		}
+		if h.semantic == nil || err != nil {
+			if err = h.semanticFallback.Refresh(r.Context(), h.history); err == nil {
+				hits, err = h.semanticFallback.Search(r.Context(), query, opts)
+			}
+			if err != nil {
+				respondError(w, http.StatusBadRequest, err, "")
+				return
+			}
+		}
+
+		resp.Hits = make([]semanticHit, 0, len(hits))
+		for _, hit := range hits {
+			e, ok := h.history.Get(hit.EntryID)
+			if !ok {
+				// Pruned by retention: drop it on the next refresh.
+				h.touchIndexes(hit.EntryID)
+				continue
+			}
+			resp.Hits = append(resp.Hits, semanticHit{Hit: hit, Query: e.Query, Title: e.Title, JQL: e.JQL})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
+
+func (h *apiHandler) touchIndexes(id string) {
+	for _, ix := range []*semantic.Index{h.semantic, h.semanticFallback} {
+		if ix != nil {
+			ix.Touch(id)
+		}
+	}
+}
+
+// indexedHistory tells the semantic indexes about every entry written or
+// deleted, so a search only embeds what changed since the previous one.
+// Entries dropped by retention are noticed when a hit points at them.
+type indexedHistory struct {
+	history.Storage
+	indexes []*semantic.Index
+}
+
+func withIndexes(s history.Storage, indexes ...*semantic.Index) history.Storage {
+	return indexedHistory{Storage: s, indexes: indexes}
+}
+
+func (s indexedHistory) touch(id string) {
+	for _, ix := range s.indexes {
+		if ix != nil {
+			ix.Touch(id)
+		}
+	}
+}
+
+func (s indexedHistory) Append(e history.Entry) error {
+	err := s.Storage.Append(e)
+	s.touch(e.ID)
+	return err
+}
+
+func (s indexedHistory) Update(e history.Entry) error {
+	err := s.Storage.Update(e)
+	s.touch(e.ID)
+	return err
+}
+
+func (s indexedHistory) Modify(id string, fn func(*history.Entry) error) (history.Entry, error) {
+	e, err := s.Storage.Modify(id, fn)
+	s.touch(id)
+	return e, err
+}
+
+func (s indexedHistory) Delete(id string) error {
+	err := s.Storage.Delete(id)
+	s.touch(id)
+	return err
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alekseymerzlyakov/jira/internal/llm"
+	"github.com/alekseymerzlyakov/jira/internal/sprintreport"
+)
+
+// retroMaxIssues bounds the issues sent to the model with the report.
+const retroMaxIssues = 40
+
+type sprintReportResponse struct {
+	Report            sprintreport.Report `json:"report"`
+	Retrospective     *llm.Analysis       `json:"retrospective,omitempty"`
+	RetrospectiveText string              `json:"retrospectiveText,omitempty"`
+	RetrospectiveErr  string              `json:"retrospectiveError,omitempty"`
+}
+
+// sprintReport serves GET /api/sprints/{id}/report: the sprint report
+// computed from the Agile API and changelogs. ?retro=1 adds a retrospective
+// narrated by the LLM (provider and model pick the backend); it is opt-in
+// because it spends tokens. A failing model does not fail the report.
+func (h *apiHandler) sprintReport() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/sprints/"), "/"), "/")
+		if len(parts) != 2 || parts[1] != "report" {
+			http.NotFound(w, r)
+			return
+		}
+		sprintID, err := strconv.Atoi(parts[0])
+		if err != nil || sprintID <= 0 {
+			respondError(w, http.StatusBadRequest, errors.New("sprint id must be a number"), "")
+			return
+		}
+		sp, status, err := h.jira.GetSprint(r.Context(), sprintID)
+		if err != nil {
+			if status < 400 {
+				status = http.StatusBadGateway
+			}
+			respondError(w, status, fmt.Errorf("get sprint %d: %w", sprintID, err), "")
+			return
+		}
+		field, name := h.storyPointsField()
+		rep, err := sprintreport.Build(r.Context(), h.jira, sprintreport.Input{Sprint: *sp, PointsField: field, PointsName: name})
+		if errors.Is(err, sprintreport.ErrNotStarted) {
+			respondError(w, http.StatusUnprocessableEntity, err, "")
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusBadGateway, err, "")
+			return
+		}
+
+		resp := sprintReportResponse{Report: rep}
+		if r.URL.Query().Get("retro") == "1" {
+			q := r.URL.Query()
+			if retro, err := h.narrateSprint(r, rep, q.Get("provider"), q.Get("model")); err != nil {
+				resp.RetrospectiveErr = err.Error()
+			} else {
+				resp.Retrospective = &retro
+				resp.RetrospectiveText = retro.Text()
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// narrateSprint asks the model for a retrospective. Only the issues worth
+// discussing (added, removed, carried over or re-estimated) go with the
+// numbers.
+func (h *apiHandler) narrateSprint(r *http.Request, rep sprintreport.Report, provider, model string) (llm.Analysis, error) {
+	p, err := h.llmFor(provider, model)
+	if err != nil {
+		return llm.Analysis{}, err
+	}
+	notable := make([]sprintreport.Issue, 0, retroMaxIssues)
+	for _, iss := range rep.Issues {
+		if len(notable) == retroMaxIssues {
+			break
+		}
+		if iss.Added || iss.Removed || !iss.Done || iss.StartPoints != iss.EndPoints {
+			notable = append(notable, iss)
+		}
+	}
+	rep.Issues = notable
+	body, err := json.Marshal(rep)
+	if err != nil {
+		return llm.Analysis{}, err
+	}
+	return p.SprintRetrospective(r.Context(), body)
+}
+
+// storyPointsField returns the story points field id and name: the policy's
+// sprints.storyPointsField, else the catalog field called "Story Points"
+// (or "Story point estimate").
+func (h *apiHandler) storyPointsField() (id, name string) {
+	id = h.policy.Get().Sprints.StoryPointsField
+	if h.catalog == nil {
+		if id != "" {
+			name = "Story Points"
+		}
+		return id, name
+	}
+	for _, f := range h.catalog.Fields {
+		switch {
+		case id != "" && f.ID == id:
+			return f.ID, f.Name
+		case id == "" && (strings.EqualFold(f.Name, "Story Points") || strings.EqualFold(f.Name, "Story point estimate")):
+			return f.ID, f.Name
+		}
+	}
+	if id != "" {
+		name = "Story Points"
+	}
+	return id, name
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/alekseymerzlyakov/jira/internal/history"
+	"github.com/alekseymerzlyakov/jira/internal/llm"
+)
+
+// Server-Sent Events emitted by the streaming endpoints:
+//
+//	step   history.Step, sent when a step starts ("running") and when it ends
+//	token  {"step": name, "delta": text}, LLM output as it is generated
+//	result the same payload the non-streaming endpoint returns
+//	error  {"error": message, "jql": jql}
+const (
+	eventStep   = "step"
+	eventToken  = "token"
+	eventResult = "result"
+	eventError  = "error"
+)
+
+type sseWriter struct {
+	mu sync.Mutex
+	w  http.ResponseWriter
+	f  http.Flusher
+}
+
+func newSSEWriter(w http.ResponseWriter) (*sseWriter, error) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming unsupported")
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	f.Flush()
+	return &sseWriter{w: w, f: f}, nil
+}
+
+func (s *sseWriter) send(event string, data any) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload)
+	s.f.Flush()
+}
+
+func (s *sseWriter) fail(err error, jql string) {
+	s.send(eventError, struct {
+		Error string `json:"error"`
+		JQL   string `json:"jql,omitempty"`
+	}{Error: err.Error(), JQL: jql})
+}
+
+// searchProgress forwards pipeline events to an SSE client. All methods are
+// no-ops on a nil receiver so runSearch can call them unconditionally.
+type searchProgress struct {
+	sse     *sseWriter
+	mu      sync.Mutex
+	current string // step receiving LLM tokens
+}
+
+func (p *searchProgress) step(s history.Step) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.current = s.Name
+	p.mu.Unlock()
+	p.sse.send(eventStep, s)
+}
+
+// stepFunc adapts step for callbacks; it returns nil when nothing listens.
+func (p *searchProgress) stepFunc() func(history.Step) {
+	if p == nil {
+		return nil
+	}
+	return p.step
+}
+
+// tokens returns ctx with an LLM token sink attributed to the current step.
+func (p *searchProgress) tokens(ctx context.Context) context.Context {
+	if p == nil {
+		return ctx
+	}
+	return llm.WithTokens(ctx, func(delta string) {
+		p.mu.Lock()
+		name := p.current
+		p.mu.Unlock()
+		p.sse.send(eventToken, struct {
+			Step  string `json:"step"`
+			Delta string `json:"delta"`
+		}{Step: name, Delta: delta})
+	})
+}
+
+// searchStream is /api/search with progress streamed as Server-Sent Events.
+func (h *apiHandler) searchStream() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var req searchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, errors.New("invalid json"), "")
+			return
+		}
+		sse, err := newSSEWriter(w)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err, "")
+			return
+		}
+		resp, serr := h.runSearch(r.Context(), req, &searchProgress{sse: sse})
+		if serr != nil {
+			sse.fail(serr.err, serr.jql)
+			return
+		}
+		sse.send(eventResult, resp)
+	})
+}
+
+func (h *apiHandler) streamHistoryAction(w http.ResponseWriter, r *http.Request, provider llm.Provider, entry history.Entry, command string, requery bool) {
+	sse, err := newSSEWriter(w)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err, "")
+		return
+	}
+	progress := &searchProgress{sse: sse}
+	if requery {
+		// Refinement reports its own steps; the refined JQL is not streamed.
+		resp, err := h.requery(r.Context(), provider, entry, command, progress)
+		if err != nil {
+			sse.fail(err, resp.JQL)
+			return
+		}
+		sse.send(eventResult, resp)
+		return
+	}
+	step := history.Step{Name: "Follow-up", Description: command, Status: "running"}
+	progress.step(step)
+	resp, err := h.followUp(progress.tokens(r.Context()), provider, entry, command)
+	step.Usage = resp.Usage
+	if err != nil {
+		step.Status = "failed"
+		progress.step(step)
+		sse.fail(fmt.Errorf("llm: %w", err), "")
+		return
+	}
+	step.Status = "completed"
+	progress.step(step)
+	sse.send(eventResult, resp)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/history"
+	"github.com/alekseymerzlyakov/jira/internal/llm"
+	"github.com/alekseymerzlyakov/jira/internal/plan"
+	"github.com/alekseymerzlyakov/jira/internal/testcases"
+)
+
+type testCasesRequest struct {
+	Issue       string `json:"issue"`     // "QA-959" or browse URL, or
+	HistoryID   string `json:"historyId"` // the issues of a history entry
+	Instruction string `json:"instruction"`
+	Provider    string `json:"provider"`
+	Model       string `json:"model"`
+	Attach      bool   `json:"attach"` // add the cases as a comment to each issue
+}
+
+type testCasesResponse struct {
+	Entry    history.Entry     `json:"entry"`
+	Cases    []llm.TestCase    `json:"cases"`
+	Markdown string            `json:"markdown"`
+	Failed   map[string]string `json:"failed,omitempty"`
+	Attached map[string]string `json:"attached,omitempty"` // issue key -> "ok" or error
+}
+
+// testCases handles POST /api/testcases: it writes test cases for one issue
+// or for the issues of a history entry and records them as a test_cases step,
+// so GET /api/history/{id}/testcases?format=... can export them later.
+func (h *apiHandler) testCases() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var req testCasesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, errors.New("invalid json"), "")
+			return
+		}
+		provider, err := h.llmFor(req.Provider, req.Model)
+		if err != nil {
+			respondError(w, http.StatusNotImplemented, err, "")
+			return
+		}
+
+		var entry history.Entry
+		isNew := false
+		switch key := extractIssueKey(req.Issue); {
+		case req.HistoryID != "":
+			var ok bool
+			if entry, ok = h.history.Get(req.HistoryID); !ok {
+				respondError(w, http.StatusNotFound, history.ErrNotFound, "")
+				return
+			}
+			if len(entry.Issues) == 0 {
+				respondError(w, http.StatusUnprocessableEntity, errors.New("history entry has no issues"), entry.JQL)
+				return
+			}
+		case key != "":
+			isNew = true
+			entry = history.Entry{
+				ID:        history.NewID(),
+				Query:     "Тест-кейсы для " + key,
+				JQL:       fmt.Sprintf("key = %s", key),
+				Issues:    []history.IssueSnapshot{{Key: key, URL: strings.TrimRight(h.jira.BaseURL(), "/") + "/browse/" + key}},
+				CreatedAt: time.Now().UTC(),
+			}
+		default:
+			respondError(w, http.StatusBadRequest, errors.New("issue (e.g. QA-959 or browse URL) or historyId is required"), "")
+			return
+		}
+
+		instruction := strings.TrimSpace(req.Instruction)
+		if instruction == "" {
+			instruction = entry.Query
+		}
+		res, err := h.testCaseGenerator(provider).Run(r.Context(), instruction, snapshotKeys(entry.Issues))
+		step := res.Step
+		step.Kind = plan.KindTestCases
+		step.Instruction = strings.TrimSpace(req.Instruction)
+		entry, serr := h.saveTestCaseStep(entry, isNew, step)
+		if err != nil {
+			respondError(w, http.StatusBadGateway, fmt.Errorf("test cases: %w", err), entry.JQL)
+			return
+		}
+		if serr != nil {
+			respondError(w, http.StatusInternalServerError, serr, entry.JQL)
+			return
+		}
+
+		resp := testCasesResponse{Cases: res.Cases, Markdown: testcases.Markdown(res.Cases), Failed: res.Failed}
+		if len(resp.Failed) == 0 {
+			resp.Failed = nil
+		}
+		if req.Attach {
+			resp.Attached = h.attachTestCases(r, res.Cases)
+		}
+		resp.Entry = entry
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// saveTestCaseStep records step, failed or not, on entry: a new entry is
+// appended, an existing one gets the step through Modify so that thread
+// turns, pins or renames saved during generation are kept.
+func (h *apiHandler) saveTestCaseStep(entry history.Entry, isNew bool, step history.Step) (history.Entry, error) {
+	if isNew {
+		step.ID = "s1"
+		entry.Steps = append(entry.Steps, step)
+		return entry, h.history.Append(entry)
+	}
+	stored, err := h.history.Modify(entry.ID, func(e *history.Entry) error {
+		step.ID = fmt.Sprintf("s%d", len(e.Steps)+1)
+		e.Steps = append(e.Steps, step)
+		return nil
+	})
+	if err != nil {
+		return entry, err
+	}
+	return stored, nil
+}
+
+// attachTestCases posts the cases of each issue as one Jira comment.
+func (h *apiHandler) attachTestCases(r *http.Request, cases []llm.TestCase) map[string]string {
+	out := map[string]string{}
+	keys, groups := testcases.ByIssue(cases)
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		body, _, err := h.jira.AddComment(r.Context(), key, testcases.JiraComment(groups[key]))
+		if err != nil {
+			out[key] = withBody(err, body).Error()
+			continue
+		}
+		out[key] = "ok"
+	}
+	return out
+}
+
+// handleTestCaseExport serves GET /api/history/{id}/testcases?format=md|csv|xray|zephyr[&step=sN]
+// from the latest completed test_cases step (or the given one) as a download.
+func (h *apiHandler) handleTestCaseExport(w http.ResponseWriter, r *http.Request, entry history.Entry) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	stepID := r.URL.Query().Get("step")
+	var found *history.Step
+	for i := range entry.Steps {
+		s := &entry.Steps[i]
+		if s.Kind != plan.KindTestCases || s.Status != plan.StatusCompleted {
+			continue
+		}
+		if stepID == "" || s.ID == stepID {
+			found = s
+		}
+	}
+	if found == nil {
+		respondError(w, http.StatusNotFound, errors.New("no test cases in this entry"), "")
+		return
+	}
+	cases, err := testcases.FromStep(found.Result)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err, "")
+		return
+	}
+	body, contentType, ext, err := testcases.Export(cases, r.URL.Query().Get("format"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err, "")
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="testcases-%s.%s"`, entry.ID, ext))
+	_, _ = w.Write(body)
+}
+
+// testCaseGenerator returns the test-case generator configured for this server.
+func (h *apiHandler) testCaseGenerator(provider llm.Provider) testcases.Generator {
+	return testcases.Generator{Provider: provider, Fetcher: h.jira, MaxIssues: h.testCaseMaxIssues}
+}
+
+func snapshotKeys(issues []history.IssueSnapshot) []string {
+	keys := make([]string, 0, len(issues))
+	for _, iss := range issues {
+		keys = append(keys, iss.Key)
+	}
+	return keys
+}
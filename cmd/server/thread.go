@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/analysis"
+	"github.com/alekseymerzlyakov/jira/internal/conversation"
+	"github.com/alekseymerzlyakov/jira/internal/history"
+	"github.com/alekseymerzlyakov/jira/internal/llm"
+)
+
+type followUpResponse struct {
+	Result string          `json:"result"`
+	JQL    string          `json:"jql,omitempty"`   // refined JQL of a requery
+	Child  *history.Entry  `json:"child,omitempty"` // entry stored by a requery
+	Thread *history.Thread `json:"thread,omitempty"`
+	Usage  *history.Usage  `json:"usage,omitempty"`
+}
+
+// followUp answers command within the conversation of entry and records the
+// command and the answer as two turns of its thread.
+func (h *apiHandler) followUp(ctx context.Context, provider llm.Provider, entry history.Entry, command string) (followUpResponse, error) {
+	asked := time.Now().UTC()
+	var m llm.Meter
+	ctx = llm.WithMeter(ctx, &m)
+	memory := h.memory
+	memory.Summarizer = provider
+	// The summary call must not leak into the streamed answer.
+	msgs, summarized, err := memory.Prepare(llm.WithTokens(ctx, nil), entry.Thread)
+	if err != nil {
+		log.Printf("thread %s: summarize: %v", entry.ID, err)
+	}
+	thread := entry.Thread
+	if summarized != nil {
+		thread = summarized
+	}
+	contextText := conversation.WithSummary(buildFollowUpContext(entry), thread)
+	answer, err := provider.FollowUp(ctx, contextText, msgs, command)
+	resp := followUpResponse{Result: answer, Usage: analysis.StepUsage(m.Total())}
+	if err != nil {
+		return resp, err
+	}
+	resp.Thread = h.recordTurns(entry.ID, summarized, command, answer, resp.Usage, asked)
+	return resp, nil
+}
+
+// recordTurns appends a command and its answer to the thread of an entry and
+// returns the saved thread. summarized, when set, carries a new summary made
+// while preparing the command; asked is when the command came in. Failures are
+// logged only: the answer is still useful even if the thread could not be saved.
+func (h *apiHandler) recordTurns(entryID string, summarized *history.Thread, command, answer string, usage *history.Usage, asked time.Time) *history.Thread {
+	now := time.Now().UTC()
+	saved, err := h.history.Modify(entryID, func(e *history.Entry) error {
+		if summarized != nil {
+			if e.Thread == nil {
+				e.Thread = &history.Thread{}
+			}
+			e.Thread.Summary = summarized.Summary
+			e.Thread.Summarized = summarized.Summarized
+		}
+		conversation.Append(e, llm.RoleUser, command, nil, asked)
+		conversation.Append(e, llm.RoleAssistant, answer, usage, now)
+		return nil
+	})
+	if err != nil {
+		log.Printf("thread %s: save: %v", entryID, err)
+		return nil
+	}
+	return saved.Thread
+}
+
+// handleThread serves the conversation of an entry:
+//
+//	GET    /api/history/{id}/thread       the turns and the running summary
+//	DELETE /api/history/{id}/thread       clear the conversation
+//	POST   /api/history/{id}/thread/fork  copy the entry with the first n turns ({"turns": n}, 0 = all)
+func (h *apiHandler) handleThread(w http.ResponseWriter, r *http.Request, entry history.Entry, action string) {
+	if action == "fork" {
+		h.handleThreadFork(w, r, entry)
+		return
+	}
+	if action != "" {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		thread := entry.Thread
+		if thread == nil {
+			thread = &history.Thread{Turns: []history.Turn{}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(thread)
+	case http.MethodDelete:
+		_, err := h.history.Modify(entry.ID, func(e *history.Entry) error {
+			e.Thread = nil
+			return nil
+		})
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err, "")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *apiHandler) handleThreadFork(w http.ResponseWriter, r *http.Request, entry history.Entry) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Turns int `json:"turns"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, errors.New("invalid json"), "")
+			return
+		}
+	}
+	fork := conversation.Fork(entry, req.Turns, time.Now().UTC())
+	if err := h.history.Append(fork); err != nil {
+		respondError(w, http.StatusInternalServerError, err, "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(fork)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/jira"
+	"github.com/alekseymerzlyakov/jira/internal/nlq"
+)
+
+type timesheetRow struct {
+	Date             string `json:"date"` // YYYY-MM-DD in the policy time zone
+	Issue            string `json:"issue"`
+	Summary          string `json:"summary,omitempty"`
+	TimeSpent        string `json:"timeSpent"`
+	TimeSpentSeconds int    `json:"timeSpentSeconds"`
+}
+
+type timesheetResponse struct {
+	User         string         `json:"user"`
+	From         string         `json:"from"`
+	To           string         `json:"to"`
+	TimeZone     string         `json:"timeZone"`
+	Rows         []timesheetRow `json:"rows"`
+	Total        string         `json:"total"`
+	TotalSeconds int            `json:"totalSeconds"`
+}
+
+// worklogTimesheet handles GET /api/worklog/timesheet: the time a user
+// logged per day and issue. from/to (YYYY-MM-DD) default to the current
+// month up to today, user to the Jira account of the server.
+func (h *apiHandler) worklogTimesheet() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		params := r.URL.Query()
+		from, to, err := dayRange(params)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err, "")
+			return
+		}
+		user := strings.TrimSpace(params.Get("user"))
+		if user == "" {
+			user = h.jira.User()
+		}
+		if user == "" {
+			respondError(w, http.StatusBadRequest, errors.New("user is required"), "")
+			return
+		}
+		resp, status, err := h.buildTimesheet(r.Context(), user, from, to)
+		if err != nil {
+			respondError(w, status, err, "")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// buildTimesheet sums user's worklogs per day and issue. from and to are
+// dates as returned by dayRange (to is exclusive); zero values mean the
+// current month and today.
+func (h *apiHandler) buildTimesheet(ctx context.Context, user string, from, to time.Time) (timesheetResponse, int, error) {
+	policy := h.policy.Get()
+	loc := policy.Location()
+	now := time.Now().In(loc)
+	if from.IsZero() {
+		from = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	}
+	if to.IsZero() {
+		to = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+	}
+	first := from.Format("2006-01-02")
+	last := to.AddDate(0, 0, -1).Format("2006-01-02")
+	if last < first {
+		return timesheetResponse{}, http.StatusBadRequest, errors.New("to is before from")
+	}
+
+	jql := fmt.Sprintf(`worklogAuthor = "%s" AND worklogDate >= "%s" AND worklogDate <= "%s" ORDER BY key`, nlq.EscapeQuotes(user), first, last)
+	type issueInfo struct{ key, summary string }
+	var issues []issueInfo
+	const pageSize = 50
+	for startAt := 0; ; {
+		body, status, err := h.jira.SearchWithPaging(ctx, jql, startAt, pageSize, []string{"summary"})
+		if err != nil {
+			return timesheetResponse{}, status, withBody(fmt.Errorf("search: %w", err), body)
+		}
+		var page struct {
+			MaxResults int `json:"maxResults"`
+			Total      int `json:"total"`
+			Issues     []struct {
+				Key    string `json:"key"`
+				Fields struct {
+					Summary string `json:"summary"`
+				} `json:"fields"`
+			} `json:"issues"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return timesheetResponse{}, http.StatusBadGateway, err
+		}
+		for _, is := range page.Issues {
+			issues = append(issues, issueInfo{is.Key, is.Fields.Summary})
+		}
+		startAt += page.MaxResults
+		if page.MaxResults == 0 || startAt >= page.Total {
+			break
+		}
+	}
+
+	type cell struct{ date, issue string }
+	seconds := map[cell]int{}
+	summaries := map[string]string{}
+	for _, is := range issues {
+		summaries[is.key] = is.summary
+		worklogs, status, err := h.jira.ListWorklogs(ctx, is.key)
+		if err != nil {
+			return timesheetResponse{}, status, fmt.Errorf("list worklogs %s: %w", is.key, err)
+		}
+		for _, wl := range worklogs {
+			if !strings.EqualFold(strings.TrimSpace(wl.Author.Name), user) {
+				continue
+			}
+			t, err := jira.ParseJiraTime(wl.Started)
+			if err != nil {
+				continue
+			}
+			day := t.In(loc).Format("2006-01-02")
+			if day < first || day > last {
+				continue
+			}
+			seconds[cell{day, is.key}] += wl.TimeSpentSeconds
+		}
+	}
+
+	resp := timesheetResponse{User: user, From: first, To: last, TimeZone: policy.TimeZone, Rows: []timesheetRow{}}
+	for c, secs := range seconds {
+		resp.Rows = append(resp.Rows, timesheetRow{
+			Date:             c.date,
+			Issue:            c.issue,
+			Summary:          summaries[c.issue],
+			TimeSpent:        formatDuration(secs),
+			TimeSpentSeconds: secs,
+		})
+		resp.TotalSeconds += secs
+	}
+	sort.Slice(resp.Rows, func(i, j int) bool {
+		if resp.Rows[i].Date != resp.Rows[j].Date {
+			return resp.Rows[i].Date < resp.Rows[j].Date
+		}
+		return resp.Rows[i].Issue < resp.Rows[j].Issue
+	})
+	resp.Total = formatDuration(resp.TotalSeconds)
+	return resp, http.StatusOK, nil
+}
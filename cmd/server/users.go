@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/config"
+	"github.com/alekseymerzlyakov/jira/internal/history"
+	"github.com/alekseymerzlyakov/jira/internal/jira"
+	"github.com/alekseymerzlyakov/jira/internal/phrases"
+	"github.com/alekseymerzlyakov/jira/internal/saved"
+	"github.com/alekseymerzlyakov/jira/internal/semantic"
+	"github.com/alekseymerzlyakov/jira/internal/users"
+)
+
+const sessionCookie = "jira_session"
+
+// userSpace holds the stores of one user in multi-user mode, under
+// DATA_DIR/users/<login>.
+type userSpace struct {
+	history          history.Storage
+	phrases          *phrases.Store
+	saved            *saved.Store
+	boardChoices     *boardChoices
+	semantic         *semantic.Index
+	semanticFallback *semantic.Index
+}
+
+// userSpaces opens user spaces on first use and keeps them open.
+type userSpaces struct {
+	cfg      config.Config
+	embedder semantic.Embedder
+	mu       sync.Mutex
+	m        map[string]*userSpace
+}
+
+func (s *userSpaces) get(login string) (*userSpace, error) {
+	key := users.DirName(login)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sp, ok := s.m[key]; ok {
+		return sp, nil
+	}
+	dir := filepath.Join(s.cfg.DataDir, "users", key)
+	store, err := openHistory(s.cfg, dir)
+	if err != nil {
+		return nil, fmt.Errorf("history of %s: %w", login, err)
+	}
+	choices, err := loadBoardChoices(filepath.Join(dir, "board_choices.json"))
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("boards of %s: %w", login, err)
+	}
+	sp := &userSpace{
+		history:          store,
+		phrases:          phrases.NewStore(filepath.Join(dir, "phrases.json")),
+		saved:            saved.NewStore(filepath.Join(dir, "saved_searches.json")),
+		boardChoices:     choices,
+		semanticFallback: semantic.NewIndex(semantic.NewHashing(0), ""),
+	}
+	if s.embedder != nil {
+		sp.semantic = semantic.NewIndex(s.embedder, filepath.Join(dir, "semantic_index.json"))
+	}
+	sp.history = withIndexes(store, sp.semantic, sp.semanticFallback)
+	if s.m == nil {
+		s.m = make(map[string]*userSpace)
+	}
+	s.m[key] = sp
+	return sp, nil
+}
+
+// usersKey returns the key stored Jira passwords are encrypted with:
+// USERS_KEY (from the environment or the secrets provider), else a key
+// derived from SECRETS_MASTER_KEY. Without either multi-user mode does not
+// start: a key kept in DATA_DIR would sit next to the credentials.
+func usersKey(cfg config.Config) ([]byte, error) {
+	key, err := users.LoadKey(cfg.UsersKey)
+	if !errors.Is(err, users.ErrNoKey) {
+		return key, err
+	}
+	if master, merr := config.MasterKey(); merr == nil {
+		log.Printf("USERS_KEY is not set: using a key derived from the secrets master key")
+		return users.DeriveKey(master), nil
+	}
+	return nil, errors.New("MULTI_USER needs USERS_KEY (32 bytes, hex or base64, e.g. `openssl rand -hex 32`) in the environment or the secrets provider, or SECRETS_MASTER_KEY to derive it from")
+}
+
+// migrateUserDirs moves data kept under the old, lossy directory names to
+// users.DirName. A legacy directory shared by several known logins is left
+// alone: whose data it holds cannot be told.
+func migrateUserDirs(dataDir string, known []users.User) {
+	byLegacy := map[string][]string{}
+	for _, u := range known {
+		legacy := users.LegacyDirName(u.Login)
+		if legacy != users.DirName(u.Login) {
+			byLegacy[legacy] = append(byLegacy[legacy], u.Login)
+		}
+	}
+	for legacy, logins := range byLegacy {
+		from := filepath.Join(dataDir, "users", legacy)
+		if _, err := os.Stat(from); err != nil {
+			continue
+		}
+		if len(logins) > 1 {
+			log.Printf("users: %s is shared by %s; left in place, move it by hand", from, strings.Join(logins, ", "))
+			continue
+		}
+		to := filepath.Join(dataDir, "users", users.DirName(logins[0]))
+		if _, err := os.Stat(to); err == nil {
+			continue
+		}
+		if err := os.Rename(from, to); err != nil {
+			log.Printf("users: move %s to %s: %v", from, to, err)
+			continue
+		}
+		log.Printf("users: moved the data of %s to %s", logins[0], to)
+	}
+}
+
+func (s *userSpaces) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sp := range s.m {
+		_ = sp.history.Close()
+	}
+}
+
+// forUser returns a copy of h acting as login: a Jira client with the
+// user's stored credentials and the user's own history, phrases and saved
+// searches.
+func (h *apiHandler) forUser(login string) (*apiHandler, error) {
+	password, err := h.users.Password(login)
+	if err != nil {
+		return nil, err
+	}
+	sp, err := h.spaces.get(login)
+	if err != nil {
+		return nil, err
+	}
+	cp := *h
+	cp.login = login
+	cp.jira = jira.NewClient(h.jira.BaseURL(), login, password)
+	cp.history = sp.history
+	cp.phrasesStore = sp.phrases
+	cp.saved = sp.saved
+	cp.boardChoices = sp.boardChoices
+	cp.semantic = sp.semantic
+	cp.semanticFallback = sp.semanticFallback
+	cp.plans = cp.newPlanRegistry()
+	return &cp, nil
+}
+
+// perUser serves build's handler as the logged-in user. In single-user mode
+// it is build(h) as is.
+func (h *apiHandler) perUser(build func(*apiHandler) http.Handler) http.Handler {
+	if h.users == nil {
+		return build(h)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := principalFrom(r.Context())
+		if !ok || p.Login == "" {
+			respondError(w, http.StatusUnauthorized, errors.New("login required"), "")
+			return
+		}
+		uh, err := h.forUser(p.Login)
+		if err != nil {
+			log.Printf("user %s: %v", p.Login, err)
+			respondError(w, http.StatusUnauthorized, errors.New("stored credentials are unusable, log in again"), "")
+			return
+		}
+		build(uh).ServeHTTP(w, r)
+	})
+}
+
+func (h *apiHandler) session(r *http.Request) (users.Session, bool) {
+	return h.sessions.Get(sessionID(r))
+}
+
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type sessionResponse struct {
+	MultiUser    bool   `json:"multiUser"`
+	AuthRequired bool   `json:"authRequired"`
+	Login        string `json:"login,omitempty"`
+	DisplayName  string `json:"displayName,omitempty"`
+	CSRFToken    string `json:"csrfToken,omitempty"`
+}
+
+// loginHandler handles POST /api/login: checks the credentials against Jira
+// (/rest/api/2/myself) and starts a session. In multi-user mode the
+// credentials are stored encrypted; otherwise only the server's own Jira
+// account may log in.
+func (h *apiHandler) loginHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var req loginRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, errors.New("invalid json"), "")
+			return
+		}
+		req.Username = strings.TrimSpace(req.Username)
+		if req.Username == "" || req.Password == "" {
+			respondError(w, http.StatusBadRequest, errors.New("username and password are required"), "")
+			return
+		}
+		if h.users == nil && !strings.EqualFold(req.Username, h.jira.User()) {
+			respondError(w, http.StatusUnauthorized, errors.New("invalid Jira username or password"), "")
+			return
+		}
+		body, status, err := jira.NewClient(h.jira.BaseURL(), req.Username, req.Password).Myself(r.Context())
+		if status == http.StatusUnauthorized || status == http.StatusForbidden {
+			respondError(w, http.StatusUnauthorized, errors.New("invalid Jira username or password"), "")
+			return
+		}
+		if err != nil {
+			respondErrorWithBody(w, http.StatusBadGateway, fmt.Errorf("jira: %w", err), body, "")
+			return
+		}
+		var me struct {
+			Name        string `json:"name"`
+			DisplayName string `json:"displayName"`
+		}
+		_ = json.Unmarshal(body, &me)
+		login := me.Name
+		if login == "" || h.users == nil {
+			login = req.Username
+		}
+		if h.users != nil {
+			if _, err := h.users.Save(login, me.DisplayName, req.Password); err != nil {
+				respondError(w, http.StatusInternalServerError, err, "")
+				return
+			}
+		}
+		sess, err := h.sessions.Create(login)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err, "")
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    sess.ID,
+			Path:     "/",
+			Expires:  sess.ExpiresAt,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(sessionResponse{
+			MultiUser:    h.users != nil,
+			AuthRequired: h.authRequired,
+			Login:        login,
+			DisplayName:  me.DisplayName,
+			CSRFToken:    sess.CSRF,
+		})
+	})
+}
+
+// logoutHandler handles POST /api/logout.
+func (h *apiHandler) logoutHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.sessions.Delete(sessionID(r))
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", Expires: time.Unix(0, 0), MaxAge: -1, HttpOnly: true})
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// sessionInfo handles GET /api/session: who is logged in, if anyone.
+func (h *apiHandler) sessionInfo() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		resp := sessionResponse{MultiUser: h.users != nil, AuthRequired: h.authRequired}
+		if sess, ok := h.session(r); ok {
+			resp.Login = sess.Login
+			resp.CSRFToken = sess.CSRF
+			if h.users != nil {
+				if u, ok := h.users.Get(sess.Login); ok {
+					resp.DisplayName = u.DisplayName
+				}
+			}
+		} else if !h.authRequired {
+			resp.Login = h.jira.User()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// scheduledHandlers returns the handlers whose saved searches the
+// scheduler runs: h itself, or one per stored user in multi-user mode.
+func (h *apiHandler) scheduledHandlers() []*apiHandler {
+	if h.users == nil {
+		return []*apiHandler{h}
+	}
+	var out []*apiHandler
+	for _, u := range h.users.List() {
+		uh, err := h.forUser(u.Login)
+		if err != nil {
+			log.Printf("scheduler: user %s: %v", u.Login, err)
+			continue
+		}
+		out = append(out, uh)
+	}
+	return out
+}
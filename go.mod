@@ -2,4 +2,11 @@ module github.com/alekseymerzlyakov/jira
 
 go 1.22
 
-require github.com/sashabaranov/go-openai v1.41.2
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/sashabaranov/go-openai v1.41.2
+	go.etcd.io/bbolt v1.3.10
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.4.0 // indirect
@@ -0,0 +1,159 @@
+// Package analysis runs LLM analysis over Jira search results that do not fit
+// into a single prompt: issues are compacted, split into token-bounded chunks,
+// analysed one chunk at a time and merged into a final summary.
+package analysis
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+)
+
+// descriptionLimit bounds the description kept per issue, in runes.
+const descriptionLimit = 500
+
+// Issue is the subset of a Jira issue worth sending to the model.
+type Issue struct {
+	Key         string   `json:"key"`
+	Summary     string   `json:"summary"`
+	Type        string   `json:"type,omitempty"`
+	Status      string   `json:"status,omitempty"`
+	Priority    string   `json:"priority,omitempty"`
+	Assignee    string   `json:"assignee,omitempty"`
+	Reporter    string   `json:"reporter,omitempty"`
+	Created     string   `json:"created,omitempty"`
+	Updated     string   `json:"updated,omitempty"`
+	Resolution  string   `json:"resolution,omitempty"`
+	Labels      []string `json:"labels,omitempty"`
+	SpentHours  float64  `json:"spentHours,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+type named struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+func (n *named) String() string {
+	if n == nil {
+		return ""
+	}
+	if n.DisplayName != "" {
+		return n.DisplayName
+	}
+	return n.Name
+}
+
+// Compact extracts issues from a /rest/api/2/search response, dropping
+// avatars, self links, rendered fields and other noise.
+func Compact(raw []byte) ([]Issue, int, error) {
+	var payload struct {
+		Total  int `json:"total"`
+		Issues []struct {
+			Key    string `json:"key"`
+			Fields struct {
+				Summary     string   `json:"summary"`
+				Description string   `json:"description"`
+				IssueType   *named   `json:"issuetype"`
+				Status      *named   `json:"status"`
+				Priority    *named   `json:"priority"`
+				Assignee    *named   `json:"assignee"`
+				Reporter    *named   `json:"reporter"`
+				Resolution  *named   `json:"resolution"`
+				Created     string   `json:"created"`
+				Updated     string   `json:"updated"`
+				Labels      []string `json:"labels"`
+				TimeSpent   int      `json:"timespent"`
+			} `json:"fields"`
+		} `json:"issues"`
+	}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, 0, err
+	}
+	out := make([]Issue, 0, len(payload.Issues))
+	for _, iss := range payload.Issues {
+		f := iss.Fields
+		out = append(out, Issue{
+			Key:         iss.Key,
+			Summary:     f.Summary,
+			Type:        f.IssueType.String(),
+			Status:      f.Status.String(),
+			Priority:    f.Priority.String(),
+			Assignee:    f.Assignee.String(),
+			Reporter:    f.Reporter.String(),
+			Resolution:  f.Resolution.String(),
+			Created:     datePart(f.Created),
+			Updated:     datePart(f.Updated),
+			Labels:      f.Labels,
+			SpentHours:  float64(f.TimeSpent) / 3600,
+			Description: truncateRunes(strings.TrimSpace(f.Description), descriptionLimit),
+		})
+	}
+	total := payload.Total
+	if total < len(out) {
+		total = len(out)
+	}
+	return out, total, nil
+}
+
+// Chunk splits issues into groups whose encoded size stays within maxTokens.
+// An issue larger than the budget gets a chunk of its own.
+func Chunk(issues []Issue, maxTokens int) [][]Issue {
+	var chunks [][]Issue
+	var cur []Issue
+	used := 0
+	for _, iss := range issues {
+		n := issueTokens(iss)
+		if len(cur) > 0 && maxTokens > 0 && used+n > maxTokens {
+			chunks = append(chunks, cur)
+			cur, used = nil, 0
+		}
+		cur = append(cur, iss)
+		used += n
+	}
+	if len(cur) > 0 {
+		chunks = append(chunks, cur)
+	}
+	return chunks
+}
+
+// Encode renders issues in the search-response shape the analyzers expect.
+func Encode(issues []Issue, total int) []byte {
+	data, _ := json.Marshal(struct {
+		Total  int     `json:"total"`
+		Issues []Issue `json:"issues"`
+	}{Total: total, Issues: issues})
+	return data
+}
+
+// Fit returns the longest prefix of issues whose encoding fits into maxTokens.
+func Fit(issues []Issue, maxTokens int) []Issue {
+	used := 0
+	for i, iss := range issues {
+		used += issueTokens(iss)
+		if used > maxTokens {
+			return issues[:i]
+		}
+	}
+	return issues
+}
+
+func issueTokens(iss Issue) int {
+	data, _ := json.Marshal(iss)
+	return estimateTokens(string(data))
+}
+
+func datePart(ts string) string {
+	if len(ts) >= 10 {
+		return ts[:10]
+	}
+	return ts
+}
+
+func truncateRunes(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:limit]) + "…"
+}
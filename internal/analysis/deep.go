@@ -0,0 +1,442 @@
+package analysis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/history"
+	"github.com/alekseymerzlyakov/jira/internal/jira"
+	"github.com/alekseymerzlyakov/jira/internal/llm"
+)
+
+// Defaults of DeepPipeline.
+const (
+	DefaultConcurrency = 4
+	DefaultMaxIssues   = 30
+	DefaultStaleDays   = 14
+)
+
+// Limits that keep one dossier within a few thousand tokens.
+const (
+	dossierDescriptionLimit = 2000
+	dossierCommentLimit     = 500
+	dossierMaxComments      = 10
+	dossierMaxChanges       = 20
+)
+
+// Fetcher reads Jira REST resources; *jira.Client satisfies it.
+type Fetcher interface {
+	Get(ctx context.Context, path string) ([]byte, error)
+}
+
+// Dossier is everything known about one issue, trimmed for an LLM prompt.
+type Dossier struct {
+	Key         string       `json:"key"`
+	Summary     string       `json:"summary"`
+	Type        string       `json:"type,omitempty"`
+	Status      string       `json:"status,omitempty"`
+	Priority    string       `json:"priority,omitempty"`
+	Assignee    string       `json:"assignee,omitempty"`
+	Reporter    string       `json:"reporter,omitempty"`
+	Resolution  string       `json:"resolution,omitempty"`
+	Created     string       `json:"created,omitempty"`
+	Updated     string       `json:"updated,omitempty"`
+	Description string       `json:"description,omitempty"`
+	Comments    []Comment    `json:"comments,omitempty"`
+	Changelog   []Change     `json:"changelog,omitempty"`
+	Links       []Link       `json:"links,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	Staleness   Staleness    `json:"staleness"`
+}
+
+type Comment struct {
+	Author  string `json:"author"`
+	Created string `json:"created"`
+	Body    string `json:"body"`
+}
+
+// Change is one field change from the issue changelog.
+type Change struct {
+	Author  string `json:"author"`
+	Created string `json:"created"`
+	Field   string `json:"field"`
+	From    string `json:"from,omitempty"`
+	To      string `json:"to,omitempty"`
+}
+
+type Link struct {
+	Type    string `json:"type"` // e.g. "blocks", "is blocked by"
+	Key     string `json:"key"`
+	Summary string `json:"summary,omitempty"`
+	Status  string `json:"status,omitempty"`
+}
+
+type Attachment struct {
+	Filename string `json:"filename"`
+	MimeType string `json:"mimeType,omitempty"`
+	Size     int    `json:"size"`
+	Author   string `json:"author,omitempty"`
+	Created  string `json:"created,omitempty"`
+}
+
+// Staleness is computed locally from dates so the model does not do arithmetic.
+type Staleness struct {
+	DaysSinceUpdate int  `json:"daysSinceUpdate"`
+	DaysInStatus    int  `json:"daysInStatus"`
+	Stale           bool `json:"stale"`
+}
+
+// FetchDossier loads an issue with comments, changelog, links and attachment
+// metadata.
+func FetchDossier(ctx context.Context, f Fetcher, key string, now time.Time, staleDays int) (Dossier, error) {
+	path := "/rest/api/2/issue/" + url.PathEscape(key) +
+		"?fields=summary,issuetype,status,priority,assignee,reporter,resolution,created,updated,description,comment,issuelinks,attachment&expand=changelog"
+	body, err := f.Get(ctx, path)
+	if err != nil {
+		return Dossier{Key: key}, err
+	}
+	d, err := parseDossier(body, now, staleDays)
+	if d.Key == "" {
+		d.Key = key
+	}
+	return d, err
+}
+
+func parseDossier(body []byte, now time.Time, staleDays int) (Dossier, error) {
+	type linked struct {
+		Key    string `json:"key"`
+		Fields struct {
+			Summary string `json:"summary"`
+			Status  *named `json:"status"`
+		} `json:"fields"`
+	}
+	var raw struct {
+		Key    string `json:"key"`
+		Fields struct {
+			Summary     string `json:"summary"`
+			Description string `json:"description"`
+			IssueType   *named `json:"issuetype"`
+			Status      *struct {
+				named
+				StatusCategory struct {
+					Key string `json:"key"`
+				} `json:"statusCategory"`
+			} `json:"status"`
+			Priority   *named `json:"priority"`
+			Assignee   *named `json:"assignee"`
+			Reporter   *named `json:"reporter"`
+			Resolution *named `json:"resolution"`
+			Created    string `json:"created"`
+			Updated    string `json:"updated"`
+			Comment    struct {
+				Comments []struct {
+					Author  *named `json:"author"`
+					Created string `json:"created"`
+					Body    string `json:"body"`
+				} `json:"comments"`
+			} `json:"comment"`
+			IssueLinks []struct {
+				Type struct {
+					Inward  string `json:"inward"`
+					Outward string `json:"outward"`
+				} `json:"type"`
+				InwardIssue  *linked `json:"inwardIssue"`
+				OutwardIssue *linked `json:"outwardIssue"`
+			} `json:"issuelinks"`
+			Attachment []struct {
+				Filename string `json:"filename"`
+				MimeType string `json:"mimeType"`
+				Size     int    `json:"size"`
+				Author   *named `json:"author"`
+				Created  string `json:"created"`
+			} `json:"attachment"`
+		} `json:"fields"`
+		Changelog struct {
+			Histories []struct {
+				Author  *named `json:"author"`
+				Created string `json:"created"`
+				Items   []struct {
+					Field      string `json:"field"`
+					FromString string `json:"fromString"`
+					ToString   string `json:"toString"`
+				} `json:"items"`
+			} `json:"histories"`
+		} `json:"changelog"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return Dossier{}, err
+	}
+	f := raw.Fields
+	d := Dossier{
+		Key:         raw.Key,
+		Summary:     f.Summary,
+		Type:        f.IssueType.String(),
+		Priority:    f.Priority.String(),
+		Assignee:    f.Assignee.String(),
+		Reporter:    f.Reporter.String(),
+		Resolution:  f.Resolution.String(),
+		Created:     datePart(f.Created),
+		Updated:     datePart(f.Updated),
+		Description: truncateRunes(strings.TrimSpace(f.Description), dossierDescriptionLimit),
+	}
+	done := f.Resolution != nil
+	if f.Status != nil {
+		d.Status = f.Status.named.String()
+		done = done || f.Status.StatusCategory.Key == "done"
+	}
+
+	comments := f.Comment.Comments
+	if len(comments) > dossierMaxComments {
+		comments = comments[len(comments)-dossierMaxComments:]
+	}
+	for _, c := range comments {
+		d.Comments = append(d.Comments, Comment{
+			Author:  c.Author.String(),
+			Created: datePart(c.Created),
+			Body:    truncateRunes(strings.TrimSpace(c.Body), dossierCommentLimit),
+		})
+	}
+
+	statusSince := f.Created
+	for _, h := range raw.Changelog.Histories {
+		for _, item := range h.Items {
+			if item.Field == "status" && h.Created > statusSince {
+				statusSince = h.Created
+			}
+			d.Changelog = append(d.Changelog, Change{
+				Author:  h.Author.String(),
+				Created: datePart(h.Created),
+				Field:   item.Field,
+				From:    truncateRunes(item.FromString, 100),
+				To:      truncateRunes(item.ToString, 100),
+			})
+		}
+	}
+	sort.SliceStable(d.Changelog, func(i, j int) bool { return d.Changelog[i].Created < d.Changelog[j].Created })
+	if len(d.Changelog) > dossierMaxChanges {
+		d.Changelog = d.Changelog[len(d.Changelog)-dossierMaxChanges:]
+	}
+
+	for _, l := range f.IssueLinks {
+		link := Link{Type: l.Type.Outward}
+		target := l.OutwardIssue
+		if l.InwardIssue != nil {
+			link.Type = l.Type.Inward
+			target = l.InwardIssue
+		}
+		if target == nil {
+			continue
+		}
+		link.Key = target.Key
+		link.Summary = target.Fields.Summary
+		link.Status = target.Fields.Status.String()
+		d.Links = append(d.Links, link)
+	}
+	for _, a := range f.Attachment {
+		d.Attachments = append(d.Attachments, Attachment{
+			Filename: a.Filename,
+			MimeType: a.MimeType,
+			Size:     a.Size,
+			Author:   a.Author.String(),
+			Created:  datePart(a.Created),
+		})
+	}
+
+	d.Staleness.DaysSinceUpdate = daysSince(f.Updated, now)
+	d.Staleness.DaysInStatus = daysSince(statusSince, now)
+	d.Staleness.Stale = !done && staleDays > 0 && d.Staleness.DaysInStatus >= staleDays
+	return d, nil
+}
+
+func daysSince(ts string, now time.Time) int {
+	t, err := jira.ParseJiraTime(ts)
+	if err != nil {
+		return 0
+	}
+	return int(now.Sub(t).Hours() / 24)
+}
+
+// DeepPipeline reviews every issue separately, then aggregates the reviews.
+type DeepPipeline struct {
+	Provider    llm.Provider
+	Fetcher     Fetcher
+	Concurrency int // parallel Jira fetches and LLM reviews
+	MaxIssues   int // issues beyond this are skipped with a warning
+	StaleDays   int // days in one status after which an open issue is stale
+	// Progress, when set, is called as each step starts ("running"), advances and ends.
+	Progress func(history.Step)
+}
+
+// DeepResult is the per-issue reviews plus the aggregate report.
+type DeepResult struct {
+	Dossiers []Dossier
+	Reviews  []llm.IssueReview
+	Report   llm.Analysis
+	Steps    []history.Step
+	Usage    llm.Usage
+}
+
+// Run fetches and reviews the issues identified by keys, in order.
+func (p DeepPipeline) Run(ctx context.Context, query string, keys []string) (DeepResult, error) {
+	var res DeepResult
+	workers := p.Concurrency
+	if workers <= 0 {
+		workers = DefaultConcurrency
+	}
+	maxIssues := p.MaxIssues
+	if maxIssues <= 0 {
+		maxIssues = DefaultMaxIssues
+	}
+	staleDays := p.StaleDays
+	if staleDays <= 0 {
+		staleDays = DefaultStaleDays
+	}
+	skipped := 0
+	if len(keys) > maxIssues {
+		skipped = len(keys) - maxIssues
+		keys = keys[:maxIssues]
+	}
+
+	// 1. Fetch dossiers.
+	fetch := history.Step{Name: "Fetch issue details", Description: fmt.Sprintf("0/%d issues", len(keys))}
+	p.emit(fetch, "running")
+	now := time.Now().UTC()
+	dossiers := make([]Dossier, len(keys))
+	errs := make([]error, len(keys))
+	p.each(ctx, len(keys), workers, func(i int) {
+		dossiers[i], errs[i] = FetchDossier(ctx, p.Fetcher, keys[i], now, staleDays)
+	}, func(done int) {
+		fetch.Description = fmt.Sprintf("%d/%d issues", done, len(keys))
+		p.emit(fetch, "running")
+	})
+	if err := ctx.Err(); err != nil {
+		return res, err
+	}
+	failed := map[string]string{}
+	for i, err := range errs {
+		if err != nil {
+			failed[keys[i]] = err.Error()
+			continue
+		}
+		res.Dossiers = append(res.Dossiers, dossiers[i])
+	}
+	stale := 0
+	for _, d := range res.Dossiers {
+		if d.Staleness.Stale {
+			stale++
+		}
+	}
+	fetch.Description = fmt.Sprintf("Fetched %d issue(s), %d failed, %d stale", len(res.Dossiers), len(failed), stale)
+	if skipped > 0 {
+		fetch.Description += fmt.Sprintf(", %d skipped over the limit of %d", skipped, maxIssues)
+	}
+	fetch.Result = marshal(map[string]any{"fetched": len(res.Dossiers), "failed": failed, "skipped": skipped, "stale": stale})
+	res.Steps = append(res.Steps, p.emit(fetch, "completed"))
+	if len(res.Dossiers) == 0 {
+		return res, fmt.Errorf("no issues could be fetched")
+	}
+
+	// 2. Review each issue. Token streaming is switched off: concurrent
+	// reviews would interleave their output.
+	review := history.Step{Name: "Review issues", Description: fmt.Sprintf("0/%d issues", len(res.Dossiers))}
+	p.emit(review, "running")
+	var m llm.Meter
+	rctx := llm.WithMeter(llm.WithTokens(ctx, nil), &m)
+	reviews := make([]llm.IssueReview, len(res.Dossiers))
+	rerrs := make([]error, len(res.Dossiers))
+	p.each(ctx, len(res.Dossiers), workers, func(i int) {
+		d := res.Dossiers[i]
+		reviews[i], rerrs[i] = p.Provider.ReviewIssue(rctx, query, marshal(d))
+		if reviews[i].Key == "" {
+			reviews[i].Key = d.Key
+		}
+	}, func(done int) {
+		review.Description = fmt.Sprintf("%d/%d issues", done, len(res.Dossiers))
+		p.emit(review, "running")
+	})
+	if err := ctx.Err(); err != nil {
+		return res, err
+	}
+	reviewFailed := map[string]string{}
+	for i, err := range rerrs {
+		if err != nil {
+			reviewFailed[res.Dossiers[i].Key] = err.Error()
+			continue
+		}
+		res.Reviews = append(res.Reviews, reviews[i])
+	}
+	review.Usage = p.usage(&res, m.Total())
+	review.Description = fmt.Sprintf("Reviewed %d issue(s), %d failed", len(res.Reviews), len(reviewFailed))
+	review.Result = marshal(map[string]any{"reviews": res.Reviews, "failed": reviewFailed})
+	if len(res.Reviews) == 0 {
+		res.Steps = append(res.Steps, p.emit(review, "failed"))
+		return res, fmt.Errorf("no issue could be reviewed")
+	}
+	res.Steps = append(res.Steps, p.emit(review, "completed"))
+
+	// 3. Aggregate.
+	agg := history.Step{Name: "Aggregate report", Description: fmt.Sprintf("Report over %d reviews", len(res.Reviews))}
+	p.emit(agg, "running")
+	var am llm.Meter
+	report, err := p.Provider.SummarizeReviews(llm.WithMeter(ctx, &am), query, res.Reviews)
+	agg.Usage = p.usage(&res, am.Total())
+	if err != nil {
+		agg.Result = marshal(map[string]string{"error": err.Error()})
+		res.Steps = append(res.Steps, p.emit(agg, "failed"))
+		return res, err
+	}
+	if skipped > 0 {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("проанализированы первые %d задач, ещё %d пропущено", maxIssues, skipped))
+	}
+	agg.Result = marshal(report)
+	res.Steps = append(res.Steps, p.emit(agg, "completed"))
+	res.Report = report
+	return res, nil
+}
+
+// each runs work for 0..n-1 on up to workers goroutines. After every call,
+// progress gets the number of finished calls; progress calls never overlap.
+func (p DeepPipeline) each(ctx context.Context, n, workers int, work func(i int), progress func(done int)) {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		count int
+	)
+	sem := make(chan struct{}, workers)
+	for i := 0; i < n; i++ {
+		if ctx.Err() != nil {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			work(i)
+			mu.Lock()
+			count++
+			progress(count)
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+}
+
+func (p DeepPipeline) emit(step history.Step, status string) history.Step {
+	step.Status = status
+	if p.Progress != nil {
+		p.Progress(step)
+	}
+	return step
+}
+
+func (p DeepPipeline) usage(res *DeepResult, u llm.Usage) *history.Usage {
+	res.Usage.Add(u)
+	return StepUsage(u)
+}
@@ -0,0 +1,152 @@
+package analysis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/alekseymerzlyakov/jira/internal/history"
+	"github.com/alekseymerzlyakov/jira/internal/llm"
+)
+
+// DefaultChunkTokens keeps a chunk comfortably below small context windows
+// once the prompt and the answer are added.
+const DefaultChunkTokens = 6000
+
+var estimateTokens = llm.EstimateTokens
+
+// Pipeline is a map-reduce analysis: every chunk is analysed separately and
+// the partial analyses are merged into one.
+type Pipeline struct {
+	Provider    llm.Provider
+	ChunkTokens int
+	// Progress, when set, is called as each step starts ("running") and ends.
+	Progress func(history.Step)
+}
+
+// Result is the merged analysis plus one history step per LLM phase.
+type Result struct {
+	Analysis llm.Analysis
+	Steps    []history.Step
+	Usage    llm.Usage
+}
+
+// Run analyses a raw search response. Steps are returned even on error so the
+// caller can persist how far the pipeline got.
+func (p Pipeline) Run(ctx context.Context, query, jql string, raw []byte) (Result, error) {
+	var res Result
+	issues, total, err := Compact(raw)
+	if err != nil {
+		return res, fmt.Errorf("compact issues: %w", err)
+	}
+	budget := p.ChunkTokens
+	if budget <= 0 {
+		budget = DefaultChunkTokens
+	}
+	chunks := Chunk(issues, budget)
+	res.add(p, history.Step{
+		Name:        "Compact issues",
+		Description: fmt.Sprintf("Compacted %d issues into %d chunk(s) of up to %d tokens", len(issues), len(chunks), budget),
+		Status:      "completed",
+		Result: marshal(map[string]int{
+			"issues":    len(issues),
+			"total":     total,
+			"chunks":    len(chunks),
+			"rawTokens": estimateTokens(string(raw)),
+		}),
+	})
+	if len(chunks) == 0 {
+		chunks = [][]Issue{nil}
+	}
+
+	parts := make([]llm.Analysis, 0, len(chunks))
+	for i, chunk := range chunks {
+		step := history.Step{
+			Name:        fmt.Sprintf("Analyze chunk %d/%d", i+1, len(chunks)),
+			Description: fmt.Sprintf("%d issues", len(chunk)),
+		}
+		p.start(step)
+		var m llm.Meter
+		part, err := p.Provider.Analyze(llm.WithMeter(ctx, &m), query, jql, Encode(chunk, total))
+		step.Usage = p.usage(&res, m.Total())
+		if err != nil {
+			res.fail(p, step, err)
+			return res, err
+		}
+		step.Status = "completed"
+		step.Result = marshal(part)
+		res.add(p, step)
+		parts = append(parts, part)
+	}
+
+	if len(parts) == 1 {
+		res.Analysis = parts[0]
+		return res, nil
+	}
+	step := history.Step{
+		Name:        "Merge summaries",
+		Description: fmt.Sprintf("Merged %d partial analyses", len(parts)),
+	}
+	p.start(step)
+	var m llm.Meter
+	merged, err := p.Provider.MergeAnalyses(llm.WithMeter(ctx, &m), query, jql, parts)
+	step.Usage = p.usage(&res, m.Total())
+	if err != nil {
+		res.fail(p, step, err)
+		return res, err
+	}
+	step.Status = "completed"
+	step.Result = marshal(merged)
+	res.add(p, step)
+	res.Analysis = merged
+	return res, nil
+}
+
+func (p Pipeline) start(step history.Step) {
+	if p.Progress != nil {
+		step.Status = "running"
+		p.Progress(step)
+	}
+}
+
+func (r *Result) add(p Pipeline, step history.Step) {
+	r.Steps = append(r.Steps, step)
+	if p.Progress != nil {
+		p.Progress(step)
+	}
+}
+
+func (r *Result) fail(p Pipeline, step history.Step, err error) {
+	step.Status = "failed"
+	step.Result = marshal(map[string]string{"error": err.Error()})
+	r.add(p, step)
+}
+
+// usage adds u to the pipeline total and converts it for the history step.
+func (p Pipeline) usage(res *Result, u llm.Usage) *history.Usage {
+	res.Usage.Add(u)
+	return StepUsage(u)
+}
+
+// StepUsage converts metered usage for a history step; nil when nothing was called.
+func StepUsage(u llm.Usage) *history.Usage {
+	if u.Calls == 0 {
+		return nil
+	}
+	return &history.Usage{
+		Model:            u.Model,
+		Calls:            u.Calls,
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		CostUSD:          u.CostUSD,
+		Estimated:        u.Estimated,
+	}
+}
+
+func marshal(v any) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
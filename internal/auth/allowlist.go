@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Allowlist is a set of networks allowed to reach the server; an empty list
+// allows everyone.
+type Allowlist []*net.IPNet
+
+// ParseAllowlist parses IPs and CIDRs ("10.0.0.0/8", "127.0.0.1", "::1").
+func ParseAllowlist(items []string) (Allowlist, error) {
+	var out Allowlist
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("allowlist: bad IP %q", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			out = append(out, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("allowlist: %w", err)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// Allows reports whether remoteAddr ("host:port" or a bare IP) is allowed.
+func (l Allowlist) Allows(remoteAddr string) bool {
+	if len(l) == 0 {
+		return true
+	}
+	host := remoteAddr
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range l {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
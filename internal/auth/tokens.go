@@ -0,0 +1,201 @@
+// Package auth holds API tokens, their scopes and the IP allowlist used by
+// the server's auth middleware.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scopes. Reading needs ScopeRead, other changes ScopeWrite; logging time
+// and bulk operations (autofill) are split out so a script can search
+// without being able to touch worklogs.
+const (
+	ScopeRead    = "read"
+	ScopeWrite   = "write"
+	ScopeWorklog = "worklog"
+	ScopeBulk    = "bulk"
+	ScopeAdmin   = "admin" // manage API tokens
+)
+
+// AllScopes lists every scope; sessions get all of them.
+var AllScopes = []string{ScopeRead, ScopeWrite, ScopeWorklog, ScopeBulk, ScopeAdmin}
+
+// tokenPrefix marks the tokens this package issues.
+const tokenPrefix = "jat_"
+
+// ErrNotFound is returned for an unknown token ID.
+var ErrNotFound = errors.New("token not found")
+
+// Token is an API token; only a hash of the secret is stored.
+type Token struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Login     string     `json:"login,omitempty"` // user the token acts for in multi-user mode
+	Scopes    []string   `json:"scopes"`
+	Hash      string     `json:"hash,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	LastUsed  *time.Time `json:"lastUsed,omitempty"`
+}
+
+// HasScope reports whether scopes contains scope.
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeScopes validates scopes and returns them sorted without
+// duplicates; read is always included.
+func NormalizeScopes(scopes []string) ([]string, error) {
+	set := map[string]bool{ScopeRead: true}
+	for _, s := range scopes {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" {
+			continue
+		}
+		if !HasScope(AllScopes, s) {
+			return nil, fmt.Errorf("unknown scope %q (known: %s)", s, strings.Join(AllScopes, ", "))
+		}
+		set[s] = true
+	}
+	out := make([]string, 0, len(set))
+	for s := range set {
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// TokenStore persists tokens to a JSON file.
+type TokenStore struct {
+	path string
+	mu   sync.Mutex
+	list []Token
+}
+
+func NewTokenStore(path string) (*TokenStore, error) {
+	s := &TokenStore{path: path}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, &s.list); err != nil {
+			return nil, fmt.Errorf("tokens: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Create issues a token and returns its secret, which is not stored and
+// cannot be shown again.
+func (s *TokenStore) Create(name, login string, scopes []string) (Token, string, error) {
+	if strings.TrimSpace(login) == "" {
+		return Token{}, "", errors.New("token needs a login")
+	}
+	scopes, err := NormalizeScopes(scopes)
+	if err != nil {
+		return Token{}, "", err
+	}
+	buf := make([]byte, 38)
+	if _, err := rand.Read(buf); err != nil {
+		return Token{}, "", err
+	}
+	secret := tokenPrefix + hex.EncodeToString(buf[6:])
+	t := Token{
+		ID:        hex.EncodeToString(buf[:6]),
+		Name:      strings.TrimSpace(name),
+		Login:     login,
+		Scopes:    scopes,
+		Hash:      hashSecret(secret),
+		CreatedAt: time.Now().UTC(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.list = append(s.list, t)
+	return t, secret, s.save()
+}
+
+// Verify returns the token with the given secret and records its use.
+func (s *TokenStore) Verify(secret string) (Token, bool) {
+	if !strings.HasPrefix(secret, tokenPrefix) {
+		return Token{}, false
+	}
+	h := hashSecret(secret)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.list {
+		if subtle.ConstantTimeCompare([]byte(s.list[i].Hash), []byte(h)) == 1 {
+			now := time.Now().UTC()
+			// Saved at most once an hour to keep verification cheap.
+			if s.list[i].LastUsed == nil || now.Sub(*s.list[i].LastUsed) > time.Hour {
+				s.list[i].LastUsed = &now
+				_ = s.save()
+			}
+			return s.list[i], true
+		}
+	}
+	return Token{}, false
+}
+
+// List returns the tokens of login; an empty login owns none.
+func (s *TokenStore) List(login string) []Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Token
+	if login == "" {
+		return out
+	}
+	for _, t := range s.list {
+		if strings.EqualFold(t.Login, login) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Delete revokes a token of login.
+func (s *TokenStore) Delete(id, login string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if login == "" {
+		return ErrNotFound
+	}
+	for i, t := range s.list {
+		if t.ID == id && strings.EqualFold(t.Login, login) {
+			s.list = append(s.list[:i], s.list[i+1:]...)
+			return s.save()
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *TokenStore) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s.list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o600)
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
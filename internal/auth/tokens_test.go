@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestTokensBelongToALogin(t *testing.T) {
+	s, err := NewTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Create("anon", "", []string{ScopeAdmin}); err == nil {
+		t.Error("created a token without a login")
+	}
+	tok, secret, err := s.Create("cron", "ann", []string{ScopeRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := s.Verify(secret); !ok || got.ID != tok.ID {
+		t.Fatalf("Verify = %+v, %v", got, ok)
+	}
+	if n := len(s.List("")); n != 0 {
+		t.Errorf("empty login lists %d tokens", n)
+	}
+	if n := len(s.List("ANN")); n != 1 {
+		t.Errorf("owner lists %d tokens", n)
+	}
+	for _, login := range []string{"", "bob"} {
+		if err := s.Delete(tok.ID, login); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Delete by %q = %v, want ErrNotFound", login, err)
+		}
+	}
+	if err := s.Delete(tok.ID, "ann"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Verify(secret); ok {
+		t.Error("revoked token still verifies")
+	}
+}
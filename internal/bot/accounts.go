@@ -0,0 +1,70 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Account maps a chat user to a Jira account. Empty JiraUser means the
+// server's own Jira credentials. The password is never kept in the accounts
+// file: PasswordKey names a secret (e.g. BOT_JIRA_PASSWORD_IVAN) looked up
+// through the secrets provider; without it a multi-user server uses the
+// credentials JiraUser logged in with.
+type Account struct {
+	Transport   string `json:"transport"` // e.g. "telegram"
+	ChatUser    string `json:"chatUser"`  // user ID on that transport
+	Name        string `json:"name,omitempty"`
+	JiraUser    string `json:"jiraUser,omitempty"`
+	PasswordKey string `json:"passwordKey,omitempty"`
+}
+
+// Accounts is the list of chat users allowed to use the bot.
+type Accounts struct {
+	list []Account
+}
+
+// LoadAccounts reads a JSON array of accounts. A missing file allows nobody.
+func LoadAccounts(path string) (*Accounts, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Accounts{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var raw []struct {
+		Account
+		JiraPassword string `json:"jiraPassword"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	list := make([]Account, len(raw))
+	for i, r := range raw {
+		if r.JiraPassword != "" {
+			return nil, fmt.Errorf("%s: account %s/%s keeps a plaintext jiraPassword; store it as a secret and reference it with passwordKey", path, r.Transport, r.ChatUser)
+		}
+		list[i] = r.Account
+	}
+	return &Accounts{list: list}, nil
+}
+
+// Lookup finds the account of a chat user.
+func (a *Accounts) Lookup(transport, chatUser string) (Account, bool) {
+	for _, acc := range a.list {
+		if acc.Transport == transport && acc.ChatUser == chatUser {
+			return acc, true
+		}
+	}
+	return Account{}, false
+}
+
+// All returns the configured accounts.
+func (a *Accounts) All() []Account {
+	return append([]Account(nil), a.list...)
+}
+
+// Len returns the number of configured accounts.
+func (a *Accounts) Len() int { return len(a.list) }
@@ -0,0 +1,247 @@
+// Package bot is a chat front-end for worklog commands and Jira searches.
+// Transports (Telegram first) deliver messages; a Backend executes them with
+// the Jira account mapped to the chat user.
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Incoming is one chat message.
+type Incoming struct {
+	ChatID   string
+	UserID   string
+	UserName string
+	Text     string
+}
+
+// Transport connects the bot to a chat service.
+type Transport interface {
+	Name() string
+	// Receive blocks until messages arrive, ctx is done or polling fails.
+	Receive(ctx context.Context) ([]Incoming, error)
+	Send(ctx context.Context, chatID, text string) error
+}
+
+// WorklogRequest mirrors /api/worklog/command: DurationText and DateText
+// answer an earlier clarification.
+type WorklogRequest struct {
+	Query        string
+	DurationText string
+	DateText     string
+	DryRun       bool
+}
+
+// Reply is a backend answer. A non-empty Question asks for the field named
+// by Need; Default is used when the user just confirms.
+type Reply struct {
+	Text     string
+	Question string
+	Need     string // "duration" or "date"
+	Default  string
+}
+
+// Backend executes commands on behalf of an account.
+type Backend interface {
+	Worklog(ctx context.Context, acc Account, req WorklogRequest) (Reply, error)
+	Search(ctx context.Context, acc Account, query string) (Reply, error)
+}
+
+// Bot routes chat messages to a Backend and keeps the clarification state
+// of each chat user.
+type Bot struct {
+	Transport Transport
+	Backend   Backend
+	Accounts  *Accounts
+
+	mu      sync.Mutex
+	pending map[string]clarification // by chat and user
+}
+
+// clarification is a worklog request waiting for the answer to a question.
+type clarification struct {
+	req   WorklogRequest
+	asked Reply
+}
+
+const helpText = `Команды:
+/log QA-959 30m вчера — списать время
+/dry QA-959 30m вчера — показать, что будет списано
+/search мои баги в этом спринте — поиск в Jira
+/cancel — отменить уточнение
+Текст без команды с ключом задачи и временем считается списанием, остальное — поиском.`
+
+// Run polls the transport and answers messages until ctx is cancelled.
+func (b *Bot) Run(ctx context.Context) error {
+	backoff := time.Second
+	for {
+		msgs, err := b.Transport.Receive(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			log.Printf("bot %s: receive: %v", b.Transport.Name(), err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			if backoff < time.Minute {
+				backoff *= 2
+			}
+			continue
+		}
+		backoff = time.Second
+		for _, m := range msgs {
+			reply := b.Handle(ctx, m)
+			if reply == "" {
+				continue
+			}
+			if err := b.Transport.Send(ctx, m.ChatID, reply); err != nil {
+				log.Printf("bot %s: send to %s: %v", b.Transport.Name(), m.ChatID, err)
+			}
+		}
+	}
+}
+
+// Handle answers one message.
+func (b *Bot) Handle(ctx context.Context, m Incoming) string {
+	text := strings.TrimSpace(m.Text)
+	if text == "" {
+		return ""
+	}
+	cmd, arg := splitCommand(text)
+	if cmd == "/start" || cmd == "/help" {
+		return fmt.Sprintf("%s\n\nВаш id: %s", helpText, m.UserID)
+	}
+	acc, ok := b.Accounts.Lookup(b.Transport.Name(), m.UserID)
+	if !ok {
+		return fmt.Sprintf("Нет доступа. Попросите администратора добавить ваш id %s в список пользователей бота.", m.UserID)
+	}
+	key := m.ChatID + "/" + m.UserID
+	switch cmd {
+	case "/cancel":
+		b.clear(key)
+		return "Ок, отменил."
+	case "/log", "/dry":
+		b.clear(key)
+		return b.worklog(ctx, key, acc, WorklogRequest{Query: arg, DryRun: cmd == "/dry"})
+	case "/search", "/s":
+		b.clear(key)
+		return b.search(ctx, acc, arg)
+	case "":
+	default:
+		return "Неизвестная команда.\n\n" + helpText
+	}
+	if c, ok := b.takePending(key); ok {
+		req, answer := c.req, text
+		if c.asked.Default != "" && isConfirmation(answer) {
+			answer = c.asked.Default
+		}
+		switch c.asked.Need {
+		case "duration":
+			req.DurationText = answer
+		case "date":
+			req.DateText = answer
+		}
+		return b.worklog(ctx, key, acc, req)
+	}
+	if LooksLikeWorklog(text) {
+		return b.worklog(ctx, key, acc, WorklogRequest{Query: text})
+	}
+	return b.search(ctx, acc, text)
+}
+
+func (b *Bot) worklog(ctx context.Context, key string, acc Account, req WorklogRequest) string {
+	if strings.TrimSpace(req.Query) == "" {
+		return "Напишите задачу и время, например: /log QA-959 30m вчера"
+	}
+	reply, err := b.Backend.Worklog(ctx, acc, req)
+	if err != nil {
+		return "Ошибка: " + err.Error()
+	}
+	if reply.Question == "" {
+		return reply.Text
+	}
+	b.mu.Lock()
+	if b.pending == nil {
+		b.pending = make(map[string]clarification)
+	}
+	b.pending[key] = clarification{req: req, asked: reply}
+	b.mu.Unlock()
+	if reply.Default != "" {
+		return fmt.Sprintf("%s\nОтветьте «+», чтобы использовать «%s». /cancel — отменить.", reply.Question, reply.Default)
+	}
+	return reply.Question + "\n/cancel — отменить."
+}
+
+func (b *Bot) search(ctx context.Context, acc Account, query string) string {
+	if strings.TrimSpace(query) == "" {
+		return "Что искать? Например: /search мои открытые баги"
+	}
+	reply, err := b.Backend.Search(ctx, acc, query)
+	if err != nil {
+		return "Ошибка поиска: " + err.Error()
+	}
+	return reply.Text
+}
+
+func (b *Bot) takePending(key string) (clarification, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.pending[key]
+	delete(b.pending, key)
+	return c, ok
+}
+
+func (b *Bot) clear(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.pending, key)
+}
+
+// splitCommand separates a leading /command (dropping a Telegram @botname
+// suffix) from its argument.
+func splitCommand(text string) (cmd, arg string) {
+	if !strings.HasPrefix(text, "/") {
+		return "", text
+	}
+	cmd, arg, _ = strings.Cut(text, " ")
+	cmd, _, _ = strings.Cut(strings.ToLower(cmd), "@")
+	return cmd, strings.TrimSpace(arg)
+}
+
+func isConfirmation(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "+", "да", "ок", "ok", "yes", "y", "д":
+		return true
+	}
+	return false
+}
+
+var (
+	issueKeyRe = regexp.MustCompile(`(?i)\b[a-z][a-z0-9]+\s*[-‐‑–—−]\s*\d+\b`)
+	durationRe = regexp.MustCompile(`(?i)\b\d+\s*(m|h|min|мин|минут[аы]?|час(а|ов)?)\b`)
+)
+
+// LooksLikeWorklog reports whether text is a worklog command rather than a
+// search: it names an issue and asks to log time (like the web UI's check)
+// or simply contains a duration.
+func LooksLikeWorklog(text string) bool {
+	if !issueKeyRe.MatchString(text) {
+		return false
+	}
+	l := strings.ToLower(text)
+	for _, w := range []string{"залог", "логир", "worklog", "спиш", "списа", "time log", "log time", "каждый рабоч"} {
+		if strings.Contains(l, w) {
+			return true
+		}
+	}
+	return durationRe.MatchString(l)
+}
@@ -0,0 +1,153 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// telegramMaxText is the sendMessage text limit; longer replies are split.
+const telegramMaxText = 4096
+
+// Telegram receives updates with getUpdates long polling and answers with
+// sendMessage. BaseURL defaults to https://api.telegram.org.
+type Telegram struct {
+	Token       string
+	BaseURL     string
+	PollTimeout time.Duration // server-side wait of getUpdates; default 30s
+	Client      *http.Client
+
+	offset int64
+}
+
+func (t *Telegram) Name() string { return "telegram" }
+
+func (t *Telegram) Receive(ctx context.Context) ([]Incoming, error) {
+	timeout := t.PollTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	var updates []struct {
+		UpdateID int64 `json:"update_id"`
+		Message  *struct {
+			Text string `json:"text"`
+			Chat struct {
+				ID int64 `json:"id"`
+			} `json:"chat"`
+			From *struct {
+				ID       int64  `json:"id"`
+				Username string `json:"username"`
+			} `json:"from"`
+		} `json:"message"`
+	}
+	err := t.call(ctx, "getUpdates", map[string]any{
+		"offset":          t.offset,
+		"timeout":         int(timeout.Seconds()),
+		"allowed_updates": []string{"message"},
+	}, timeout+10*time.Second, &updates)
+	if err != nil {
+		return nil, err
+	}
+	var out []Incoming
+	for _, u := range updates {
+		t.offset = u.UpdateID + 1
+		if u.Message == nil || u.Message.From == nil {
+			continue
+		}
+		out = append(out, Incoming{
+			ChatID:   strconv.FormatInt(u.Message.Chat.ID, 10),
+			UserID:   strconv.FormatInt(u.Message.From.ID, 10),
+			UserName: u.Message.From.Username,
+			Text:     u.Message.Text,
+		})
+	}
+	return out, nil
+}
+
+func (t *Telegram) Send(ctx context.Context, chatID, text string) error {
+	for _, part := range splitText(text, telegramMaxText) {
+		err := t.call(ctx, "sendMessage", map[string]any{
+			"chat_id":                  chatID,
+			"text":                     part,
+			"disable_web_page_preview": true,
+		}, 15*time.Second, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// call invokes a Bot API method and decodes its result into out.
+func (t *Telegram) call(ctx context.Context, method string, params any, timeout time.Duration, out any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	base := strings.TrimRight(t.BaseURL, "/")
+	if base == "" {
+		base = "https://api.telegram.org"
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/bot"+t.Token+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := t.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL carries the token; keep it out of logs.
+		return errors.New(strings.ReplaceAll(err.Error(), t.Token, "***"))
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return err
+	}
+	var envelope struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("%s: status %d", method, resp.StatusCode)
+	}
+	if !envelope.OK {
+		return fmt.Errorf("%s: %s", method, envelope.Description)
+	}
+	if out != nil {
+		return json.Unmarshal(envelope.Result, out)
+	}
+	return nil
+}
+
+// splitText cuts text into chunks of at most max runes, preferring line
+// breaks.
+func splitText(text string, max int) []string {
+	var parts []string
+	r := []rune(text)
+	for len(r) > max {
+		cut := max
+		for i := max; i > max/2; i-- {
+			if r[i-1] == '\n' {
+				cut = i
+				break
+			}
+		}
+		parts = append(parts, string(r[:cut]))
+		r = r[cut:]
+	}
+	return append(parts, string(r))
+}
@@ -19,36 +19,187 @@ type Config struct {
 	OpenAIKey    string
 	OpenAIModel  string
 	BoardID      int
+
+	// LLM providers. LLMProvider picks the default (openai, local, anthropic, fake);
+	// when empty the first configured one wins.
+	LLMProvider    string
+	OpenAIBaseURL  string
+	AnthropicKey   string
+	AnthropicModel string
+	LocalLLMURL    string
+	LocalLLMModel  string
+
+	// AnalysisChunkTokens bounds each chunk sent to the LLM during analysis.
+	AnalysisChunkTokens int
+
+	// Per-issue ("каждую задачу") analysis: parallel requests, issue cap and the
+	// number of days in one status after which an open issue counts as stale.
+	DeepConcurrency int
+	DeepMaxIssues   int
+	StaleDays       int
+
+	// TestCaseMaxIssues caps how many issues one test-case generation covers.
+	TestCaseMaxIssues int
+
+	// ThreadMaxTokens bounds the follow-up conversation sent verbatim; older
+	// turns are summarised.
+	ThreadMaxTokens int
+
+	// Semantic history search: "hash" (offline, default), "openai" or "local"
+	// (an OpenAI-compatible server at LOCAL_LLM_BASE_URL).
+	EmbeddingsProvider string
+	EmbeddingsModel    string
+
+	// History storage: "bolt" (embedded database, default) or "json" (the
+	// legacy history.json). Zero limits disable that part of the retention.
+	HistoryBackend    string
+	HistoryMaxEntries int
+	HistoryMaxAgeDays int
+
+	// Notifiers for saved-search reports and worklog events. The outbox (a
+	// directory of JSON files) is always on; the others are enabled when
+	// configured. NotifyEvents limits which server events are pushed (empty
+	// means all).
+	NotifyOutboxDir     string
+	NotifyWebhookURL    string
+	NotifyWebhookSecret string
+	NotifyEvents        []string
+	SlackWebhookURL     string
+	SlackChannel        string
+	TelegramBotToken    string
+	TelegramChatID      string
+	TelegramAPIURL      string
+	SMTPAddr            string
+	SMTPFrom            string
+	SMTPTo              []string
+	SMTPUser            string
+	SMTPPassword        string
+
+	// Chat bot: BotTransport "telegram" (empty disables it) uses
+	// TELEGRAM_BOT_TOKEN; BotUsersFile maps chat users to Jira accounts.
+	BotTransport string
+	BotUsersFile string
+
+	// Multi-user mode: everyone logs in with their own Jira account, whose
+	// password is kept encrypted with UsersKey (USERS_KEY, or a key derived
+	// from the secrets master key). JIRA_USER/JIRA_PASSWORD become optional.
+	MultiUser       bool
+	UsersKey        string
+	SessionTTLHours int
+
+	// API auth: AuthRequired rejects anonymous API requests (always on in
+	// multi-user mode); AuthAllowIPs limits clients to these IPs/CIDRs.
+	AuthRequired  bool
+	AuthAllowIPs  []string
+	APITokensFile string
+
+	// ConfigFile is the YAML/TOML policy file (see Policy); empty means
+	// the built-in defaults.
+	ConfigFile string
 }
 
 func Load() (Config, error) {
-	// Convenience for local dev: allow credentials in ./env.local or ./.env.local (gitignored).
-	loadEnvFileIfPresent("env.local")
-	loadEnvFileIfPresent(".env.local")
+	LoadEnvFiles()
+
+	// Secrets come from the environment first, then SECRETS_PROVIDER.
+	provider, err := SecretsProvider()
+	if err != nil {
+		return Config{}, err
+	}
+	var secretErr error
+	secret := func(key string) string {
+		v, _, err := provider.Get(key)
+		if err != nil && secretErr == nil {
+			secretErr = err
+		}
+		return v
+	}
 
 	cfg := Config{
 		Addr:     env("ADDR", ":8080"),
 		JiraHost: env("JIRA_HOST", ""),
 		JiraUser: env("JIRA_USER", ""),
-		JiraPassword: env("JIRA_PASSWORD", func() string {
-			if v := os.Getenv("JIRA_PASS"); v != "" {
+		JiraPassword: func() string {
+			if v := secret("JIRA_PASSWORD"); v != "" {
 				return v
 			}
-			return ""
-		}()),
+			return os.Getenv("JIRA_PASS")
+		}(),
 		WebDir:      env("WEB_DIR", filepath.Join(".", "web")),
 		DataDir:     env("DATA_DIR", filepath.Join(".", "data")),
-		OpenAIKey:   env("OPENAI_API_KEY", ""),
+		OpenAIKey:   secret("OPENAI_API_KEY"),
 		OpenAIModel: env("OPENAI_MODEL", "gpt-4o-mini"),
 		BoardID:     intFromEnv("JIRA_BOARD_ID", 0),
+
+		LLMProvider:    env("LLM_PROVIDER", ""),
+		OpenAIBaseURL:  env("OPENAI_BASE_URL", ""),
+		AnthropicKey:   secret("ANTHROPIC_API_KEY"),
+		AnthropicModel: env("ANTHROPIC_MODEL", ""),
+		LocalLLMURL:    env("LOCAL_LLM_BASE_URL", ""),
+		LocalLLMModel:  env("LOCAL_LLM_MODEL", "llama3.1"),
+
+		AnalysisChunkTokens: intFromEnv("ANALYSIS_CHUNK_TOKENS", 6000),
+		DeepConcurrency:     intFromEnv("DEEP_ANALYSIS_CONCURRENCY", 4),
+		DeepMaxIssues:       intFromEnv("DEEP_ANALYSIS_MAX_ISSUES", 30),
+		StaleDays:           intFromEnv("STALE_DAYS", 14),
+		TestCaseMaxIssues:   intFromEnv("TEST_CASES_MAX_ISSUES", 10),
+		ThreadMaxTokens:     intFromEnv("THREAD_MAX_TOKENS", 3000),
+
+		EmbeddingsProvider: env("EMBEDDINGS_PROVIDER", "hash"),
+		EmbeddingsModel:    env("EMBEDDINGS_MODEL", ""),
+
+		HistoryBackend:    env("HISTORY_BACKEND", "bolt"),
+		HistoryMaxEntries: intFromEnv("HISTORY_MAX_ENTRIES", 1000),
+		HistoryMaxAgeDays: intFromEnv("HISTORY_MAX_AGE_DAYS", 0),
+
+		NotifyWebhookURL:    env("NOTIFY_WEBHOOK_URL", ""),
+		NotifyWebhookSecret: secret("NOTIFY_WEBHOOK_SECRET"),
+		NotifyEvents:        listFromEnv("NOTIFY_EVENTS"),
+		SlackWebhookURL:     secret("SLACK_WEBHOOK_URL"),
+		SlackChannel:        env("SLACK_CHANNEL", ""),
+		TelegramBotToken:    secret("TELEGRAM_BOT_TOKEN"),
+		TelegramChatID:      env("TELEGRAM_CHAT_ID", ""),
+		TelegramAPIURL:      env("TELEGRAM_API_URL", ""),
+		SMTPAddr:            env("SMTP_ADDR", ""),
+		SMTPFrom:            env("SMTP_FROM", ""),
+		SMTPTo:              listFromEnv("SMTP_TO"),
+		SMTPUser:            env("SMTP_USER", ""),
+		SMTPPassword:        secret("SMTP_PASSWORD"),
 	}
 
+	cfg.NotifyOutboxDir = env("NOTIFY_OUTBOX_DIR", filepath.Join(cfg.DataDir, "outbox"))
+	cfg.BotTransport = env("BOT_TRANSPORT", "")
+	cfg.BotUsersFile = env("BOT_USERS_FILE", filepath.Join(cfg.DataDir, "bot_users.json"))
+	cfg.MultiUser = boolFromEnv("MULTI_USER", false)
+	cfg.AuthRequired = boolFromEnv("AUTH_REQUIRED", true) || cfg.MultiUser
+	cfg.AuthAllowIPs = listFromEnv("AUTH_ALLOW_IPS")
+	cfg.APITokensFile = env("API_TOKENS_FILE", filepath.Join(cfg.DataDir, "api_tokens.json"))
+	cfg.UsersKey = secret("USERS_KEY")
+	cfg.SessionTTLHours = intFromEnv("SESSION_TTL_HOURS", 24)
+	cfg.ConfigFile = env("CONFIG_FILE", defaultConfigFile())
+
+	if secretErr != nil {
+		return Config{}, secretErr
+	}
+	if cfg.MultiUser {
+		if cfg.JiraHost == "" {
+			return Config{}, errors.New("JIRA_HOST is required")
+		}
+		return cfg, nil
+	}
 	if cfg.JiraHost == "" || cfg.JiraUser == "" || cfg.JiraPassword == "" {
 		return Config{}, errors.New("JIRA_HOST, JIRA_USER, JIRA_PASSWORD are required")
 	}
 	return cfg, nil
 }
 
+// LoadEnvFiles reads ./env.local and ./.env.local (gitignored) into the
+// environment without overriding variables that are already set.
+func LoadEnvFiles() {
+	loadEnvFileIfPresent("env.local")
+	loadEnvFileIfPresent(".env.local")
+}
+
 func env(key, def string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -89,6 +240,16 @@ func loadEnvFileIfPresent(filename string) {
 	}
 }
 
+func boolFromEnv(key string, def bool) bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(key))) {
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	}
+	return def
+}
+
 func intFromEnv(key string, def int) int {
 	v := os.Getenv(key)
 	if v == "" {
@@ -101,6 +262,42 @@ func intFromEnv(key string, def int) int {
 	return i
 }
 
+// defaultConfigFile returns the first of ./config.yaml, ./config.yml and
+// ./config.toml that exists.
+func defaultConfigFile() string {
+	for _, name := range []string{"config.yaml", "config.yml", "config.toml"} {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// Redacted returns a copy of c with every secret replaced by "***", for
+// showing the configuration.
+func (c Config) Redacted() Config {
+	for _, s := range []*string{
+		&c.JiraPassword, &c.OpenAIKey, &c.AnthropicKey, &c.NotifyWebhookSecret,
+		&c.SlackWebhookURL, &c.TelegramBotToken, &c.SMTPPassword, &c.UsersKey,
+	} {
+		if *s != "" {
+			*s = "***"
+		}
+	}
+	return c
+}
+
 func (c Config) String() string {
 	return fmt.Sprintf("addr=%s jira=%s user=%s web=%s data=%s", c.Addr, c.JiraHost, c.JiraUser, c.WebDir, c.DataDir)
 }
+
+// listFromEnv splits a comma-separated variable, dropping empty items.
+func listFromEnv(key string) []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,314 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Policy is the team policy kept in CONFIG_FILE (YAML or TOML, by
+// extension): the rules that used to be hardcoded in handlers. Unlike the
+// env settings it is reloaded while the server runs. An omitted section
+// keeps the built-in default.
+type Policy struct {
+	// TimeZone is used for worklog days, autofill and saved-search schedules.
+	TimeZone string        `json:"timeZone" yaml:"timeZone" toml:"timeZone"`
+	Projects ProjectPolicy `json:"projects" yaml:"projects" toml:"projects"`
+	Sprints  SprintPolicy  `json:"sprints" yaml:"sprints" toml:"sprints"`
+	Worklog  WorklogPolicy `json:"worklog" yaml:"worklog" toml:"worklog"`
+
+	loc *time.Location
+}
+
+// ProjectPolicy: Hidden projects are left out of /api/projects.
+type ProjectPolicy struct {
+	Hidden []string `json:"hidden" yaml:"hidden" toml:"hidden"`
+}
+
+// SprintPolicy says which projects have sprints and on which board.
+// Projects limits /api/projects/{key}/sprints (empty means all). Boards
+// pins a project to a board instead of discovering its scrum boards in
+// Jira, and DefaultProject is the project whose board answers sprint
+// questions in a search that names no project. StoryPointsField
+// (customfield_NNN) is read by sprint reports; empty means the field named
+// "Story Points" in the metadata catalog.
+type SprintPolicy struct {
+	Projects         []string       `json:"projects" yaml:"projects" toml:"projects"`
+	Boards           map[string]int `json:"boards" yaml:"boards" toml:"boards"`
+	DefaultProject   string         `json:"defaultProject" yaml:"defaultProject" toml:"defaultProject"`
+	StoryPointsField string         `json:"storyPointsField,omitempty" yaml:"storyPointsField" toml:"storyPointsField"`
+}
+
+// WorklogPolicy drives autofill and logged time: Schedule is the time logged
+// per weekday ("monday": "30m"; a missing day is a day off) and StartTime the
+// local time worklogs start at.
+type WorklogPolicy struct {
+	StartTime string            `json:"startTime" yaml:"startTime" toml:"startTime"`
+	Schedule  map[string]string `json:"schedule" yaml:"schedule" toml:"schedule"`
+}
+
+// DefaultPolicy is what the server used before CONFIG_FILE existed.
+func DefaultPolicy() Policy {
+	p := Policy{
+		TimeZone: "Europe/Kiev",
+		Projects: ProjectPolicy{Hidden: []string{
+			"AMP", "CONE", "COR", "CRED", "DEEP", "TP", "IC",
+			"SEC", "MS", "QAD", "SEN", "SIMTW", "TDS", "WU",
+		}},
+		Sprints: SprintPolicy{Boards: map[string]int{}},
+		Worklog: WorklogPolicy{
+			StartTime: "09:00",
+			Schedule: map[string]string{
+				"monday":    "30m",
+				"tuesday":   "45m",
+				"wednesday": "30m",
+				"thursday":  "1h30m",
+				"friday":    "30m",
+			},
+		},
+	}
+	_ = p.Validate()
+	return p
+}
+
+// weekdays maps schedule keys to time.Weekday.
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday,
+	"wednesday": time.Wednesday, "thursday": time.Thursday, "friday": time.Friday,
+	"saturday": time.Saturday,
+}
+
+// ParsePolicy decodes a policy file; format is "yaml" or "toml". Unknown
+// keys are errors so a typo does not silently fall back to a default.
+func ParsePolicy(data []byte, format string) (Policy, error) {
+	p := DefaultPolicy()
+	// Maps are decoded into nil so the file replaces the defaults rather
+	// than merging with them.
+	p.Sprints.Boards = nil
+	p.Worklog.Schedule = nil
+	switch format {
+	case "yaml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&p); err != nil && !errors.Is(err, io.EOF) {
+			return Policy{}, err
+		}
+	case "toml":
+		md, err := toml.Decode(string(data), &p)
+		if err != nil {
+			return Policy{}, err
+		}
+		if keys := md.Undecoded(); len(keys) > 0 {
+			return Policy{}, fmt.Errorf("unknown key %s", keys[0])
+		}
+	default:
+		return Policy{}, fmt.Errorf("unsupported config format %q (yaml or toml)", format)
+	}
+	def := DefaultPolicy()
+	if p.Sprints.Boards == nil {
+		p.Sprints.Boards = def.Sprints.Boards
+	}
+	if p.Worklog.Schedule == nil {
+		p.Worklog.Schedule = def.Worklog.Schedule
+	}
+	if p.TimeZone == "" {
+		p.TimeZone = def.TimeZone
+	}
+	if p.Worklog.StartTime == "" {
+		p.Worklog.StartTime = def.Worklog.StartTime
+	}
+	return p, p.Validate()
+}
+
+// LoadPolicy reads the policy file at path; the format follows the
+// extension (.yaml, .yml or .toml).
+func LoadPolicy(path string) (Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Policy{}, err
+	}
+	var format string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		format = "yaml"
+	case ".toml":
+		format = "toml"
+	default:
+		return Policy{}, fmt.Errorf("%s: unknown config extension (use .yaml, .yml or .toml)", path)
+	}
+	p, err := ParsePolicy(data, format)
+	if err != nil {
+		return Policy{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Validate checks the policy against its schema, reporting every problem
+// with its key path, and normalises project keys to upper case.
+func (p *Policy) Validate() error {
+	var errs []error
+	bad := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	loc, err := time.LoadLocation(p.TimeZone)
+	if err != nil {
+		bad("timeZone", "unknown time zone %q", p.TimeZone)
+	} else {
+		p.loc = loc
+	}
+
+	p.Projects.Hidden = upperKeys(p.Projects.Hidden, "projects.hidden", bad)
+	p.Sprints.Projects = upperKeys(p.Sprints.Projects, "sprints.projects", bad)
+	boards := make(map[string]int, len(p.Sprints.Boards))
+	for k, id := range p.Sprints.Boards {
+		key := strings.ToUpper(strings.TrimSpace(k))
+		if !validProjectKey(key) {
+			bad("sprints.boards", "invalid project key %q", k)
+		}
+		if id <= 0 {
+			bad("sprints.boards."+k, "board id must be positive, got %d", id)
+		}
+		boards[key] = id
+	}
+	p.Sprints.Boards = boards
+	p.Sprints.DefaultProject = strings.ToUpper(strings.TrimSpace(p.Sprints.DefaultProject))
+	if p.Sprints.DefaultProject != "" && !validProjectKey(p.Sprints.DefaultProject) {
+		bad("sprints.defaultProject", "invalid project key %q", p.Sprints.DefaultProject)
+	}
+
+	p.Sprints.StoryPointsField = strings.TrimSpace(p.Sprints.StoryPointsField)
+	if f := p.Sprints.StoryPointsField; f != "" && !strings.HasPrefix(f, "customfield_") {
+		bad("sprints.storyPointsField", "want a field id such as customfield_10002, got %q", f)
+	}
+
+	if _, _, ok := parseClock(p.Worklog.StartTime); !ok {
+		bad("worklog.startTime", "want HH:MM, got %q", p.Worklog.StartTime)
+	}
+	schedule := make(map[string]string, len(p.Worklog.Schedule))
+	for day, spent := range p.Worklog.Schedule {
+		d := strings.ToLower(strings.TrimSpace(day))
+		if _, ok := weekdays[d]; !ok {
+			bad("worklog.schedule", "unknown weekday %q (monday … sunday)", day)
+			continue
+		}
+		secs, err := parseSpent(spent)
+		if err != nil || secs <= 0 || secs > 24*3600 {
+			bad("worklog.schedule."+d, "want a duration such as 30m or 1h30m, got %q", spent)
+		}
+		schedule[d] = spent
+	}
+	p.Worklog.Schedule = schedule
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errors.Join(errs...)
+}
+
+// Location returns the policy time zone.
+func (p *Policy) Location() *time.Location {
+	if p.loc == nil {
+		return time.UTC
+	}
+	return p.loc
+}
+
+// WorkSeconds returns the seconds to log on day; ok is false on a day off.
+func (p *Policy) WorkSeconds(day time.Weekday) (int, bool) {
+	for name, wd := range weekdays {
+		if wd != day {
+			continue
+		}
+		spent, ok := p.Worklog.Schedule[name]
+		if !ok {
+			return 0, false
+		}
+		secs, err := parseSpent(spent)
+		return secs, err == nil && secs > 0
+	}
+	return 0, false
+}
+
+// StartOf returns the time worklogs for day start at in the policy zone.
+func (p *Policy) StartOf(day time.Time) time.Time {
+	h, m, _ := parseClock(p.Worklog.StartTime)
+	day = day.In(p.Location())
+	return time.Date(day.Year(), day.Month(), day.Day(), h, m, 0, 0, p.Location())
+}
+
+// ProjectHidden reports whether key is in projects.hidden.
+func (p *Policy) ProjectHidden(key string) bool {
+	return containsFold(p.Projects.Hidden, key)
+}
+
+// SprintsEnabled reports whether sprints are listed for project.
+func (p *Policy) SprintsEnabled(project string) bool {
+	return len(p.Sprints.Projects) == 0 || containsFold(p.Sprints.Projects, project)
+}
+
+// BoardFor returns the configured board of project.
+func (p *Policy) BoardFor(project string) (int, bool) {
+	id, ok := p.Sprints.Boards[strings.ToUpper(project)]
+	return id, ok
+}
+
+func upperKeys(keys []string, field string, bad func(string, string, ...any)) []string {
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		key := strings.ToUpper(strings.TrimSpace(k))
+		if !validProjectKey(key) {
+			bad(field, "invalid project key %q", k)
+			continue
+		}
+		out = append(out, key)
+	}
+	return out
+}
+
+// validProjectKey accepts Jira project keys: a letter, then letters, digits
+// or underscores.
+func validProjectKey(key string) bool {
+	if key == "" || key[0] < 'A' || key[0] > 'Z' {
+		return false
+	}
+	for _, r := range key {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSpent parses "30m", "1h30m" or "1h 30m".
+func parseSpent(s string) (int, error) {
+	d, err := time.ParseDuration(strings.ReplaceAll(strings.TrimSpace(s), " ", ""))
+	if err != nil {
+		return 0, err
+	}
+	return int(d / time.Second), nil
+}
+
+func parseClock(s string) (h, m int, ok bool) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, 0, false
+	}
+	return t.Hour(), t.Minute(), true
+}
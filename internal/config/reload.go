@@ -0,0 +1,122 @@
+package config
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PolicyStore holds the current policy and reloads it from its file. Readers
+// always see a complete policy: a file that fails validation is reported and
+// the previous policy stays in force.
+type PolicyStore struct {
+	path string
+	cur  atomic.Pointer[Policy]
+
+	mu       sync.Mutex
+	modTime  time.Time
+	size     int64
+	loadedAt time.Time
+}
+
+// OpenPolicy loads the policy file at path; an empty path means the
+// built-in defaults. Errors are fatal at startup.
+func OpenPolicy(path string) (*PolicyStore, error) {
+	s := &PolicyStore{path: path}
+	if path == "" {
+		p := DefaultPolicy()
+		s.cur.Store(&p)
+		s.loadedAt = time.Now().UTC()
+		return s, nil
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get returns the current policy; callers must not modify it.
+func (s *PolicyStore) Get() *Policy {
+	return s.cur.Load()
+}
+
+// Path is the policy file, empty when the defaults are used.
+func (s *PolicyStore) Path() string { return s.path }
+
+// LoadedAt is when the current policy was loaded.
+func (s *PolicyStore) LoadedAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadedAt
+}
+
+// Reload re-reads the file and swaps the policy in when it is valid.
+func (s *PolicyStore) Reload() error {
+	if s.path == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	p, err := LoadPolicy(s.path)
+	if err != nil {
+		return err
+	}
+	s.cur.Store(&p)
+	s.modTime, s.size = fi.ModTime(), fi.Size()
+	s.loadedAt = time.Now().UTC()
+	return nil
+}
+
+// changed reports whether the file differs from the one last loaded.
+func (s *PolicyStore) changed() bool {
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !fi.ModTime().Equal(s.modTime) || fi.Size() != s.size
+}
+
+// Watch reloads the policy when a value arrives on hup (SIGHUP) or when the
+// file's modification time or size changes, checked every interval, until
+// ctx is cancelled.
+func (s *PolicyStore) Watch(ctx context.Context, interval time.Duration, hup <-chan os.Signal) {
+	if s.path == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var reason string
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			reason = "SIGHUP"
+		case <-ticker.C:
+			if !s.changed() {
+				continue
+			}
+			reason = "file changed"
+		}
+		if err := s.Reload(); err != nil {
+			// Remember the broken file so it is not reported every tick.
+			if fi, statErr := os.Stat(s.path); statErr == nil {
+				s.mu.Lock()
+				s.modTime, s.size = fi.ModTime(), fi.Size()
+				s.mu.Unlock()
+			}
+			log.Printf("config: reload (%s) failed, keeping the previous policy: %v", reason, err)
+			continue
+		}
+		log.Printf("config: reloaded %s (%s)", s.path, reason)
+	}
+}
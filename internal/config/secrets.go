@@ -0,0 +1,87 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/alekseymerzlyakov/jira/internal/secrets"
+)
+
+// SecretKeys are the variables Load reads through the secrets provider
+// rather than plain env.
+var SecretKeys = []string{
+	"JIRA_PASSWORD",
+	"OPENAI_API_KEY",
+	"ANTHROPIC_API_KEY",
+	"SMTP_PASSWORD",
+	"TELEGRAM_BOT_TOKEN",
+	"NOTIFY_WEBHOOK_SECRET",
+	"SLACK_WEBHOOK_URL",
+	"USERS_KEY",
+}
+
+// SecretsProvider returns the environment followed by the provider chosen
+// with SECRETS_PROVIDER: "file" (SECRETS_FILE, unlocked by the master key)
+// or "command" (SECRETS_COMMAND, e.g. "pass show jira/{key}").
+func SecretsProvider() (secrets.Provider, error) {
+	chain := secrets.Chain{secrets.Env{}}
+	switch p := env("SECRETS_PROVIDER", "env"); p {
+	case "env":
+	case "file":
+		f, err := OpenSecretsFile()
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, f)
+	case "command":
+		tmpl := env("SECRETS_COMMAND", "")
+		if tmpl == "" {
+			return nil, errors.New("SECRETS_PROVIDER=command needs SECRETS_COMMAND")
+		}
+		chain = append(chain, secrets.Command{Template: tmpl})
+	default:
+		return nil, fmt.Errorf("unknown SECRETS_PROVIDER %q (env, file or command)", p)
+	}
+	return chain, nil
+}
+
+// SecretsFilePath is SECRETS_FILE, by default DATA_DIR/secrets.enc.
+func SecretsFilePath() string {
+	return env("SECRETS_FILE", filepath.Join(env("DATA_DIR", filepath.Join(".", "data")), "secrets.enc"))
+}
+
+// OpenSecretsFile opens the encrypted secrets file with the master key.
+func OpenSecretsFile() (*secrets.File, error) {
+	key, err := MasterKey()
+	if err != nil {
+		return nil, err
+	}
+	return secrets.OpenFile(SecretsFilePath(), key)
+}
+
+// MasterKey reads the secrets file key from SECRETS_MASTER_KEY or the file
+// named by SECRETS_MASTER_KEY_FILE. It is deliberately not read from the
+// secrets provider or a default location next to the encrypted file.
+func MasterKey() ([]byte, error) {
+	if v := os.Getenv("SECRETS_MASTER_KEY"); v != "" {
+		key, err := secrets.DecodeKey(v)
+		if err != nil {
+			return nil, fmt.Errorf("SECRETS_MASTER_KEY: %w", err)
+		}
+		return key, nil
+	}
+	if p := os.Getenv("SECRETS_MASTER_KEY_FILE"); p != "" {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("SECRETS_MASTER_KEY_FILE: %w", err)
+		}
+		key, err := secrets.DecodeKey(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("SECRETS_MASTER_KEY_FILE: %w", err)
+		}
+		return key, nil
+	}
+	return nil, errors.New("SECRETS_MASTER_KEY or SECRETS_MASTER_KEY_FILE is required")
+}
@@ -0,0 +1,143 @@
+// Package conversation keeps the follow-up thread of a history entry: turns
+// are appended as commands are answered and, once the thread outgrows its
+// token budget, older turns are condensed into a running summary.
+package conversation
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/history"
+	"github.com/alekseymerzlyakov/jira/internal/llm"
+)
+
+// Defaults of Memory.
+const (
+	DefaultMaxTokens = 3000
+	DefaultKeepTurns = 4
+)
+
+// Memory decides which part of a thread is sent with the next command.
+type Memory struct {
+	Summarizer llm.FollowUpper
+	// MaxTokens bounds the turns sent verbatim; older ones are summarised.
+	MaxTokens int
+	// KeepTurns is how many recent turns are always sent verbatim.
+	KeepTurns int
+}
+
+// Prepare returns the turns to send with the next command, oldest first.
+// When the unsummarised turns exceed MaxTokens, all but the last KeepTurns are
+// folded into a new summary and updated is a copy of t carrying it; t itself
+// is never modified, since it may be shared with the history store. If
+// summarising fails the recent turns are still returned along with the
+// error, so callers can go on with a shorter memory.
+func (m Memory) Prepare(ctx context.Context, t *history.Thread) (msgs []llm.Message, updated *history.Thread, err error) {
+	if t == nil {
+		return nil, nil, nil
+	}
+	maxTokens := m.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = DefaultMaxTokens
+	}
+	keep := m.KeepTurns
+	if keep <= 0 {
+		keep = DefaultKeepTurns
+	}
+	cp := *t
+	changed := false
+	if cp.Summarized > len(cp.Turns) {
+		cp.Summarized = 0
+		cp.Summary = ""
+		changed = true
+	}
+	if tokens(cp.Turns[cp.Summarized:]) > maxTokens {
+		// Cut on a user turn: providers expect the history to start with one.
+		cut := len(cp.Turns) - keep
+		for cut > cp.Summarized && cp.Turns[cut].Role != llm.RoleUser {
+			cut--
+		}
+		if cut > cp.Summarized {
+			summary, serr := m.Summarizer.SummarizeThread(ctx, cp.Summary, messages(cp.Turns[cp.Summarized:cut]))
+			if serr != nil {
+				if changed {
+					updated = &cp
+				}
+				return messages(cp.Turns[cut:]), updated, serr
+			}
+			cp.Summary = strings.TrimSpace(summary)
+			cp.Summarized = cut
+			changed = true
+		}
+	}
+	if changed {
+		updated = &cp
+	}
+	return messages(cp.Turns[cp.Summarized:]), updated, nil
+}
+
+// WithSummary appends the summary of earlier turns to a follow-up context.
+func WithSummary(contextText string, t *history.Thread) string {
+	if t == nil || t.Summary == "" {
+		return contextText
+	}
+	return contextText + "Earlier conversation (summary): " + t.Summary + "\n"
+}
+
+// Append adds a turn to the thread of e, creating the thread if needed.
+func Append(e *history.Entry, role, content string, usage *history.Usage, now time.Time) {
+	if e.Thread == nil {
+		e.Thread = &history.Thread{}
+	}
+	e.Thread.Turns = append(e.Thread.Turns, history.Turn{
+		Role:      role,
+		Content:   content,
+		Tokens:    llm.EstimateTokens(content),
+		Usage:     usage,
+		CreatedAt: now,
+	})
+}
+
+// Fork copies e under a new ID with the first n turns of its thread (all of
+// them when n <= 0 or beyond the length), so a conversation can branch off
+// without touching the original.
+func Fork(e history.Entry, n int, now time.Time) history.Entry {
+	fork := e
+	fork.ID = history.NewID()
+	fork.ForkedFrom = e.ID
+	fork.CreatedAt = now
+	fork.Steps = append([]history.Step(nil), e.Steps...)
+	fork.Issues = append([]history.IssueSnapshot(nil), e.Issues...)
+	if e.Thread == nil {
+		return fork
+	}
+	t := *e.Thread
+	if n <= 0 || n > len(t.Turns) {
+		n = len(t.Turns)
+	}
+	t.Turns = append([]history.Turn(nil), t.Turns[:n]...)
+	if t.Summarized > n {
+		// The summary covers turns that are not part of the fork.
+		t.Summary = ""
+		t.Summarized = 0
+	}
+	fork.Thread = &t
+	return fork
+}
+
+func messages(turns []history.Turn) []llm.Message {
+	out := make([]llm.Message, 0, len(turns))
+	for _, t := range turns {
+		out = append(out, llm.Message{Role: t.Role, Content: t.Content})
+	}
+	return out
+}
+
+func tokens(turns []history.Turn) int {
+	n := 0
+	for _, t := range turns {
+		n += t.Tokens
+	}
+	return n
+}
@@ -0,0 +1,49 @@
+package conversation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alekseymerzlyakov/jira/internal/history"
+	"github.com/alekseymerzlyakov/jira/internal/llm"
+)
+
+type summarizer struct{}
+
+func (summarizer) FollowUp(context.Context, string, []llm.Message, string) (string, error) {
+	return "", nil
+}
+
+func (summarizer) SummarizeThread(_ context.Context, previous string, turns []llm.Message) (string, error) {
+	return previous + "+summary", nil
+}
+
+func TestPrepareLeavesThreadAlone(t *testing.T) {
+	thread := &history.Thread{}
+	for i := 0; i < 6; i++ {
+		role := llm.RoleUser
+		if i%2 == 1 {
+			role = llm.RoleAssistant
+		}
+		thread.Turns = append(thread.Turns, history.Turn{Role: role, Content: "turn", Tokens: 100})
+	}
+	m := Memory{Summarizer: summarizer{}, MaxTokens: 300, KeepTurns: 2}
+
+	msgs, updated, err := m.Prepare(context.Background(), thread)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thread.Summary != "" || thread.Summarized != 0 {
+		t.Errorf("Prepare modified its input: %+v", thread)
+	}
+	if updated == nil || updated.Summary != "+summary" || updated.Summarized != 4 {
+		t.Fatalf("updated = %+v, want the first 4 turns summarised", updated)
+	}
+	if len(msgs) != 2 {
+		t.Errorf("got %d messages, want the 2 kept turns", len(msgs))
+	}
+
+	if _, again, _ := m.Prepare(context.Background(), updated); again != nil {
+		t.Errorf("a thread within budget was updated again: %+v", again)
+	}
+}
@@ -0,0 +1,409 @@
+package history
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// entriesBucket maps timeKey(CreatedAt, ID) to the gzip-compressed JSON
+	// entry, so cursors walk it in chronological order.
+	entriesBucket = []byte("entries")
+	// idsBucket maps an entry ID to its key in entriesBucket.
+	idsBucket = []byte("ids")
+	// parentsBucket indexes refined entries: ParentID + 0 + timeKey.
+	parentsBucket = []byte("parents")
+	// pinnedBucket holds the IDs of pinned entries, which retention skips.
+	pinnedBucket = []byte("pinned")
+	// metaBucket holds the entry and pinned counters retention compares
+	// against MaxEntries, so Append never has to walk a bucket to count it.
+	metaBucket = []byte("meta")
+
+	entriesCount = []byte("entries")
+	pinnedCount  = []byte("pinned")
+)
+
+// BoltStore persists history in an embedded bbolt database. Entries are
+// compressed, lookups by ID use an index and only the changed entry is
+// written, so it scales to histories far larger than Store.
+type BoltStore struct {
+	db        *bolt.DB
+	retention Retention
+}
+
+// OpenBolt opens (or creates) the database at path.
+func OpenBolt(path string, retention Retention) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{entriesBucket, idsBucket, parentsBucket, pinnedBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil || meta.Get(entriesCount) != nil {
+			return err
+		}
+		if err := setCount(tx, entriesCount, 0); err != nil {
+			return err
+		}
+		return setCount(tx, pinnedCount, 0)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db, retention: retention}, nil
+}
+
+// Close releases the database file.
+func (s *BoltStore) Close() error { return s.db.Close() }
+
+// Append adds an entry (replacing one with the same ID) and applies the
+// retention policy.
+func (s *BoltStore) Append(e Entry) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := put(tx, e); err != nil {
+			return err
+		}
+		_, err := s.prune(tx, time.Now())
+		return err
+	})
+}
+
+// Update replaces the stored entry with the same ID.
+func (s *BoltStore) Update(e Entry) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(idsBucket).Get([]byte(e.ID)) == nil {
+			return ErrNotFound
+		}
+		return put(tx, e)
+	})
+}
+
+// Modify applies fn to the stored entry with the given ID and saves it in the
+// same transaction.
+func (s *BoltStore) Modify(id string, fn func(*Entry) error) (Entry, error) {
+	var out Entry
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		e, ok, err := get(tx, id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrNotFound
+		}
+		// e is freshly decoded, so fn cannot touch the stored copy.
+		out = e
+		if err := fn(&e); err != nil {
+			return err
+		}
+		out = e
+		return put(tx, e)
+	})
+	return out, err
+}
+
+// Get returns entry by ID.
+func (s *BoltStore) Get(id string) (Entry, bool) {
+	var (
+		e  Entry
+		ok bool
+	)
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		e, ok, err = get(tx, id)
+		return err
+	})
+	return e, ok
+}
+
+// Latest returns up to n most recent entries (newest first).
+func (s *BoltStore) Latest(n int) []Entry {
+	out := make([]Entry, 0)
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(entriesBucket).Cursor()
+		for k, v := c.Last(); k != nil && (n <= 0 || len(out) < n); k, v = c.Prev() {
+			e, err := decode(v)
+			if err != nil {
+				return err
+			}
+			out = append(out, e)
+		}
+		return nil
+	})
+	return out
+}
+
+// Children returns the entries refined from parentID, newest first.
+func (s *BoltStore) Children(parentID string) []Entry {
+	out := make([]Entry, 0)
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		prefix := parentKey(parentID, nil)
+		entries := tx.Bucket(entriesBucket)
+		var keys [][]byte
+		c := tx.Bucket(parentsBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			keys = append(keys, k[len(prefix):])
+		}
+		for i := len(keys) - 1; i >= 0; i-- {
+			e, err := decode(entries.Get(keys[i]))
+			if err != nil {
+				return err
+			}
+			out = append(out, e)
+		}
+		return nil
+	})
+	return out
+}
+
+// Delete removes the entry with the given ID.
+func (s *BoltStore) Delete(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(idsBucket).Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+		return remove(tx, id)
+	})
+}
+
+// List returns one page of entries matching f, newest first.
+func (s *BoltStore) List(f Filter) (Page, error) {
+	page := Page{Entries: make([]Entry, 0)}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(entriesBucket).Cursor()
+		var k, v []byte
+		if f.Cursor != "" {
+			key := tx.Bucket(idsBucket).Get([]byte(f.Cursor))
+			if key == nil {
+				return ErrBadCursor
+			}
+			c.Seek(key)
+			k, v = c.Prev()
+		} else {
+			k, v = c.Last()
+		}
+		for ; k != nil; k, v = c.Prev() {
+			if !f.From.IsZero() && keyTime(k).Before(f.From) {
+				break
+			}
+			e, err := decode(v)
+			if err != nil {
+				return err
+			}
+			if !f.match(e) {
+				continue
+			}
+			if len(page.Entries) == f.limit() {
+				page.NextCursor = page.Entries[len(page.Entries)-1].ID
+				break
+			}
+			page.Entries = append(page.Entries, e)
+		}
+		return nil
+	})
+	return page, err
+}
+
+// Prune drops entries outside the retention policy.
+func (s *BoltStore) Prune() (int, error) {
+	var removed int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		removed, err = s.prune(tx, time.Now())
+		return err
+	})
+	return removed, err
+}
+
+// prune deletes expired entries and the oldest ones above MaxEntries,
+// walking from the oldest key and skipping pinned ones.
+func (s *BoltStore) prune(tx *bolt.Tx, now time.Time) (int, error) {
+	r := s.retention
+	if r.MaxEntries <= 0 && r.MaxAge <= 0 {
+		return 0, nil
+	}
+	pinned := tx.Bucket(pinnedBucket)
+	over := 0
+	if r.MaxEntries > 0 {
+		over = count(tx, entriesCount) - count(tx, pinnedCount) - r.MaxEntries
+	}
+	var ids []string
+	c := tx.Bucket(entriesBucket).Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		if len(ids) >= over && !r.expired(keyTime(k), now) {
+			break
+		}
+		if id := keyID(k); pinned.Get([]byte(id)) == nil {
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range ids {
+		if err := remove(tx, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
+// put writes e and its indexes, dropping any previous version first since
+// its key may differ.
+func put(tx *bolt.Tx, e Entry) error {
+	if err := remove(tx, e.ID); err != nil {
+		return err
+	}
+	data, err := encode(e)
+	if err != nil {
+		return err
+	}
+	key := timeKey(e.CreatedAt, e.ID)
+	if err := tx.Bucket(entriesBucket).Put(key, data); err != nil {
+		return err
+	}
+	if err := tx.Bucket(idsBucket).Put([]byte(e.ID), key); err != nil {
+		return err
+	}
+	if err := addCount(tx, entriesCount, 1); err != nil {
+		return err
+	}
+	if e.Pinned {
+		if err := tx.Bucket(pinnedBucket).Put([]byte(e.ID), nil); err != nil {
+			return err
+		}
+		if err := addCount(tx, pinnedCount, 1); err != nil {
+			return err
+		}
+	}
+	if e.ParentID != "" {
+		return tx.Bucket(parentsBucket).Put(parentKey(e.ParentID, key), nil)
+	}
+	return nil
+}
+
+// remove deletes the entry with the given ID and its indexes, if present.
+func remove(tx *bolt.Tx, id string) error {
+	ids := tx.Bucket(idsBucket)
+	key := ids.Get([]byte(id))
+	if key == nil {
+		return nil
+	}
+	key = append([]byte(nil), key...)
+	entries := tx.Bucket(entriesBucket)
+	old, err := decode(entries.Get(key))
+	if err != nil {
+		return err
+	}
+	if old.ParentID != "" {
+		if err := tx.Bucket(parentsBucket).Delete(parentKey(old.ParentID, key)); err != nil {
+			return err
+		}
+	}
+	if pinned := tx.Bucket(pinnedBucket); pinned.Get([]byte(id)) != nil {
+		if err := pinned.Delete([]byte(id)); err != nil {
+			return err
+		}
+		if err := addCount(tx, pinnedCount, -1); err != nil {
+			return err
+		}
+	}
+	if err := entries.Delete(key); err != nil {
+		return err
+	}
+	if err := addCount(tx, entriesCount, -1); err != nil {
+		return err
+	}
+	return ids.Delete([]byte(id))
+}
+
+func count(tx *bolt.Tx, name []byte) int {
+	v := tx.Bucket(metaBucket).Get(name)
+	if len(v) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(v))
+}
+
+func setCount(tx *bolt.Tx, name []byte, n int) error {
+	if n < 0 {
+		n = 0
+	}
+	return tx.Bucket(metaBucket).Put(name, binary.BigEndian.AppendUint64(nil, uint64(n)))
+}
+
+func addCount(tx *bolt.Tx, name []byte, delta int) error {
+	return setCount(tx, name, count(tx, name)+delta)
+}
+
+func get(tx *bolt.Tx, id string) (Entry, bool, error) {
+	key := tx.Bucket(idsBucket).Get([]byte(id))
+	if key == nil {
+		return Entry{}, false, nil
+	}
+	e, err := decode(tx.Bucket(entriesBucket).Get(key))
+	return e, err == nil, err
+}
+
+// timeKey orders entries by creation time; the ID keeps keys unique.
+func timeKey(t time.Time, id string) []byte {
+	key := make([]byte, 8, 8+len(id))
+	var nanos int64
+	if !t.IsZero() {
+		nanos = t.UnixNano()
+	}
+	binary.BigEndian.PutUint64(key, uint64(nanos))
+	return append(key, id...)
+}
+
+func keyTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key[:8])))
+}
+
+func keyID(key []byte) string { return string(key[8:]) }
+
+func parentKey(parentID string, key []byte) []byte {
+	out := append([]byte(parentID), 0)
+	return append(out, key...)
+}
+
+// encode stores entries gzip-compressed: raw Jira JSON in steps compresses
+// several times over.
+func encode(e Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(e); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decode(data []byte) (Entry, error) {
+	var e Entry
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return e, fmt.Errorf("decode history entry: %w", err)
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return e, fmt.Errorf("decode history entry: %w", err)
+	}
+	return e, json.Unmarshal(raw, &e)
+}
@@ -0,0 +1,66 @@
+package history
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func ids(t *testing.T, s *BoltStore) []string {
+	t.Helper()
+	page, err := s.List(Filter{Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]string, 0, len(page.Entries))
+	for _, e := range page.Entries {
+		out = append(out, e.ID)
+	}
+	return out
+}
+
+func TestBoltRetentionCounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	s, err := OpenBolt(path, Retention{MaxEntries: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Now().Add(-time.Hour)
+	add := func(i int, pinned bool) {
+		t.Helper()
+		e := Entry{ID: fmt.Sprintf("e%d", i), Query: "q", Pinned: pinned, CreatedAt: base.Add(time.Duration(i) * time.Minute)}
+		if err := s.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(1, true)
+	for i := 2; i <= 5; i++ {
+		add(i, false)
+	}
+	// Re-appending an entry replaces it and must not count twice.
+	add(5, false)
+	if got, want := ids(t, s), []string{"e5", "e4", "e3", "e1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("entries = %v, want %v", got, want)
+	}
+	if err := s.Delete("e1"); err != nil {
+		t.Fatal(err)
+	}
+	add(6, false)
+	if got, want := ids(t, s), []string{"e6", "e5", "e4"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("entries = %v, want %v", got, want)
+	}
+	s.Close()
+
+	// The counts survive a reopen.
+	s, err = OpenBolt(path, Retention{MaxEntries: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	add(7, false)
+	if got, want := ids(t, s), []string{"e7", "e6", "e5"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("entries after reopen = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,75 @@
+package history
+
+// IssueDiff is what changed between two snapshots of the same JQL.
+// Truncated means a snapshot held only the first page of a larger result:
+// an issue that moved across the page boundary then shows up as added or
+// removed although it still matches, so those lists are unconfirmed.
+type IssueDiff struct {
+	Added     []IssueSnapshot `json:"added"`
+	Removed   []IssueSnapshot `json:"removed"`
+	Changed   []IssueChange   `json:"changed"`
+	Truncated bool            `json:"truncated,omitempty"`
+}
+
+// IssueChange is an issue present in both snapshots whose status or assignee
+// differs. Issue is the current state.
+type IssueChange struct {
+	Issue   IssueSnapshot `json:"issue"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// FieldChange is one changed field of an issue.
+type FieldChange struct {
+	Field string `json:"field"` // "status" or "assignee"
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// Empty reports whether nothing changed.
+func (d IssueDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffIssues compares the issues of a re-run (after) with an earlier snapshot
+// (before), keeping the order of after for added and changed issues and of
+// before for removed ones. Old snapshots without a status did not record the
+// issue state, so only presence is compared for them.
+func DiffIssues(before, after []IssueSnapshot) IssueDiff {
+	diff := IssueDiff{
+		Added:   make([]IssueSnapshot, 0),
+		Removed: make([]IssueSnapshot, 0),
+		Changed: make([]IssueChange, 0),
+	}
+	old := make(map[string]IssueSnapshot, len(before))
+	for _, s := range before {
+		old[s.Key] = s
+	}
+	seen := make(map[string]bool, len(after))
+	for _, cur := range after {
+		seen[cur.Key] = true
+		prev, ok := old[cur.Key]
+		if !ok {
+			diff.Added = append(diff.Added, cur)
+			continue
+		}
+		if prev.Status == "" {
+			continue
+		}
+		var changes []FieldChange
+		if prev.Status != cur.Status {
+			changes = append(changes, FieldChange{Field: "status", From: prev.Status, To: cur.Status})
+		}
+		if prev.Assignee != cur.Assignee {
+			changes = append(changes, FieldChange{Field: "assignee", From: prev.Assignee, To: cur.Assignee})
+		}
+		if len(changes) > 0 {
+			diff.Changed = append(diff.Changed, IssueChange{Issue: cur, Changes: changes})
+		}
+	}
+	for _, s := range before {
+		if !seen[s.Key] {
+			diff.Removed = append(diff.Removed, s)
+		}
+	}
+	return diff
+}
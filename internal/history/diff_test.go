@@ -0,0 +1,55 @@
+package history
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffIssues(t *testing.T) {
+	snap := func(key, status, assignee string) IssueSnapshot {
+		return IssueSnapshot{Key: key, Title: "T " + key, Status: status, Assignee: assignee}
+	}
+	keys := func(list []IssueSnapshot) []string {
+		out := make([]string, 0, len(list))
+		for _, s := range list {
+			out = append(out, s.Key)
+		}
+		return out
+	}
+	before := []IssueSnapshot{
+		snap("A-1", "Open", "ann"),
+		snap("A-2", "Open", "ann"),
+		snap("A-3", "Open", "bob"),
+		{Key: "A-4", Title: "old snapshot without state"},
+		snap("A-5", "Done", "bob"),
+	}
+	after := []IssueSnapshot{
+		snap("A-6", "Open", ""),
+		snap("A-3", "In Progress", ""),
+		snap("A-1", "Open", "ann"),
+		snap("A-4", "Done", "ann"),
+		snap("A-2", "Done", "ann"),
+	}
+	d := DiffIssues(before, after)
+	if got := keys(d.Added); !reflect.DeepEqual(got, []string{"A-6"}) {
+		t.Errorf("added = %v", got)
+	}
+	if got := keys(d.Removed); !reflect.DeepEqual(got, []string{"A-5"}) {
+		t.Errorf("removed = %v", got)
+	}
+	want := []IssueChange{
+		{Issue: after[1], Changes: []FieldChange{{"status", "Open", "In Progress"}, {"assignee", "bob", ""}}},
+		{Issue: after[4], Changes: []FieldChange{{"status", "Open", "Done"}}},
+	}
+	if !reflect.DeepEqual(d.Changed, want) {
+		t.Errorf("changed = %+v, want %+v", d.Changed, want)
+	}
+	if d.Empty() {
+		t.Error("diff reported empty")
+	}
+
+	same := DiffIssues(before, before)
+	if !same.Empty() || same.Added == nil || same.Removed == nil || same.Changed == nil {
+		t.Errorf("identical snapshots: %+v, want empty non-nil lists", same)
+	}
+}
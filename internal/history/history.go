@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,6 +12,9 @@ import (
 	"time"
 )
 
+// ErrNotFound is returned when an entry ID is unknown.
+var ErrNotFound = errors.New("history entry not found")
+
 // Entry is a single search attempt.
 type Entry struct {
 	ID         string          `json:"id"`
@@ -20,49 +24,228 @@ type Entry struct {
 	Steps      []Step          `json:"steps,omitempty"`
 	Issues     []IssueSnapshot `json:"issues,omitempty"`
 	Analysis   string          `json:"analysis,omitempty"`
+	Thread     *Thread         `json:"thread,omitempty"`
+	ForkedFrom string          `json:"forkedFrom,omitempty"` // entry the thread was forked from
+	ParentID   string          `json:"parentId,omitempty"`   // entry refined by this one's JQL
+	RerunOf    string          `json:"rerunOf,omitempty"`    // entry whose JQL this one re-ran
+	Title      string          `json:"title,omitempty"`      // custom name shown instead of Query
+	Tags       []string        `json:"tags,omitempty"`
+	Pinned     bool            `json:"pinned,omitempty"` // kept regardless of retention
 	CreatedAt  time.Time       `json:"createdAt"`
 }
 
+// Thread is the follow-up conversation about an entry. Turns before
+// Summarized are condensed into Summary and no longer sent to the model.
+type Thread struct {
+	Turns      []Turn `json:"turns"`
+	Summary    string `json:"summary,omitempty"`
+	Summarized int    `json:"summarized,omitempty"`
+}
+
+// Turn is one message of a thread.
+type Turn struct {
+	Role      string    `json:"role"` // "user" or "assistant"
+	Content   string    `json:"content"`
+	Tokens    int       `json:"tokens"`          // estimated tokens of Content
+	Usage     *Usage    `json:"usage,omitempty"` // LLM call that produced an assistant turn
+	CreatedAt time.Time `json:"createdAt"`
+}
+
 // Step represents an individual phase (JQL derivation, query, summary).
+// Planned steps (see internal/plan) also carry an ID, a registered Kind and
+// timing, so they can be executed and re-run one by one.
 type Step struct {
+	ID          string          `json:"id,omitempty"`
+	Kind        string          `json:"kind,omitempty"`
 	Name        string          `json:"name"`
 	Description string          `json:"description,omitempty"`
+	Instruction string          `json:"instruction,omitempty"`
 	Status      string          `json:"status"`
 	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Usage       *Usage          `json:"usage,omitempty"`
+	StartedAt   *time.Time      `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time      `json:"finishedAt,omitempty"`
 }
 
-// IssueSnapshot keeps minimal info for follow-ups.
+// Usage is the LLM token consumption and estimated cost of a step.
+type Usage struct {
+	Model            string  `json:"model,omitempty"`
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	CostUSD          float64 `json:"costUsd"`
+	Estimated        bool    `json:"estimated,omitempty"`
+}
+
+// IssueSnapshot keeps minimal info for follow-ups and for diffing a re-run
+// against the original result. Assignee is empty for unassigned issues.
 type IssueSnapshot struct {
-	Key   string `json:"key"`
-	Title string `json:"title"`
-	URL   string `json:"url"`
+	Key      string `json:"key"`
+	Title    string `json:"title"`
+	URL      string `json:"url"`
+	Status   string `json:"status,omitempty"`
+	Assignee string `json:"assignee,omitempty"`
 }
 
-// Store persists history to a JSON file with a simple append-then-trim strategy.
+// DefaultMaxEntries is the retention of a Store created without a limit.
+const DefaultMaxEntries = 100
+
+// Store persists history to a JSON file with a simple append-then-trim
+// strategy. The whole file is rewritten on every change, so it suits small
+// histories; see BoltStore for larger ones.
 type Store struct {
-	path string
-	mu   sync.Mutex
-	list []Entry
+	path      string
+	retention Retention
+	mu        sync.Mutex
+	list      []Entry
 }
 
-func NewStore(path string) *Store {
-	s := &Store{path: path}
+// NewStore loads the history file at path. A zero MaxEntries keeps
+// DefaultMaxEntries entries.
+func NewStore(path string, retention Retention) *Store {
+	if retention.MaxEntries <= 0 {
+		retention.MaxEntries = DefaultMaxEntries
+	}
+	s := &Store{path: path, retention: retention}
 	_ = s.load()
 	return s
 }
 
-// Append adds an entry and saves to disk. Keeps only the latest 100 entries.
+// Append adds an entry, applies the retention policy and saves to disk.
 func (s *Store) Append(e Entry) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	s.list = append(s.list, e)
-	if len(s.list) > 100 {
-		s.list = s.list[len(s.list)-100:]
-	}
+	s.trim(time.Now())
 	return s.save()
 }
 
+// Prune drops entries outside the retention policy.
+func (s *Store) Prune() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := s.trim(time.Now())
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.save()
+}
+
+// trim drops expired entries and the oldest ones above MaxEntries. Pinned
+// entries are kept and do not count against the limit.
+func (s *Store) trim(now time.Time) int {
+	unpinned := 0
+	for _, e := range s.list {
+		if !e.Pinned {
+			unpinned++
+		}
+	}
+	over := unpinned - s.retention.MaxEntries
+	before := len(s.list)
+	kept := s.list[:0]
+	for _, e := range s.list {
+		if !e.Pinned && (over > 0 || s.retention.expired(e.CreatedAt, now)) {
+			over--
+			continue
+		}
+		kept = append(kept, e)
+	}
+	s.list = kept
+	return before - len(s.list)
+}
+
+// Delete removes the entry with the given ID.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.list) - 1; i >= 0; i-- {
+		if s.list[i].ID == id {
+			s.list = append(s.list[:i], s.list[i+1:]...)
+			return s.save()
+		}
+	}
+	return ErrNotFound
+}
+
+// List returns one page of entries matching f, newest first.
+func (s *Store) List(f Filter) (Page, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := len(s.list) - 1
+	if f.Cursor != "" {
+		start = -2
+		for i := len(s.list) - 1; i >= 0; i-- {
+			if s.list[i].ID == f.Cursor {
+				start = i - 1
+				break
+			}
+		}
+		if start == -2 {
+			return Page{}, ErrBadCursor
+		}
+	}
+	page := Page{Entries: make([]Entry, 0)}
+	for i := start; i >= 0; i-- {
+		if !f.match(s.list[i]) {
+			continue
+		}
+		if len(page.Entries) == f.limit() {
+			page.NextCursor = page.Entries[len(page.Entries)-1].ID
+			break
+		}
+		page.Entries = append(page.Entries, s.list[i])
+	}
+	return page, nil
+}
+
+// Close is a no-op; every change is already on disk.
+func (s *Store) Close() error { return nil }
+
+// Update replaces the stored entry with the same ID.
+func (s *Store) Update(e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.list) - 1; i >= 0; i-- {
+		if s.list[i].ID == e.ID {
+			s.list[i] = e
+			return s.save()
+		}
+	}
+	return ErrNotFound
+}
+
+// Modify applies fn to the stored entry with the given ID and saves it, so
+// concurrent changes to other fields of the entry are not lost.
+func (s *Store) Modify(id string, fn func(*Entry) error) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.list) - 1; i >= 0; i-- {
+		if s.list[i].ID != id {
+			continue
+		}
+		e := s.list[i]
+		if e.Thread != nil {
+			// fn may append turns; do not let it touch the stored copy on error.
+			t := *e.Thread
+			t.Turns = append([]Turn(nil), t.Turns...)
+			e.Thread = &t
+		}
+		if err := fn(&e); err != nil {
+			return s.list[i], err
+		}
+		s.list[i] = e
+		return e, s.save()
+	}
+	return Entry{}, ErrNotFound
+}
+
 // Latest returns up to n most recent entries (newest first).
 func (s *Store) Latest(n int) []Entry {
 	s.mu.Lock()
@@ -101,6 +284,20 @@ func (s *Store) save() error {
 	return os.WriteFile(s.path, data, 0o644)
 }
 
+// Children returns the entries refined from parentID, newest first.
+func (s *Store) Children(parentID string) []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]Entry, 0)
+	for i := len(s.list) - 1; i >= 0; i-- {
+		if s.list[i].ParentID == parentID {
+			out = append(out, s.list[i])
+		}
+	}
+	return out
+}
+
 // Get returns entry by ID.
 func (s *Store) Get(id string) (Entry, bool) {
 	s.mu.Lock()
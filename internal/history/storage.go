@@ -0,0 +1,154 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Storage persists history entries. Store keeps them in a JSON file,
+// BoltStore in an embedded bbolt database.
+type Storage interface {
+	Append(e Entry) error
+	Update(e Entry) error
+	// Modify applies fn to the stored entry with the given ID and saves it.
+	Modify(id string, fn func(*Entry) error) (Entry, error)
+	Get(id string) (Entry, bool)
+	// Latest returns up to n most recent entries (newest first); n <= 0
+	// returns all of them.
+	Latest(n int) []Entry
+	// Children returns the entries refined from parentID, newest first.
+	Children(parentID string) []Entry
+	Delete(id string) error
+	// List returns one page of entries matching f, newest first.
+	List(f Filter) (Page, error)
+	// Prune applies the retention policy and returns how many entries were
+	// removed.
+	Prune() (int, error)
+	Close() error
+}
+
+// DefaultPageSize is the page size of List when Filter.Limit is not set.
+const DefaultPageSize = 20
+
+// Filter selects entries for List. Query (matched against the query and the
+// title) and JQL are case-insensitive substrings; From and To bound CreatedAt
+// (To is exclusive). Tag must be one of the entry's tags, Pinned keeps only
+// pinned entries. Cursor is the ID of the last entry of the previous page.
+type Filter struct {
+	From   time.Time
+	To     time.Time
+	Query  string
+	JQL    string
+	Tag    string
+	Pinned bool
+	Cursor string
+	Limit  int
+}
+
+// Page is a slice of List results. NextCursor is empty on the last page.
+type Page struct {
+	Entries    []Entry `json:"entries"`
+	NextCursor string  `json:"nextCursor,omitempty"`
+}
+
+// Retention limits how much history is kept. Zero values disable a limit.
+// Pinned entries are never removed and do not count against MaxEntries.
+type Retention struct {
+	MaxEntries int
+	MaxAge     time.Duration
+}
+
+// ErrBadCursor is returned by List for a cursor that names no entry.
+var ErrBadCursor = errors.New("history cursor not found")
+
+// match reports whether e passes the non-cursor parts of f.
+func (f Filter) match(e Entry) bool {
+	if !f.From.IsZero() && e.CreatedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !e.CreatedAt.Before(f.To) {
+		return false
+	}
+	if f.Query != "" && !containsFold(e.Query, f.Query) && !containsFold(e.Title, f.Query) {
+		return false
+	}
+	if f.JQL != "" && !containsFold(e.JQL, f.JQL) {
+		return false
+	}
+	if f.Pinned && !e.Pinned {
+		return false
+	}
+	if f.Tag != "" && !hasTag(e.Tags, f.Tag) {
+		return false
+	}
+	return true
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeTags trims tags and drops empty and duplicate (case-insensitive)
+// ones, keeping the first spelling.
+func NormalizeTags(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t != "" && !hasTag(out, t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func (f Filter) limit() int {
+	if f.Limit <= 0 {
+		return DefaultPageSize
+	}
+	return f.Limit
+}
+
+// expired reports whether an entry created at t is older than r allows.
+func (r Retention) expired(t, now time.Time) bool {
+	return r.MaxAge > 0 && t.Before(now.Add(-r.MaxAge))
+}
+
+func containsFold(s, sub string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(sub))
+}
+
+// MigrateJSON imports a legacy history.json into dst when dst is empty, then
+// renames the file to path+".migrated" so the import runs only once. It
+// returns the number of imported entries.
+func MigrateJSON(path string, dst Storage) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(dst.Latest(1)) > 0 {
+		return 0, fmt.Errorf("%s not imported: history storage is not empty", path)
+	}
+	var list []Entry
+	if err := json.Unmarshal(data, &list); err != nil {
+		return 0, fmt.Errorf("parse %s: %w", path, err)
+	}
+	// The file is in insertion order, which is what Append expects.
+	for _, e := range list {
+		if err := dst.Append(e); err != nil {
+			return 0, fmt.Errorf("import entry %s: %w", e.ID, err)
+		}
+	}
+	return len(list), os.Rename(path, path+".migrated")
+}
@@ -86,6 +86,12 @@ type Sprint struct {
 	Name      string    `json:"name"`
 	StartDate time.Time `json:"startDate"`
 	EndDate   time.Time `json:"endDate"`
+	// Set by the sprint endpoints: state is future, active or closed;
+	// CompleteDate is when a closed sprint was completed.
+	State         string    `json:"state,omitempty"`
+	CompleteDate  time.Time `json:"completeDate"`
+	Goal          string    `json:"goal,omitempty"`
+	OriginBoardID int       `json:"originBoardId,omitempty"`
 }
 
 type Board struct {
@@ -204,6 +210,12 @@ func (c *Client) AddWorklog(ctx context.Context, issueKey string, started time.T
 	return c.post(ctx, endpoint, payload)
 }
 
+// AddComment adds a comment (Jira wiki markup) to an issue.
+func (c *Client) AddComment(ctx context.Context, issueKey, body string) ([]byte, int, error) {
+	endpoint := fmt.Sprintf("/rest/api/2/issue/%s/comment", url.PathEscape(issueKey))
+	return c.post(ctx, endpoint, map[string]any{"body": body})
+}
+
 func ParseJiraTime(s string) (time.Time, error) {
 	if s == "" {
 		return time.Time{}, errors.New("empty time")
@@ -0,0 +1,171 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	anthropicDefaultURL   = "https://api.anthropic.com/v1"
+	anthropicVersion      = "2023-06-01"
+	anthropicDefaultModel = "claude-3-5-haiku-latest"
+)
+
+// Anthropic calls the Messages API directly over HTTP.
+type Anthropic struct {
+	chat
+	apiKey  string
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+func NewAnthropic(apiKey, model string) *Anthropic {
+	if apiKey == "" {
+		return nil
+	}
+	if model == "" {
+		model = anthropicDefaultModel
+	}
+	a := &Anthropic{
+		apiKey:  apiKey,
+		baseURL: anthropicDefaultURL,
+		model:   model,
+		client:  &http.Client{Timeout: 60 * time.Second},
+	}
+	a.chat.complete = a.complete
+	return a
+}
+
+func (a *Anthropic) complete(ctx context.Context, req chatRequest) (string, error) {
+	messages := make([]map[string]string, 0, len(req.History)+1)
+	for _, m := range req.History {
+		messages = append(messages, map[string]string{"role": m.Role, "content": m.Content})
+	}
+	messages = append(messages, map[string]string{"role": "user", "content": req.User})
+	payload := map[string]any{
+		"model":       a.model,
+		"system":      withSchema(req),
+		"max_tokens":  req.MaxTokens,
+		"temperature": req.Temperature,
+		"messages":    messages,
+	}
+	fn := tokensFrom(ctx)
+	if fn != nil {
+		payload["stream"] = true
+	}
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, a.baseURL+"/messages", bytes.NewReader(buf))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", a.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("anthropic: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if fn != nil {
+		return a.readStream(ctx, resp.Body, fn)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	var out struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		Usage struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", fmt.Errorf("anthropic: parse response: %w", err)
+	}
+	record(ctx, Usage{Model: a.model, PromptTokens: out.Usage.InputTokens, CompletionTokens: out.Usage.OutputTokens})
+	var b strings.Builder
+	for _, part := range out.Content {
+		if part.Type == "text" {
+			b.WriteString(part.Text)
+		}
+	}
+	if b.Len() == 0 {
+		return "", errors.New("no content")
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// readStream consumes the Messages API event stream, forwarding text deltas to fn.
+func (a *Anthropic) readStream(ctx context.Context, r io.Reader, fn TokenFunc) (string, error) {
+	var b strings.Builder
+	var usage Usage
+	usage.Model = a.model
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var ev struct {
+			Type    string `json:"type"`
+			Message struct {
+				Usage struct {
+					InputTokens int `json:"input_tokens"`
+				} `json:"usage"`
+			} `json:"message"`
+			Delta struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"delta"`
+			Usage struct {
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			continue
+		}
+		switch ev.Type {
+		case "message_start":
+			usage.PromptTokens = ev.Message.Usage.InputTokens
+		case "content_block_delta":
+			if ev.Delta.Type == "text_delta" && ev.Delta.Text != "" {
+				b.WriteString(ev.Delta.Text)
+				fn(ev.Delta.Text)
+			}
+		case "message_delta":
+			usage.CompletionTokens = ev.Usage.OutputTokens
+		case "error":
+			return "", fmt.Errorf("anthropic: %s", ev.Error.Message)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", fmt.Errorf("anthropic: read stream: %w", err)
+	}
+	record(ctx, usage)
+	if b.Len() == 0 {
+		return "", errors.New("no content")
+	}
+	return strings.TrimSpace(b.String()), nil
+}
@@ -0,0 +1,396 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// chatRequest is a single system+user completion, the lowest common denominator
+// across providers.
+type chatRequest struct {
+	System string
+	// History holds earlier conversation turns sent before User.
+	History     []Message
+	User        string
+	MaxTokens   int
+	Temperature float32
+	// Schema, when set, asks for a JSON object matching it. The schema is also
+	// spelled out in System for backends that cannot enforce it.
+	Schema *schema
+}
+
+// completeFunc performs one completion against a concrete backend.
+type completeFunc func(ctx context.Context, req chatRequest) (string, error)
+
+// chat implements Provider on top of a backend-specific completeFunc, so every
+// provider shares the same prompts.
+type chat struct {
+	complete  completeFunc
+	grounding Grounding
+}
+
+// SetGrounding attaches instance metadata used to ground DeriveJQL prompts.
+func (c *chat) SetGrounding(g Grounding) {
+	c.grounding = g
+}
+
+func (c *chat) DeriveJQL(ctx context.Context, query string) (JQLResult, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return JQLResult{}, errors.New("empty query")
+	}
+
+	system := `You are a Jira JQL expert. Given a user request, answer with a JSON object:
+- "jql": the JQL string only, no prose;
+- "explanation": one sentence (in Russian) on how the JQL answers the request;
+- "assumptions": what you had to guess (dates, people, projects), empty if nothing;
+- "confidence": 0..1, how sure you are that the JQL matches the intent.
+Rules:
+- Keep it concise and valid for Jira Server 7.12 (JQL 2.x API).
+- Prefer fields: project, issuetype, status, assignee, reporter, summary, description, updated, created, priority, resolution, labels, worklogAuthor, worklogDate, timespent.
+- When user talks about “мои задачи / я делал / assigned to me” use assignee = currentUser().
+- When user asks about tasks they reported (“я создал/завел”) use reporter = currentUser().
+- For “сколько времени списал я за этот месяц” use: worklogAuthor = currentUser() AND worklogDate >= startOfMonth() AND worklogDate <= endOfMonth().
+- If nothing specific is given, search by text: text ~ "user query".
+- Do not use functions unavailable in server 7.12 (avoid IN with empty).
+- Never include quotes around field names.` + c.groundingRules(query)
+
+	out, err := c.complete(ctx, chatRequest{
+		System:      system,
+		User:        fmt.Sprintf("User request: %s", query),
+		Temperature: 0.2,
+		MaxTokens:   400,
+		Schema:      &jqlSchema,
+	})
+	if err != nil {
+		return JQLResult{}, err
+	}
+	return decodeJQL(out)
+}
+
+func (c *chat) RefineJQL(ctx context.Context, baseJQL, command string) (JQLResult, error) {
+	baseJQL = strings.TrimSpace(baseJQL)
+	command = strings.TrimSpace(command)
+	if baseJQL == "" || command == "" {
+		return JQLResult{}, errors.New("empty jql or command")
+	}
+	system := `You are a Jira JQL expert. The user already ran a JQL query and now gives a follow-up command that narrows or adjusts the result (e.g. "покажи только те, что в статусе Done", "без багов", "только за последнюю неделю"). Answer with a JSON object:
+- "jql": the new JQL string only. Keep every condition of the base JQL unless the command explicitly changes it, combine with AND and keep the ORDER BY clause;
+- "explanation": one sentence (in Russian) on what changed compared to the base JQL;
+- "assumptions": what you had to guess, empty if nothing;
+- "confidence": 0..1, how sure you are that the JQL matches the intent.
+Rules:
+- Keep it valid for Jira Server 7.12 (JQL 2.x API).
+- Never include quotes around field names.` + c.groundingRules(command)
+
+	out, err := c.complete(ctx, chatRequest{
+		System:      system,
+		User:        fmt.Sprintf("Base JQL: %s\nFollow-up command: %s", baseJQL, command),
+		Temperature: 0.2,
+		MaxTokens:   400,
+		Schema:      &jqlSchema,
+	})
+	if err != nil {
+		return JQLResult{}, err
+	}
+	return decodeJQL(out)
+}
+
+// groundingRules lists instance metadata relevant to text for JQL prompts.
+func (c *chat) groundingRules(text string) string {
+	if c.grounding == nil {
+		return ""
+	}
+	meta := c.grounding.PromptContext(text)
+	if meta == "" {
+		return ""
+	}
+	return `
+- Use only project keys, statuses, issue types, priorities, custom fields and versions listed below; never invent names.
+- Quote multi-word values, e.g. status = "In Progress". Reference custom fields by their cf[NNN] clause.
+
+Instance metadata:
+` + meta
+}
+
+func (c *chat) Analyze(ctx context.Context, userQuery string, jql string, rawJSON []byte) (Analysis, error) {
+	if len(rawJSON) == 0 {
+		return Analysis{}, errors.New("empty results")
+	}
+	system := `You are a Jira expert. Given:
+- the original user request,
+- the JQL that was executed,
+- the raw Jira search JSON (issues array with fields),
+Answer in Russian with a JSON object:
+- "summary": краткое резюме (1-3 предложения);
+- "totals": итоговые значения, например суммарное время worklog в часах, если спрашивали про время; иначе пусто;
+- "issues": ключи задач с короткими заголовками и заметкой (5-10 задач максимум);
+- "warnings": если данных мало или они неполные, скажи об этом.
+Не выдумывай данных, опирайся только на JSON.`
+
+	out, err := c.complete(ctx, chatRequest{
+		System:      system,
+		User:        fmt.Sprintf("User request: %s\nExecuted JQL: %s\nJira raw JSON: %s", userQuery, jql, string(rawJSON)),
+		Temperature: 0.2,
+		MaxTokens:   800,
+		Schema:      &analysisSchema,
+	})
+	if err != nil {
+		return Analysis{}, err
+	}
+	var res Analysis
+	if err := decodeStructured(out, &res); err != nil {
+		return Analysis{}, err
+	}
+	return res, nil
+}
+
+func (c *chat) MergeAnalyses(ctx context.Context, userQuery string, jql string, parts []Analysis) (Analysis, error) {
+	if len(parts) == 0 {
+		return Analysis{}, errors.New("nothing to merge")
+	}
+	if len(parts) == 1 {
+		return parts[0], nil
+	}
+	partsJSON, err := json.Marshal(parts)
+	if err != nil {
+		return Analysis{}, err
+	}
+	system := `You are a Jira expert. A large Jira result set was split into chunks and each chunk was analysed separately.
+Merge the partial analyses into one answer in Russian, as the same JSON object:
+- "summary": общее резюме по всем частям (1-3 предложения);
+- "totals": сложи одноимённые итоги частей (например часы), не дублируй;
+- "issues": 5-10 самых важных задач из всех частей;
+- "warnings": объедини предупреждения без повторов.
+Не выдумывай данных, опирайся только на частичные анализы.`
+
+	out, err := c.complete(ctx, chatRequest{
+		System:      system,
+		User:        fmt.Sprintf("User request: %s\nExecuted JQL: %s\nPartial analyses: %s", userQuery, jql, string(partsJSON)),
+		Temperature: 0.2,
+		MaxTokens:   800,
+		Schema:      &analysisSchema,
+	})
+	if err != nil {
+		return Analysis{}, err
+	}
+	var res Analysis
+	if err := decodeStructured(out, &res); err != nil {
+		return Analysis{}, err
+	}
+	return res, nil
+}
+
+func (c *chat) FollowUp(ctx context.Context, contextText string, thread []Message, command string) (string, error) {
+	if strings.TrimSpace(contextText) == "" {
+		return "", errors.New("empty context")
+	}
+	if strings.TrimSpace(command) == "" {
+		return "", errors.New("empty command")
+	}
+	system := `You are an AI assistant that manipulates Jira search results. The context below has the goal, executed JQL, issue list and analysis; the user sends commands describing what to do next (render as HTML, produce test cases, summarize, etc.). Earlier commands and your answers are part of the conversation, so a command may refer to them. Use only the provided context and conversation. Respond with concise, plain text (or formatted text if requested), do not invent extra data.
+
+Context:
+` + contextText
+	return c.complete(ctx, chatRequest{
+		System:      system,
+		History:     thread,
+		User:        command,
+		Temperature: 0.2,
+		MaxTokens:   400,
+	})
+}
+
+func (c *chat) SummarizeThread(ctx context.Context, previous string, turns []Message) (string, error) {
+	if len(turns) == 0 {
+		return previous, nil
+	}
+	var b strings.Builder
+	if previous != "" {
+		fmt.Fprintf(&b, "Summary so far: %s\n\n", previous)
+	}
+	for _, t := range turns {
+		fmt.Fprintf(&b, "%s: %s\n", t.Role, t.Content)
+	}
+	system := `You condense a conversation about Jira search results. Write a short summary in Russian (up to 10 sentences) that keeps what the user asked for, decisions and any issue keys, numbers or formats the later commands may rely on. Extend the existing summary instead of repeating it. Plain text only.`
+	return c.complete(ctx, chatRequest{
+		System:      system,
+		User:        b.String(),
+		Temperature: 0.2,
+		MaxTokens:   500,
+	})
+}
+
+func (c *chat) Plan(ctx context.Context, query string, kinds []StepKind) ([]PlannedStep, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, errors.New("empty query")
+	}
+	var catalog strings.Builder
+	for _, k := range kinds {
+		fmt.Fprintf(&catalog, "- %s: %s\n", k.Name, k.Description)
+	}
+	system := `You plan work over Jira. Split the user instruction into an ordered list of steps, using only these step kinds:
+` + catalog.String() + `Answer with a JSON object {"steps": [...]}, each step having:
+- "kind": one of the kinds above;
+- "title": short title in Russian;
+- "instruction": what exactly this step should produce (empty for steps that need no input).
+Steps run in order and see the results of earlier steps. Use as few steps as the instruction needs.`
+
+	out, err := c.complete(ctx, chatRequest{
+		System:      system,
+		User:        fmt.Sprintf("User instruction: %s", query),
+		Temperature: 0.2,
+		MaxTokens:   500,
+		Schema:      &planSchema,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Steps []PlannedStep `json:"steps"`
+	}
+	if err := decodeStructured(out, &res); err != nil {
+		return nil, err
+	}
+	if len(res.Steps) == 0 {
+		return nil, errors.New("model returned an empty plan")
+	}
+	return res.Steps, nil
+}
+
+func (c *chat) ReviewIssue(ctx context.Context, userQuery string, dossier []byte) (IssueReview, error) {
+	if len(dossier) == 0 {
+		return IssueReview{}, errors.New("empty issue")
+	}
+	system := `You are a senior QA engineer reviewing one Jira issue. The issue JSON has the description, comments, status changelog, linked issues, attachment metadata and computed staleness.
+Answer in Russian with a JSON object:
+- "key": the issue key;
+- "summary": суть задачи и её текущее состояние (1-2 предложения);
+- "risks": риски (блокеры, открытые вопросы в комментариях, зависимости от незакрытых связанных задач), пусто если нет;
+- "missingAcceptanceCriteria": чего не хватает в критериях приёмки или описании, пусто если всё есть;
+- "staleness": оценка застоя по датам и истории статусов (например "14 дней в In Progress без движения"), пусто если задача движется;
+- "recommendation": одно конкретное следующее действие.
+Опирайся только на JSON, не выдумывай.`
+
+	out, err := c.complete(ctx, chatRequest{
+		System:      system,
+		User:        fmt.Sprintf("User request: %s\nIssue: %s", userQuery, string(dossier)),
+		Temperature: 0.2,
+		MaxTokens:   600,
+		Schema:      &reviewSchema,
+	})
+	if err != nil {
+		return IssueReview{}, err
+	}
+	var res IssueReview
+	if err := decodeStructured(out, &res); err != nil {
+		return IssueReview{}, err
+	}
+	return res, nil
+}
+
+func (c *chat) SummarizeReviews(ctx context.Context, userQuery string, reviews []IssueReview) (Analysis, error) {
+	if len(reviews) == 0 {
+		return Analysis{}, errors.New("nothing to summarize")
+	}
+	reviewsJSON, err := json.Marshal(reviews)
+	if err != nil {
+		return Analysis{}, err
+	}
+	system := `You are a Jira expert. Each issue of a result set was reviewed separately (risks, missing acceptance criteria, staleness).
+Write the aggregate report in Russian as a JSON object:
+- "summary": общая картина по всем задачам (2-4 предложения);
+- "totals": счётчики, например "С рисками", "Без критериев приёмки", "Застряли";
+- "issues": 5-10 задач, требующих внимания в первую очередь, с заметкой почему;
+- "warnings": системные проблемы (например много задач без критериев приёмки).
+Опирайся только на ревью, не выдумывай.`
+
+	out, err := c.complete(ctx, chatRequest{
+		System:      system,
+		User:        fmt.Sprintf("User request: %s\nIssue reviews: %s", userQuery, string(reviewsJSON)),
+		Temperature: 0.2,
+		MaxTokens:   800,
+		Schema:      &analysisSchema,
+	})
+	if err != nil {
+		return Analysis{}, err
+	}
+	var res Analysis
+	if err := decodeStructured(out, &res); err != nil {
+		return Analysis{}, err
+	}
+	return res, nil
+}
+
+func (c *chat) GenerateTestCases(ctx context.Context, instruction string, dossier []byte) ([]TestCase, error) {
+	if len(dossier) == 0 {
+		return nil, errors.New("empty issue")
+	}
+	system := `You are a senior QA engineer. Write manual test cases for one Jira issue (description, comments, linked issues, attachment metadata).
+Answer in Russian with a JSON object {"cases": [...]}; each case has:
+- "issueKey": the issue key;
+- "title": короткое название проверки;
+- "preconditions": что должно быть подготовлено перед тестом, пусто если ничего;
+- "steps": шаги с "action" (действие), "data" (тестовые данные, пусто если не нужны) и "expected" (ожидаемый результат шага);
+- "expected": итоговый ожидаемый результат;
+- "priority": "High" для основного сценария и критичных проверок, "Medium" для альтернативных, "Low" для второстепенных.
+Покрой позитивный сценарий, негативные случаи и граничные значения из описания — обычно 3-8 кейсов. Опирайся только на JSON задачи, не выдумывай функциональность.`
+
+	user := fmt.Sprintf("Issue: %s", string(dossier))
+	if strings.TrimSpace(instruction) != "" {
+		user = fmt.Sprintf("User request: %s\n%s", instruction, user)
+	}
+	out, err := c.complete(ctx, chatRequest{
+		System:      system,
+		User:        user,
+		Temperature: 0.3,
+		MaxTokens:   2000,
+		Schema:      &testCasesSchema,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Cases []TestCase `json:"cases"`
+	}
+	if err := decodeStructured(out, &res); err != nil {
+		return nil, err
+	}
+	if len(res.Cases) == 0 {
+		return nil, errors.New("model returned no test cases")
+	}
+	return res.Cases, nil
+}
+
+func (c *chat) SprintRetrospective(ctx context.Context, report []byte) (Analysis, error) {
+	if len(report) == 0 {
+		return Analysis{}, errors.New("empty report")
+	}
+	system := `You are an agile coach preparing a sprint retrospective. The sprint report JSON is already computed: committed vs completed story points, scope change (issues added or removed mid-sprint, re-estimates), carry-over, issues carried in from earlier sprints and time logged per person.
+Answer in Russian with a JSON object:
+- "summary": как прошёл спринт (3-5 предложений): выполнение обязательств, изменения объёма, что перенесено;
+- "totals": ключевые цифры, например "Обещано", "Сделано", "Выполнение", "Добавлено в ходе спринта", "Перенесено";
+- "issues": задачи, которые стоит обсудить (перенесённые, добавленные посреди спринта, переоценённые), с заметкой почему;
+- "warnings": тревожные сигналы и вопросы для обсуждения на ретро (например объём вырос больше чем на 20% или время списано неравномерно).
+Не пересчитывай цифры и не выдумывай то, чего нет в отчёте.`
+
+	out, err := c.complete(ctx, chatRequest{
+		System:      system,
+		User:        fmt.Sprintf("Sprint report: %s", string(report)),
+		Temperature: 0.3,
+		MaxTokens:   900,
+		Schema:      &analysisSchema,
+	})
+	if err != nil {
+		return Analysis{}, err
+	}
+	var res Analysis
+	if err := decodeStructured(out, &res); err != nil {
+		return Analysis{}, err
+	}
+	return res, nil
+}
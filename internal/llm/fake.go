@@ -0,0 +1,338 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Fake is a deterministic Provider for tests and offline demos. It never calls
+// the network: DeriveJQL returns a text search, Analyze counts issues and
+// FollowUp echoes the command.
+type Fake struct {
+	// JQL, when set, is returned by DeriveJQL verbatim.
+	JQL string
+	// Confidence reported by DeriveJQL and RefineJQL; nil means 1.
+	Confidence *float64
+}
+
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+func (f *Fake) confidence() float64 {
+	if f.Confidence == nil {
+		return 1
+	}
+	return *f.Confidence
+}
+
+func (f *Fake) DeriveJQL(ctx context.Context, query string) (JQLResult, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return JQLResult{}, errors.New("empty query")
+	}
+	res := JQLResult{JQL: f.JQL, Explanation: "fake provider", Assumptions: []string{}, Confidence: f.confidence()}
+	if res.JQL == "" {
+		q := strings.ReplaceAll(strings.ReplaceAll(query, `\`, `\\`), `"`, `\"`)
+		res.JQL = `text ~ "` + q + `"`
+		res.Explanation = "fake provider: full-text search"
+	}
+	return res, nil
+}
+
+// RefineJQL ANDs a full-text search for the command onto the base JQL.
+func (f *Fake) RefineJQL(ctx context.Context, baseJQL, command string) (JQLResult, error) {
+	baseJQL = strings.TrimSpace(baseJQL)
+	command = strings.TrimSpace(command)
+	if baseJQL == "" || command == "" {
+		return JQLResult{}, errors.New("empty jql or command")
+	}
+	res := JQLResult{JQL: f.JQL, Explanation: "fake provider", Assumptions: []string{}, Confidence: f.confidence()}
+	if res.JQL == "" {
+		order := ""
+		if i := strings.Index(strings.ToUpper(baseJQL), " ORDER BY "); i >= 0 {
+			baseJQL, order = baseJQL[:i], baseJQL[i:]
+		}
+		q := strings.ReplaceAll(strings.ReplaceAll(command, `\`, `\\`), `"`, `\"`)
+		res.JQL = "(" + baseJQL + `) AND text ~ "` + q + `"` + order
+		res.Explanation = "fake provider: full-text refinement"
+	}
+	return res, nil
+}
+
+func (f *Fake) Analyze(ctx context.Context, userQuery string, jql string, rawJSON []byte) (Analysis, error) {
+	if len(rawJSON) == 0 {
+		return Analysis{}, errors.New("empty results")
+	}
+	var res struct {
+		Total  int `json:"total"`
+		Issues []struct {
+			Key     string `json:"key"`
+			Summary string `json:"summary"` // compacted issues
+			Fields  struct {
+				Summary string `json:"summary"`
+			} `json:"fields"`
+		} `json:"issues"`
+	}
+	if err := json.Unmarshal(rawJSON, &res); err != nil {
+		return Analysis{}, err
+	}
+	out := Analysis{
+		Summary:  fmt.Sprintf("Найдено задач: %d.", res.Total),
+		Totals:   []Total{{Label: "Задач", Value: fmt.Sprintf("%d", res.Total)}},
+		Issues:   make([]AnalysisIssue, 0, len(res.Issues)),
+		Warnings: []string{},
+	}
+	for _, iss := range res.Issues {
+		title := iss.Fields.Summary
+		if title == "" {
+			title = iss.Summary
+		}
+		out.Issues = append(out.Issues, AnalysisIssue{Key: iss.Key, Title: title})
+	}
+	if res.Total > len(res.Issues) {
+		out.Warnings = append(out.Warnings, fmt.Sprintf("показаны %d из %d задач", len(res.Issues), res.Total))
+	}
+	f.meter(ctx, userQuery+jql+string(rawJSON), out.Summary)
+	f.stream(ctx, out.Summary)
+	return out, nil
+}
+
+func (f *Fake) MergeAnalyses(ctx context.Context, userQuery string, jql string, parts []Analysis) (Analysis, error) {
+	if len(parts) == 0 {
+		return Analysis{}, errors.New("nothing to merge")
+	}
+	out := Analysis{Issues: []AnalysisIssue{}, Warnings: []string{}}
+	summaries := make([]string, 0, len(parts))
+	count := 0
+	for _, p := range parts {
+		summaries = append(summaries, p.Summary)
+		out.Issues = append(out.Issues, p.Issues...)
+		out.Warnings = append(out.Warnings, p.Warnings...)
+		count += len(p.Issues)
+	}
+	out.Summary = strings.Join(summaries, " ")
+	out.Totals = []Total{{Label: "Задач", Value: fmt.Sprintf("%d", count)}}
+	f.meter(ctx, userQuery+jql, out.Summary)
+	f.stream(ctx, out.Summary)
+	return out, nil
+}
+
+// Plan proposes the basic derive → search → analyze flow, keeping only the
+// kinds that are offered.
+func (f *Fake) Plan(ctx context.Context, query string, kinds []StepKind) ([]PlannedStep, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, errors.New("empty query")
+	}
+	var steps []PlannedStep
+	for _, want := range []string{"derive_jql", "search", "analyze"} {
+		for _, k := range kinds {
+			if k.Name == want {
+				steps = append(steps, PlannedStep{Kind: want})
+			}
+		}
+	}
+	if len(steps) == 0 {
+		return nil, errors.New("fake: no known step kinds")
+	}
+	return steps, nil
+}
+
+// ReviewIssue flags an empty description and reports the staleness computed
+// by the caller, if any.
+func (f *Fake) ReviewIssue(ctx context.Context, userQuery string, dossier []byte) (IssueReview, error) {
+	var iss struct {
+		Key         string `json:"key"`
+		Summary     string `json:"summary"`
+		Status      string `json:"status"`
+		Description string `json:"description"`
+		Staleness   struct {
+			Stale        bool `json:"stale"`
+			DaysInStatus int  `json:"daysInStatus"`
+		} `json:"staleness"`
+	}
+	if err := json.Unmarshal(dossier, &iss); err != nil {
+		return IssueReview{}, err
+	}
+	out := IssueReview{
+		Key:                       iss.Key,
+		Summary:                   fmt.Sprintf("%s (%s)", iss.Summary, iss.Status),
+		Risks:                     []string{},
+		MissingAcceptanceCriteria: []string{},
+		Recommendation:            "fake: проверить вручную",
+	}
+	if strings.TrimSpace(iss.Description) == "" {
+		out.MissingAcceptanceCriteria = append(out.MissingAcceptanceCriteria, "нет описания")
+	}
+	if iss.Staleness.Stale {
+		out.Staleness = fmt.Sprintf("%d дн. в статусе %s", iss.Staleness.DaysInStatus, iss.Status)
+	}
+	f.meter(ctx, userQuery+string(dossier), out.Summary)
+	f.stream(ctx, out.Summary+"\n")
+	return out, nil
+}
+
+func (f *Fake) SummarizeReviews(ctx context.Context, userQuery string, reviews []IssueReview) (Analysis, error) {
+	if len(reviews) == 0 {
+		return Analysis{}, errors.New("nothing to summarize")
+	}
+	out := Analysis{Issues: []AnalysisIssue{}, Warnings: []string{}}
+	stale, noAC := 0, 0
+	for _, r := range reviews {
+		note := []string{}
+		if r.Staleness != "" {
+			stale++
+			note = append(note, r.Staleness)
+		}
+		if len(r.MissingAcceptanceCriteria) > 0 {
+			noAC++
+			note = append(note, strings.Join(r.MissingAcceptanceCriteria, ", "))
+		}
+		if len(note) > 0 {
+			out.Issues = append(out.Issues, AnalysisIssue{Key: r.Key, Title: r.Summary, Note: strings.Join(note, "; ")})
+		}
+	}
+	out.Summary = fmt.Sprintf("Проверено задач: %d.", len(reviews))
+	out.Totals = []Total{
+		{Label: "Проверено", Value: fmt.Sprintf("%d", len(reviews))},
+		{Label: "Застряли", Value: fmt.Sprintf("%d", stale)},
+		{Label: "Без критериев приёмки", Value: fmt.Sprintf("%d", noAC)},
+	}
+	f.meter(ctx, userQuery, out.Summary)
+	f.stream(ctx, out.Summary)
+	return out, nil
+}
+
+// GenerateTestCases returns a positive and a negative case built from the
+// issue summary.
+func (f *Fake) GenerateTestCases(ctx context.Context, instruction string, dossier []byte) ([]TestCase, error) {
+	var iss struct {
+		Key     string `json:"key"`
+		Summary string `json:"summary"`
+	}
+	if err := json.Unmarshal(dossier, &iss); err != nil {
+		return nil, err
+	}
+	out := []TestCase{
+		{
+			IssueKey:      iss.Key,
+			Title:         "Основной сценарий: " + iss.Summary,
+			Preconditions: []string{"fake: тестовое окружение доступно"},
+			Steps: []TestStep{
+				{Action: "Открыть функциональность из " + iss.Key, Expected: "Экран открыт"},
+				{Action: "Выполнить основной сценарий", Data: "валидные данные", Expected: "Операция выполнена"},
+			},
+			Expected: "Поведение соответствует описанию " + iss.Key,
+			Priority: "High",
+		},
+		{
+			IssueKey:      iss.Key,
+			Title:         "Негативный сценарий: " + iss.Summary,
+			Preconditions: []string{},
+			Steps: []TestStep{
+				{Action: "Выполнить сценарий с невалидными данными", Data: "пустое значение", Expected: "Показана ошибка валидации"},
+			},
+			Expected: "Данные не сохранены",
+			Priority: "Medium",
+		},
+	}
+	f.meter(ctx, instruction+string(dossier), out[0].Title+out[1].Title)
+	f.stream(ctx, out[0].Title+"\n"+out[1].Title+"\n")
+	return out, nil
+}
+
+// SprintRetrospective restates the report's numbers.
+func (f *Fake) SprintRetrospective(ctx context.Context, report []byte) (Analysis, error) {
+	var rep struct {
+		Sprint struct {
+			Name string `json:"name"`
+		} `json:"sprint"`
+		Committed struct {
+			Issues int     `json:"issues"`
+			Points float64 `json:"points"`
+		} `json:"committed"`
+		Completed struct {
+			Issues int     `json:"issues"`
+			Points float64 `json:"points"`
+		} `json:"completed"`
+		Added     []string `json:"added"`
+		Removed   []string `json:"removed"`
+		CarryOver []string `json:"carryOver"`
+		Issues    []struct {
+			Key     string `json:"key"`
+			Summary string `json:"summary"`
+		} `json:"issues"`
+	}
+	if err := json.Unmarshal(report, &rep); err != nil {
+		return Analysis{}, err
+	}
+	out := Analysis{
+		Summary: fmt.Sprintf("Спринт %s: обещано %d задач (%g SP), сделано %d (%g SP).",
+			rep.Sprint.Name, rep.Committed.Issues, rep.Committed.Points, rep.Completed.Issues, rep.Completed.Points),
+		Totals: []Total{
+			{Label: "Добавлено в ходе спринта", Value: fmt.Sprintf("%d", len(rep.Added))},
+			{Label: "Убрано", Value: fmt.Sprintf("%d", len(rep.Removed))},
+			{Label: "Перенесено", Value: fmt.Sprintf("%d", len(rep.CarryOver))},
+		},
+		Issues:   []AnalysisIssue{},
+		Warnings: []string{},
+	}
+	titles := map[string]string{}
+	for _, iss := range rep.Issues {
+		titles[iss.Key] = iss.Summary
+	}
+	for _, key := range rep.CarryOver {
+		out.Issues = append(out.Issues, AnalysisIssue{Key: key, Title: titles[key], Note: "не закрыта к концу спринта"})
+	}
+	f.meter(ctx, string(report), out.Summary)
+	f.stream(ctx, out.Summary)
+	return out, nil
+}
+
+// stream emits text word by word when the caller asked for tokens.
+func (f *Fake) stream(ctx context.Context, text string) {
+	fn := tokensFrom(ctx)
+	if fn == nil {
+		return
+	}
+	for i, word := range strings.Fields(text) {
+		if i > 0 {
+			word = " " + word
+		}
+		fn(word)
+	}
+}
+
+// meter records an estimated usage so pipelines show non-zero token counts offline.
+func (f *Fake) meter(ctx context.Context, prompt, completion string) {
+	record(ctx, Usage{Model: "fake", PromptTokens: EstimateTokens(prompt), CompletionTokens: EstimateTokens(completion), Estimated: true})
+}
+
+func (f *Fake) FollowUp(ctx context.Context, contextText string, thread []Message, command string) (string, error) {
+	if strings.TrimSpace(contextText) == "" {
+		return "", errors.New("empty context")
+	}
+	if strings.TrimSpace(command) == "" {
+		return "", errors.New("empty command")
+	}
+	answer := fmt.Sprintf("fake: %s (context %d bytes, %d earlier turns)", strings.TrimSpace(command), len(contextText), len(thread))
+	f.meter(ctx, contextText+command, answer)
+	f.stream(ctx, answer)
+	return answer, nil
+}
+
+// SummarizeThread keeps the previous summary and lists the user commands.
+func (f *Fake) SummarizeThread(ctx context.Context, previous string, turns []Message) (string, error) {
+	var asked []string
+	for _, t := range turns {
+		if t.Role == RoleUser {
+			asked = append(asked, t.Content)
+		}
+	}
+	summary := strings.TrimSpace(previous + " fake: обсуждали — " + strings.Join(asked, "; "))
+	f.meter(ctx, summary, summary)
+	return summary, nil
+}
@@ -4,10 +4,78 @@ import "context"
 
 // JQLGenerator generates JQL from a natural-language query.
 type JQLGenerator interface {
-	DeriveJQL(ctx context.Context, query string) (string, error)
+	DeriveJQL(ctx context.Context, query string) (JQLResult, error)
+	// RefineJQL adjusts an executed JQL to a follow-up command such as
+	// "only those in Done".
+	RefineJQL(ctx context.Context, baseJQL, command string) (JQLResult, error)
 }
 
 // Analyzer produces a human summary/answer based on Jira search results and the original query.
 type Analyzer interface {
-	Analyze(ctx context.Context, userQuery string, jql string, rawJSON []byte) (string, error)
+	Analyze(ctx context.Context, userQuery string, jql string, rawJSON []byte) (Analysis, error)
+}
+
+// Merger combines analyses of separate chunks of one result set into a single answer.
+type Merger interface {
+	MergeAnalyses(ctx context.Context, userQuery string, jql string, parts []Analysis) (Analysis, error)
+}
+
+// FollowUpper answers a follow-up command against a stored search context.
+// thread holds the earlier turns of the conversation, oldest first; long
+// threads are condensed with SummarizeThread.
+type FollowUpper interface {
+	FollowUp(ctx context.Context, contextText string, thread []Message, command string) (string, error)
+	SummarizeThread(ctx context.Context, previous string, turns []Message) (string, error)
+}
+
+// Message roles.
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is one turn of a conversation.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Planner splits one instruction into ranked steps drawn from kinds.
+type Planner interface {
+	Plan(ctx context.Context, query string, kinds []StepKind) ([]PlannedStep, error)
+}
+
+// IssueReviewer analyses single issues in depth and aggregates the reviews.
+type IssueReviewer interface {
+	ReviewIssue(ctx context.Context, userQuery string, dossier []byte) (IssueReview, error)
+	SummarizeReviews(ctx context.Context, userQuery string, reviews []IssueReview) (Analysis, error)
+}
+
+// TestCaseWriter turns one issue into structured test cases.
+type TestCaseWriter interface {
+	GenerateTestCases(ctx context.Context, instruction string, dossier []byte) ([]TestCase, error)
+}
+
+// Retrospective narrates a computed sprint report (JSON) as a team
+// retrospective.
+type Retrospective interface {
+	SprintRetrospective(ctx context.Context, report []byte) (Analysis, error)
+}
+
+// Provider is everything the server needs from an LLM backend.
+type Provider interface {
+	JQLGenerator
+	Analyzer
+	Merger
+	FollowUpper
+	Planner
+	IssueReviewer
+	TestCaseWriter
+	Retrospective
+}
+
+// Grounding supplies instance-specific metadata (projects, statuses, custom fields,
+// versions) relevant to a query, so prompts reference names that actually exist.
+type Grounding interface {
+	PromptContext(query string) string
 }
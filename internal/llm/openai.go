@@ -3,139 +3,136 @@ package llm
 import (
 	"context"
 	"errors"
-	"fmt"
+	"io"
 	"strings"
 
 	openai "github.com/sashabaranov/go-openai"
 )
 
+// OpenAI talks to the OpenAI chat completions API or any compatible server
+// (llama.cpp, Ollama, vLLM) when constructed with a custom base URL.
 type OpenAI struct {
+	chat
 	client *openai.Client
 	model  string
+	// compatible servers get json_object instead of json_schema, which most of
+	// them (llama.cpp, Ollama) support more reliably.
+	compatible bool
 }
 
 func NewOpenAI(apiKey, model string) *OpenAI {
 	if apiKey == "" {
 		return nil
 	}
+	return newOpenAI(openai.DefaultConfig(apiKey), model)
+}
+
+// NewOpenAICompatible targets an OpenAI-compatible endpoint such as
+// http://localhost:11434/v1 (Ollama) or http://localhost:8080/v1 (llama.cpp).
+// Local servers usually ignore the key, so it may be empty.
+func NewOpenAICompatible(baseURL, apiKey, model string) *OpenAI {
+	if baseURL == "" {
+		return nil
+	}
+	cfg := openai.DefaultConfig(apiKey)
+	cfg.BaseURL = strings.TrimRight(baseURL, "/")
+	o := newOpenAI(cfg, model)
+	o.compatible = true
+	return o
+}
+
+func newOpenAI(cfg openai.ClientConfig, model string) *OpenAI {
 	if model == "" {
 		model = "gpt-4o-mini"
 	}
-	c := openai.NewClient(apiKey)
-	return &OpenAI{client: c, model: model}
+	o := &OpenAI{client: openai.NewClientWithConfig(cfg), model: model}
+	o.chat.complete = o.complete
+	return o
 }
 
-func (o *OpenAI) DeriveJQL(ctx context.Context, query string) (string, error) {
-	query = strings.TrimSpace(query)
-	if query == "" {
-		return "", errors.New("empty query")
+func (o *OpenAI) complete(ctx context.Context, req chatRequest) (string, error) {
+	messages := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: withSchema(req)}}
+	for _, m := range req.History {
+		messages = append(messages, openai.ChatCompletionMessage{Role: m.Role, Content: m.Content})
 	}
-
-	system := `You are a Jira JQL expert. Given a user request, output ONLY a JQL string, no prose.
-Rules:
-- Keep it concise and valid for Jira Server 7.12 (JQL 2.x API).
-- Prefer fields: project, issuetype, status, assignee, reporter, summary, description, updated, created, priority, resolution, labels, worklogAuthor, worklogDate, timespent.
-- When user talks about “мои задачи / я делал / assigned to me” use assignee = currentUser().
-- When user asks about tasks they reported (“я создал/завел”) use reporter = currentUser().
-- For “сколько времени списал я за этот месяц” use: worklogAuthor = currentUser() AND worklogDate >= startOfMonth() AND worklogDate <= endOfMonth().
-- If nothing specific is given, search by text: text ~ "user query".
-- Do not use functions unavailable in server 7.12 (avoid IN with empty).
-- Never include quotes around field names.`
-
-	user := fmt.Sprintf("User request: %s", query)
-
-	resp, err := o.client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model: o.model,
-			Messages: []openai.ChatCompletionMessage{
-				{Role: openai.ChatMessageRoleSystem, Content: system},
-				{Role: openai.ChatMessageRoleUser, Content: user},
-			},
-			Temperature: 0.2,
-			MaxTokens:   120,
-		},
-	)
-	if err != nil {
-		return "", err
+	messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: req.User})
+	creq := openai.ChatCompletionRequest{
+		Model:       o.model,
+		Messages:    messages,
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
 	}
-	if len(resp.Choices) == 0 {
-		return "", errors.New("no choices")
-	}
-	out := strings.TrimSpace(resp.Choices[0].Message.Content)
-	// Some models might wrap in code fences; strip them.
-	out = strings.Trim(out, "`")
-	if strings.HasPrefix(out, "SQL") || strings.HasPrefix(out, "JQL") {
-		out = strings.TrimSpace(out[3:])
+	if req.Schema != nil {
+		if o.compatible {
+			creq.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+		} else {
+			creq.ResponseFormat = &openai.ChatCompletionResponseFormat{
+				Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+				JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+					Name:   req.Schema.Name,
+					Schema: req.Schema.JSON,
+					Strict: true,
+				},
+			}
+		}
 	}
-	return out, nil
-}
-
-func (o *OpenAI) Analyze(ctx context.Context, userQuery string, jql string, rawJSON []byte) (string, error) {
-	if len(rawJSON) == 0 {
-		return "", errors.New("empty results")
+	if fn := tokensFrom(ctx); fn != nil {
+		return o.stream(ctx, creq, fn)
 	}
-	system := `You are a Jira expert. Given:
-- the original user request,
-- the JQL that was executed,
-- the raw Jira search JSON (issues array with fields),
-Produce a concise answer in Russian with:
-1) краткое резюме (1-3 предложения),
-2) если спрашивали про время/лог worklog — покажи итоговое время (hours) суммарно,
-3) перечисли ключи задач с короткими заголовками (5-10 задач максимум),
-4) если данных мало, скажи об этом.
-Формат: резюме, затем список задач.
-Не выдумывай данных, опирайся только на JSON.`
-
-	user := fmt.Sprintf("User request: %s\nExecuted JQL: %s\nJira raw JSON: %s", userQuery, jql, string(rawJSON))
-
-	resp, err := o.client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model: o.model,
-			Messages: []openai.ChatCompletionMessage{
-				{Role: openai.ChatMessageRoleSystem, Content: system},
-				{Role: openai.ChatMessageRoleUser, Content: user},
-			},
-			Temperature: 0.2,
-			MaxTokens:   400,
-		},
-	)
+	resp, err := o.client.CreateChatCompletion(ctx, creq)
 	if err != nil {
 		return "", err
 	}
+	record(ctx, Usage{Model: o.model, PromptTokens: resp.Usage.PromptTokens, CompletionTokens: resp.Usage.CompletionTokens})
 	if len(resp.Choices) == 0 {
 		return "", errors.New("no choices")
 	}
 	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
 }
 
-func (o *OpenAI) FollowUp(ctx context.Context, contextText, command string) (string, error) {
-	if strings.TrimSpace(contextText) == "" {
-		return "", errors.New("empty context")
+// stream runs the completion with stream=true, forwarding deltas to fn.
+// Compatible servers often reject stream_options, so their usage is estimated.
+func (o *OpenAI) stream(ctx context.Context, creq openai.ChatCompletionRequest, fn TokenFunc) (string, error) {
+	creq.Stream = true
+	if !o.compatible {
+		creq.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
 	}
-	if strings.TrimSpace(command) == "" {
-		return "", errors.New("empty command")
-	}
-	system := `You are an AI assistant that manipulates Jira search results. The user provides context (goal, executed JQL, issue list, analysis) and a command describing what to do next (render as HTML, produce test cases, summarize, etc.). Use only the provided context. Respond with concise, plain text (or formatted text if requested), do not invent extra data.`
-	user := fmt.Sprintf("Context: %s\nUser command: %s", contextText, command)
-	resp, err := o.client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model: o.model,
-			Messages: []openai.ChatCompletionMessage{
-				{Role: openai.ChatMessageRoleSystem, Content: system},
-				{Role: openai.ChatMessageRoleUser, Content: user},
-			},
-			Temperature: 0.2,
-			MaxTokens:   400,
-		},
-	)
+	stream, err := o.client.CreateChatCompletionStream(ctx, creq)
 	if err != nil {
 		return "", err
 	}
-	if len(resp.Choices) == 0 {
+	defer stream.Close()
+	var b strings.Builder
+	var usage *openai.Usage
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if delta := choice.Delta.Content; delta != "" {
+				b.WriteString(delta)
+				fn(delta)
+			}
+		}
+	}
+	if usage != nil {
+		record(ctx, Usage{Model: o.model, PromptTokens: usage.PromptTokens, CompletionTokens: usage.CompletionTokens})
+	} else {
+		prompt := ""
+		for _, m := range creq.Messages {
+			prompt += m.Content
+		}
+		record(ctx, Usage{Model: o.model, PromptTokens: EstimateTokens(prompt), CompletionTokens: EstimateTokens(b.String()), Estimated: true})
+	}
+	if b.Len() == 0 {
 		return "", errors.New("no choices")
 	}
-	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+	return strings.TrimSpace(b.String()), nil
 }
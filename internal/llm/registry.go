@@ -0,0 +1,197 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNoProvider is returned when no provider is configured for a request.
+var ErrNoProvider = errors.New("LLM not configured")
+
+// Factory builds a provider for a model; an empty model means the provider default.
+// It returns nil when the provider is not usable (e.g. missing API key).
+type Factory func(model string) Provider
+
+// ProviderInfo describes a registered provider for the UI.
+type ProviderInfo struct {
+	Name    string `json:"name"`
+	Model   string `json:"defaultModel,omitempty"`
+	Default bool   `json:"default"`
+}
+
+// Registry maps provider names (openai, local, anthropic, fake) to factories and
+// caches the provider built for each default model. Other models come from
+// client input, so they are built per request rather than cached.
+type Registry struct {
+	mu        sync.Mutex
+	factories map[string]Factory
+	models    map[string]string
+	def       string
+	grounding Grounding
+	cache     map[string]Provider
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		factories: map[string]Factory{},
+		models:    map[string]string{},
+		cache:     map[string]Provider{},
+	}
+}
+
+// Register adds a factory under name with its default model.
+func (r *Registry) Register(name, defaultModel string, f Factory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[name] = f
+	r.models[name] = defaultModel
+	r.dropCached(name)
+}
+
+// SetDefault selects the provider used when a request does not name one.
+func (r *Registry) SetDefault(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.def = name
+}
+
+// SetGrounding attaches metadata to every provider that supports it.
+func (r *Registry) SetGrounding(g Grounding) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.grounding = g
+	r.cache = map[string]Provider{}
+}
+
+// Available reports whether the default provider can be built.
+func (r *Registry) Available() bool {
+	if r == nil {
+		return false
+	}
+	_, err := r.Get("", "")
+	return err == nil
+}
+
+// Get returns the provider by name (default when empty) for model (provider default when empty).
+func (r *Registry) Get(name, model string) (Provider, error) {
+	if r == nil {
+		return nil, ErrNoProvider
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if name == "" {
+		name = r.def
+	}
+	if name == "" {
+		return nil, ErrNoProvider
+	}
+	f, ok := r.factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown LLM provider %q", name)
+	}
+	if model == "" {
+		model = r.models[name]
+	} else if !validModel(model) {
+		return nil, fmt.Errorf("invalid model name %q", model)
+	}
+	cacheable := model == r.models[name]
+	key := name + "|" + model
+	if p, ok := r.cache[key]; ok && cacheable {
+		return p, nil
+	}
+	p := f(model)
+	if p == nil {
+		return nil, fmt.Errorf("LLM provider %q is not configured", name)
+	}
+	if g, ok := p.(interface{ SetGrounding(Grounding) }); ok && r.grounding != nil {
+		g.SetGrounding(r.grounding)
+	}
+	if cacheable {
+		r.cache[key] = p
+	}
+	return p, nil
+}
+
+// validModel accepts model names such as "gpt-4o-mini", "llama3.1:8b" or
+// "org/model@v1"; anything else is rejected before it reaches a provider.
+func validModel(model string) bool {
+	if len(model) > 100 {
+		return false
+	}
+	for _, r := range model {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("._:/@=+-", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// List returns registered providers sorted by name.
+func (r *Registry) List() []ProviderInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]ProviderInfo, 0, len(r.factories))
+	for name := range r.factories {
+		out = append(out, ProviderInfo{Name: name, Model: r.models[name], Default: name == r.def})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (r *Registry) dropCached(name string) {
+	for key := range r.cache {
+		if len(key) > len(name) && key[:len(name)+1] == name+"|" {
+			delete(r.cache, key)
+		}
+	}
+}
+
+// OpenAIFactory builds OpenAI providers; a non-empty baseURL targets an
+// OpenAI-compatible server instead of api.openai.com.
+func OpenAIFactory(baseURL, apiKey string) Factory {
+	return func(model string) Provider {
+		var o *OpenAI
+		if baseURL != "" {
+			o = NewOpenAICompatible(baseURL, apiKey, model)
+		} else {
+			o = NewOpenAI(apiKey, model)
+		}
+		if o == nil {
+			return nil
+		}
+		return o
+	}
+}
+
+// AnthropicFactory builds Anthropic providers.
+func AnthropicFactory(apiKey string) Factory {
+	return func(model string) Provider {
+		a := NewAnthropic(apiKey, model)
+		if a == nil {
+			return nil
+		}
+		return a
+	}
+}
+
+// FakeFactory builds deterministic fakes. The model "confidence=0.3" sets the
+// confidence of derived JQL, to exercise the confirmation path; other models
+// are ignored.
+func FakeFactory() Factory {
+	return func(model string) Provider {
+		f := NewFake()
+		if v, ok := strings.CutPrefix(model, "confidence="); ok {
+			if c, err := strconv.ParseFloat(v, 64); err == nil {
+				f.Confidence = &c
+			}
+		}
+		return f
+	}
+}
@@ -0,0 +1,36 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistryCachesDefaultModelOnly(t *testing.T) {
+	built := 0
+	r := NewRegistry()
+	r.Register("fake", "base", func(string) Provider { built++; return NewFake() })
+	r.SetDefault("fake")
+
+	for _, model := range []string{"", "base", ""} {
+		if _, err := r.Get("", model); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if built != 1 {
+		t.Fatalf("default model built %d times, want 1", built)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := r.Get("fake", "other"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if built != 4 || len(r.cache) != 1 {
+		t.Errorf("built %d providers and cached %d, want 4 built and only the default cached", built, len(r.cache))
+	}
+
+	for _, bad := range []string{"a b", "x\\ny", strings.Repeat("m", 101)} {
+		if _, err := r.Get("fake", bad); err == nil {
+			t.Errorf("model %q accepted", bad)
+		}
+	}
+}
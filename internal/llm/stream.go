@@ -0,0 +1,20 @@
+package llm
+
+import "context"
+
+// TokenFunc receives completion text as it is generated.
+type TokenFunc func(delta string)
+
+type tokensKey struct{}
+
+// WithTokens returns a context whose completions are streamed to fn. Backends
+// that cannot stream deliver the whole answer in one call once it is ready.
+// A nil fn switches streaming off for calls made with the returned context.
+func WithTokens(ctx context.Context, fn TokenFunc) context.Context {
+	return context.WithValue(ctx, tokensKey{}, fn)
+}
+
+func tokensFrom(ctx context.Context) TokenFunc {
+	fn, _ := ctx.Value(tokensKey{}).(TokenFunc)
+	return fn
+}
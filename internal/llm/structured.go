@@ -0,0 +1,262 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// LowConfidence is the threshold below which derived JQL should be confirmed by the user.
+const LowConfidence = 0.5
+
+// JQLResult is the structured answer of DeriveJQL.
+type JQLResult struct {
+	JQL         string   `json:"jql"`
+	Explanation string   `json:"explanation"`
+	Assumptions []string `json:"assumptions"`
+	Confidence  float64  `json:"confidence"` // 0..1
+}
+
+// decodeJQL decodes a DeriveJQL/RefineJQL reply. A reply without
+// "confidence" (prompt-only schemas are not enforced) counts as confident
+// rather than as 0, which would ask for confirmation on every search; a
+// stated value is clamped to [0, 1].
+func decodeJQL(out string) (JQLResult, error) {
+	var wire struct {
+		JQLResult
+		Confidence *float64 `json:"confidence"`
+	}
+	if err := decodeStructured(out, &wire); err != nil {
+		return JQLResult{}, err
+	}
+	res := wire.JQLResult
+	res.JQL = strings.TrimSpace(res.JQL)
+	if res.JQL == "" {
+		return JQLResult{}, errors.New("model returned empty jql")
+	}
+	res.Confidence = 1
+	if wire.Confidence != nil {
+		res.Confidence = math.Max(0, math.Min(1, *wire.Confidence))
+	}
+	return res, nil
+}
+
+// NeedsConfirmation reports whether the model was unsure about the JQL.
+func (r JQLResult) NeedsConfirmation() bool {
+	return r.Confidence < LowConfidence
+}
+
+// Analysis is the structured answer of Analyze.
+type Analysis struct {
+	Summary  string          `json:"summary"`
+	Totals   []Total         `json:"totals"`
+	Issues   []AnalysisIssue `json:"issues"`
+	Warnings []string        `json:"warnings"`
+}
+
+// Total is a named aggregate, e.g. {"Списано", "12.5 ч"}.
+type Total struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// AnalysisIssue is one highlighted issue with a short note.
+type AnalysisIssue struct {
+	Key   string `json:"key"`
+	Title string `json:"title"`
+	Note  string `json:"note"`
+}
+
+// Text renders the analysis as plain text for history entries and follow-up context.
+func (a Analysis) Text() string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(a.Summary))
+	if len(a.Totals) > 0 {
+		b.WriteString("\n")
+		for _, t := range a.Totals {
+			fmt.Fprintf(&b, "\n%s: %s", t.Label, t.Value)
+		}
+	}
+	if len(a.Issues) > 0 {
+		b.WriteString("\n")
+		for _, iss := range a.Issues {
+			fmt.Fprintf(&b, "\n- %s: %s", iss.Key, iss.Title)
+			if iss.Note != "" {
+				fmt.Fprintf(&b, " — %s", iss.Note)
+			}
+		}
+	}
+	if len(a.Warnings) > 0 {
+		b.WriteString("\n")
+		for _, w := range a.Warnings {
+			fmt.Fprintf(&b, "\n⚠ %s", w)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// IssueReview is the structured answer of ReviewIssue.
+type IssueReview struct {
+	Key                       string   `json:"key"`
+	Summary                   string   `json:"summary"`
+	Risks                     []string `json:"risks"`
+	MissingAcceptanceCriteria []string `json:"missingAcceptanceCriteria"`
+	Staleness                 string   `json:"staleness"`
+	Recommendation            string   `json:"recommendation"`
+}
+
+// TestCase is one structured test case produced by GenerateTestCases.
+type TestCase struct {
+	IssueKey      string     `json:"issueKey"`
+	Title         string     `json:"title"`
+	Preconditions []string   `json:"preconditions"`
+	Steps         []TestStep `json:"steps"`
+	Expected      string     `json:"expected"` // overall expected result
+	Priority      string     `json:"priority"` // High, Medium or Low
+}
+
+type TestStep struct {
+	Action   string `json:"action"`
+	Data     string `json:"data"`
+	Expected string `json:"expected"`
+}
+
+// StepKind is a step type the planner may choose from.
+type StepKind struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// PlannedStep is one step of a plan. Instruction carries step-specific input,
+// e.g. what a follow-up step should produce.
+type PlannedStep struct {
+	Kind        string `json:"kind"`
+	Title       string `json:"title"`
+	Instruction string `json:"instruction"`
+}
+
+// schema is a named JSON schema for structured completions.
+type schema struct {
+	Name string
+	JSON json.RawMessage
+}
+
+// Schemas are strict-mode compatible: every property required, no extras.
+var (
+	jqlSchema = schema{Name: "jql_result", JSON: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "jql": {"type": "string"},
+    "explanation": {"type": "string"},
+    "assumptions": {"type": "array", "items": {"type": "string"}},
+    "confidence": {"type": "number"}
+  },
+  "required": ["jql", "explanation", "assumptions", "confidence"],
+  "additionalProperties": false
+}`)}
+
+	analysisSchema = schema{Name: "analysis", JSON: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "summary": {"type": "string"},
+    "totals": {"type": "array", "items": {
+      "type": "object",
+      "properties": {"label": {"type": "string"}, "value": {"type": "string"}},
+      "required": ["label", "value"],
+      "additionalProperties": false
+    }},
+    "issues": {"type": "array", "items": {
+      "type": "object",
+      "properties": {"key": {"type": "string"}, "title": {"type": "string"}, "note": {"type": "string"}},
+      "required": ["key", "title", "note"],
+      "additionalProperties": false
+    }},
+    "warnings": {"type": "array", "items": {"type": "string"}}
+  },
+  "required": ["summary", "totals", "issues", "warnings"],
+  "additionalProperties": false
+}`)}
+
+	reviewSchema = schema{Name: "issue_review", JSON: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "key": {"type": "string"},
+    "summary": {"type": "string"},
+    "risks": {"type": "array", "items": {"type": "string"}},
+    "missingAcceptanceCriteria": {"type": "array", "items": {"type": "string"}},
+    "staleness": {"type": "string"},
+    "recommendation": {"type": "string"}
+  },
+  "required": ["key", "summary", "risks", "missingAcceptanceCriteria", "staleness", "recommendation"],
+  "additionalProperties": false
+}`)}
+
+	testCasesSchema = schema{Name: "test_cases", JSON: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "cases": {"type": "array", "items": {
+      "type": "object",
+      "properties": {
+        "issueKey": {"type": "string"},
+        "title": {"type": "string"},
+        "preconditions": {"type": "array", "items": {"type": "string"}},
+        "steps": {"type": "array", "items": {
+          "type": "object",
+          "properties": {"action": {"type": "string"}, "data": {"type": "string"}, "expected": {"type": "string"}},
+          "required": ["action", "data", "expected"],
+          "additionalProperties": false
+        }},
+        "expected": {"type": "string"},
+        "priority": {"type": "string", "enum": ["High", "Medium", "Low"]}
+      },
+      "required": ["issueKey", "title", "preconditions", "steps", "expected", "priority"],
+      "additionalProperties": false
+    }}
+  },
+  "required": ["cases"],
+  "additionalProperties": false
+}`)}
+
+	planSchema = schema{Name: "plan", JSON: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "steps": {"type": "array", "items": {
+      "type": "object",
+      "properties": {"kind": {"type": "string"}, "title": {"type": "string"}, "instruction": {"type": "string"}},
+      "required": ["kind", "title", "instruction"],
+      "additionalProperties": false
+    }}
+  },
+  "required": ["steps"],
+  "additionalProperties": false
+}`)}
+)
+
+// decodeStructured parses a model reply into v. Backends without native schema
+// support sometimes wrap the object in prose or code fences, so the outermost
+// {...} is tried as well.
+func decodeStructured(out string, v any) error {
+	out = strings.TrimSpace(out)
+	if err := json.Unmarshal([]byte(out), v); err == nil {
+		return nil
+	}
+	start := strings.Index(out, "{")
+	end := strings.LastIndex(out, "}")
+	if start < 0 || end <= start {
+		return errors.New("model reply is not JSON")
+	}
+	if err := json.Unmarshal([]byte(out[start:end+1]), v); err != nil {
+		return fmt.Errorf("parse model reply: %w", err)
+	}
+	return nil
+}
+
+// withSchema appends the JSON schema to the system prompt when one is requested.
+func withSchema(req chatRequest) string {
+	if req.Schema == nil {
+		return req.System
+	}
+	return req.System + "\n\nRespond with a single JSON object (no prose, no code fences) matching this JSON schema:\n" + string(req.Schema.JSON)
+}
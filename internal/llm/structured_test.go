@@ -0,0 +1,45 @@
+package llm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDecodeJQLConfidence(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		out  string
+		want float64
+	}{
+		{"missing", `{"jql": "project = CE", "explanation": "", "assumptions": []}`, 1},
+		{"stated", `{"jql": "project = CE", "confidence": 0.3}`, 0.3},
+		{"zero", `{"jql": "project = CE", "confidence": 0}`, 0},
+		{"above one", `{"jql": "project = CE", "confidence": 7}`, 1},
+		{"negative", "Here you go:\n{\"jql\": \"project = CE\", \"confidence\": -2}", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := decodeJQL(tc.out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Confidence != tc.want {
+				t.Errorf("confidence = %v, want %v", res.Confidence, tc.want)
+			}
+		})
+	}
+	if _, err := decodeJQL(`{"jql": "  ", "confidence": 1}`); err == nil {
+		t.Error("empty jql accepted")
+	}
+}
+
+func TestFakeConfidence(t *testing.T) {
+	for model, want := range map[string]bool{"": false, "confidence=0.2": true, "confidence=0.9": false} {
+		res, err := FakeFactory()(model).DeriveJQL(context.Background(), "bugs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.NeedsConfirmation() != want {
+			t.Errorf("model %q: needsConfirmation = %v, want %v", model, res.NeedsConfirmation(), want)
+		}
+	}
+}
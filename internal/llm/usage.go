@@ -0,0 +1,101 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Usage is the token consumption of one or more completions.
+type Usage struct {
+	Model            string  `json:"model,omitempty"`
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	CostUSD          float64 `json:"costUsd"`
+	// Estimated is set when the backend did not report usage and tokens were
+	// approximated from text length.
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+// Add accumulates o into u.
+func (u *Usage) Add(o Usage) {
+	if u.Model == "" {
+		u.Model = o.Model
+	}
+	u.Calls += o.Calls
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.CostUSD += o.CostUSD
+	u.Estimated = u.Estimated || o.Estimated
+}
+
+// Meter collects usage of every completion made with a context returned by WithMeter.
+type Meter struct {
+	mu    sync.Mutex
+	total Usage
+}
+
+type meterKey struct{}
+
+// WithMeter returns a context whose completions are recorded into m.
+func WithMeter(ctx context.Context, m *Meter) context.Context {
+	return context.WithValue(ctx, meterKey{}, m)
+}
+
+// Total returns the usage recorded so far.
+func (m *Meter) Total() Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.total
+}
+
+func record(ctx context.Context, u Usage) {
+	m, ok := ctx.Value(meterKey{}).(*Meter)
+	if !ok || m == nil {
+		return
+	}
+	u.Calls = 1
+	u.CostUSD = Price(u.Model, u.PromptTokens, u.CompletionTokens)
+	m.mu.Lock()
+	m.total.Add(u)
+	m.mu.Unlock()
+}
+
+// pricing is USD per 1M prompt/completion tokens, matched by model prefix.
+// Unknown and local models are free.
+var pricing = []struct {
+	prefix             string
+	prompt, completion float64
+}{
+	{"gpt-4o-mini", 0.15, 0.60},
+	{"gpt-4o", 2.50, 10.00},
+	{"gpt-4.1-mini", 0.40, 1.60},
+	{"gpt-4.1-nano", 0.10, 0.40},
+	{"gpt-4.1", 2.00, 8.00},
+	{"claude-3-5-haiku", 0.80, 4.00},
+	{"claude-3-5-sonnet", 3.00, 15.00},
+	{"claude-3-7-sonnet", 3.00, 15.00},
+	{"claude-sonnet-4", 3.00, 15.00},
+}
+
+// Price estimates the USD cost of a completion.
+func Price(model string, promptTokens, completionTokens int) float64 {
+	for _, p := range pricing {
+		if strings.HasPrefix(model, p.prefix) {
+			return (float64(promptTokens)*p.prompt + float64(completionTokens)*p.completion) / 1e6
+		}
+	}
+	return 0
+}
+
+// EstimateTokens approximates the token count of s. Mixed Russian/English text
+// with JSON punctuation averages about three characters per token.
+func EstimateTokens(s string) int {
+	n := utf8.RuneCountInString(s)
+	if n == 0 {
+		return 0
+	}
+	return n/3 + 1
+}
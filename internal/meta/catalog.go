@@ -0,0 +1,464 @@
+package meta
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Project is a Jira project as stored in jira_projects.json.
+type Project struct {
+	ID   string `json:"id"`
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+// Status is a workflow status with its category (To Do / In Progress / Done).
+type Status struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Category string `json:"category"`
+}
+
+// Field is a Jira field; custom fields carry cf[NNN] clause names.
+type Field struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Custom      bool     `json:"custom"`
+	Searchable  bool     `json:"searchable"`
+	ClauseNames []string `json:"clauseNames,omitempty"`
+	Type        string   `json:"type,omitempty"`
+}
+
+// Version is a project fix version.
+type Version struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	ProjectKey string `json:"projectKey"`
+	Released   bool   `json:"released"`
+	Archived   bool   `json:"archived"`
+}
+
+// Catalog is the in-memory view of the reference data written by Fetcher.
+type Catalog struct {
+	Projects   []Project `json:"projects"`
+	Statuses   []Status  `json:"statuses"`
+	IssueTypes []string  `json:"issueTypes"`
+	Priorities []string  `json:"priorities"`
+	Fields     []Field   `json:"fields"`
+	Versions   []Version `json:"versions"`
+}
+
+// Limits for the prompt subset; the full catalog is far too large for a JQL prompt.
+const (
+	promptMaxStatuses     = 40
+	promptMaxCustomFields = 15
+	promptMaxVersions     = 15
+)
+
+// LoadCatalog reads the jira_*.json files from dir. Missing files are skipped;
+// an error is returned only when nothing could be loaded at all.
+func LoadCatalog(dir string) (*Catalog, error) {
+	c := &Catalog{}
+	var loaded int
+	var errs []string
+
+	var projects []Project
+	if ok, err := readJSON(dir, "jira_projects", &projects); ok {
+		c.Projects = projects
+		loaded++
+	} else if err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	var statuses []struct {
+		ID             string `json:"id"`
+		Name           string `json:"name"`
+		StatusCategory struct {
+			Name string `json:"name"`
+		} `json:"statusCategory"`
+	}
+	if ok, err := readJSON(dir, "jira_statuses", &statuses); ok {
+		seen := map[string]struct{}{}
+		for _, s := range statuses {
+			key := strings.ToLower(s.Name)
+			if _, dup := seen[key]; dup || s.Name == "" {
+				continue
+			}
+			seen[key] = struct{}{}
+			c.Statuses = append(c.Statuses, Status{ID: s.ID, Name: s.Name, Category: s.StatusCategory.Name})
+		}
+		loaded++
+	} else if err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	var named []struct {
+		Name string `json:"name"`
+	}
+	if ok, err := readJSON(dir, "jira_issue_types", &named); ok {
+		c.IssueTypes = uniqueNames(named)
+		loaded++
+	} else if err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	named = nil
+	if ok, err := readJSON(dir, "jira_priorities", &named); ok {
+		c.Priorities = uniqueNames(named)
+		loaded++
+	} else if err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	var fields []struct {
+		ID          string   `json:"id"`
+		Name        string   `json:"name"`
+		Custom      bool     `json:"custom"`
+		Searchable  bool     `json:"searchable"`
+		ClauseNames []string `json:"clauseNames"`
+		Schema      struct {
+			Type string `json:"type"`
+		} `json:"schema"`
+	}
+	if ok, err := readJSON(dir, "jira_fields", &fields); ok {
+		for _, f := range fields {
+			c.Fields = append(c.Fields, Field{
+				ID:          f.ID,
+				Name:        f.Name,
+				Custom:      f.Custom,
+				Searchable:  f.Searchable,
+				ClauseNames: f.ClauseNames,
+				Type:        f.Schema.Type,
+			})
+		}
+		loaded++
+	} else if err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	// jira_versions.json is keyed by project id.
+	var versions map[string][]struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		Released bool   `json:"released"`
+		Archived bool   `json:"archived"`
+	}
+	if ok, err := readJSON(dir, "jira_versions", &versions); ok {
+		keyByID := make(map[string]string, len(c.Projects))
+		for _, p := range c.Projects {
+			keyByID[p.ID] = p.Key
+		}
+		ids := make([]string, 0, len(versions))
+		for id := range versions {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			for _, v := range versions[id] {
+				c.Versions = append(c.Versions, Version{
+					ID:         v.ID,
+					Name:       v.Name,
+					ProjectKey: keyByID[id],
+					Released:   v.Released,
+					Archived:   v.Archived,
+				})
+			}
+		}
+		loaded++
+	} else if err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if loaded == 0 {
+		if len(errs) > 0 {
+			return nil, fmt.Errorf("load catalog: %s", strings.Join(errs, "; "))
+		}
+		return nil, fmt.Errorf("load catalog: no metadata in %s (run cmd/fetchmeta)", dir)
+	}
+	return c, nil
+}
+
+// ProjectByKey returns a project by its key (case-insensitive).
+func (c *Catalog) ProjectByKey(key string) (Project, bool) {
+	if c == nil {
+		return Project{}, false
+	}
+	for _, p := range c.Projects {
+		if strings.EqualFold(p.Key, key) {
+			return p, true
+		}
+	}
+	return Project{}, false
+}
+
+// PromptContext renders the part of the catalog relevant to query as plain text
+// for an LLM prompt: all project keys, issue types and priorities, plus statuses,
+// custom fields and versions ranked by overlap with the query.
+func (c *Catalog) PromptContext(query string) string {
+	if c == nil {
+		return ""
+	}
+	tokens := tokenize(query)
+	mentioned := c.mentionedProjects(query, tokens)
+
+	var b strings.Builder
+	if len(c.Projects) > 0 {
+		b.WriteString("Projects (key: name):\n")
+		for _, p := range c.Projects {
+			fmt.Fprintf(&b, "- %s: %s\n", p.Key, p.Name)
+		}
+	}
+	if len(c.IssueTypes) > 0 {
+		b.WriteString("Issue types: " + strings.Join(quoteAll(c.IssueTypes), ", ") + "\n")
+	}
+	if len(c.Priorities) > 0 {
+		b.WriteString("Priorities: " + strings.Join(quoteAll(c.Priorities), ", ") + "\n")
+	}
+
+	if statuses := c.relevantStatuses(tokens); len(statuses) > 0 {
+		b.WriteString("Statuses (name [category]); statusCategory may be To Do, In Progress or Done:\n")
+		for _, s := range statuses {
+			fmt.Fprintf(&b, "- %q [%s]\n", s.Name, s.Category)
+		}
+	}
+
+	if fields := c.relevantCustomFields(tokens); len(fields) > 0 {
+		b.WriteString("Custom fields (clause: name, type):\n")
+		for _, f := range fields {
+			fmt.Fprintf(&b, "- %s: %q, %s\n", fieldClause(f), f.Name, f.Type)
+		}
+	}
+
+	if versions := c.relevantVersions(tokens, mentioned); len(versions) > 0 {
+		b.WriteString("Versions (project: name):\n")
+		for _, v := range versions {
+			state := "unreleased"
+			if v.Released {
+				state = "released"
+			}
+			fmt.Fprintf(&b, "- %s: %q (%s)\n", v.ProjectKey, v.Name, state)
+		}
+	}
+	return b.String()
+}
+
+func (c *Catalog) mentionedProjects(query string, tokens []string) map[string]bool {
+	out := map[string]bool{}
+	upper := strings.ToUpper(query)
+	for _, p := range c.Projects {
+		if containsWord(upper, p.Key) {
+			out[p.Key] = true
+			continue
+		}
+		if overlap(tokens, tokenize(p.Name)) > 0 {
+			out[p.Key] = true
+		}
+	}
+	return out
+}
+
+func (c *Catalog) relevantStatuses(tokens []string) []Status {
+	type scored struct {
+		s     Status
+		score int
+		idx   int
+	}
+	list := make([]scored, 0, len(c.Statuses))
+	for i, s := range c.Statuses {
+		list = append(list, scored{s: s, score: overlap(tokens, tokenize(s.Name)), idx: i})
+	}
+	// Matches first; the rest keep Jira's id order, which puts the long-lived
+	// shared statuses (new, In Progress, Done...) ahead of project-specific ones.
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].score != list[j].score {
+			return list[i].score > list[j].score
+		}
+		return list[i].idx < list[j].idx
+	})
+	out := make([]Status, 0, promptMaxStatuses)
+	for _, it := range list {
+		if len(out) >= promptMaxStatuses {
+			break
+		}
+		out = append(out, it.s)
+	}
+	return out
+}
+
+func (c *Catalog) relevantCustomFields(tokens []string) []Field {
+	// Agile fields are referenced constantly in sprint/estimate queries; keep them.
+	always := map[string]bool{"sprint": true, "story points": true, "epic link": true, "severity": true}
+	var matched, rest []Field
+	for _, f := range c.Fields {
+		if !f.Custom || !f.Searchable {
+			continue
+		}
+		if overlap(tokens, tokenize(f.Name)) > 0 {
+			matched = append(matched, f)
+		} else if always[strings.ToLower(f.Name)] {
+			rest = append(rest, f)
+		}
+	}
+	out := append(matched, rest...)
+	if len(out) > promptMaxCustomFields {
+		out = out[:promptMaxCustomFields]
+	}
+	return out
+}
+
+func (c *Catalog) relevantVersions(tokens []string, projects map[string]bool) []Version {
+	var named, active []Version
+	for _, v := range c.Versions {
+		lname := strings.ToLower(v.Name)
+		isNamed := false
+		for _, t := range tokens {
+			if len(t) >= 3 && strings.Contains(lname, t) {
+				isNamed = true
+				break
+			}
+		}
+		switch {
+		case isNamed:
+			named = append(named, v)
+		case projects[v.ProjectKey] && !v.Archived && !v.Released:
+			active = append(active, v)
+		}
+	}
+	out := append(named, active...)
+	if len(out) > promptMaxVersions {
+		out = out[:promptMaxVersions]
+	}
+	return out
+}
+
+func fieldClause(f Field) string {
+	for _, n := range f.ClauseNames {
+		if strings.HasPrefix(n, "cf[") {
+			return n
+		}
+	}
+	if len(f.ClauseNames) > 0 {
+		return f.ClauseNames[0]
+	}
+	return f.ID
+}
+
+func readJSON(dir, name string, v any) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name+".json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("parse %s: %w", name, err)
+	}
+	return true, nil
+}
+
+func uniqueNames(list []struct {
+	Name string `json:"name"`
+}) []string {
+	seen := map[string]struct{}{}
+	out := make([]string, 0, len(list))
+	for _, it := range list {
+		if it.Name == "" {
+			continue
+		}
+		if _, ok := seen[it.Name]; ok {
+			continue
+		}
+		seen[it.Name] = struct{}{}
+		out = append(out, it.Name)
+	}
+	return out
+}
+
+func quoteAll(items []string) []string {
+	out := make([]string, 0, len(items))
+	for _, it := range items {
+		out = append(out, fmt.Sprintf("%q", it))
+	}
+	return out
+}
+
+// stopWords are frequent query words that would otherwise match half the catalog.
+var stopWords = map[string]struct{}{
+	"the": {}, "for": {}, "and": {}, "with": {}, "from": {}, "all": {}, "my": {},
+	"задача": {}, "задачи": {}, "задач": {}, "покажи": {}, "найди": {}, "выведи": {},
+	"мои": {}, "все": {}, "для": {}, "что": {}, "как": {}, "это": {}, "этот": {}, "статусе": {},
+}
+
+// tokenize lowercases s and splits it into words of at least 3 letters/digits,
+// dropping stop words.
+func tokenize(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	out := words[:0]
+	for _, w := range words {
+		if len([]rune(w)) < 3 {
+			continue
+		}
+		if _, stop := stopWords[w]; stop {
+			continue
+		}
+		out = append(out, w)
+	}
+	return out
+}
+
+// overlap counts query tokens that match a name token. A shared prefix of 4+
+// runes counts as a match so inflected forms ("testing"/"tested") still hit.
+func overlap(query, name []string) int {
+	n := 0
+	for _, q := range query {
+		for _, t := range name {
+			if q == t || commonPrefix(q, t) >= 4 {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+func commonPrefix(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	n := 0
+	for n < len(ra) && n < len(rb) && ra[n] == rb[n] {
+		n++
+	}
+	return n
+}
+
+func containsWord(haystack, word string) bool {
+	if word == "" {
+		return false
+	}
+	for i := 0; ; {
+		j := strings.Index(haystack[i:], word)
+		if j < 0 {
+			return false
+		}
+		start := i + j
+		end := start + len(word)
+		before := start == 0 || !isWordByte(haystack[start-1])
+		after := end == len(haystack) || !isWordByte(haystack[end])
+		if before && after {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || (b >= '0' && b <= '9') || (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z')
+}
@@ -0,0 +1,46 @@
+package nlq
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// Case is one corpus entry: a real user query and the JQL it should produce.
+type Case struct {
+	Query string `json:"query"`
+	JQL   string `json:"jql"`
+	Note  string `json:"note,omitempty"`
+}
+
+// Mismatch is a corpus case whose derived JQL differs from the expectation.
+type Mismatch struct {
+	Case
+	Got string `json:"got"`
+}
+
+// LoadCorpus reads a JSON array of cases.
+func LoadCorpus(path string) ([]Case, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cases []Case
+	if err := json.Unmarshal(data, &cases); err != nil {
+		return nil, err
+	}
+	return cases, nil
+}
+
+// Check derives JQL for every case and returns the ones that differ
+// (whitespace-insensitive).
+func (e *Engine) Check(cases []Case) []Mismatch {
+	var out []Mismatch
+	for _, c := range cases {
+		got := e.DeriveJQL(c.Query)
+		if strings.Join(strings.Fields(got), " ") != strings.Join(strings.Fields(c.JQL), " ") {
+			out = append(out, Mismatch{Case: c, Got: got})
+		}
+	}
+	return out
+}
@@ -0,0 +1,144 @@
+package nlq
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// Dictionary maps user vocabulary to Jira concepts. Aliases are lowercase word
+// stems: "баг" matches "баги" and "багов". Aliases of one or two runes ("я",
+// "qa") only match a whole word. Multi-word aliases match as a phrase.
+type Dictionary struct {
+	Worklog  []string `json:"worklog"`  // time-tracking questions
+	Bug      []string `json:"bug"`      // defects reported by someone
+	Sprint   []string `json:"sprint"`   // sprint-scoped questions
+	Self     []string `json:"self"`     // the current user
+	Reported []string `json:"reported"` // "я создал/завел": reporter rather than assignee
+	PerIssue []string `json:"perIssue"` // "каждую задачу": analyse issues one by one
+	Refine   []string `json:"refine"`   // "покажи только те, что...": narrow down a previous result
+
+	Created  []string `json:"created"`  // date refers to creation
+	Updated  []string `json:"updated"`  // date refers to last update
+	Resolved []string `json:"resolved"` // date refers to resolution
+
+	People           map[string]string   `json:"people"`           // alias -> Jira login
+	Projects         map[string]string   `json:"projects"`         // alias -> project key
+	Statuses         map[string][]string `json:"statuses"`         // alias -> status names
+	StatusCategories map[string]string   `json:"statusCategories"` // alias -> To Do | In Progress | Done
+	IssueTypes       map[string]string   `json:"issueTypes"`       // alias -> issue type name
+}
+
+// DefaultDictionary covers the Russian/English phrasing used in day-to-day queries.
+func DefaultDictionary() Dictionary {
+	return Dictionary{
+		Worklog:  []string{"worklog", "time spent", "сколько времени", "затрек", "списал", "списан", "затрачен", "часы", "часов", "hours"},
+		Bug:      []string{"ошиб", "bug", "баг", "дефект", "заведен"},
+		Sprint:   []string{"спринт", "sprint"},
+		Self:     []string{"я", "мои", "мой", "моя", "моих", "мне", "меня", "mine", "my", "me"},
+		Reported: []string{"я создал", "я завел", "я завёл", "создал я", "завел я", "reported by me", "i reported", "заведенн"},
+		PerIssue: []string{"каждую задач", "каждой задач", "каждый тикет", "по каждой", "по отдельности", "each issue", "every issue", "each ticket", "per issue"},
+		Refine:   []string{"только те", "только задачи", "оставь только", "покажи только", "отфильтр", "исключи", "кроме", "из них", "среди них", "only those", "only the", "filter", "exclude", "of them"},
+
+		Created:  []string{"создан", "созда", "заведен", "created"},
+		Updated:  []string{"обновл", "изменен", "updated", "changed"},
+		Resolved: []string{"закрыт", "решен", "решён", "resolved", "closed"},
+
+		People:   map[string]string{},
+		Projects: map[string]string{},
+		Statuses: map[string][]string{},
+		StatusCategories: map[string]string{
+			"в работе":    "In Progress",
+			"в процессе":  "In Progress",
+			"in progress": "In Progress",
+			"открыт":      "To Do",
+			"новые":       "To Do",
+			"to do":       "To Do",
+			"todo":        "To Do",
+			"сделан":      "Done",
+			"выполнен":    "Done",
+			"готов":       "Done",
+			"завершен":    "Done",
+			"done":        "Done",
+		},
+		IssueTypes: map[string]string{
+			"ошиб":     "Bug",
+			"баг":      "Bug",
+			"дефект":   "Bug",
+			"bug":      "Bug",
+			"истори":   "Story",
+			"стори":    "Story",
+			"story":    "Story",
+			"эпик":     "Epic",
+			"epic":     "Epic",
+			"подзадач": "Sub-task",
+			"сабтаск":  "Sub-task",
+			"sub-task": "Sub-task",
+			"subtask":  "Sub-task",
+			"улучшен":  "Improvement",
+			"improvem": "Improvement",
+			"фич":      "New Feature",
+			"feature":  "New Feature",
+			"инцидент": "Incident",
+			"incident": "Incident",
+			"рефактор": "Refactoring",
+			"деплой":   "Deployment",
+			"релиз":    "Release",
+		},
+	}
+}
+
+// LoadDictionary reads path and merges it over DefaultDictionary: lists are
+// appended, map entries override. A missing file yields the defaults.
+func LoadDictionary(path string) (Dictionary, error) {
+	d := DefaultDictionary()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return d, nil
+		}
+		return d, err
+	}
+	var extra Dictionary
+	if err := json.Unmarshal(data, &extra); err != nil {
+		return d, err
+	}
+	d.merge(extra)
+	return d, nil
+}
+
+func (d *Dictionary) merge(o Dictionary) {
+	d.Worklog = append(d.Worklog, lowerAll(o.Worklog)...)
+	d.Bug = append(d.Bug, lowerAll(o.Bug)...)
+	d.Sprint = append(d.Sprint, lowerAll(o.Sprint)...)
+	d.Self = append(d.Self, lowerAll(o.Self)...)
+	d.Reported = append(d.Reported, lowerAll(o.Reported)...)
+	d.PerIssue = append(d.PerIssue, lowerAll(o.PerIssue)...)
+	d.Refine = append(d.Refine, lowerAll(o.Refine)...)
+	d.Created = append(d.Created, lowerAll(o.Created)...)
+	d.Updated = append(d.Updated, lowerAll(o.Updated)...)
+	d.Resolved = append(d.Resolved, lowerAll(o.Resolved)...)
+	for k, v := range o.People {
+		d.People[strings.ToLower(k)] = v
+	}
+	for k, v := range o.Projects {
+		d.Projects[strings.ToLower(k)] = v
+	}
+	for k, v := range o.Statuses {
+		d.Statuses[strings.ToLower(k)] = v
+	}
+	for k, v := range o.StatusCategories {
+		d.StatusCategories[strings.ToLower(k)] = v
+	}
+	for k, v := range o.IssueTypes {
+		d.IssueTypes[strings.ToLower(k)] = v
+	}
+}
+
+func lowerAll(list []string) []string {
+	out := make([]string, 0, len(list))
+	for _, s := range list {
+		out = append(out, strings.ToLower(strings.TrimSpace(s)))
+	}
+	return out
+}
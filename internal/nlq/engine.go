@@ -0,0 +1,508 @@
+// Package nlq turns natural-language Jira questions into JQL without an LLM.
+// It extracts intents (worklog, bugs, sprint) and entities (people, projects,
+// statuses, issue types, dates) using a synonym Dictionary and the metadata
+// catalog fetched by cmd/fetchmeta.
+package nlq
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/alekseymerzlyakov/jira/internal/meta"
+)
+
+// Query is the structured reading of a natural-language request.
+type Query struct {
+	Raw string `json:"raw"`
+
+	Worklog      bool `json:"worklog,omitempty"`
+	Bug          bool `json:"bug,omitempty"`
+	Sprint       bool `json:"sprint,omitempty"`
+	SprintNumber int  `json:"sprintNumber,omitempty"`
+	Week         bool `json:"week,omitempty"`
+	Self         bool `json:"self,omitempty"`
+	Reported     bool `json:"reported,omitempty"`
+	PerIssue     bool `json:"perIssue,omitempty"` // deep analysis of every result
+	Refine       bool `json:"refine,omitempty"`   // narrow down earlier results
+
+	People           []string `json:"people,omitempty"`
+	Projects         []string `json:"projects,omitempty"`
+	Statuses         []string `json:"statuses,omitempty"`
+	StatusCategories []string `json:"statusCategories,omitempty"`
+	IssueTypes       []string `json:"issueTypes,omitempty"`
+
+	// DateField is worklogDate, created, updated or resolved; From/To are JQL
+	// date expressions such as startOfMonth() or "2025-12-01".
+	DateField string `json:"dateField,omitempty"`
+	From      string `json:"from,omitempty"`
+	To        string `json:"to,omitempty"`
+
+	Text string `json:"text,omitempty"`
+
+	// PassThrough is set when the input already looks like JQL; only the
+	// intent flags are filled in then.
+	PassThrough bool `json:"passThrough,omitempty"`
+}
+
+// Engine extracts a Query from text.
+type Engine struct {
+	dict    Dictionary
+	catalog *meta.Catalog
+	// statusRes matches every known status name case-insensitively; see
+	// withoutNames.
+	statusRes map[string]*regexp.Regexp
+}
+
+// New builds an engine; catalog may be nil, in which case only the dictionary is used.
+func New(dict Dictionary, catalog *meta.Catalog) *Engine {
+	e := &Engine{dict: dict, catalog: catalog, statusRes: map[string]*regexp.Regexp{}}
+	for _, names := range dict.Statuses {
+		for _, n := range names {
+			e.statusRes[n] = nameRegexp(n)
+		}
+	}
+	if catalog != nil {
+		for _, st := range catalog.Statuses {
+			e.statusRes[st.Name] = nameRegexp(st.Name)
+		}
+	}
+	return e
+}
+
+var (
+	reSprintNumber = regexp.MustCompile(`(?i)(спринт|sprint)\s*([0-9]+)|([0-9]+)\s*(спринт|sprint)`)
+	reISODate      = regexp.MustCompile(`\b(\d{4}-\d{2}-\d{2})\b`)
+	reDMYDate      = regexp.MustCompile(`\b(\d{1,2})\.(\d{1,2})\.(\d{4})\b`)
+	reLastNDays    = regexp.MustCompile(`(?:последние|последних|за)\s+(\d+)\s+(?:дн|день)|last\s+(\d+)\s+days?`)
+	reUpperWord    = regexp.MustCompile(`\b[A-Z][A-Z0-9]+\b(?:-\d+)?`)
+	reQuoted       = regexp.MustCompile(`["«“]([^"»”]+)["»”]`)
+	reLastWeek     = regexp.MustCompile(`(прошл|прошедш|предыдущ)\S*\s+недел|last\s+week|previous\s+week`)
+	reLastMonth    = regexp.MustCompile(`(прошл|прошедш|предыдущ)\S*\s+месяц|last\s+month|previous\s+month`)
+)
+
+// SprintNumber returns the sprint number mentioned in text ("спринт 42", "42 sprint"), or 0.
+func SprintNumber(text string) int {
+	m := reSprintNumber.FindStringSubmatch(text)
+	if len(m) == 0 {
+		return 0
+	}
+	for _, g := range []string{m[2], m[3]} {
+		if g != "" {
+			n, _ := strconv.Atoi(g)
+			return n
+		}
+	}
+	return 0
+}
+
+// LooksLikeJQL reports whether the user typed JQL rather than prose.
+func LooksLikeJQL(query string) bool {
+	lq := strings.ToLower(query)
+	return strings.Contains(lq, "project ") || strings.Contains(lq, "assignee ") || strings.Contains(lq, "status ")
+}
+
+// Parse extracts intents and entities from text. Text may also be a query
+// followed by the JQL derived for it; intent flags then see both.
+func (e *Engine) Parse(text string) Query {
+	q := Query{Raw: strings.TrimSpace(text)}
+	if q.Raw == "" {
+		return q
+	}
+	norm := normalize(q.Raw)
+
+	q.Bug = matchAny(norm, e.dict.Bug)
+	q.Worklog = matchAny(norm, e.dict.Worklog)
+	q.Sprint = matchAny(norm, e.dict.Sprint)
+	q.SprintNumber = SprintNumber(q.Raw)
+	q.Week = matchAny(norm, []string{"недел", "week"})
+	q.Reported = matchAny(norm, e.dict.Reported)
+	q.Self = q.Reported || matchAny(norm, e.dict.Self)
+	q.PerIssue = matchAny(norm, e.dict.PerIssue)
+	q.Refine = matchAny(norm, e.dict.Refine)
+	if LooksLikeJQL(q.Raw) {
+		q.PassThrough = true
+		return q
+	}
+
+	q.People = matchMap(norm, e.dict.People)
+	q.Statuses, q.StatusCategories = e.statuses(norm)
+	q.Projects = e.projects(e.withoutNames(q.Raw, q.Statuses), norm)
+	q.IssueTypes = e.issueTypes(norm)
+	if q.Bug && !contains(q.IssueTypes, "Bug") {
+		q.IssueTypes = append([]string{"Bug"}, q.IssueTypes...)
+	}
+	q.DateField, q.From, q.To = e.dates(q, norm)
+
+	if m := reQuoted.FindStringSubmatch(q.Raw); len(m) == 2 {
+		q.Text = strings.TrimSpace(m[1])
+	} else if !q.Structured() {
+		q.Text = q.Raw
+	}
+	return q
+}
+
+// DeriveJQL is Parse followed by JQL.
+func (e *Engine) DeriveJQL(text string) string {
+	return e.Parse(text).JQL()
+}
+
+// Structured reports whether the text names any filter beyond free text.
+func (q Query) Structured() bool {
+	return q.Worklog || q.Bug || q.Sprint || q.Self || len(q.People) > 0 || len(q.Projects) > 0 ||
+		len(q.Statuses) > 0 || len(q.StatusCategories) > 0 || len(q.IssueTypes) > 0 || q.From != ""
+}
+
+// JQL renders the query. Date ranges come first so that search() can swap the
+// week/month placeholders for real sprint dates.
+func (q Query) JQL() string {
+	if q.Raw == "" {
+		return ""
+	}
+	if q.PassThrough {
+		return q.Raw
+	}
+	var clauses []string
+	if q.DateField != "" && q.From != "" {
+		clauses = append(clauses, fmt.Sprintf("%s >= %s AND %s <= %s", q.DateField, q.From, q.DateField, q.To))
+	}
+	if len(q.Projects) > 0 {
+		clauses = append(clauses, inClause("project", q.Projects, false))
+	}
+	if len(q.IssueTypes) > 0 {
+		clauses = append(clauses, inClause("issuetype", q.IssueTypes, true))
+	}
+	if len(q.Statuses) > 0 {
+		clauses = append(clauses, inClause("status", q.Statuses, true))
+	} else if len(q.StatusCategories) > 0 {
+		clauses = append(clauses, inClause("statusCategory", q.StatusCategories, true))
+	}
+	if role := q.personField(); role != "" {
+		switch {
+		case len(q.People) > 0:
+			clauses = append(clauses, role+" in ("+QuoteList(q.People)+")")
+		default:
+			clauses = append(clauses, role+" = currentUser()")
+		}
+	}
+	if q.Text != "" {
+		clauses = append(clauses, `text ~ "`+EscapeQuotes(q.Text)+`"`)
+	}
+	return strings.Join(clauses, " AND ")
+}
+
+// personField picks the field people refer to; empty when nobody is implied.
+// Worklog and bug questions default to the current user, as the old heuristics
+// did; a bug question wins over a worklog one, as it did there too.
+func (q Query) personField() string {
+	switch {
+	case q.Bug || q.Reported:
+		return "reporter"
+	case q.Worklog:
+		return "worklogAuthor"
+	case q.Self || len(q.People) > 0:
+		return "assignee"
+	}
+	return ""
+}
+
+func (e *Engine) projects(raw, norm string) []string {
+	var out []string
+	seen := map[string]bool{}
+	add := func(key string) {
+		if key != "" && !seen[key] {
+			seen[key] = true
+			out = append(out, key)
+		}
+	}
+	if e.catalog != nil {
+		// Uppercase words that are project keys; issue keys (QA-959) are not projects.
+		for _, w := range reUpperWord.FindAllString(raw, -1) {
+			if strings.Contains(w, "-") {
+				continue
+			}
+			if p, ok := e.catalog.ProjectByKey(w); ok && p.Key == w {
+				add(p.Key)
+			}
+		}
+		for _, p := range e.catalog.Projects {
+			name := strings.ToLower(p.Name)
+			if len([]rune(name)) >= 4 && strings.Contains(" "+norm+" ", " "+normalize(name)+" ") {
+				add(p.Key)
+			}
+		}
+	}
+	for _, key := range matchMap(norm, e.dict.Projects) {
+		add(key)
+	}
+	return out
+}
+
+func (e *Engine) issueTypes(norm string) []string {
+	out := matchMap(norm, e.dict.IssueTypes)
+	if e.catalog != nil {
+		// Catalog names must match a whole word: "updated" is not the Update type.
+		for _, name := range e.catalog.IssueTypes {
+			if strings.Contains(" "+norm+" ", " "+normalize(name)+" ") && !contains(out, name) {
+				out = append(out, name)
+			}
+		}
+	}
+	return out
+}
+
+func (e *Engine) statuses(norm string) ([]string, []string) {
+	var statuses []string
+	aliases := make([]string, 0, len(e.dict.Statuses))
+	for a := range e.dict.Statuses {
+		aliases = append(aliases, a)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		if matchAlias(norm, alias) {
+			for _, n := range e.dict.Statuses[alias] {
+				if !contains(statuses, n) {
+					statuses = append(statuses, n)
+				}
+			}
+		}
+	}
+	if e.catalog != nil {
+		// Exact status names typed by the user ("в статусе Ready for QA"); the
+		// longest match wins so "In Progress" is not also read as "Progress".
+		var hits []string
+		for _, s := range e.catalog.Statuses {
+			name := normalize(s.Name)
+			if len([]rune(name)) >= 4 && strings.Contains(" "+norm+" ", " "+name+" ") {
+				hits = append(hits, s.Name)
+			}
+		}
+		sort.Slice(hits, func(i, j int) bool { return len(hits[i]) > len(hits[j]) })
+		for _, h := range hits {
+			covered := false
+			for _, s := range statuses {
+				if strings.Contains(strings.ToLower(s), strings.ToLower(h)) {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				statuses = append(statuses, h)
+			}
+		}
+	}
+	var categories []string
+	if len(statuses) == 0 {
+		categories = matchMap(norm, e.dict.StatusCategories)
+	}
+	return statuses, categories
+}
+
+func (e *Engine) dates(q Query, norm string) (field, from, to string) {
+	switch {
+	case q.Bug || matchAny(norm, e.dict.Created):
+		field = "created"
+	case q.Worklog:
+		field = "worklogDate"
+	case matchAny(norm, e.dict.Resolved):
+		field = "resolved"
+	default:
+		field = "updated"
+	}
+
+	lower := strings.ToLower(q.Raw)
+	switch {
+	case reISODate.MatchString(lower) || reDMYDate.MatchString(lower):
+		dates := explicitDates(lower)
+		from = `"` + dates[0] + `"`
+		to = `"` + dates[len(dates)-1] + `"`
+		if len(dates) == 1 {
+			to = `"` + dates[0] + ` 23:59"`
+		}
+	case reLastNDays.MatchString(norm):
+		m := reLastNDays.FindStringSubmatch(norm)
+		n := m[1]
+		if n == "" {
+			n = m[2]
+		}
+		from, to = "-"+n+"d", "now()"
+	case matchAny(norm, []string{"сегодня", "today"}):
+		from, to = "startOfDay()", "endOfDay()"
+	case matchAny(norm, []string{"вчера", "yesterday"}):
+		from, to = "startOfDay(-1d)", "endOfDay(-1d)"
+	case reLastWeek.MatchString(norm):
+		from, to = "startOfWeek(-1w)", "endOfWeek(-1w)"
+	case reLastMonth.MatchString(norm):
+		from, to = "startOfMonth(-1M)", "endOfMonth(-1M)"
+	case q.Week || q.Sprint:
+		// Sprint dates are resolved later from the board; the week range is the placeholder.
+		from, to = "startOfWeek()", "endOfWeek()"
+	case matchAny(norm, []string{"месяц", "month"}):
+		from, to = "startOfMonth()", "endOfMonth()"
+	case matchAny(norm, []string{"год", "year"}):
+		from, to = "startOfYear()", "endOfYear()"
+	case q.Worklog || q.Bug:
+		from, to = "startOfMonth()", "endOfMonth()"
+	default:
+		return "", "", ""
+	}
+	return field, from, to
+}
+
+// withoutNames blanks out status names (case-insensitive) from s, so that
+// "QA" inside the status "Ready for QA" is not read as a project key. The
+// patterns are compiled once in New.
+func (e *Engine) withoutNames(s string, names []string) string {
+	for _, n := range names {
+		re, ok := e.statusRes[n]
+		if !ok {
+			re = nameRegexp(n)
+		}
+		s = re.ReplaceAllString(s, " ")
+	}
+	return s
+}
+
+func nameRegexp(name string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)` + regexp.QuoteMeta(name))
+}
+
+// explicitDates returns YYYY-MM-DD strings in order of appearance.
+func explicitDates(s string) []string {
+	type hit struct {
+		pos  int
+		date string
+	}
+	var hits []hit
+	for _, m := range reISODate.FindAllStringSubmatchIndex(s, -1) {
+		if _, err := time.Parse("2006-01-02", s[m[2]:m[3]]); err != nil {
+			continue
+		}
+		hits = append(hits, hit{m[0], s[m[2]:m[3]]})
+	}
+	for _, m := range reDMYDate.FindAllStringSubmatchIndex(s, -1) {
+		d, _ := strconv.Atoi(s[m[2]:m[3]])
+		mo, _ := strconv.Atoi(s[m[4]:m[5]])
+		y, _ := strconv.Atoi(s[m[6]:m[7]])
+		if !validDate(y, mo, d) {
+			continue
+		}
+		hits = append(hits, hit{m[0], fmt.Sprintf("%04d-%02d-%02d", y, mo, d)})
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].pos < hits[j].pos })
+	out := make([]string, 0, len(hits))
+	for _, h := range hits {
+		out = append(out, h.date)
+	}
+	return out
+}
+
+// validDate reports whether y-mo-d is a calendar date: time.Date normalises
+// 32.13.2025 into another day, so the round trip must give the same parts.
+func validDate(y, mo, d int) bool {
+	t := time.Date(y, time.Month(mo), d, 0, 0, 0, 0, time.UTC)
+	return t.Year() == y && int(t.Month()) == mo && t.Day() == d
+}
+
+// normalize lowercases s, folds ё to е and collapses everything that is not a
+// letter, digit or hyphen into single spaces.
+func normalize(s string) string {
+	s = strings.ReplaceAll(strings.ToLower(s), "ё", "е")
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	})
+	return strings.Join(words, " ")
+}
+
+// matchAlias reports whether alias occurs in norm starting at a word boundary.
+// Short aliases (one or two runes) must match a whole word.
+func matchAlias(norm, alias string) bool {
+	alias = normalize(alias)
+	if alias == "" {
+		return false
+	}
+	padded := " " + norm + " "
+	if len([]rune(alias)) <= 2 {
+		return strings.Contains(padded, " "+alias+" ")
+	}
+	return strings.Contains(padded, " "+alias)
+}
+
+func matchAny(norm string, aliases []string) bool {
+	for _, a := range aliases {
+		if matchAlias(norm, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMap returns the distinct values whose aliases occur in norm, in alias order.
+func matchMap(norm string, m map[string]string) []string {
+	aliases := make([]string, 0, len(m))
+	for a := range m {
+		aliases = append(aliases, a)
+	}
+	sort.Strings(aliases)
+	var out []string
+	for _, a := range aliases {
+		if matchAlias(norm, a) && !contains(out, m[a]) {
+			out = append(out, m[a])
+		}
+	}
+	return out
+}
+
+func contains(list []string, v string) bool {
+	for _, it := range list {
+		if strings.EqualFold(it, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func inClause(field string, values []string, quote bool) string {
+	items := make([]string, 0, len(values))
+	for _, v := range values {
+		if quote {
+			v = quoteValue(v)
+		}
+		items = append(items, v)
+	}
+	if len(items) == 1 {
+		return field + " = " + items[0]
+	}
+	return field + " in (" + strings.Join(items, ", ") + ")"
+}
+
+// quoteValue quotes v unless it is a single plain word (Bug, Done).
+func quoteValue(v string) string {
+	for _, r := range v {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return `"` + EscapeQuotes(v) + `"`
+		}
+	}
+	return v
+}
+
+// QuoteList renders items as a comma-separated list of quoted JQL strings,
+// for "field in (...)".
+func QuoteList(items []string) string {
+	quoted := make([]string, 0, len(items))
+	for _, it := range items {
+		quoted = append(quoted, `"`+EscapeQuotes(it)+`"`)
+	}
+	return strings.Join(quoted, ",")
+}
+
+// EscapeQuotes escapes backslashes and double quotes for a JQL string.
+func EscapeQuotes(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return s
+}
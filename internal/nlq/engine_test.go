@@ -0,0 +1,65 @@
+package nlq
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alekseymerzlyakov/jira/internal/meta"
+)
+
+// dataDir holds the metadata catalog, the synonym dictionary and the corpus.
+var dataDir = filepath.Join("..", "..", "data")
+
+func corpusEngine(t *testing.T) *Engine {
+	t.Helper()
+	catalog, err := meta.LoadCatalog(dataDir)
+	if err != nil {
+		t.Fatalf("load catalog: %v", err)
+	}
+	dict, err := LoadDictionary(filepath.Join(dataDir, "nlq_synonyms.json"))
+	if err != nil {
+		t.Fatalf("load synonyms: %v", err)
+	}
+	return New(dict, catalog)
+}
+
+// TestCorpus derives JQL for every query of data/nlq_corpus.json.
+func TestCorpus(t *testing.T) {
+	cases, err := LoadCorpus(filepath.Join(dataDir, "nlq_corpus.json"))
+	if err != nil {
+		t.Fatalf("load corpus: %v", err)
+	}
+	e := corpusEngine(t)
+	for _, c := range cases {
+		t.Run(c.Query, func(t *testing.T) {
+			if m := e.Check([]Case{c}); len(m) > 0 {
+				t.Errorf("query: %s\n want: %s\n got:  %s", c.Query, c.JQL, m[0].Got)
+			}
+		})
+	}
+}
+
+func TestExplicitDates(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want []string
+	}{
+		{"с 01.02.2025 по 2025-02-10", []string{"2025-02-01", "2025-02-10"}},
+		{"29.02.2024", []string{"2024-02-29"}},
+		{"29.02.2025", []string{}},
+		{"32.13.2025 и 2025-13-01", []string{}},
+		{"31.04.2025 до 1.5.2025", []string{"2025-05-01"}},
+	} {
+		if got := explicitDates(tc.in); strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("explicitDates(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestBugAndWorklogIntents(t *testing.T) {
+	q := corpusEngine(t).Parse("сколько времени списали на баги")
+	if !q.Bug || !q.Worklog {
+		t.Errorf("bug = %v, worklog = %v; want both, the intents are independent", q.Bug, q.Worklog)
+	}
+}
@@ -0,0 +1,89 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Slack posts to a Slack or Mattermost incoming webhook. Channel and
+// Username override the webhook defaults when set.
+type Slack struct {
+	URL      string
+	Channel  string
+	Username string
+	Client   *http.Client
+}
+
+func (s Slack) Notify(ctx context.Context, msg Message) error {
+	payload := map[string]string{"text": chatText(msg, "*")}
+	if s.Channel != "" {
+		payload["channel"] = s.Channel
+	}
+	if s.Username != "" {
+		payload["username"] = s.Username
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return post(ctx, s.Client, s.URL, body, nil)
+}
+
+// DefaultTelegramAPI is the Bot API base URL.
+const DefaultTelegramAPI = "https://api.telegram.org"
+
+// telegramMaxText is the sendMessage text limit.
+const telegramMaxText = 4096
+
+// Telegram sends messages through the Bot API sendMessage method. BaseURL
+// defaults to DefaultTelegramAPI; point it at a stand-in for local checks.
+type Telegram struct {
+	Token   string
+	ChatID  string
+	BaseURL string
+	Client  *http.Client
+}
+
+func (t Telegram) Notify(ctx context.Context, msg Message) error {
+	text := chatText(msg, "")
+	if r := []rune(text); len(r) > telegramMaxText {
+		text = string(r[:telegramMaxText-1]) + "…"
+	}
+	body, err := json.Marshal(map[string]any{
+		"chat_id":                  t.ChatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return err
+	}
+	base := strings.TrimRight(t.BaseURL, "/")
+	if base == "" {
+		base = DefaultTelegramAPI
+	}
+	data, err := postJSON(ctx, t.Client, base+"/bot"+t.Token+"/sendMessage", body, nil)
+	if err != nil {
+		// The URL carries the token; keep it out of logs.
+		return errors.New(strings.ReplaceAll(err.Error(), t.Token, "***"))
+	}
+	var resp struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if json.Unmarshal(data, &resp) == nil && !resp.OK {
+		return errors.New("telegram: " + resp.Description)
+	}
+	return nil
+}
+
+// chatText renders subject and text for chat channels, wrapping the subject
+// in bold markers when the channel supports them.
+func chatText(msg Message, bold string) string {
+	if msg.Subject == "" {
+		return msg.Text
+	}
+	return bold + msg.Subject + bold + "\n" + msg.Text
+}
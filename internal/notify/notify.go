@@ -0,0 +1,80 @@
+// Package notify delivers reports and alerts out of the server.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Message is one notification. Text is plain text; Fields carry structured
+// details for channels that can use them (webhooks, the outbox).
+type Message struct {
+	Event     string            `json:"event"` // e.g. "saved_search"
+	Subject   string            `json:"subject"`
+	Text      string            `json:"text"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// Notifier sends messages over one channel.
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// Registry holds the configured notifiers by name.
+type Registry struct {
+	mu        sync.RWMutex
+	notifiers map[string]Notifier
+}
+
+func NewRegistry() *Registry {
+	return &Registry{notifiers: make(map[string]Notifier)}
+}
+
+// Register adds or replaces a notifier.
+func (r *Registry) Register(name string, n Notifier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifiers[name] = n
+}
+
+// Names lists the registered notifiers, sorted.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.notifiers))
+	for name := range r.notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Send delivers msg to the named notifiers, or to all of them when names is
+// empty. Every channel is tried; the errors are joined.
+func (r *Registry) Send(ctx context.Context, names []string, msg Message) error {
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now().UTC()
+	}
+	if len(names) == 0 {
+		names = r.Names()
+	}
+	var errs []error
+	for _, name := range names {
+		r.mu.RLock()
+		n, ok := r.notifiers[name]
+		r.mu.RUnlock()
+		if !ok {
+			errs = append(errs, fmt.Errorf("notifier %q is not configured", name))
+			continue
+		}
+		if err := n.Notify(ctx, msg); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,202 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type received struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// standIn records every request; a path containing /botbad/ gets a Telegram
+// error reply.
+func standIn(t *testing.T) (*httptest.Server, func() received) {
+	t.Helper()
+	var mu sync.Mutex
+	var got []received
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		got = append(got, received{path: r.URL.Path, header: r.Header.Clone(), body: body})
+		mu.Unlock()
+		if strings.Contains(r.URL.Path, "/botbad/") {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"ok":false,"description":"Bad Request: chat not found"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	t.Cleanup(srv.Close)
+	last := func() received {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(got) == 0 {
+			t.Fatal("nothing received")
+		}
+		return got[len(got)-1]
+	}
+	return srv, last
+}
+
+var testMessage = Message{Event: "check", Subject: "Проверка", Text: "CE-1: Login fails"}
+
+func TestWebhookSignature(t *testing.T) {
+	srv, last := standIn(t)
+	const secret = "s3cret"
+	if err := (Webhook{URL: srv.URL + "/hook", Secret: secret}).Notify(context.Background(), testMessage); err != nil {
+		t.Fatal(err)
+	}
+	r := last()
+	ts, sig := r.header.Get(TimestampHeader), r.header.Get(SignatureHeader)
+	if !Verify(secret, ts, r.body, sig) {
+		t.Errorf("signature %q does not verify", sig)
+	}
+	if Verify("other", ts, r.body, sig) || Verify(secret, ts, append(r.body, ' '), sig) {
+		t.Error("signature verifies with another secret or body")
+	}
+	var m Message
+	if err := json.Unmarshal(r.body, &m); err != nil || m.Subject != testMessage.Subject {
+		t.Errorf("unexpected body %s", r.body)
+	}
+}
+
+func TestSlackPayload(t *testing.T) {
+	srv, last := standIn(t)
+	if err := (Slack{URL: srv.URL + "/slack", Channel: "#qa"}).Notify(context.Background(), testMessage); err != nil {
+		t.Fatal(err)
+	}
+	var p map[string]string
+	if err := json.Unmarshal(last().body, &p); err != nil || p["text"] != "*Проверка*\nCE-1: Login fails" || p["channel"] != "#qa" {
+		t.Errorf("unexpected payload %v (%v)", p, err)
+	}
+}
+
+func TestTelegram(t *testing.T) {
+	srv, last := standIn(t)
+	if err := (Telegram{Token: "123:abc", ChatID: "42", BaseURL: srv.URL}).Notify(context.Background(), testMessage); err != nil {
+		t.Fatal(err)
+	}
+	r := last()
+	if r.path != "/bot123:abc/sendMessage" {
+		t.Errorf("path = %s", r.path)
+	}
+	var p struct {
+		ChatID string `json:"chat_id"`
+		Text   string `json:"text"`
+	}
+	if err := json.Unmarshal(r.body, &p); err != nil || p.ChatID != "42" || !strings.HasPrefix(p.Text, "Проверка\n") {
+		t.Errorf("unexpected body %s", r.body)
+	}
+
+	err := (Telegram{Token: "bad", ChatID: "1", BaseURL: srv.URL}).Notify(context.Background(), testMessage)
+	if err == nil {
+		t.Fatal("error reply not reported")
+	}
+	if strings.Contains(err.Error(), "/botbad/") {
+		t.Errorf("token leaked into the error: %v", err)
+	}
+}
+
+// TestSMTPDeadServer checks that a server that accepts but never greets
+// cannot block Notify past the context deadline.
+func TestSMTPDeadServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = (SMTP{Addr: ln.Addr().String(), From: "a@example.com", To: []string{"b@example.com"}}).Notify(ctx, testMessage)
+	if err == nil {
+		t.Fatal("no error from a silent server")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Notify took %v", d)
+	}
+}
+
+// TestSMTPSend runs a session against a minimal SMTP stand-in.
+func TestSMTPSend(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	data := make(chan string, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		rd := bufio.NewReader(c)
+		say := func(s string) { _, _ = io.WriteString(c, s+"\r\n") }
+		say("220 stand-in")
+		var body strings.Builder
+		inData := false
+		for {
+			line, err := rd.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					data <- body.String()
+					say("250 queued")
+					continue
+				}
+				body.WriteString(line)
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				say("250 stand-in")
+			case cmd == "DATA":
+				inData = true
+				say("354 go on")
+			case cmd == "QUIT":
+				say("221 bye")
+				return
+			default:
+				say("250 ok")
+			}
+		}
+	}()
+	msg := testMessage
+	msg.CreatedAt = time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := (SMTP{Addr: ln.Addr().String(), From: "a@example.com", To: []string{"b@example.com"}}).Notify(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	got := <-data
+	for _, want := range []string{"To: b@example.com\r\n", "Subject: =?utf-8?q?", "\r\n\r\nCE-1: Login fails"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("message lacks %q:\n%s", want, got)
+		}
+	}
+}
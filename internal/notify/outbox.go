@@ -0,0 +1,27 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Outbox writes each message as a JSON file into Dir, for local use or for
+// another process to pick up.
+type Outbox struct {
+	Dir string
+}
+
+func (o Outbox) Notify(_ context.Context, msg Message) error {
+	if err := os.MkdirAll(o.Dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(msg, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.json", msg.CreatedAt.UTC().Format("20060102-150405.000000000"), msg.Event)
+	return os.WriteFile(filepath.Join(o.Dir, name), data, 0o644)
+}
@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Signature headers of a signed webhook. The signature is
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)), so receivers
+// can reject replays with a stale timestamp.
+const (
+	SignatureHeader = "X-Signature-256"
+	TimestampHeader = "X-Signature-Timestamp"
+)
+
+// Webhook POSTs the message as JSON to URL, signed when Secret is set.
+type Webhook struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+func (w Webhook) Notify(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	var header http.Header
+	if w.Secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		header = http.Header{}
+		header.Set(TimestampHeader, ts)
+		header.Set(SignatureHeader, Sign(w.Secret, ts, body))
+	}
+	return post(ctx, w.Client, w.URL, body, header)
+}
+
+// Sign returns the signature header value for body sent at timestamp ts.
+func Sign(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature produced by Sign in constant time.
+func Verify(secret, ts string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature))
+}
+
+// post sends a JSON body and treats any non-2xx status as an error. It
+// returns the response body for channels that report errors inside it.
+func post(ctx context.Context, client *http.Client, url string, body []byte, header http.Header) error {
+	_, err := postJSON(ctx, client, url, body, header)
+	return err
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte, header http.Header) ([]byte, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return data, fmt.Errorf("status %d: %s", resp.StatusCode, trim(data, 300))
+	}
+	return data, nil
+}
+
+func trim(b []byte, max int) string {
+	b = bytes.TrimSpace(b)
+	if len(b) > max {
+		return string(b[:max]) + "..."
+	}
+	return string(b)
+}
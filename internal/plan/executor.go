@@ -0,0 +1,118 @@
+package plan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/history"
+	"github.com/alekseymerzlyakov/jira/internal/llm"
+)
+
+// ErrStepNotFound is returned by RunStep for an unknown step ID.
+var ErrStepNotFound = errors.New("step not found")
+
+// Executor runs planned steps of a history entry.
+type Executor struct {
+	Registry *Registry
+	LLM      llm.Provider
+	// Progress, when set, receives every status change of a step.
+	Progress func(history.Step)
+	// Save, when set, persists the entry after every step.
+	Save func(history.Entry) error
+}
+
+// Run executes pending and failed steps in order and stops at the first
+// failure. Completed steps are kept, so a failed run can be resumed.
+func (x *Executor) Run(ctx context.Context, e *history.Entry) error {
+	st := x.restore(e, len(e.Steps))
+	for i := range e.Steps {
+		step := &e.Steps[i]
+		if step.Kind == "" || step.Status == StatusCompleted {
+			continue
+		}
+		if err := x.exec(ctx, st, e, step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunStep re-runs a single step against the results of the steps before it.
+// Later steps are left as they are.
+func (x *Executor) RunStep(ctx context.Context, e *history.Entry, id string) error {
+	for i := range e.Steps {
+		if e.Steps[i].ID != id {
+			continue
+		}
+		if e.Steps[i].Kind == "" {
+			return fmt.Errorf("step %s is not runnable", id)
+		}
+		st := x.restore(e, i)
+		return x.exec(ctx, st, e, &e.Steps[i])
+	}
+	return ErrStepNotFound
+}
+
+// restore rebuilds the state from completed steps before index upto.
+func (x *Executor) restore(e *history.Entry, upto int) *State {
+	st := &State{Entry: e, LLM: x.LLM, results: map[string]json.RawMessage{}}
+	for _, step := range e.Steps[:upto] {
+		if step.Kind != "" && step.Status == StatusCompleted {
+			st.results[step.Kind] = step.Result
+		}
+	}
+	return st
+}
+
+func (x *Executor) exec(ctx context.Context, st *State, e *history.Entry, step *history.Step) error {
+	kind, ok := x.Registry.Get(step.Kind)
+	if !ok {
+		return x.finish(e, step, fmt.Errorf("unknown step kind %q", step.Kind))
+	}
+	for _, req := range kind.Requires {
+		if st.results[req] == nil && !(req == KindDeriveJQL && e.JQL != "") {
+			return x.finish(e, step, fmt.Errorf("step needs %s to complete first", req))
+		}
+	}
+	now := time.Now().UTC()
+	step.Status = StatusRunning
+	step.StartedAt = &now
+	step.FinishedAt = nil
+	step.Error = ""
+	step.Description = ""
+	step.Result = nil
+	step.Usage = nil
+	x.progress(*step)
+
+	if err := kind.Run(ctx, st, step); err != nil {
+		return x.finish(e, step, err)
+	}
+	st.results[step.Kind] = step.Result
+	return x.finish(e, step, nil)
+}
+
+func (x *Executor) finish(e *history.Entry, step *history.Step, err error) error {
+	now := time.Now().UTC()
+	step.FinishedAt = &now
+	step.Status = StatusCompleted
+	if err != nil {
+		step.Status = StatusFailed
+		step.Error = err.Error()
+	}
+	x.progress(*step)
+	if x.Save != nil {
+		if serr := x.Save(*e); serr != nil && err == nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+func (x *Executor) progress(step history.Step) {
+	if x.Progress != nil {
+		x.Progress(step)
+	}
+}
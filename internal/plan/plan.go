@@ -0,0 +1,190 @@
+// Package plan implements the stepwise workflow from docs/stepwise-workflow.md:
+// an instruction is split into typed steps, previewed, then executed in order
+// with each step's status and result persisted in the history entry.
+package plan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/alekseymerzlyakov/jira/internal/history"
+	"github.com/alekseymerzlyakov/jira/internal/llm"
+)
+
+// Step statuses.
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// Built-in step kinds. The server registers a runner for each.
+const (
+	KindDeriveJQL    = "derive_jql"
+	KindSearch       = "search"
+	KindAnalyze      = "analyze"
+	KindDeepAnalyze  = "deep_analyze"
+	KindIssueDetails = "issue_details"
+	KindFollowUp     = "follow_up"
+	KindTestCases    = "test_cases"
+)
+
+// State is shared by the steps of one run. Steps read earlier results through
+// Result and write their output into the step they execute; Entry fields (JQL,
+// issues, analysis) are updated directly.
+type State struct {
+	Entry   *history.Entry
+	LLM     llm.Provider // may be nil
+	results map[string]json.RawMessage
+}
+
+// Result returns the latest completed result of a step kind.
+func (s *State) Result(kind string) json.RawMessage {
+	return s.results[kind]
+}
+
+// Kind is a registered step type.
+type Kind struct {
+	Name        string
+	Title       string // default card title
+	Description string // shown to the planner
+	// Requires lists kinds that must have run before this one.
+	Requires []string
+	// Run executes the step, filling step.Result (and optionally Usage or
+	// Description). Status and timing are handled by the Executor.
+	Run func(ctx context.Context, st *State, step *history.Step) error
+}
+
+// Registry holds the step kinds available to the planner, in canonical order.
+type Registry struct {
+	kinds []Kind
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds or replaces a kind.
+func (r *Registry) Register(k Kind) {
+	for i := range r.kinds {
+		if r.kinds[i].Name == k.Name {
+			r.kinds[i] = k
+			return
+		}
+	}
+	r.kinds = append(r.kinds, k)
+}
+
+func (r *Registry) Get(name string) (Kind, bool) {
+	for _, k := range r.kinds {
+		if k.Name == name {
+			return k, true
+		}
+	}
+	return Kind{}, false
+}
+
+// Kinds lists registered kinds for the planner prompt and the UI.
+func (r *Registry) Kinds() []llm.StepKind {
+	out := make([]llm.StepKind, 0, len(r.kinds))
+	for _, k := range r.kinds {
+		out = append(out, llm.StepKind{Name: k.Name, Description: k.Description})
+	}
+	return out
+}
+
+// Plan decomposes query into pending steps. The LLM planner is tried first;
+// without one, or when it fails, a keyword heuristic is used. The returned
+// source is "llm" or "heuristic".
+func (r *Registry) Plan(ctx context.Context, p llm.Planner, query string, haveJQL bool) ([]history.Step, string) {
+	var planned []llm.PlannedStep
+	source := "heuristic"
+	if p != nil {
+		if steps, err := p.Plan(ctx, query, r.Kinds()); err == nil {
+			planned = steps
+			source = "llm"
+		}
+	}
+	if planned == nil {
+		planned = r.heuristic(query)
+	}
+	return r.normalize(planned, haveJQL), source
+}
+
+// heuristic picks steps from keywords in the query.
+func (r *Registry) heuristic(query string) []llm.PlannedStep {
+	q := strings.ToLower(query)
+	has := func(words ...string) bool {
+		for _, w := range words {
+			if strings.Contains(q, w) {
+				return true
+			}
+		}
+		return false
+	}
+	steps := []llm.PlannedStep{{Kind: KindDeriveJQL}, {Kind: KindSearch}}
+	extra := false
+	if has("опис", "коммент", "детал", "detail", "comment", "description") {
+		steps = append(steps, llm.PlannedStep{Kind: KindIssueDetails})
+		extra = true
+	}
+	if has("кажд", "по отдельности", "each", "every") {
+		steps = append(steps, llm.PlannedStep{Kind: KindDeepAnalyze})
+		extra = true
+	} else if has("анализ", "проанализ", "резюм", "итог", "analy", "summar") {
+		steps = append(steps, llm.PlannedStep{Kind: KindAnalyze})
+		extra = true
+	}
+	if has("тест", "test", "чек-лист", "checklist") {
+		steps = append(steps, llm.PlannedStep{Kind: KindTestCases, Instruction: query})
+		extra = true
+	}
+	if !extra {
+		steps = append(steps, llm.PlannedStep{Kind: KindAnalyze})
+	}
+	return steps
+}
+
+// normalize drops unknown kinds, adds missing prerequisites and assigns IDs.
+func (r *Registry) normalize(planned []llm.PlannedStep, haveJQL bool) []history.Step {
+	var out []history.Step
+	seen := map[string]bool{}
+	var add func(ps llm.PlannedStep)
+	add = func(ps llm.PlannedStep) {
+		k, ok := r.Get(ps.Kind)
+		if !ok {
+			return
+		}
+		if k.Name == KindDeriveJQL && haveJQL {
+			return
+		}
+		for _, req := range k.Requires {
+			if !seen[req] && !(req == KindDeriveJQL && haveJQL) {
+				add(llm.PlannedStep{Kind: req})
+			}
+		}
+		// Repeating a data step is pointless; repeating follow-ups is not.
+		if seen[k.Name] && k.Name != KindFollowUp {
+			return
+		}
+		seen[k.Name] = true
+		title := strings.TrimSpace(ps.Title)
+		if title == "" {
+			title = k.Title
+		}
+		out = append(out, history.Step{
+			ID:          fmt.Sprintf("s%d", len(out)+1),
+			Kind:        k.Name,
+			Name:        title,
+			Instruction: strings.TrimSpace(ps.Instruction),
+			Status:      StatusPending,
+		})
+	}
+	for _, ps := range planned {
+		add(ps)
+	}
+	return out
+}
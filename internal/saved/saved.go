@@ -0,0 +1,179 @@
+// Package saved stores named searches that can be re-run on demand or on a
+// schedule.
+package saved
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/schedule"
+)
+
+// ErrNotFound is returned when a saved search ID is unknown.
+var ErrNotFound = errors.New("saved search not found")
+
+// Search is a stored query with the same filters as /api/search, an optional
+// schedule and the notifiers that receive its results.
+type Search struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Query    string   `json:"query,omitempty"`
+	JQL      string   `json:"jql,omitempty"`
+	Projects []string `json:"projects,omitempty"`
+	Users    []string `json:"users,omitempty"`
+	SprintID int      `json:"sprintId,omitempty"`
+	Analysis bool     `json:"analysis,omitempty"`
+	Provider string   `json:"provider,omitempty"`
+	Model    string   `json:"model,omitempty"`
+
+	Schedule string   `json:"schedule,omitempty"` // cron expression; empty runs only on demand
+	Notify   []string `json:"notify,omitempty"`   // notifier names; empty means all configured
+	Paused   bool     `json:"paused,omitempty"`
+
+	LastRun     *time.Time `json:"lastRun,omitempty"`
+	LastEntryID string     `json:"lastEntryId,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+// Validate checks the fields a client may set.
+func (s Search) Validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return errors.New("name is required")
+	}
+	if strings.TrimSpace(s.Query) == "" && strings.TrimSpace(s.JQL) == "" {
+		return errors.New("query or jql is required")
+	}
+	if s.Schedule != "" {
+		if _, err := schedule.Parse(s.Schedule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Due reports whether a scheduled, unpaused search should run at now (in
+// loc). It is measured from the last run, or from creation for a new search.
+func (s Search) Due(now time.Time, loc *time.Location) bool {
+	if s.Paused || s.Schedule == "" {
+		return false
+	}
+	sched, err := schedule.Parse(s.Schedule)
+	if err != nil {
+		return false
+	}
+	since := s.CreatedAt
+	if s.LastRun != nil {
+		since = *s.LastRun
+	}
+	next := sched.Next(since.In(loc))
+	return !next.IsZero() && !next.After(now)
+}
+
+// Store persists saved searches to a JSON file.
+type Store struct {
+	path string
+	mu   sync.Mutex
+	list []Search
+}
+
+func NewStore(path string) *Store {
+	s := &Store{path: path}
+	_ = s.load()
+	return s
+}
+
+// List returns all saved searches ordered by name.
+func (s *Store) List() []Search {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Search, len(s.list))
+	copy(out, s.list)
+	sort.SliceStable(out, func(i, j int) bool { return strings.ToLower(out[i].Name) < strings.ToLower(out[j].Name) })
+	return out
+}
+
+// Get returns the saved search with the given ID.
+func (s *Store) Get(id string) (Search, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.list {
+		if v.ID == id {
+			return v, true
+		}
+	}
+	return Search{}, false
+}
+
+// Put inserts or replaces a saved search by ID.
+func (s *Store) Put(v Search) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.list {
+		if s.list[i].ID == v.ID {
+			s.list[i] = v
+			return s.save()
+		}
+	}
+	s.list = append(s.list, v)
+	return s.save()
+}
+
+// Delete removes a saved search.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.list {
+		if s.list[i].ID == id {
+			s.list = append(s.list[:i], s.list[i+1:]...)
+			return s.save()
+		}
+	}
+	return ErrNotFound
+}
+
+// MarkRun records the outcome of a run.
+func (s *Store) MarkRun(id string, at time.Time, entryID string, runErr error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.list {
+		if s.list[i].ID != id {
+			continue
+		}
+		s.list[i].LastRun = &at
+		s.list[i].LastError = ""
+		if runErr != nil {
+			s.list[i].LastError = runErr.Error()
+		}
+		if entryID != "" {
+			s.list[i].LastEntryID = entryID
+		}
+		return s.save()
+	}
+	return ErrNotFound
+}
+
+func (s *Store) load() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil // ignore missing
+	}
+	return json.Unmarshal(data, &s.list)
+}
+
+func (s *Store) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s.list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o644)
+}
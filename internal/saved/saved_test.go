@@ -0,0 +1,54 @@
+package saved
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDue(t *testing.T) {
+	kyiv, err := time.LoadLocation("Europe/Kyiv")
+	if err != nil {
+		t.Skip(err)
+	}
+	at := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	ptr := func(t time.Time) *time.Time { return &t }
+	daily := Search{Schedule: "0 9 * * *", CreatedAt: at("2026-10-18T08:00:00Z")}
+	ran := daily
+	ran.LastRun = ptr(at("2026-10-18T09:00:00Z"))
+	paused := daily
+	paused.Paused = true
+	broken := daily
+	broken.Schedule = "0 25 * * *"
+	onDemand := daily
+	onDemand.Schedule = ""
+	for _, c := range []struct {
+		name string
+		s    Search
+		now  string
+		loc  *time.Location
+		want bool
+	}{
+		{"before the first run", daily, "2026-10-18T08:59:00Z", time.UTC, false},
+		{"first run", daily, "2026-10-18T09:00:00Z", time.UTC, true},
+		{"missed run", daily, "2026-10-18T15:00:00Z", time.UTC, true},
+		{"just ran", ran, "2026-10-18T09:00:30Z", time.UTC, false},
+		{"later that day", ran, "2026-10-18T23:59:00Z", time.UTC, false},
+		{"next day", ran, "2026-10-19T09:00:00Z", time.UTC, true},
+		// 09:00 in Kyiv (UTC+3) is 06:00 UTC.
+		{"local time, before", daily, "2026-10-19T05:59:00Z", kyiv, false},
+		{"local time", Search{Schedule: "0 9 * * *", CreatedAt: at("2026-10-19T05:00:00Z")}, "2026-10-19T06:00:00Z", kyiv, true},
+		{"paused", paused, "2026-10-19T09:00:00Z", time.UTC, false},
+		{"bad schedule", broken, "2026-10-19T09:00:00Z", time.UTC, false},
+		{"on demand", onDemand, "2026-10-19T09:00:00Z", time.UTC, false},
+	} {
+		if got := c.s.Due(at(c.now), c.loc); got != c.want {
+			t.Errorf("%s: Due(%s) = %v, want %v", c.name, c.now, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Package schedule parses cron-like expressions for saved searches.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed five-field cron expression: minute, hour, day of
+// month, month and day of week (0 or 7 is Sunday). Fields accept *, lists,
+// ranges and steps ("*/15", "1-5", "9,13,17"). The shortcuts @hourly,
+// @daily, @weekly (Monday 09:00), @weekdays (Mon-Fri 09:00) and @monthly are
+// also recognised.
+type Schedule struct {
+	expr                     string
+	minute, hour, dom, month uint64
+	dow                      uint64
+	domAny, dowAny           bool
+}
+
+var shortcuts = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 9 * * *",
+	"@weekly":   "0 9 * * 1",
+	"@weekdays": "0 9 * * 1-5",
+	"@monthly":  "0 9 1 * *",
+}
+
+type bounds struct {
+	name     string
+	min, max int
+}
+
+var fieldBounds = [5]bounds{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Parse parses expr.
+func Parse(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	spec := expr
+	if s, ok := shortcuts[strings.ToLower(expr)]; ok {
+		spec = s
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("schedule %q: want 5 fields (minute hour day month weekday) or a shortcut like @daily", expr)
+	}
+	var sets [5]uint64
+	for i, f := range fields {
+		set, err := parseField(f, fieldBounds[i])
+		if err != nil {
+			return Schedule{}, fmt.Errorf("schedule %q: %w", expr, err)
+		}
+		sets[i] = set
+	}
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1 // 7 is Sunday too
+	}
+	if fields[4] == "*" && !possibleDay(sets[2], sets[3]) {
+		return Schedule{}, fmt.Errorf("schedule %q: no month has that day", expr)
+	}
+	return Schedule{
+		expr:   expr,
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}, nil
+}
+
+// String returns the expression the schedule was parsed from.
+func (s Schedule) String() string { return s.expr }
+
+// Next returns the first minute strictly after t that matches the schedule,
+// in t's location, or the zero time if none exists within five years.
+// Matching is on the wall clock: a time skipped by a DST jump fires at the
+// instant it maps to (02:30 becomes 03:30), and a time repeated when the
+// clocks go back fires once.
+func (s Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	// w walks the wall clock in UTC, where every minute exists once.
+	w := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC).Add(time.Minute)
+	limit := w.AddDate(5, 0, 0)
+	for w.Before(limit) {
+		if !has(s.month, int(w.Month())) {
+			w = time.Date(w.Year(), w.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.dayMatches(w) {
+			w = time.Date(w.Year(), w.Month(), w.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !has(s.hour, w.Hour()) {
+			w = time.Date(w.Year(), w.Month(), w.Day(), w.Hour()+1, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !has(s.minute, w.Minute()) {
+			w = w.Add(time.Minute)
+			continue
+		}
+		if at := time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), 0, 0, loc); at.After(t) {
+			return at
+		}
+		w = w.Add(time.Minute)
+	}
+	return time.Time{}
+}
+
+// dayMatches follows cron: when both day fields are restricted, either may
+// match.
+func (s Schedule) dayMatches(t time.Time) bool {
+	dom := has(s.dom, t.Day())
+	dow := has(s.dow, int(t.Weekday()))
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// possibleDay reports whether some month in months has a day in days;
+// February counts with its leap day.
+func possibleDay(days, months uint64) bool {
+	for m := 1; m <= 12; m++ {
+		if !has(months, m) {
+			continue
+		}
+		last := time.Date(2024, time.Month(m)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		for d := 1; d <= last; d++ {
+			if has(days, d) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func has(set uint64, v int) bool { return set&(1<<uint(v)) != 0 }
+
+func parseField(f string, b bounds) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(f, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step in %s %q", b.name, part)
+			}
+			rng, step = part[:i], n
+		}
+		lo, hi := b.min, b.max
+		if rng != "*" {
+			var err error
+			if i := strings.IndexByte(rng, '-'); i >= 0 {
+				lo, err = strconv.Atoi(rng[:i])
+				if err == nil {
+					hi, err = strconv.Atoi(rng[i+1:])
+				}
+			} else {
+				lo, err = strconv.Atoi(rng)
+				hi = lo
+				if step > 1 {
+					hi = b.max
+				}
+			}
+			if err != nil {
+				return 0, fmt.Errorf("bad %s %q", b.name, part)
+			}
+		}
+		if lo < b.min || hi > b.max || lo > hi {
+			return 0, fmt.Errorf("%s %q out of range %d-%d", b.name, part, b.min, b.max)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
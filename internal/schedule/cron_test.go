@@ -0,0 +1,112 @@
+package schedule
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	for _, c := range []struct {
+		expr string
+		ok   bool
+	}{
+		{"@weekdays", true},
+		{"@DAILY", true},
+		{"*/15 9-18 * * 1-5", true},
+		{"0 9 29 2 *", true}, // leap years only
+		{"0 9 31 2 1", true}, // the weekday still matches
+		{"0 9 * * 7", true},
+		{"", false},
+		{"0 9 * *", false},
+		{"60 * * * *", false},
+		{"*/0 * * * *", false},
+		{"5-1 * * * *", false},
+		{"0 9 * * 8", false},
+		{"@yearly", false},
+		{"0 9 31 2 *", false},
+		{"0 9 30,31 2 *", false},
+		{"0 9 31 4,6,9,11 *", false},
+	} {
+		_, err := Parse(c.expr)
+		if (err == nil) != c.ok {
+			t.Errorf("Parse(%q) error = %v, want ok %v", c.expr, err, c.ok)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	utc := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	local := func(s string, offset int) time.Time {
+		return utc(s).Add(-time.Duration(offset) * time.Hour).In(berlin)
+	}
+	for _, c := range []struct {
+		name     string
+		expr     string
+		from     time.Time
+		want     time.Time
+		wantZone int // UTC offset of want in hours, for the Berlin cases
+	}{
+		{"step", "*/15 * * * *", utc("2026-10-19 10:07").Add(30 * time.Second), utc("2026-10-19 10:15"), 0},
+		{"strictly after", "*/15 * * * *", utc("2026-10-19 10:15"), utc("2026-10-19 10:30"), 0},
+		{"weekdays over the weekend", "@weekdays", utc("2026-10-16 10:00"), utc("2026-10-19 09:00"), 0},
+		{"weekdays same day", "@weekdays", utc("2026-10-19 08:59"), utc("2026-10-19 09:00"), 0},
+		{"sunday as 7", "0 9 * * 7", utc("2026-10-19 00:00"), utc("2026-10-25 09:00"), 0},
+		// Both day fields restricted: the 13th or a Friday.
+		{"dom or dow: friday", "0 9 13 * 5", utc("2026-10-01 00:00"), utc("2026-10-02 09:00"), 0},
+		{"dom or dow: the 13th", "0 9 13 * 5", utc("2026-10-10 00:00"), utc("2026-10-13 09:00"), 0},
+		{"dom only", "0 9 13 * *", utc("2026-10-14 00:00"), utc("2026-11-13 09:00"), 0},
+		{"leap day", "0 9 29 2 *", utc("2026-03-01 00:00"), utc("2028-02-29 09:00"), 0},
+		{"month boundary", "0 0 1 * *", utc("2026-12-31 23:59"), utc("2027-01-01 00:00"), 0},
+		// Clocks go forward at 02:00 on 2026-03-29: 02:30 does not exist
+		// that day and fires when it would have.
+		{"dst gap", "30 2 * * *", local("2026-03-28 12:00", 1), local("2026-03-29 03:30", 2), 2},
+		{"after dst gap", "30 2 * * *", local("2026-03-29 03:30", 2), local("2026-03-30 02:30", 2), 2},
+		{"daily across dst end", "@daily", local("2026-10-24 09:00", 2), local("2026-10-25 09:00", 1), 1},
+	} {
+		s, err := Parse(c.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		got := s.Next(c.from)
+		if !got.Equal(c.want) {
+			t.Errorf("%s: Next(%v) = %v, want %v", c.name, c.from, got, c.want)
+		}
+		if got.Location() == berlin {
+			if _, off := got.Zone(); off != c.wantZone*3600 {
+				t.Errorf("%s: offset %d, want %dh", c.name, off, c.wantZone)
+			}
+		}
+	}
+}
+
+// TestNextRepeatedHour checks that a wall-clock time repeated when the
+// clocks go back (02:30 on 2026-10-25 in Berlin) fires once.
+func TestNextRepeatedHour(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	s, err := Parse("30 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for at := time.Date(2026, 10, 24, 12, 0, 0, 0, berlin); len(got) < 3; {
+		at = s.Next(at)
+		got = append(got, at.Format("01-02 15:04"))
+	}
+	if want := "10-25 02:30 10-26 02:30 10-27 02:30"; strings.Join(got, " ") != want {
+		t.Errorf("runs = %v, want %s", got, want)
+	}
+}
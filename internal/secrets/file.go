@@ -0,0 +1,173 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// fileVersion is written to the file so the format can change later.
+const fileVersion = 1
+
+// File keeps secrets in one AES-256-GCM encrypted JSON file unlocked by a
+// master key. The file reveals neither names nor values without the key.
+type File struct {
+	path string
+	mu   sync.Mutex
+	key  []byte
+	data map[string]string
+}
+
+type fileEnvelope struct {
+	Version   int       `json:"version"`
+	Nonce     []byte    `json:"nonce"`
+	Data      []byte    `json:"data"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// OpenFile decrypts the secrets file at path; a missing file is empty.
+func OpenFile(path string, key []byte) (*File, error) {
+	f := &File{path: path, key: key, data: map[string]string{}}
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var env fileEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return nil, fmt.Errorf("secrets file %s: %w", path, err)
+	}
+	if env.Version != fileVersion {
+		return nil, fmt.Errorf("secrets file %s: unsupported version %d", path, env.Version)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, env.Nonce, env.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("secrets file %s: wrong master key or corrupted file", path)
+	}
+	if err := json.Unmarshal(plain, &f.data); err != nil {
+		return nil, fmt.Errorf("secrets file %s: %w", path, err)
+	}
+	return f, nil
+}
+
+func (f *File) Name() string { return "file" }
+
+func (f *File) Get(key string) (string, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.data[key]
+	return v, ok, nil
+}
+
+// Keys returns the stored secret names, sorted.
+func (f *File) Keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]string, 0, len(f.data))
+	for k := range f.data {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Set stores a secret and rewrites the file.
+func (f *File) Set(key, value string) error {
+	if key == "" {
+		return errors.New("secret name is required")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.data[key] = value
+	return f.save()
+}
+
+// Delete removes a secret; deleting a missing one is not an error.
+func (f *File) Delete(key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.data, key)
+	return f.save()
+}
+
+// Rotate re-encrypts the file with newKey.
+func (f *File) Rotate(newKey []byte) error {
+	if _, err := newAEAD(newKey); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	old := f.key
+	f.key = newKey
+	if err := f.save(); err != nil {
+		f.key = old
+		return err
+	}
+	return nil
+}
+
+// save writes the file atomically so an interrupted write cannot lose the
+// existing secrets.
+func (f *File) save() error {
+	aead, err := newAEAD(f.key)
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(f.data)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(fileEnvelope{
+		Version:   fileVersion,
+		Nonce:     nonce,
+		Data:      aead.Seal(nil, nonce, plain, nil),
+		UpdatedAt: time.Now().UTC(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return err
+	}
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, out, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("master key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// NewKey returns a random 32-byte master key, hex encoded.
+func NewKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
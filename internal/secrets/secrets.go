@@ -0,0 +1,106 @@
+// Package secrets looks up credentials such as JIRA_PASSWORD from the
+// environment, an encrypted file or an external password manager.
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Provider returns a secret by name; ok is false when it has none.
+type Provider interface {
+	Name() string
+	Get(key string) (value string, ok bool, err error)
+}
+
+// Env reads secrets from environment variables (including env.local).
+type Env struct{}
+
+func (Env) Name() string { return "env" }
+
+func (Env) Get(key string) (string, bool, error) {
+	v := os.Getenv(key)
+	return v, v != "", nil
+}
+
+// Command runs a password manager for each secret, e.g.
+// "pass show jira/{key}" or "op read op://dev/jira/{key}". {key} is replaced
+// by the secret name; the command runs without a shell and the first line
+// of its output is the value. A failing command means "no such secret"
+// unless it cannot be started at all.
+type Command struct {
+	Template string
+	Timeout  time.Duration
+}
+
+func (c Command) Name() string { return "command" }
+
+func (c Command) Get(key string) (string, bool, error) {
+	args := strings.Fields(strings.ReplaceAll(c.Template, "{key}", key))
+	if len(args) == 0 {
+		return "", false, errors.New("secrets command is empty")
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+	if ctx.Err() != nil {
+		return "", false, fmt.Errorf("secrets command %s: %w", args[0], ctx.Err())
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("secrets command %s: %w", args[0], err)
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	line = strings.TrimRight(line, "\r")
+	return line, line != "", nil
+}
+
+// Chain asks providers in order and returns the first value found.
+type Chain []Provider
+
+func (c Chain) Name() string {
+	names := make([]string, len(c))
+	for i, p := range c {
+		names[i] = p.Name()
+	}
+	return strings.Join(names, "+")
+}
+
+func (c Chain) Get(key string) (string, bool, error) {
+	for _, p := range c {
+		v, ok, err := p.Get(key)
+		if err != nil {
+			return "", false, fmt.Errorf("%s: %s: %w", p.Name(), key, err)
+		}
+		if ok {
+			return v, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// DecodeKey parses a 32-byte key given as hex or base64.
+func DecodeKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if b, err := hex.DecodeString(s); err == nil && len(b) == 32 {
+		return b, nil
+	}
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil && len(b) == 32 {
+		return b, nil
+	}
+	return nil, errors.New("key must be 32 bytes, hex or base64")
+}
@@ -0,0 +1,95 @@
+package semantic
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alekseymerzlyakov/jira/internal/analysis"
+	"github.com/alekseymerzlyakov/jira/internal/history"
+)
+
+// Document kinds.
+const (
+	KindQuery    = "query"    // the question and its JQL
+	KindAnalysis = "analysis" // the LLM summary
+	KindThread   = "thread"   // follow-up commands
+	KindIssue    = "issue"    // one issue: title and description
+)
+
+// Limits that keep the index proportional to what people search for.
+const (
+	maxIssuesPerEntry = 50
+	maxDocRunes       = 2000
+)
+
+// Document is one searchable piece of a history entry.
+type Document struct {
+	EntryID   string    `json:"entryId"`
+	Kind      string    `json:"kind"`
+	IssueKey  string    `json:"issueKey,omitempty"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Documents splits an entry into searchable documents. Issue descriptions come
+// from the stored search result when it is available, titles otherwise.
+func Documents(e history.Entry) []Document {
+	doc := func(kind, key, text string) Document {
+		return Document{EntryID: e.ID, Kind: kind, IssueKey: key, Text: truncate(strings.TrimSpace(text)), CreatedAt: e.CreatedAt}
+	}
+	var out []Document
+	out = append(out, doc(KindQuery, "", strings.TrimSpace(e.Query+"\n"+e.JQL)))
+	if e.Analysis != "" {
+		out = append(out, doc(KindAnalysis, "", e.Analysis))
+	}
+	if e.Thread != nil {
+		var asked []string
+		for _, t := range e.Thread.Turns {
+			if t.Role == "user" {
+				asked = append(asked, t.Content)
+			}
+		}
+		if len(asked) > 0 {
+			out = append(out, doc(KindThread, "", strings.Join(asked, "\n")))
+		}
+	}
+
+	seen := map[string]bool{}
+	add := func(key, text string) {
+		if key == "" || seen[key] || len(seen) >= maxIssuesPerEntry {
+			return
+		}
+		seen[key] = true
+		out = append(out, doc(KindIssue, key, text))
+	}
+	if raw := searchResult(e.Steps); raw != nil {
+		if issues, _, err := analysis.Compact(raw); err == nil {
+			for _, iss := range issues {
+				add(iss.Key, fmt.Sprintf("%s %s\n%s", iss.Key, iss.Summary, iss.Description))
+			}
+		}
+	}
+	for _, iss := range e.Issues {
+		add(iss.Key, iss.Key+" "+iss.Title)
+	}
+	return out
+}
+
+// searchResult finds the raw Jira search response among the steps.
+func searchResult(steps []history.Step) []byte {
+	for _, s := range steps {
+		if (s.Kind == "search" || s.Name == "Execute Jira search") && len(s.Result) > 0 {
+			return s.Result
+		}
+	}
+	return nil
+}
+
+func truncate(s string) string {
+	if utf8.RuneCountInString(s) <= maxDocRunes {
+		return s
+	}
+	return string([]rune(s)[:maxDocRunes])
+}
@@ -0,0 +1,164 @@
+// Package semantic indexes history entries — queries, analyses, follow-up
+// threads and issue titles/descriptions — as vectors, so past work can be
+// found by meaning rather than by substring.
+package semantic
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Embedder turns texts into vectors of a fixed dimension. Name identifies the
+// model, so an index built with another model is rebuilt instead of reused.
+type Embedder interface {
+	Name() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// DefaultDims is the vector size of the hashing embedder.
+const DefaultDims = 512
+
+// Hashing is an offline embedder: words and character trigrams are hashed into
+// a fixed number of buckets ("feature hashing"). Trigrams make it tolerant to
+// Russian word endings ("платёжный"/"платёжного") and typos. It captures word
+// overlap rather than meaning, but needs no model and no network.
+type Hashing struct {
+	Dims int
+}
+
+func NewHashing(dims int) *Hashing {
+	if dims <= 0 {
+		dims = DefaultDims
+	}
+	return &Hashing{Dims: dims}
+}
+
+func (h *Hashing) Name() string { return "hashing" }
+
+func (h *Hashing) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, t := range texts {
+		out[i] = h.vector(t)
+	}
+	return out, nil
+}
+
+func (h *Hashing) vector(text string) []float32 {
+	v := make([]float32, h.Dims)
+	for _, w := range words(text) {
+		h.add(v, "w:"+w, 1)
+		runes := []rune("^" + w + "$")
+		for i := 0; i+3 <= len(runes); i++ {
+			h.add(v, "t:"+string(runes[i:i+3]), 0.5)
+		}
+	}
+	normalize(v)
+	return v
+}
+
+// add puts weight into the bucket of feature, with a hash-derived sign so
+// collisions cancel out on average.
+func (h *Hashing) add(v []float32, feature string, weight float32) {
+	f := fnv.New64a()
+	_, _ = f.Write([]byte(feature))
+	sum := f.Sum64()
+	if sum&(1<<63) != 0 {
+		weight = -weight
+	}
+	v[sum%uint64(len(v))] += weight
+}
+
+// stopwords are dropped before hashing: they appear in every question about
+// history ("где я спрашивал про...") and would drown the topic words.
+var stopwords = map[string]bool{
+	"где": true, "я": true, "мы": true, "про": true, "о": true, "об": true, "в": true, "во": true, "на": true,
+	"по": true, "и": true, "или": true, "с": true, "со": true, "за": true, "для": true, "это": true, "что": true,
+	"как": true, "когда": true, "спрашивал": true, "спрашивала": true, "искал": true, "искала": true,
+	"the": true, "a": true, "an": true, "about": true, "did": true, "i": true, "ask": true, "asked": true,
+	"where": true, "what": true, "when": true, "in": true, "on": true, "of": true, "for": true, "and": true, "or": true,
+}
+
+func words(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	out := fields[:0]
+	for _, f := range fields {
+		f = strings.ReplaceAll(f, "ё", "е")
+		if !stopwords[f] {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func normalize(v []float32) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return
+	}
+	n := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= n
+	}
+}
+
+// OpenAIEmbedder calls an OpenAI-compatible /embeddings endpoint: OpenAI
+// itself or a local server (Ollama, llama.cpp) running a small model such as
+// nomic-embed-text.
+type OpenAIEmbedder struct {
+	client *openai.Client
+	model  string
+}
+
+// NewOpenAIEmbedder targets baseURL (empty for api.openai.com).
+func NewOpenAIEmbedder(baseURL, apiKey, model string) *OpenAIEmbedder {
+	cfg := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		cfg.BaseURL = strings.TrimRight(baseURL, "/")
+	}
+	if model == "" {
+		model = string(openai.SmallEmbedding3)
+	}
+	return &OpenAIEmbedder{client: openai.NewClientWithConfig(cfg), model: model}
+}
+
+func (o *OpenAIEmbedder) Name() string { return "openai:" + o.model }
+
+// embedBatch bounds the inputs of one request.
+const embedBatch = 64
+
+func (o *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for start := 0; start < len(texts); start += embedBatch {
+		end := min(start+embedBatch, len(texts))
+		resp, err := o.client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+			Input: texts[start:end],
+			Model: openai.EmbeddingModel(o.model),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Data) != end-start {
+			return nil, errors.New("embeddings: unexpected number of vectors")
+		}
+		for i, d := range resp.Data {
+			v := append([]float32(nil), d.Embedding...)
+			normalize(v)
+			if d.Index >= 0 && d.Index < end-start {
+				i = d.Index
+			}
+			out[start+i] = v
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,390 @@
+package semantic
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alekseymerzlyakov/jira/internal/history"
+)
+
+// DefaultLimit is the number of entries Search returns by default.
+const DefaultLimit = 10
+
+// snippetRunes bounds the matched text returned with a hit.
+const snippetRunes = 200
+
+// Index holds the vectors of all history documents. Entries are embedded
+// lazily and re-embedded only when their documents change: Refresh reads the
+// whole history once, then only the entries reported by Touch.
+type Index struct {
+	embedder Embedder
+	path     string // empty keeps the index in memory only
+
+	// syncMu serialises syncs; embedding runs without mu so searches are
+	// not held up by the embedder.
+	syncMu sync.Mutex
+
+	mu      sync.Mutex
+	entries map[string]*indexed
+	synced  bool            // a full pass over the history has completed
+	dirty   map[string]bool // entries touched since, see Touch
+}
+
+// Source is the history an index follows; history.Storage is one.
+type Source interface {
+	Get(id string) (history.Entry, bool)
+	Latest(n int) []history.Entry
+}
+
+type indexed struct {
+	Fingerprint string     `json:"fingerprint"`
+	Docs        []Document `json:"docs"`
+	Vectors     []Vector   `json:"vectors"`
+}
+
+type persisted struct {
+	Model   string              `json:"model"`
+	Entries map[string]*indexed `json:"entries"`
+}
+
+// NewIndex loads the index saved at path; an index built by another embedder
+// is discarded. With an empty path nothing is persisted, which suits the
+// hashing embedder whose vectors are cheaper to recompute than to store.
+func NewIndex(e Embedder, path string) *Index {
+	ix := &Index{embedder: e, path: path, entries: map[string]*indexed{}, dirty: map[string]bool{}}
+	if path == "" {
+		return ix
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ix
+	}
+	var p persisted
+	if json.Unmarshal(data, &p) == nil && p.Model == e.Name() && p.Entries != nil {
+		ix.entries = p.Entries
+	}
+	return ix
+}
+
+// Embedder names the embedder the index was built with.
+func (ix *Index) Embedder() string {
+	return ix.embedder.Name()
+}
+
+// Touch marks an entry as added, changed or deleted, for the next Refresh.
+func (ix *Index) Touch(id string) {
+	ix.mu.Lock()
+	ix.dirty[id] = true
+	ix.mu.Unlock()
+}
+
+// Refresh brings the index in line with src. The first call reads the whole
+// history; later ones only look at the entries passed to Touch since.
+// Entries that were not indexed because of an error are tried again next
+// time.
+func (ix *Index) Refresh(ctx context.Context, src Source) error {
+	ix.syncMu.Lock()
+	defer ix.syncMu.Unlock()
+	ix.mu.Lock()
+	synced, dirty := ix.synced, ix.dirty
+	ix.dirty = map[string]bool{}
+	ix.mu.Unlock()
+
+	var err error
+	if !synced {
+		if err = ix.sync(ctx, src.Latest(0), true); err == nil {
+			ix.mu.Lock()
+			ix.synced = true
+			ix.mu.Unlock()
+		}
+	} else {
+		var entries []history.Entry
+		var gone []string
+		for id := range dirty {
+			if e, ok := src.Get(id); ok {
+				entries = append(entries, e)
+			} else {
+				gone = append(gone, id)
+			}
+		}
+		if err = ix.drop(gone); err == nil {
+			err = ix.sync(ctx, entries, false)
+		}
+	}
+	if err != nil {
+		ix.mu.Lock()
+		for id := range dirty {
+			ix.dirty[id] = true
+		}
+		ix.mu.Unlock()
+	}
+	return err
+}
+
+// Sync brings the index in line with entries: new and changed entries are
+// embedded, entries that are gone are dropped.
+func (ix *Index) Sync(ctx context.Context, entries []history.Entry) error {
+	ix.syncMu.Lock()
+	defer ix.syncMu.Unlock()
+	return ix.sync(ctx, entries, true)
+}
+
+// sync embeds the entries of entries whose documents changed, in batches
+// saved one by one. With prune, indexed entries missing from entries are
+// dropped.
+func (ix *Index) sync(ctx context.Context, entries []history.Entry, prune bool) error {
+	type pending struct {
+		id  string
+		doc *indexed
+	}
+	var todo []pending
+	live := make(map[string]bool, len(entries))
+	ix.mu.Lock()
+	for _, e := range entries {
+		live[e.ID] = true
+		docs := Documents(e)
+		fp := fingerprint(docs)
+		if cur, ok := ix.entries[e.ID]; ok && cur.Fingerprint == fp {
+			continue
+		}
+		todo = append(todo, pending{id: e.ID, doc: &indexed{Fingerprint: fp, Docs: docs}})
+	}
+	var gone []string
+	if prune {
+		for id := range ix.entries {
+			if !live[id] {
+				gone = append(gone, id)
+			}
+		}
+	}
+	ix.mu.Unlock()
+	if err := ix.drop(gone); err != nil {
+		return err
+	}
+
+	for len(todo) > 0 {
+		// A batch holds whole entries, about one embedder request, and is
+		// saved before the next so a failure keeps what was embedded.
+		n, texts := 0, []string(nil)
+		for n < len(todo) && (n == 0 || len(texts)+len(todo[n].doc.Docs) <= embedBatch) {
+			for _, d := range todo[n].doc.Docs {
+				texts = append(texts, d.Text)
+			}
+			n++
+		}
+		batch := todo[:n]
+		todo = todo[n:]
+		var vectors [][]float32
+		if len(texts) > 0 {
+			var err error
+			if vectors, err = ix.embedder.Embed(ctx, texts); err != nil {
+				return err
+			}
+			if len(vectors) != len(texts) {
+				return errors.New("embedder returned a wrong number of vectors")
+			}
+		}
+		ix.mu.Lock()
+		i := 0
+		for _, p := range batch {
+			for range p.doc.Docs {
+				p.doc.Vectors = append(p.doc.Vectors, vectors[i])
+				i++
+			}
+			ix.entries[p.id] = p.doc
+		}
+		err := ix.save()
+		ix.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drop removes entries from the index and saves it if any was there.
+func (ix *Index) drop(ids []string) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	changed := false
+	for _, id := range ids {
+		if _, ok := ix.entries[id]; ok {
+			delete(ix.entries, id)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return ix.save()
+}
+
+// Options narrow a search.
+type Options struct {
+	Limit    int
+	From, To time.Time // zero means unbounded
+}
+
+// Hit is an entry matching a search, with its best-matching documents.
+type Hit struct {
+	EntryID   string    `json:"entryId"`
+	Score     float32   `json:"score"`
+	CreatedAt time.Time `json:"createdAt"`
+	Matches   []Match   `json:"matches"`
+}
+
+type Match struct {
+	Kind     string  `json:"kind"`
+	IssueKey string  `json:"issueKey,omitempty"`
+	Text     string  `json:"text"`
+	Score    float32 `json:"score"`
+}
+
+// Search ranks entries by the cosine similarity of their best document to
+// query. Time phrases such as "в прошлом месяце" or "last week" restrict the
+// entries by creation date (unless opts already does) and are not embedded.
+func (ix *Index) Search(ctx context.Context, query string, opts Options) ([]Hit, error) {
+	text := query
+	if opts.From.IsZero() && opts.To.IsZero() {
+		if from, to, rest, ok := ParseTimeRange(query, time.Now()); ok {
+			opts.From, opts.To, text = from, to, rest
+		}
+	}
+	if len(words(text)) == 0 {
+		return nil, errors.New("query has no searchable words")
+	}
+	vectors, err := ix.embedder.Embed(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	q := vectors[0]
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	var hits []Hit
+	for id, e := range ix.entries {
+		if len(e.Docs) == 0 {
+			continue
+		}
+		created := e.Docs[0].CreatedAt
+		if (!opts.From.IsZero() && created.Before(opts.From)) || (!opts.To.IsZero() && !created.Before(opts.To)) {
+			continue
+		}
+		hit := Hit{EntryID: id, CreatedAt: created}
+		for i, d := range e.Docs {
+			score := dot(q, e.Vectors[i])
+			if score <= 0 {
+				continue
+			}
+			hit.Matches = append(hit.Matches, Match{Kind: d.Kind, IssueKey: d.IssueKey, Text: snippet(d.Text), Score: score})
+		}
+		if len(hit.Matches) == 0 {
+			continue
+		}
+		sort.Slice(hit.Matches, func(i, j int) bool { return hit.Matches[i].Score > hit.Matches[j].Score })
+		if len(hit.Matches) > 3 {
+			hit.Matches = hit.Matches[:3]
+		}
+		hit.Score = hit.Matches[0].Score
+		hits = append(hits, hit)
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].CreatedAt.After(hits[j].CreatedAt)
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+func (ix *Index) save() error {
+	if ix.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(ix.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(persisted{Model: ix.embedder.Name(), Entries: ix.entries})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ix.path, data, 0o644)
+}
+
+func fingerprint(docs []Document) string {
+	h := fnv.New64a()
+	for _, d := range docs {
+		_, _ = h.Write([]byte(d.Kind + "\x00" + d.IssueKey + "\x00" + d.Text + "\x00"))
+	}
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], h.Sum64())
+	return base64.RawStdEncoding.EncodeToString(buf[:])
+}
+
+func dot(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var s float32
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return s
+}
+
+func snippet(s string) string {
+	if utf8.RuneCountInString(s) <= snippetRunes {
+		return s
+	}
+	return string([]rune(s)[:snippetRunes]) + "…"
+}
+
+// Vector is stored as base64 of little-endian float32s, which is several
+// times smaller than a JSON number array.
+type Vector []float32
+
+func (v Vector) MarshalJSON() ([]byte, error) {
+	buf := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(x))
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(buf))
+}
+
+func (v *Vector) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	buf, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	if len(buf)%4 != 0 {
+		return errors.New("vector: bad length")
+	}
+	out := make(Vector, len(buf)/4)
+	for i := range out {
+		out[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	*v = out
+	return nil
+}
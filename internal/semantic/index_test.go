@@ -0,0 +1,94 @@
+package semantic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/history"
+)
+
+// counting embeds with Hashing, counts the texts and fails the call numbered
+// failAt (1-based).
+type counting struct {
+	Hashing
+	calls, texts, failAt int
+}
+
+func (c *counting) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	c.calls++
+	if c.calls == c.failAt {
+		return nil, errors.New("embedder down")
+	}
+	c.texts += len(texts)
+	return c.Hashing.Embed(ctx, texts)
+}
+
+func TestRefreshIsIncremental(t *testing.T) {
+	dir := t.TempDir()
+	store := history.NewStore(filepath.Join(dir, "history.json"), history.Retention{MaxEntries: 1000})
+	base := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		e := history.Entry{ID: fmt.Sprintf("e%03d", i), Query: fmt.Sprintf("запрос номер %d", i), CreatedAt: base.Add(time.Duration(i) * time.Minute)}
+		if err := store.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(dir, "index.json")
+	emb := &counting{Hashing: Hashing{Dims: 64}, failAt: 2}
+	ix := NewIndex(emb, path)
+	ctx := context.Background()
+
+	// The second batch fails; the first one is kept.
+	if err := ix.Refresh(ctx, store); err == nil {
+		t.Fatal("no error from a failing embedder")
+	}
+	if emb.texts != embedBatch {
+		t.Fatalf("embedded %d texts before the failure, want %d", emb.texts, embedBatch)
+	}
+	if err := ix.Refresh(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	if emb.texts != 100 {
+		t.Fatalf("embedded %d texts in total, want 100", emb.texts)
+	}
+
+	// Only touched entries are looked at again.
+	if _, err := store.Modify("e007", func(e *history.Entry) error { e.Analysis = "платёжный шлюз падает"; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	ix.Touch("e007")
+	ix.Touch("e008") // touched but unchanged
+	if err := store.Delete("e009"); err != nil {
+		t.Fatal(err)
+	}
+	ix.Touch("e009")
+	if err := ix.Refresh(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	if emb.texts != 102 {
+		t.Errorf("embedded %d texts in total, want 102 (query and analysis of e007)", emb.texts)
+	}
+	hits, err := ix.Search(ctx, "платёжный шлюз", Options{Limit: 1})
+	if err != nil || len(hits) != 1 || hits[0].EntryID != "e007" {
+		t.Errorf("hits = %+v, %v", hits, err)
+	}
+	ix.mu.Lock()
+	_, kept := ix.entries["e009"]
+	ix.mu.Unlock()
+	if kept {
+		t.Error("deleted entry still indexed")
+	}
+
+	// A reopened index reuses the saved vectors.
+	again := &counting{Hashing: Hashing{Dims: 64}}
+	if err := NewIndex(again, path).Refresh(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	if again.texts != 0 {
+		t.Errorf("reopened index embedded %d texts", again.texts)
+	}
+}
@@ -0,0 +1,67 @@
+package semantic
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// timePhrases map wording to a period relative to now. Longer phrases come
+// first so "на прошлой неделе" is not read as "на ... неделе".
+var timePhrases = []struct {
+	re     *regexp.Regexp
+	period func(now time.Time) (from, to time.Time)
+}{
+	{regexp.MustCompile(`(?i)(в\s+)?прошл(ом|ый)\s+месяц[е]?|last\s+month`), func(now time.Time) (time.Time, time.Time) {
+		start := monthStart(now)
+		return start.AddDate(0, -1, 0), start
+	}},
+	{regexp.MustCompile(`(?i)(в\s+)?(этом|текущем)\s+месяц[е]?|this\s+month`), func(now time.Time) (time.Time, time.Time) {
+		return monthStart(now), now.Add(time.Second)
+	}},
+	{regexp.MustCompile(`(?i)(на\s+)?прошл(ой|ую)\s+недел[юие]|last\s+week`), func(now time.Time) (time.Time, time.Time) {
+		start := weekStart(now)
+		return start.AddDate(0, 0, -7), start
+	}},
+	{regexp.MustCompile(`(?i)(на\s+)?(этой|текущей)\s+недел[еию]|this\s+week`), func(now time.Time) (time.Time, time.Time) {
+		return weekStart(now), now.Add(time.Second)
+	}},
+	{regexp.MustCompile(`(?i)вчера|yesterday`), func(now time.Time) (time.Time, time.Time) {
+		start := dayStart(now)
+		return start.AddDate(0, 0, -1), start
+	}},
+	{regexp.MustCompile(`(?i)сегодня|today`), func(now time.Time) (time.Time, time.Time) {
+		return dayStart(now), now.Add(time.Second)
+	}},
+}
+
+// ParseTimeRange finds a relative period ("в прошлом месяце", "last week",
+// "вчера") in query. It returns the half-open range [from, to) and the query
+// without the phrase.
+func ParseTimeRange(query string, now time.Time) (from, to time.Time, rest string, ok bool) {
+	for _, p := range timePhrases {
+		loc := p.re.FindStringIndex(query)
+		if loc == nil {
+			continue
+		}
+		from, to = p.period(now)
+		rest = strings.Join(strings.Fields(query[:loc[0]]+" "+query[loc[1]:]), " ")
+		return from, to, rest, true
+	}
+	return time.Time{}, time.Time{}, query, false
+}
+
+func dayStart(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+func weekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7 // Monday = 0
+	return dayStart(t).AddDate(0, 0, -offset)
+}
+
+func monthStart(t time.Time) time.Time {
+	y, m, _ := t.Date()
+	return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+}
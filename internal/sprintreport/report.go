@@ -0,0 +1,626 @@
+// Package sprintreport builds a sprint report from the Jira Agile API and
+// issue changelogs: committed vs completed story points, issues added or
+// removed mid-sprint, carry-over and time logged per person.
+package sprintreport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/jira"
+)
+
+// Limits on what one report fetches.
+const (
+	pageSize = 100
+	// DefaultMaxCandidates bounds the project issues updated since the sprint
+	// start that are scanned for issues removed from the sprint.
+	DefaultMaxCandidates = 500
+)
+
+// Fetcher issues a GET against the Jira REST API; *jira.Client satisfies it.
+type Fetcher interface {
+	Get(ctx context.Context, path string) ([]byte, error)
+}
+
+// ErrNotStarted is returned for a future sprint.
+var ErrNotStarted = errors.New("sprint has not started")
+
+// Input describes the sprint to report on.
+type Input struct {
+	Sprint jira.Sprint
+	// PointsField is the story points field id (customfield_NNN) and
+	// PointsName its display name as used in changelogs; empty means the
+	// report counts issues only.
+	PointsField string
+	PointsName  string
+	// MaxCandidates bounds the removed-issue scan; zero means
+	// DefaultMaxCandidates.
+	MaxCandidates int
+	// Now is the end of an active sprint; zero means time.Now().
+	Now time.Time
+}
+
+// Report is the result. Points are story points; without a points field
+// they stay zero and the issue counts carry the meaning.
+type Report struct {
+	Sprint      SprintInfo `json:"sprint"`
+	PointsField string     `json:"pointsField,omitempty"`
+
+	Committed      Totals  `json:"committed"` // in the sprint at its start
+	Completed      Totals  `json:"completed"` // done by its end
+	CompletionRate float64 `json:"completionRate"`
+
+	Scope     ScopeChange `json:"scopeChange"`
+	Added     []string    `json:"added"`     // joined after the start
+	Removed   []string    `json:"removed"`   // left before the end
+	CarryOver []string    `json:"carryOver"` // still open at the end
+	CarriedIn []string    `json:"carriedIn"` // committed after an earlier sprint
+
+	TimeByPerson []PersonTime `json:"timeByPerson"`
+	TotalLogged  string       `json:"totalLogged"`
+	Issues       []Issue      `json:"issues"`
+	Warnings     []string     `json:"warnings,omitempty"`
+}
+
+// SprintInfo is the reported window: Start to End, where End is the
+// completion date of a closed sprint or now for an active one.
+type SprintInfo struct {
+	ID    int       `json:"id"`
+	Name  string    `json:"name"`
+	State string    `json:"state"`
+	Goal  string    `json:"goal,omitempty"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type Totals struct {
+	Issues int     `json:"issues"`
+	Points float64 `json:"points"`
+}
+
+// ScopeChange sums what changed after the start: points of added and
+// removed issues and re-estimates of issues that stayed.
+type ScopeChange struct {
+	AddedIssues     int     `json:"addedIssues"`
+	AddedPoints     float64 `json:"addedPoints"`
+	RemovedIssues   int     `json:"removedIssues"`
+	RemovedPoints   float64 `json:"removedPoints"`
+	ReestimatedDiff float64 `json:"reestimatedPoints"`
+	NetPoints       float64 `json:"netPoints"`
+}
+
+// PersonTime is the time a person logged on sprint issues inside the
+// sprint window.
+type PersonTime struct {
+	Person  string `json:"person"`
+	Seconds int    `json:"seconds"`
+	Time    string `json:"time"`
+	Issues  int    `json:"issues"`
+}
+
+// Issue is one issue that was in the sprint at some point.
+type Issue struct {
+	Key         string  `json:"key"`
+	Summary     string  `json:"summary"`
+	Type        string  `json:"type,omitempty"`
+	Status      string  `json:"status"`
+	Assignee    string  `json:"assignee,omitempty"`
+	StartPoints float64 `json:"startPoints"`
+	EndPoints   float64 `json:"endPoints"`
+	Committed   bool    `json:"committed"`
+	Added       bool    `json:"added,omitempty"`
+	Removed     bool    `json:"removed,omitempty"`
+	Done        bool    `json:"done"`
+	LoggedSecs  int     `json:"loggedSeconds,omitempty"`
+}
+
+// rawIssue is the part of a Jira issue the report reads.
+type rawIssue struct {
+	Key    string                     `json:"key"`
+	Fields map[string]json.RawMessage `json:"fields"`
+	// Changelog histories, oldest first after sorting.
+	Changelog struct {
+		Histories []changeGroup `json:"histories"`
+	} `json:"changelog"`
+}
+
+// changeGroup is one changelog entry: the fields changed together.
+type changeGroup struct {
+	Created string `json:"created"`
+	Items   []struct {
+		Field      string `json:"field"`
+		FieldID    string `json:"fieldId"`
+		From       string `json:"from"`
+		FromString string `json:"fromString"`
+		To         string `json:"to"`
+		ToString   string `json:"toString"`
+	} `json:"items"`
+	at time.Time
+}
+
+// Build fetches the sprint's issues and the project issues updated since
+// its start (to find removed ones), with changelogs, and computes the report.
+func Build(ctx context.Context, f Fetcher, in Input) (Report, error) {
+	sp := in.Sprint
+	if sp.StartDate.IsZero() {
+		return Report{}, fmt.Errorf("sprint %d: %w", sp.ID, ErrNotStarted)
+	}
+	now := in.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	end := now
+	if !sp.CompleteDate.IsZero() {
+		end = sp.CompleteDate
+	} else if sp.State == "closed" && !sp.EndDate.IsZero() {
+		end = sp.EndDate
+	}
+	rep := Report{
+		Sprint:      SprintInfo{ID: sp.ID, Name: sp.Name, State: sp.State, Goal: sp.Goal, Start: sp.StartDate, End: end},
+		PointsField: in.PointsField,
+		Added:       []string{},
+		Removed:     []string{},
+		CarryOver:   []string{},
+		CarriedIn:   []string{},
+		Issues:      []Issue{},
+	}
+	if in.PointsField == "" {
+		rep.Warnings = append(rep.Warnings, "story points field not found: only issue counts are reported")
+	}
+
+	fields := "summary,status,issuetype,assignee,resolutiondate,worklog"
+	if in.PointsField != "" {
+		fields += "," + in.PointsField
+	}
+	inSprint, err := fetchAll(ctx, f, fmt.Sprintf("/rest/agile/1.0/sprint/%d/issue?fields=%s&expand=changelog", sp.ID, fields), 0)
+	if err != nil {
+		return Report{}, fmt.Errorf("sprint issues: %w", err)
+	}
+	member := map[string]bool{}
+	issues := map[string]rawIssue{}
+	projects := map[string]bool{}
+	for _, iss := range inSprint {
+		member[iss.Key] = true
+		issues[iss.Key] = iss
+		if p, _, ok := strings.Cut(iss.Key, "-"); ok {
+			projects[p] = true
+		}
+	}
+
+	// Issues removed mid-sprint are no longer listed by the sprint; look for
+	// them among the project issues updated since the start.
+	if len(projects) > 0 {
+		maxCand := in.MaxCandidates
+		if maxCand <= 0 {
+			maxCand = DefaultMaxCandidates
+		}
+		jql := fmt.Sprintf(`project in (%s) AND updated >= "%s"`, strings.Join(sortedKeys(projects), ","), sp.StartDate.Format("2006-01-02"))
+		path := "/rest/api/2/search?jql=" + url.QueryEscape(jql) + "&fields=" + fields + "&expand=changelog"
+		cands, err := fetchAll(ctx, f, path, maxCand)
+		if err != nil {
+			rep.Warnings = append(rep.Warnings, "removed issues unknown: "+err.Error())
+		}
+		if len(cands) >= maxCand {
+			rep.Warnings = append(rep.Warnings, fmt.Sprintf("only the first %d issues updated since the start were checked for removals", maxCand))
+		}
+		for _, iss := range cands {
+			if _, ok := issues[iss.Key]; !ok && touchesSprint(iss, sp) {
+				issues[iss.Key] = iss
+			}
+		}
+	}
+
+	cats, err := statusCategories(ctx, f, issues)
+	if err != nil {
+		rep.Warnings = append(rep.Warnings, "status categories: "+err.Error()+"; statuses left after the sprint are judged by the issues' current ones")
+	}
+
+	seconds := map[string]int{}
+	personIssues := map[string]map[string]bool{}
+	for _, key := range sortedKeys(issues) {
+		iss := issues[key]
+		sortHistories(&iss)
+		row, ok := evaluate(iss, in, sp, member[key], end, cats)
+		if !ok {
+			continue
+		}
+		logs, err := worklogs(ctx, f, iss)
+		if err != nil {
+			rep.Warnings = append(rep.Warnings, fmt.Sprintf("%s: worklogs: %v", key, err))
+		}
+		for _, wl := range logs {
+			t, err := jira.ParseJiraTime(wl.Started)
+			if err != nil || t.Before(sp.StartDate) || t.After(end) {
+				continue
+			}
+			who := wl.Author.DisplayName
+			if who == "" {
+				who = wl.Author.Name
+			}
+			seconds[who] += wl.TimeSpentSeconds
+			row.LoggedSecs += wl.TimeSpentSeconds
+			if personIssues[who] == nil {
+				personIssues[who] = map[string]bool{}
+			}
+			personIssues[who][key] = true
+		}
+		rep.add(row)
+		if row.Committed && previousSprints(iss, sp) {
+			rep.CarriedIn = append(rep.CarriedIn, key)
+		}
+	}
+
+	total := 0
+	for who, secs := range seconds {
+		rep.TimeByPerson = append(rep.TimeByPerson, PersonTime{Person: who, Seconds: secs, Time: FormatSeconds(secs), Issues: len(personIssues[who])})
+		total += secs
+	}
+	sort.Slice(rep.TimeByPerson, func(i, j int) bool { return rep.TimeByPerson[i].Seconds > rep.TimeByPerson[j].Seconds })
+	if rep.TimeByPerson == nil {
+		rep.TimeByPerson = []PersonTime{}
+	}
+	rep.TotalLogged = FormatSeconds(total)
+	switch {
+	case rep.Committed.Points > 0:
+		rep.CompletionRate = round2(rep.Completed.Points / rep.Committed.Points)
+	case in.PointsField == "" && rep.Committed.Issues > 0:
+		rep.CompletionRate = round2(float64(rep.Completed.Issues) / float64(rep.Committed.Issues))
+	}
+	rep.Scope.ReestimatedDiff = round2(rep.Scope.ReestimatedDiff)
+	rep.Scope.NetPoints = round2(rep.Scope.AddedPoints - rep.Scope.RemovedPoints + rep.Scope.ReestimatedDiff)
+	return rep, nil
+}
+
+// add accounts one issue in the totals.
+func (r *Report) add(row Issue) {
+	r.Issues = append(r.Issues, row)
+	if row.Committed {
+		r.Committed.Issues++
+		r.Committed.Points += row.StartPoints
+		if !row.Removed {
+			r.Scope.ReestimatedDiff += row.EndPoints - row.StartPoints
+		}
+	}
+	if row.Added {
+		r.Added = append(r.Added, row.Key)
+		r.Scope.AddedIssues++
+		r.Scope.AddedPoints += row.EndPoints
+	}
+	if row.Removed {
+		r.Removed = append(r.Removed, row.Key)
+		r.Scope.RemovedIssues++
+		r.Scope.RemovedPoints += row.EndPoints
+		return
+	}
+	if row.Done {
+		r.Completed.Issues++
+		r.Completed.Points += row.EndPoints
+	} else {
+		r.CarryOver = append(r.CarryOver, row.Key)
+	}
+}
+
+// evaluate replays the sprint and points changes of one issue; ok is false
+// when the issue was never in the sprint during its window.
+func evaluate(iss rawIssue, in Input, sp jira.Sprint, memberNow bool, end time.Time, cats map[string]string) (Issue, bool) {
+	atStart := membershipAt(iss, sp, memberNow, sp.StartDate)
+	atEnd := membershipAt(iss, sp, memberNow, end)
+	joined := false
+	for _, h := range iss.Changelog.Histories {
+		if h.at.After(sp.StartDate) && !h.at.After(end) {
+			for _, it := range h.Items {
+				if isSprintItem(it.Field) && hasSprint(it.To, it.ToString, sp) && !hasSprint(it.From, it.FromString, sp) {
+					joined = true
+				}
+			}
+		}
+	}
+	if !atStart && !joined {
+		return Issue{}, false
+	}
+
+	row := Issue{
+		Key:       iss.Key,
+		Summary:   stringField(iss.Fields["summary"]),
+		Type:      namedField(iss.Fields["issuetype"], "name"),
+		Status:    namedField(iss.Fields["status"], "name"),
+		Assignee:  namedField(iss.Fields["assignee"], "displayName"),
+		Committed: atStart,
+		Added:     !atStart && joined,
+		Removed:   !atEnd,
+	}
+	if in.PointsField != "" {
+		now := numberField(iss.Fields[in.PointsField])
+		row.StartPoints = pointsAt(iss, in, now, sp.StartDate)
+		row.EndPoints = pointsAt(iss, in, now, end)
+	}
+	row.Done = doneBy(iss, end, cats)
+	return row, true
+}
+
+// membershipAt undoes the Sprint changes made after t.
+func membershipAt(iss rawIssue, sp jira.Sprint, memberNow bool, t time.Time) bool {
+	m := memberNow
+	hs := iss.Changelog.Histories
+	for i := len(hs) - 1; i >= 0 && hs[i].at.After(t); i-- {
+		for _, it := range hs[i].Items {
+			if isSprintItem(it.Field) {
+				m = hasSprint(it.From, it.FromString, sp)
+			}
+		}
+	}
+	return m
+}
+
+// pointsAt undoes the story points changes made after t.
+func pointsAt(iss rawIssue, in Input, now float64, t time.Time) float64 {
+	v := now
+	hs := iss.Changelog.Histories
+	for i := len(hs) - 1; i >= 0 && hs[i].at.After(t); i-- {
+		for _, it := range hs[i].Items {
+			if it.FieldID == in.PointsField || (in.PointsName != "" && strings.EqualFold(it.Field, in.PointsName)) {
+				v, _ = strconv.ParseFloat(strings.TrimSpace(it.FromString), 64)
+			}
+		}
+	}
+	return v
+}
+
+// doneBy reports whether the issue was in a done status at end. Status
+// changes made after end are undone, so an issue finished in the sprint and
+// reopened later still counts as completed. When nothing changed after end,
+// the resolution date must not be after it; an unreadable one is not done.
+func doneBy(iss rawIssue, end time.Time, cats map[string]string) bool {
+	id, name := namedField(iss.Fields["status"], "id"), namedField(iss.Fields["status"], "name")
+	replayed := false
+	hs := iss.Changelog.Histories
+	for i := len(hs) - 1; i >= 0 && hs[i].at.After(end); i-- {
+		for _, it := range hs[i].Items {
+			if strings.EqualFold(it.Field, "status") {
+				id, name, replayed = it.From, it.FromString, true
+			}
+		}
+	}
+	if replayed {
+		return categoryOf(cats, id, name) == "done"
+	}
+	if namedField(iss.Fields["status"], "statusCategory.key") != "done" {
+		return false
+	}
+	resolved := stringField(iss.Fields["resolutiondate"])
+	if resolved == "" {
+		return true
+	}
+	t, err := jira.ParseJiraTime(resolved)
+	return err == nil && !t.After(end)
+}
+
+// statusCategories maps status ids and lowercased names to their category
+// key (new, indeterminate or done), so statuses found in changelogs can be
+// judged. The issues' current statuses are always included; the error only
+// says the full list from Jira is missing.
+func statusCategories(ctx context.Context, f Fetcher, issues map[string]rawIssue) (map[string]string, error) {
+	cats := map[string]string{}
+	put := func(id, name, cat string) {
+		if cat == "" {
+			return
+		}
+		if id != "" {
+			cats[id] = cat
+		}
+		if name != "" {
+			cats[strings.ToLower(name)] = cat
+		}
+	}
+	for _, iss := range issues {
+		st := iss.Fields["status"]
+		put(namedField(st, "id"), namedField(st, "name"), namedField(st, "statusCategory.key"))
+	}
+	data, err := f.Get(ctx, "/rest/api/2/status")
+	if err != nil {
+		return cats, err
+	}
+	var statuses []struct {
+		ID             string `json:"id"`
+		Name           string `json:"name"`
+		StatusCategory struct {
+			Key string `json:"key"`
+		} `json:"statusCategory"`
+	}
+	if err := json.Unmarshal(data, &statuses); err != nil {
+		return cats, err
+	}
+	for _, st := range statuses {
+		put(st.ID, st.Name, st.StatusCategory.Key)
+	}
+	return cats, nil
+}
+
+// categoryOf looks a status up by id, then by name.
+func categoryOf(cats map[string]string, id, name string) string {
+	if c, ok := cats[strings.TrimSpace(id)]; ok && id != "" {
+		return c
+	}
+	return cats[strings.ToLower(strings.TrimSpace(name))]
+}
+
+// touchesSprint reports whether any Sprint change of iss mentions sp.
+func touchesSprint(iss rawIssue, sp jira.Sprint) bool {
+	for _, h := range iss.Changelog.Histories {
+		for _, it := range h.Items {
+			if isSprintItem(it.Field) && (hasSprint(it.From, it.FromString, sp) || hasSprint(it.To, it.ToString, sp)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// previousSprints reports whether iss had been in another sprint before it
+// joined sp, i.e. it was carried over into sp.
+func previousSprints(iss rawIssue, sp jira.Sprint) bool {
+	for _, h := range iss.Changelog.Histories {
+		for _, it := range h.Items {
+			if isSprintItem(it.Field) && hasSprint(it.To, it.ToString, sp) && !hasSprint(it.From, it.FromString, sp) {
+				return strings.TrimSpace(it.From) != "" || strings.TrimSpace(it.FromString) != ""
+			}
+		}
+	}
+	return false
+}
+
+func isSprintItem(field string) bool { return strings.EqualFold(field, "Sprint") }
+
+// hasSprint checks a Sprint changelog value: ids ("101, 102") when Jira
+// provides them, otherwise sprint names.
+func hasSprint(ids, names string, sp jira.Sprint) bool {
+	if strings.TrimSpace(ids) != "" {
+		want := strconv.Itoa(sp.ID)
+		for _, id := range strings.Split(ids, ",") {
+			if strings.TrimSpace(id) == want {
+				return true
+			}
+		}
+		return false
+	}
+	for _, n := range strings.Split(names, ",") {
+		if strings.TrimSpace(n) == sp.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func sortHistories(iss *rawIssue) {
+	hs := iss.Changelog.Histories
+	for i := range hs {
+		hs[i].at, _ = jira.ParseJiraTime(hs[i].Created)
+	}
+	sort.SliceStable(hs, func(i, j int) bool { return hs[i].at.Before(hs[j].at) })
+}
+
+// fetchAll pages through an issue list (Agile or search API); max > 0
+// stops after that many issues.
+func fetchAll(ctx context.Context, f Fetcher, path string, max int) ([]rawIssue, error) {
+	var out []rawIssue
+	for startAt := 0; ; {
+		body, err := f.Get(ctx, fmt.Sprintf("%s&startAt=%d&maxResults=%d", path, startAt, pageSize))
+		if err != nil {
+			return out, err
+		}
+		var page struct {
+			Issues []rawIssue `json:"issues"`
+			Total  int        `json:"total"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return out, err
+		}
+		out = append(out, page.Issues...)
+		startAt += len(page.Issues)
+		if len(page.Issues) == 0 || startAt >= page.Total || (max > 0 && len(out) >= max) {
+			break
+		}
+	}
+	if max > 0 && len(out) > max {
+		out = out[:max]
+	}
+	return out, nil
+}
+
+type worklog struct {
+	Started          string `json:"started"`
+	TimeSpentSeconds int    `json:"timeSpentSeconds"`
+	Author           struct {
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"author"`
+}
+
+// worklogs returns the issue's worklogs, fetching them separately when the
+// issue only carries the first page.
+func worklogs(ctx context.Context, f Fetcher, iss rawIssue) ([]worklog, error) {
+	var embedded struct {
+		Total    int       `json:"total"`
+		Worklogs []worklog `json:"worklogs"`
+	}
+	if raw := iss.Fields["worklog"]; len(raw) > 0 {
+		if err := json.Unmarshal(raw, &embedded); err == nil && embedded.Total <= len(embedded.Worklogs) {
+			return embedded.Worklogs, nil
+		}
+	}
+	body, err := f.Get(ctx, "/rest/api/2/issue/"+url.PathEscape(iss.Key)+"/worklog")
+	if err != nil {
+		return embedded.Worklogs, err
+	}
+	var all struct {
+		Worklogs []worklog `json:"worklogs"`
+	}
+	if err := json.Unmarshal(body, &all); err != nil {
+		return embedded.Worklogs, err
+	}
+	return all.Worklogs, nil
+}
+
+func stringField(raw json.RawMessage) string {
+	var s string
+	_ = json.Unmarshal(raw, &s)
+	return s
+}
+
+func numberField(raw json.RawMessage) float64 {
+	var v float64
+	_ = json.Unmarshal(raw, &v)
+	return v
+}
+
+// namedField reads a dotted path such as "statusCategory.key" from an object
+// field.
+func namedField(raw json.RawMessage, path string) string {
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return ""
+	}
+	for _, part := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return ""
+		}
+		v = m[part]
+	}
+	s, _ := v.(string)
+	return s
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// FormatSeconds renders seconds as "1h 30m".
+func FormatSeconds(secs int) string {
+	h, m := secs/3600, secs%3600/60
+	switch {
+	case h > 0 && m > 0:
+		return fmt.Sprintf("%dh %dm", h, m)
+	case h > 0:
+		return fmt.Sprintf("%dh", h)
+	}
+	return fmt.Sprintf("%dm", m)
+}
@@ -0,0 +1,134 @@
+package sprintreport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/jira"
+)
+
+// fakeJira serves canned bodies by path prefix; list endpoints return their
+// issues on the first page only.
+type fakeJira map[string]any
+
+func (f fakeJira) Get(_ context.Context, path string) ([]byte, error) {
+	for prefix, body := range f {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		if issues, ok := body.([]any); ok && strings.Contains(path, "startAt=") {
+			if !strings.Contains(path, "startAt=0&") {
+				issues = nil
+			}
+			body = map[string]any{"total": len(issues), "issues": issues}
+		}
+		return json.Marshal(body)
+	}
+	return nil, fmt.Errorf("unexpected path %s", path)
+}
+
+func issue(key, status string, points float64, resolved string, histories ...any) map[string]any {
+	cats := map[string][2]string{"To Do": {"1", "new"}, "In Progress": {"3", "indeterminate"}, "Done": {"10001", "done"}}
+	fields := map[string]any{
+		"summary":           "S " + key,
+		"status":            map[string]any{"id": cats[status][0], "name": status, "statusCategory": map[string]any{"key": cats[status][1]}},
+		"customfield_10002": points,
+		"worklog":           map[string]any{"total": 0, "worklogs": []any{}},
+	}
+	if resolved != "" {
+		fields["resolutiondate"] = resolved
+	}
+	if histories == nil {
+		histories = []any{}
+	}
+	return map[string]any{"key": key, "fields": fields, "changelog": map[string]any{"histories": histories}}
+}
+
+func change(at, field, from, fromString, to, toString string) map[string]any {
+	return map[string]any{"created": at, "items": []any{map[string]any{
+		"field": field, "from": from, "fromString": fromString, "to": to, "toString": toString,
+	}}}
+}
+
+func TestBuild(t *testing.T) {
+	joined := change("2026-09-30T10:00:00.000+0000", "Sprint", "", "", "7", "S7")
+	a1 := issue("A-1", "Done", 3, "2026-10-10T10:00:00.000+0000", joined)
+	a1["fields"].(map[string]any)["worklog"] = map[string]any{"total": 2, "worklogs": []any{
+		map[string]any{"author": map[string]any{"displayName": "Ann"}, "started": "2026-10-02T10:00:00.000+0000", "timeSpentSeconds": 3600},
+		map[string]any{"author": map[string]any{"displayName": "Bob"}, "started": "2026-09-29T10:00:00.000+0000", "timeSpentSeconds": 1800},
+	}}
+	f := fakeJira{
+		"/rest/agile/1.0/sprint/7/issue": []any{
+			a1,
+			// Done in the sprint, reopened after it.
+			issue("A-2", "In Progress", 2, "", joined,
+				change("2026-10-10T10:00:00.000+0000", "status", "3", "In Progress", "10001", "Done"),
+				change("2026-10-20T10:00:00.000+0000", "status", "10001", "Done", "3", "In Progress")),
+			// Done, but the resolution date cannot be read.
+			issue("A-3", "Done", 1, "garbage", joined),
+			// Added mid-sprint and not finished.
+			issue("A-4", "To Do", 5, "", change("2026-10-05T10:00:00.000+0000", "Sprint", "", "", "7", "S7")),
+			// Re-estimated from 2 to 5, then done.
+			issue("A-6", "Done", 5, "2026-10-12T10:00:00.000+0000", joined,
+				map[string]any{"created": "2026-10-06T10:00:00.000+0000", "items": []any{map[string]any{
+					"field": "Story Points", "fieldId": "customfield_10002", "fromString": "2", "toString": "5"}}}),
+		},
+		"/rest/api/2/search": []any{
+			issue("A-5", "To Do", 8, "", joined, change("2026-10-08T10:00:00.000+0000", "Sprint", "7", "S7", "", "")),
+			issue("A-9", "To Do", 1, ""),
+		},
+		"/rest/api/2/status": []any{
+			map[string]any{"id": "1", "name": "To Do", "statusCategory": map[string]any{"key": "new"}},
+			map[string]any{"id": "3", "name": "In Progress", "statusCategory": map[string]any{"key": "indeterminate"}},
+			map[string]any{"id": "10001", "name": "Done", "statusCategory": map[string]any{"key": "done"}},
+		},
+	}
+	sp := jira.Sprint{
+		ID: 7, Name: "S7", State: "closed",
+		StartDate:    time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:      time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC),
+		CompleteDate: time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC),
+	}
+	rep, err := Build(context.Background(), f, Input{Sprint: sp, PointsField: "customfield_10002", PointsName: "Story Points"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (Totals{Issues: 5, Points: 16}); rep.Committed != want {
+		t.Errorf("committed = %+v, want %+v", rep.Committed, want)
+	}
+	if want := (Totals{Issues: 3, Points: 10}); rep.Completed != want {
+		t.Errorf("completed = %+v, want %+v", rep.Completed, want)
+	}
+	for name, c := range map[string]struct{ got, want []string }{
+		"added":     {rep.Added, []string{"A-4"}},
+		"removed":   {rep.Removed, []string{"A-5"}},
+		"carryOver": {rep.CarryOver, []string{"A-3", "A-4"}},
+	} {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%s = %v, want %v", name, c.got, c.want)
+		}
+	}
+	if rep.Scope.ReestimatedDiff != 3 || rep.Scope.NetPoints != 0 {
+		t.Errorf("scope = %+v, want re-estimate 3 and net 0", rep.Scope)
+	}
+	if want := []PersonTime{{Person: "Ann", Seconds: 3600, Time: "1h", Issues: 1}}; !reflect.DeepEqual(rep.TimeByPerson, want) {
+		t.Errorf("timeByPerson = %+v, want %+v", rep.TimeByPerson, want)
+	}
+	if len(rep.Warnings) != 0 {
+		t.Errorf("warnings = %v", rep.Warnings)
+	}
+}
+
+func TestBuildNotStarted(t *testing.T) {
+	_, err := Build(context.Background(), fakeJira{}, Input{Sprint: jira.Sprint{ID: 8, State: "future"}})
+	if !errors.Is(err, ErrNotStarted) {
+		t.Fatalf("err = %v, want ErrNotStarted", err)
+	}
+}
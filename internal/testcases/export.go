@@ -0,0 +1,246 @@
+package testcases
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/alekseymerzlyakov/jira/internal/llm"
+)
+
+// Export formats.
+const (
+	FormatMarkdown = "md"
+	FormatCSV      = "csv"
+	FormatXray     = "xray"
+	FormatZephyr   = "zephyr"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format (want md, csv, xray or zephyr)")
+
+// Export renders cases in format and returns the body, its content type and
+// a file extension for downloads.
+func Export(cases []llm.TestCase, format string) ([]byte, string, string, error) {
+	switch format {
+	case FormatMarkdown, "markdown", "":
+		return []byte(Markdown(cases)), "text/markdown; charset=utf-8", "md", nil
+	case FormatCSV:
+		b, err := CSV(cases)
+		return b, "text/csv; charset=utf-8", "csv", err
+	case FormatXray:
+		b, err := Xray(cases)
+		return b, "application/json", "xray.json", err
+	case FormatZephyr:
+		b, err := Zephyr(cases)
+		return b, "application/json", "zephyr.json", err
+	}
+	return nil, "", "", ErrUnknownFormat
+}
+
+// Markdown renders cases grouped by issue.
+func Markdown(cases []llm.TestCase) string {
+	var b strings.Builder
+	lastKey := ""
+	for i, c := range cases {
+		if c.IssueKey != lastKey {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "# %s\n\n", c.IssueKey)
+			lastKey = c.IssueKey
+		}
+		fmt.Fprintf(&b, "## TC-%d. %s\n\n", i+1, c.Title)
+		fmt.Fprintf(&b, "**Priority:** %s\n\n", c.Priority)
+		if len(c.Preconditions) > 0 {
+			b.WriteString("**Preconditions:**\n")
+			for _, p := range c.Preconditions {
+				fmt.Fprintf(&b, "- %s\n", p)
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("| # | Action | Data | Expected |\n|---|---|---|---|\n")
+		for j, s := range c.Steps {
+			fmt.Fprintf(&b, "| %d | %s | %s | %s |\n", j+1, mdCell(s.Action), mdCell(s.Data), mdCell(s.Expected))
+		}
+		fmt.Fprintf(&b, "\n**Expected result:** %s\n\n", c.Expected)
+	}
+	return strings.TrimSpace(b.String()) + "\n"
+}
+
+func mdCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+// JiraComment renders cases in Jira wiki markup for an issue comment.
+func JiraComment(cases []llm.TestCase) string {
+	var b strings.Builder
+	b.WriteString("h3. Test cases\n")
+	for i, c := range cases {
+		fmt.Fprintf(&b, "\nh4. TC-%d. %s\n*Priority:* %s\n", i+1, c.Title, c.Priority)
+		if len(c.Preconditions) > 0 {
+			b.WriteString("*Preconditions:*\n")
+			for _, p := range c.Preconditions {
+				fmt.Fprintf(&b, "* %s\n", p)
+			}
+		}
+		b.WriteString("||#||Action||Data||Expected||\n")
+		for j, s := range c.Steps {
+			fmt.Fprintf(&b, "|%d|%s|%s|%s|\n", j+1, wikiCell(s.Action), wikiCell(s.Data), wikiCell(s.Expected))
+		}
+		fmt.Fprintf(&b, "*Expected result:* %s\n", c.Expected)
+	}
+	return b.String()
+}
+
+// wikiCell escapes table separators; an empty cell needs a space to render.
+func wikiCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	s = strings.ReplaceAll(s, "\n", " ")
+	if strings.TrimSpace(s) == "" {
+		return " "
+	}
+	return s
+}
+
+// CSV writes one row per step, repeating the case columns, which is the
+// layout test-management CSV importers expect.
+func CSV(cases []llm.TestCase) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"TC", "Issue", "Title", "Priority", "Preconditions", "Step", "Action", "Data", "Step Expected", "Expected Result"})
+	for i, c := range cases {
+		tc := fmt.Sprintf("TC-%d", i+1)
+		pre := strings.Join(c.Preconditions, "\n")
+		steps := c.Steps
+		if len(steps) == 0 {
+			steps = []llm.TestStep{{}}
+		}
+		for j, s := range steps {
+			_ = w.Write([]string{tc, c.IssueKey, c.Title, c.Priority, pre, fmt.Sprint(j + 1), s.Action, s.Data, s.Expected, c.Expected})
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// Xray renders the Xray (Server/DC) bulk test import format: manual tests in
+// the project of the covered issue, linked to it with the "Tests" link.
+func Xray(cases []llm.TestCase) ([]byte, error) {
+	type step struct {
+		Index  int    `json:"index"`
+		Action string `json:"action"`
+		Data   string `json:"data"`
+		Result string `json:"result"`
+	}
+	type test struct {
+		TestType string         `json:"testtype"`
+		Fields   map[string]any `json:"fields"`
+		Update   map[string]any `json:"update,omitempty"`
+		Steps    []step         `json:"steps"`
+	}
+	out := make([]test, 0, len(cases))
+	for _, c := range cases {
+		t := test{
+			TestType: "Manual",
+			Fields: map[string]any{
+				"summary":     c.Title,
+				"description": description(c),
+				"priority":    map[string]string{"name": c.Priority},
+			},
+			Steps: []step{},
+		}
+		if project := projectKey(c.IssueKey); project != "" {
+			t.Fields["project"] = map[string]string{"key": project}
+			t.Update = map[string]any{"issuelinks": []any{map[string]any{"add": map[string]any{
+				"type":         map[string]string{"name": "Tests"},
+				"outwardIssue": map[string]string{"key": c.IssueKey},
+			}}}}
+		}
+		for j, s := range c.Steps {
+			t.Steps = append(t.Steps, step{Index: j + 1, Action: s.Action, Data: s.Data, Result: s.Expected})
+		}
+		out = append(out, t)
+	}
+	return json.MarshalIndent(out, "", "  ")
+}
+
+// Zephyr renders test cases in the Zephyr Scale (TM4J) REST format with a
+// step-by-step script and a link to the covered issue.
+func Zephyr(cases []llm.TestCase) ([]byte, error) {
+	type step struct {
+		Description    string `json:"description"`
+		TestData       string `json:"testData"`
+		ExpectedResult string `json:"expectedResult"`
+	}
+	type script struct {
+		Type  string `json:"type"`
+		Steps []step `json:"steps"`
+	}
+	type test struct {
+		ProjectKey   string   `json:"projectKey,omitempty"`
+		Name         string   `json:"name"`
+		Objective    string   `json:"objective"`
+		Precondition string   `json:"precondition"`
+		Priority     string   `json:"priority"`
+		IssueLinks   []string `json:"issueLinks,omitempty"`
+		TestScript   script   `json:"testScript"`
+	}
+	out := make([]test, 0, len(cases))
+	for _, c := range cases {
+		t := test{
+			ProjectKey:   projectKey(c.IssueKey),
+			Name:         c.Title,
+			Objective:    c.Expected,
+			Precondition: strings.Join(c.Preconditions, "\n"),
+			Priority:     c.Priority,
+			TestScript:   script{Type: "STEP_BY_STEP", Steps: []step{}},
+		}
+		if c.IssueKey != "" {
+			t.IssueLinks = []string{c.IssueKey}
+		}
+		for _, s := range c.Steps {
+			t.TestScript.Steps = append(t.TestScript.Steps, step{Description: s.Action, TestData: s.Data, ExpectedResult: s.Expected})
+		}
+		out = append(out, t)
+	}
+	return json.MarshalIndent(out, "", "  ")
+}
+
+// description is the free-text part of a case for tools without dedicated
+// precondition and expected-result fields.
+func description(c llm.TestCase) string {
+	var b strings.Builder
+	if len(c.Preconditions) > 0 {
+		b.WriteString("Preconditions:\n")
+		for _, p := range c.Preconditions {
+			fmt.Fprintf(&b, "* %s\n", p)
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "Expected result: %s", c.Expected)
+	return b.String()
+}
+
+func projectKey(issueKey string) string {
+	if i := strings.LastIndex(issueKey, "-"); i > 0 {
+		return issueKey[:i]
+	}
+	return ""
+}
+
+// ByIssue groups cases by issue key, keeping the order of first appearance.
+func ByIssue(cases []llm.TestCase) ([]string, map[string][]llm.TestCase) {
+	var keys []string
+	groups := map[string][]llm.TestCase{}
+	for _, c := range cases {
+		if _, ok := groups[c.IssueKey]; !ok {
+			keys = append(keys, c.IssueKey)
+		}
+		groups[c.IssueKey] = append(groups[c.IssueKey], c)
+	}
+	return keys, groups
+}
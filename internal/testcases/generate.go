@@ -0,0 +1,130 @@
+// Package testcases generates structured test cases from Jira issues and
+// exports them for people (Markdown, Jira comments) and test-management tools
+// (CSV, Xray and Zephyr Scale JSON imports).
+package testcases
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/analysis"
+	"github.com/alekseymerzlyakov/jira/internal/history"
+	"github.com/alekseymerzlyakov/jira/internal/llm"
+)
+
+// DefaultMaxIssues bounds how many issues one run writes test cases for.
+const DefaultMaxIssues = 10
+
+// Generator writes test cases for issues one by one.
+type Generator struct {
+	Provider  llm.TestCaseWriter
+	Fetcher   analysis.Fetcher
+	MaxIssues int
+	// Progress, when set, is called as the step starts ("running"), advances and ends.
+	Progress func(history.Step)
+}
+
+// Result is the generated cases plus the step that produced them.
+type Result struct {
+	Cases  []llm.TestCase
+	Failed map[string]string // issue key -> error
+	Step   history.Step
+	Usage  llm.Usage
+}
+
+// Run fetches each issue and asks the model for its test cases. Issues that
+// fail are reported in Result.Failed; Run fails only when none succeeded.
+func (g Generator) Run(ctx context.Context, instruction string, keys []string) (Result, error) {
+	res := Result{Failed: map[string]string{}}
+	maxIssues := g.MaxIssues
+	if maxIssues <= 0 {
+		maxIssues = DefaultMaxIssues
+	}
+	skipped := 0
+	if len(keys) > maxIssues {
+		skipped = len(keys) - maxIssues
+		keys = keys[:maxIssues]
+	}
+	step := history.Step{Name: "Generate test cases", Description: fmt.Sprintf("0/%d issues", len(keys))}
+	g.emit(&step, "running")
+	if len(keys) == 0 {
+		step.Description = "No issues"
+		g.emit(&step, "failed")
+		res.Step = step
+		return res, fmt.Errorf("no issues to write test cases for")
+	}
+
+	var m llm.Meter
+	mctx := llm.WithMeter(ctx, &m)
+	now := time.Now().UTC()
+	for i, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		d, err := analysis.FetchDossier(ctx, g.Fetcher, key, now, 0)
+		if err == nil {
+			var dossier []byte
+			dossier, err = json.Marshal(d)
+			if err == nil {
+				var cases []llm.TestCase
+				cases, err = g.Provider.GenerateTestCases(mctx, instruction, dossier)
+				for _, c := range cases {
+					if c.IssueKey == "" {
+						c.IssueKey = key
+					}
+					res.Cases = append(res.Cases, c)
+				}
+			}
+		}
+		if err != nil {
+			res.Failed[key] = err.Error()
+		}
+		step.Description = fmt.Sprintf("%d/%d issues", i+1, len(keys))
+		g.emit(&step, "running")
+	}
+
+	res.Usage = m.Total()
+	step.Usage = analysis.StepUsage(res.Usage)
+	step.Description = fmt.Sprintf("%d test case(s) for %d issue(s), %d failed", len(res.Cases), len(keys)-len(res.Failed), len(res.Failed))
+	if skipped > 0 {
+		step.Description += fmt.Sprintf(", %d skipped over the limit of %d", skipped, maxIssues)
+	}
+	step.Result = marshalResult(res.Cases, res.Failed)
+	if len(res.Cases) == 0 {
+		g.emit(&step, "failed")
+		res.Step = step
+		return res, fmt.Errorf("no test cases were generated")
+	}
+	g.emit(&step, "completed")
+	res.Step = step
+	return res, nil
+}
+
+func (g Generator) emit(step *history.Step, status string) {
+	step.Status = status
+	if g.Progress != nil {
+		g.Progress(*step)
+	}
+}
+
+// StepResult is the JSON stored in a test-case step's Result.
+type StepResult struct {
+	Cases  []llm.TestCase    `json:"cases"`
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+func marshalResult(cases []llm.TestCase, failed map[string]string) json.RawMessage {
+	b, _ := json.Marshal(StepResult{Cases: cases, Failed: failed})
+	return b
+}
+
+// FromStep reads the cases stored by Run in a step result.
+func FromStep(raw json.RawMessage) ([]llm.TestCase, error) {
+	var r StepResult
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return nil, err
+	}
+	return r.Cases, nil
+}
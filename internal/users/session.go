@@ -0,0 +1,78 @@
+package users
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Session is a logged-in browser.
+type Session struct {
+	ID        string    `json:"-"`
+	Login     string    `json:"login"`
+	CSRF      string    `json:"-"` // sent back in X-CSRF-Token on changing requests
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Sessions keeps login sessions in memory; a restart logs everyone out.
+type Sessions struct {
+	ttl time.Duration
+	mu  sync.Mutex
+	m   map[string]Session
+}
+
+func NewSessions(ttl time.Duration) *Sessions {
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &Sessions{ttl: ttl, m: make(map[string]Session)}
+}
+
+// Create starts a session for login.
+func (s *Sessions) Create(login string) (Session, error) {
+	buf := make([]byte, 48)
+	if _, err := rand.Read(buf); err != nil {
+		return Session{}, err
+	}
+	now := time.Now().UTC()
+	sess := Session{
+		ID:        hex.EncodeToString(buf[:32]),
+		Login:     login,
+		CSRF:      hex.EncodeToString(buf[32:]),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.ttl),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, v := range s.m {
+		if now.After(v.ExpiresAt) {
+			delete(s.m, id)
+		}
+	}
+	s.m[sess.ID] = sess
+	return sess, nil
+}
+
+// Get returns the live session with the given ID.
+func (s *Sessions) Get(id string) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.m[id]
+	if !ok {
+		return Session{}, false
+	}
+	if time.Now().After(sess.ExpiresAt) {
+		delete(s.m, id)
+		return Session{}, false
+	}
+	return sess, true
+}
+
+// Delete ends a session.
+func (s *Sessions) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, id)
+}
@@ -0,0 +1,214 @@
+// Package users keeps the Jira accounts of a multi-user server: credentials
+// encrypted at rest and login sessions.
+package users
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alekseymerzlyakov/jira/internal/secrets"
+)
+
+// ErrNotFound is returned for an unknown login.
+var ErrNotFound = errors.New("user not found")
+
+// User is a Jira account that has logged in to the server.
+type User struct {
+	Login       string    `json:"login"`
+	DisplayName string    `json:"displayName,omitempty"`
+	Secret      string    `json:"secret"` // password sealed with the store key, base64
+	CreatedAt   time.Time `json:"createdAt"`
+	LastLogin   time.Time `json:"lastLogin"`
+}
+
+// Store persists users to a JSON file. Passwords are sealed with AES-256-GCM
+// so the file alone does not reveal them.
+type Store struct {
+	path string
+	aead cipher.AEAD
+	mu   sync.Mutex
+	list []User
+}
+
+// OpenStore loads the users file at path; key must be 32 bytes.
+func OpenStore(path string, key []byte) (*Store, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("users key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{path: path, aead: aead}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, &s.list); err != nil {
+			return nil, fmt.Errorf("users: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Save stores or updates the user's credentials after a successful login.
+func (s *Store) Save(login, displayName, password string) (User, error) {
+	secret, err := s.seal(login, password)
+	if err != nil {
+		return User{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	for i := range s.list {
+		if strings.EqualFold(s.list[i].Login, login) {
+			s.list[i].DisplayName = displayName
+			s.list[i].Secret = secret
+			s.list[i].LastLogin = now
+			return s.list[i], s.save()
+		}
+	}
+	u := User{Login: login, DisplayName: displayName, Secret: secret, CreatedAt: now, LastLogin: now}
+	s.list = append(s.list, u)
+	return u, s.save()
+}
+
+// Get returns the user with the given login.
+func (s *Store) Get(login string) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.list {
+		if strings.EqualFold(u.Login, login) {
+			return u, true
+		}
+	}
+	return User{}, false
+}
+
+// List returns all users ordered by login.
+func (s *Store) List() []User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]User, len(s.list))
+	copy(out, s.list)
+	sort.Slice(out, func(i, j int) bool { return out[i].Login < out[j].Login })
+	return out
+}
+
+// Password decrypts the stored Jira password of login.
+func (s *Store) Password(login string) (string, error) {
+	u, ok := s.Get(login)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return s.open(u.Login, u.Secret)
+}
+
+// seal encrypts password; the login is bound as additional data so a secret
+// cannot be copied to another user.
+func (s *Store) seal(login, password string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	out := s.aead.Seal(nonce, nonce, []byte(password), []byte(strings.ToLower(login)))
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+func (s *Store) open(login, secret string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil || len(data) < s.aead.NonceSize() {
+		return "", errors.New("users: malformed secret")
+	}
+	n := s.aead.NonceSize()
+	plain, err := s.aead.Open(nil, data[:n], data[n:], []byte(strings.ToLower(login)))
+	if err != nil {
+		return "", errors.New("users: cannot decrypt credentials (wrong USERS_KEY?)")
+	}
+	return string(plain), nil
+}
+
+func (s *Store) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s.list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o600)
+}
+
+// ErrNoKey means neither USERS_KEY nor a master key to derive it from is
+// configured.
+var ErrNoKey = errors.New("users: USERS_KEY is not set")
+
+// LoadKey decodes the 32-byte credentials key from spec (hex or base64).
+// The key is never generated or stored next to the credentials it protects.
+func LoadKey(spec string) ([]byte, error) {
+	if spec = strings.TrimSpace(spec); spec == "" {
+		return nil, ErrNoKey
+	}
+	return secrets.DecodeKey(spec)
+}
+
+// DeriveKey derives the credentials key from the secrets master key, so the
+// two keys differ even though one secret protects both.
+func DeriveKey(master []byte) []byte {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte("jira users credentials v1"))
+	return mac.Sum(nil)
+}
+
+// DirName turns a login into a directory name for the user's data. It is
+// injective on lowercased logins: letters, digits, '-' and a non-leading
+// '.' are kept and every other byte, '_' included, becomes "_xx" (hex), so
+// "a@b", "a+b" and "a_b" get different directories.
+func DirName(login string) string {
+	var b strings.Builder
+	for i, c := range []byte(strings.ToLower(login)) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '.' && i > 0:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "_%02x", c)
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+// LegacyDirName is the lossy name DirName produced before it became
+// injective; it is only used to point users at data left under it.
+func LegacyDirName(login string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(login) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 || strings.Trim(b.String(), ".") == "" {
+		return "_" + hex.EncodeToString([]byte(login))
+	}
+	return b.String()
+}
@@ -0,0 +1,40 @@
+package users
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDirName(t *testing.T) {
+	cases := map[string]string{
+		"Ann":      "ann",
+		"ann.lee":  "ann.lee",
+		"ann-lee":  "ann-lee",
+		"a@b":      "a_40b",
+		"a+b":      "a_2bb",
+		"a_b":      "a_5fb",
+		"a_40b":    "a_5f40b",
+		".hidden":  "_2ehidden",
+		"../x":     "_2e._2fx",
+		"Ян":       "_d1_8f_d0_bd",
+		"":         "_",
+		"a b\\c/d": "a_20b_5cc_2fd",
+	}
+	seen := map[string]string{}
+	for login, want := range cases {
+		got := DirName(login)
+		if got != want {
+			t.Errorf("DirName(%q) = %q, want %q", login, got, want)
+		}
+		if strings.ContainsAny(got, `/\`) || got == "." || got == ".." {
+			t.Errorf("DirName(%q) = %q is not a plain directory name", login, got)
+		}
+		if other, ok := seen[got]; ok {
+			t.Errorf("DirName(%q) = DirName(%q) = %q", login, other, got)
+		}
+		seen[got] = login
+	}
+	if DirName("ANN") != DirName("ann") {
+		t.Error("DirName is case-sensitive")
+	}
+}
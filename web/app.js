@@ -13,6 +13,7 @@ const outputEl = document.getElementById("output");
 const projectsBox = document.getElementById("projectsBox");
 const usersBox = document.getElementById("usersBox");
 const previewBtn = document.getElementById("preview");
+const planBtn = document.getElementById("plan");
 const analysisFlag = document.getElementById("analysis");
 const showRawFlag = document.getElementById("showRaw");
 const queryInput = document.getElementById("query");
@@ -36,8 +37,23 @@ const historyDetailEl = document.getElementById("historyDetail");
 const commandInput = document.getElementById("commandInput");
 const commandRunBtn = document.getElementById("commandRun");
 const commandOutput = document.getElementById("commandOutput");
+const testCasesBtn = document.getElementById("testCasesRun");
+const testCasesAttach = document.getElementById("testCasesAttach");
+const commandModeSelect = document.getElementById("commandMode");
+const threadForkBtn = document.getElementById("threadFork");
+const threadClearBtn = document.getElementById("threadClear");
+const historySemanticInput = document.getElementById("historySemantic");
+const historySemanticBtn = document.getElementById("historySemanticRun");
+const historySemanticReset = document.getElementById("historySemanticReset");
+const historyFilterInput = document.getElementById("historyFilter");
+const historyTagInput = document.getElementById("historyTag");
+const historyPinnedInput = document.getElementById("historyPinned");
+const historyMoreBtn = document.getElementById("historyMore");
 let historyEntries = [];
+let historyNextCursor = "";
 let currentHistoryId = null;
+const llmProviderSelect = document.getElementById("llmProvider");
+const llmModelInput = document.getElementById("llmModel");
 
 // Если пользователь меняет текст запроса — сбрасываем JQL, чтобы не прилипало старое.
 queryInput.addEventListener("input", () => {
@@ -57,18 +73,47 @@ function buildPayload(dryRun = false) {
     users: getCheckedValues("usersBox", USER_LIST.map((u) => u.key)),
     dryRun,
     analysis: analysisFlag.checked,
+    ...llmSelection(),
   };
 }
 
+function llmSelection() {
+  return {
+    provider: llmProviderSelect ? llmProviderSelect.value : "",
+    model: llmModelInput ? llmModelInput.value.trim() : "",
+  };
+}
+
+async function loadProviders() {
+  if (!llmProviderSelect) return;
+  try {
+    const res = await fetch("/api/llm/providers");
+    if (!res.ok) return;
+    const data = await res.json();
+    (Array.isArray(data) ? data : []).forEach((p) => {
+      const opt = document.createElement("option");
+      opt.value = p.name;
+      opt.textContent = p.defaultModel ? `${p.name} (${p.defaultModel})` : p.name;
+      llmProviderSelect.appendChild(opt);
+    });
+  } catch (err) {
+    console.error("loadProviders", err);
+  }
+}
+
 previewBtn.addEventListener("click", async () => {
   await runSearch(true);
 });
 
+planBtn.addEventListener("click", async () => {
+  await previewPlan();
+});
+
 runBtn.addEventListener("click", async () => {
   await runSearch(false);
 });
 
-async function runSearch(dryRun) {
+async function runSearch(dryRun, confirmed = false) {
   const q = getQueryValue();
   if (isWorklogQuery(q)) {
     await runWorklogCommand(dryRun, q);
@@ -78,18 +123,37 @@ async function runSearch(dryRun) {
   statusEl.textContent = dryRun ? "Previewing..." : "Running...";
   outputEl.textContent = "";
   const payload = buildPayload(dryRun);
+  payload.confirmed = confirmed;
 
   try {
-    const res = await fetch("/api/search", {
-      method: "POST",
-      headers: { "Content-Type": "application/json" },
-      body: JSON.stringify(payload),
-    });
-    const data = await res.json();
-    if (!res.ok) {
-      throw new Error(data.error || res.statusText);
+    let data;
+    if (dryRun) {
+      const res = await fetch("/api/search", {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify(payload),
+      });
+      data = await res.json();
+      if (!res.ok) {
+        throw new Error(data.error || res.statusText);
+      }
+    } else {
+      data = await streamSearch(payload);
     }
     document.getElementById("jql").value = data.jql; // show final JQL
+    if (data.needsConfirmation) {
+      const d = data.derivation || {};
+      const msg =
+        `Модель не уверена в JQL (confidence ${formatConfidence(d.confidence)}).\n\n${data.jql}\n\n` +
+        `${d.explanation || ""}${formatAssumptions(d.assumptions)}\n\nВыполнить?`;
+      if (window.confirm(msg)) {
+        await runSearch(false, true);
+      } else {
+        statusEl.textContent = "JQL не подтверждён — поправь запрос или JQL";
+        outputEl.textContent = `JQL: ${data.jql}\n\n${formatDerivation(d)}`;
+      }
+      return;
+    }
     const rawText =
       data.raw && showRawFlag.checked
         ? typeof data.raw === "string"
@@ -97,11 +161,17 @@ async function runSearch(dryRun) {
           : JSON.stringify(data.raw, null, 2)
         : "";
     statusEl.textContent = dryRun ? `Preview JQL ready` : `OK, executed`;
-    const analysisBlock = data.analysis ? `Analysis:\n${data.analysis}\n\n` : "";
+    const derivationBlock = data.derivation ? formatDerivation(data.derivation) : "";
+    const analysisBlock = data.report
+      ? formatReport(data.report)
+      : data.analysis
+        ? `Analysis:\n${data.analysis}\n\n`
+        : "";
+    const reviewsBlock = formatReviews(data.reviews);
     const linksBlock = buildIssuesList(data.raw, data.issues);
     const totalBlock = data.total ? `Total: ${data.total}\n\n` : "";
     const rawBlock = rawText ? `Raw:\n${rawText}` : "";
-    outputEl.textContent = `JQL: ${data.jql}\n\n${totalBlock}${analysisBlock}${linksBlock}${rawBlock}`;
+    outputEl.textContent = `JQL: ${data.jql}\n\n${derivationBlock}${totalBlock}${analysisBlock}${reviewsBlock}${linksBlock}${rawBlock}`;
     renderSteps(data.steps || []);
     if (!dryRun) {
       if (data.historyId) {
@@ -115,6 +185,50 @@ async function runSearch(dryRun) {
   }
 }
 
+function formatReviews(reviews) {
+  if (!reviews || !reviews.length) return "";
+  const list = (title, items) => (items && items.length ? `\n  ${title}: ${items.join("; ")}` : "");
+  const lines = reviews.map(
+    (r) =>
+      `${r.key}: ${r.summary}` +
+      list("Риски", r.risks) +
+      list("Не хватает AC", r.missingAcceptanceCriteria) +
+      (r.staleness ? `\n  Застой: ${r.staleness}` : "") +
+      (r.recommendation ? `\n  → ${r.recommendation}` : ""),
+  );
+  return `По задачам:\n${lines.join("\n")}\n\n`;
+}
+
+function formatConfidence(value) {
+  return typeof value === "number" ? `${Math.round(value * 100)}%` : "?";
+}
+
+function formatAssumptions(list) {
+  if (!list || !list.length) return "";
+  return `\nДопущения:\n${list.map((a) => `- ${a}`).join("\n")}`;
+}
+
+function formatDerivation(d) {
+  const low = typeof d.confidence === "number" && d.confidence < 0.5 ? " ⚠ низкая уверенность" : "";
+  const explanation = d.explanation ? `${d.explanation}\n` : "";
+  return `Confidence: ${formatConfidence(d.confidence)}${low}\n${explanation}${formatAssumptions(d.assumptions)}\n\n`;
+}
+
+function formatReport(r) {
+  const lines = ["Analysis:"];
+  if (r.summary) lines.push(r.summary);
+  (r.totals || []).forEach((t) => lines.push(`${t.label}: ${t.value}`));
+  if (r.issues && r.issues.length) {
+    lines.push("");
+    r.issues.forEach((i) => lines.push(`- ${i.key}: ${i.title}${i.note ? ` — ${i.note}` : ""}`));
+  }
+  if (r.warnings && r.warnings.length) {
+    lines.push("");
+    r.warnings.forEach((w) => lines.push(`⚠ ${w}`));
+  }
+  return `${lines.join("\n")}\n\n`;
+}
+
 async function runWorklogCommand(dryRun, queryText, durationText = "", dateText = "") {
   statusEl.textContent = dryRun ? "Previewing..." : "Running...";
   outputEl.textContent = "";
@@ -194,6 +308,64 @@ async function runWorklogCommand(dryRun, queryText, durationText = "", dateText
   }
 }
 
+// With AUTH_REQUIRED (or in multi-user mode) show the login form until there
+// is a session, and again whenever the server answers 401. Changing requests
+// carry the session's CSRF token.
+const loginPanel = document.getElementById("loginPanel");
+const layoutEl = document.querySelector("main.layout");
+const logoutBtn = document.getElementById("logout");
+
+function showLogin(message = "") {
+  loginPanel.hidden = false;
+  layoutEl.hidden = true;
+  document.getElementById("loginError").textContent = message;
+  document.getElementById("loginUser").focus();
+}
+
+let signedIn = false;
+let csrfToken = "";
+const plainFetch = window.fetch.bind(window);
+window.fetch = async (input, init = {}) => {
+  const method = (init.method || "GET").toUpperCase();
+  if (csrfToken && method !== "GET" && method !== "HEAD") {
+    init = { ...init, headers: { ...(init.headers || {}), "X-CSRF-Token": csrfToken } };
+  }
+  const res = await plainFetch(input, init);
+  const url = typeof input === "string" ? input : input.url;
+  if (res.status === 401 && signedIn && url.startsWith("/api/")) {
+    signedIn = false;
+    showLogin("Сессия истекла, войдите снова");
+  }
+  return res;
+};
+
+async function login() {
+  const username = document.getElementById("loginUser").value.trim();
+  const password = document.getElementById("loginPassword").value;
+  const res = await plainFetch("/api/login", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ username, password }),
+  });
+  if (!res.ok) {
+    const data = await res.json().catch(() => ({}));
+    document.getElementById("loginError").textContent = data.error || res.statusText;
+    return;
+  }
+  location.reload();
+}
+
+async function logout() {
+  await plainFetch("/api/logout", { method: "POST" });
+  location.reload();
+}
+
+document.getElementById("loginSubmit").addEventListener("click", login);
+document.getElementById("loginPassword").addEventListener("keydown", (e) => {
+  if (e.key === "Enter") login();
+});
+logoutBtn.addEventListener("click", logout);
+
 async function loadMyself() {
   try {
     const res = await fetch("/api/myself");
@@ -294,13 +466,34 @@ function renderUsers() {
 }
 
 // initial call
-loadMyself();
-renderUsers();
-loadProjects();
-loadPhrases().then(renderPhrases);
-loadHistoryEntries();
+async function start() {
+  try {
+    const res = await plainFetch("/api/session");
+    const session = await res.json();
+    if (session.authRequired && !session.login) {
+      showLogin();
+      return;
+    }
+    csrfToken = session.csrfToken || "";
+    logoutBtn.hidden = !session.csrfToken;
+  } catch (err) {
+    statusEl.textContent = `Session error: ${err.message}`;
+  }
+  signedIn = true;
+  loadMyself();
+  renderUsers();
+  loadProjects();
+  loadPhrases().then(renderPhrases);
+  loadHistoryEntries();
+  loadProviders();
+  loadSavedSearches();
+}
+start();
 if (commandRunBtn) {
   commandRunBtn.addEventListener("click", executeCommand);
+  if (testCasesBtn) testCasesBtn.addEventListener("click", generateTestCases);
+  if (threadForkBtn) threadForkBtn.addEventListener("click", forkThread);
+  if (threadClearBtn) threadClearBtn.addEventListener("click", clearThread);
 }
 // Ensure buttons are correct on first paint even before phrases load.
 updateActionButtons();
@@ -339,6 +532,11 @@ async function handleProjectChange() {
   currentProjectKey = selected[0];
   try {
     const res = await fetch(`/api/projects/${selected[0]}/sprints?limit=5`);
+    if (res.status === 409) {
+      const body = await res.json().catch(() => ({}));
+      renderBoardChoice(selected[0], body.boards || []);
+      return;
+    }
     if (!res.ok) {
       renderSprints([], true);
       return;
@@ -356,6 +554,33 @@ async function handleProjectChange() {
   }
 }
 
+// renderBoardChoice asks which scrum board a project with several boards
+// uses; the choice is saved on the server and the sprints are reloaded.
+function renderBoardChoice(projectKey, boards) {
+  sprintsBox.innerHTML = "";
+  const label = document.createElement("div");
+  label.style.fontSize = "12px";
+  label.textContent = `У проекта ${projectKey} несколько бордов — выберите, откуда брать спринты:`;
+  sprintsBox.appendChild(label);
+  const select = document.createElement("select");
+  select.innerHTML = `<option value="">— борд —</option>` + boards.map((b) => `<option value="${b.id}">${b.name} (#${b.id})</option>`).join("");
+  select.addEventListener("change", async () => {
+    if (!select.value) return;
+    const res = await fetch(`/api/projects/${projectKey}/boards`, {
+      method: "PUT",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ boardId: Number(select.value) }),
+    });
+    if (!res.ok) {
+      const body = await res.json().catch(() => ({}));
+      alert(body.error || "Не удалось сохранить борд");
+      return;
+    }
+    handleProjectChange();
+  });
+  sprintsBox.appendChild(select);
+}
+
 function renderSprints(list, hasProject = false) {
   sprintsBox.innerHTML = "";
   const all = document.createElement("label");
@@ -376,6 +601,17 @@ function renderSprints(list, hasProject = false) {
       label.querySelector("input").addEventListener("change", () => {
         selectedSprintId = Number(sp.id);
       });
+      if (sp.state !== "future") {
+        const report = document.createElement("a");
+        report.href = "#";
+        report.textContent = " отчёт";
+        report.style.fontSize = "12px";
+        report.addEventListener("click", (e) => {
+          e.preventDefault();
+          showSprintReport(sp.id);
+        });
+        label.appendChild(report);
+      }
       sprintsBox.appendChild(label);
     });
   }
@@ -392,6 +628,42 @@ function renderSprints(list, hasProject = false) {
   });
 }
 
+// showSprintReport prints the sprint report and its retrospective in the
+// output panel.
+async function showSprintReport(sprintId) {
+  statusEl.textContent = "Собираю отчёт по спринту...";
+  outputEl.textContent = "";
+  const params = new URLSearchParams({
+    retro: "1",
+    provider: llmProviderSelect ? llmProviderSelect.value : "",
+    model: llmModelInput ? llmModelInput.value.trim() : "",
+  });
+  try {
+    const res = await fetch(`/api/sprints/${sprintId}/report?${params}`);
+    const data = await res.json();
+    if (!res.ok) throw new Error(data.error || res.statusText);
+    const r = data.report;
+    const pts = (t) => (r.pointsField ? `${t.issues} задач, ${t.points} SP` : `${t.issues} задач`);
+    const lines = [
+      `${r.sprint.name} (${r.sprint.state})`,
+      `Обещано: ${pts(r.committed)}`,
+      `Сделано: ${pts(r.completed)} — ${Math.round(r.completionRate * 100)}%`,
+      `Добавлено: ${r.added.join(", ") || "—"}`,
+      `Убрано: ${r.removed.join(", ") || "—"}`,
+      `Перенесено дальше: ${r.carryOver.join(", ") || "—"}`,
+      `Списано времени: ${r.totalLogged || "0"}`,
+      ...(r.timeByPerson || []).map((p) => `  ${p.person}: ${p.time}`),
+    ];
+    if (r.warnings && r.warnings.length) lines.push("", ...r.warnings.map((w) => `! ${w}`));
+    if (data.retrospectiveText) lines.push("", "Ретроспектива:", data.retrospectiveText);
+    else if (data.retrospectiveError) lines.push("", `Ретроспектива недоступна: ${data.retrospectiveError}`);
+    outputEl.textContent = lines.join("\n");
+    statusEl.textContent = "Отчёт по спринту готов";
+  } catch (err) {
+    statusEl.textContent = `Error: ${err.message}`;
+  }
+}
+
 function getQueryValue() {
   return selectedPhraseText || queryInput.value;
 }
@@ -591,16 +863,116 @@ phraseCancelBtn.addEventListener("click", () => {
   renderPhrases();
 });
 
-async function loadHistoryEntries() {
+const savedNameInput = document.getElementById("savedName");
+const savedScheduleInput = document.getElementById("savedSchedule");
+const savedSaveBtn = document.getElementById("savedSave");
+const savedListEl = document.getElementById("savedList");
+
+// loadSavedSearches lists saved searches with their schedule and last run.
+async function loadSavedSearches() {
+  if (!savedListEl) return;
+  try {
+    const res = await fetch("/api/saved");
+    const data = await res.json();
+    savedListEl.innerHTML = "";
+    if (!data.searches.length) {
+      savedListEl.textContent = "Нет сохранённых поисков";
+      return;
+    }
+    data.searches.forEach((s) => {
+      const item = document.createElement("div");
+      item.className = "history-item";
+      const text = document.createElement("div");
+      const title = document.createElement("strong");
+      title.textContent = s.name;
+      const small = document.createElement("small");
+      const last = s.lastRun ? `последний запуск ${formatDate(s.lastRun)}` : "ещё не запускался";
+      small.textContent = `${s.schedule || "вручную"} · ${last}${s.lastError ? ` · ошибка: ${s.lastError}` : ""}`;
+      text.append(title, document.createElement("br"), small);
+      const runBtn = document.createElement("button");
+      runBtn.textContent = "Запустить";
+      runBtn.addEventListener("click", () => runSavedSearch(s.id, runBtn));
+      const delBtn = document.createElement("button");
+      delBtn.textContent = "Удалить";
+      delBtn.addEventListener("click", async () => {
+        if (!confirm(`Удалить «${s.name}»?`)) return;
+        await fetch(`/api/saved/${s.id}`, { method: "DELETE" });
+        loadSavedSearches();
+      });
+      item.append(text, runBtn, delBtn);
+      savedListEl.appendChild(item);
+    });
+  } catch (err) {
+    savedListEl.textContent = "Не удалось загрузить сохранённые поиски";
+    console.error("loadSavedSearches", err);
+  }
+}
+
+async function saveCurrentSearch() {
+  const name = savedNameInput.value.trim();
+  if (!name) {
+    statusEl.textContent = "Укажи название сохранённого поиска";
+    return;
+  }
+  const { dryRun, ...payload } = buildPayload();
+  const res = await fetch("/api/saved", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ ...payload, name, schedule: savedScheduleInput.value.trim() }),
+  });
+  const data = await res.json();
+  if (!res.ok) {
+    statusEl.textContent = `Не удалось сохранить: ${data.error || res.status}`;
+    return;
+  }
+  savedNameInput.value = "";
+  savedScheduleInput.value = "";
+  loadSavedSearches();
+}
+
+async function runSavedSearch(id, button) {
+  button.disabled = true;
+  statusEl.textContent = "Выполняю сохранённый поиск...";
+  try {
+    const res = await fetch(`/api/saved/${id}/run`, { method: "POST" });
+    const data = await res.json();
+    if (!res.ok) {
+      statusEl.textContent = `Ошибка: ${data.error || res.status}`;
+      return;
+    }
+    statusEl.textContent = data.notifyError
+      ? `Найдено ${data.total}, но отчёт не доставлен: ${data.notifyError}`
+      : `Найдено ${data.total}, отчёт отправлен`;
+    await loadHistoryEntries();
+    await loadHistoryEntry(data.entryId);
+  } finally {
+    button.disabled = false;
+    loadSavedSearches();
+  }
+}
+
+if (savedSaveBtn) savedSaveBtn.addEventListener("click", saveCurrentSearch);
+
+// loadHistoryEntries loads the first page of history matching the filters;
+// with more=true it appends the next page instead.
+async function loadHistoryEntries(more = false) {
   if (!historyListEl) return;
+  const params = new URLSearchParams();
+  if (historyFilterInput?.value.trim()) params.set("q", historyFilterInput.value.trim());
+  if (historyTagInput?.value.trim()) params.set("tag", historyTagInput.value.trim());
+  if (historyPinnedInput?.checked) params.set("pinned", "1");
+  if (more && historyNextCursor) params.set("cursor", historyNextCursor);
   try {
-    const res = await fetch("/api/history");
+    const res = await fetch(`/api/history?${params}`);
     if (!res.ok) {
       historyListEl.textContent = "Не удалось загрузить историю";
       return;
     }
     const data = await res.json();
-    historyEntries = Array.isArray(data) ? data : [];
+    const entries = Array.isArray(data.entries) ? data.entries : [];
+    historyEntries = more ? historyEntries.concat(entries) : entries;
+    historyNextCursor = data.nextCursor || "";
+    if (historyMoreBtn) historyMoreBtn.hidden = !historyNextCursor;
     renderHistoryList(historyEntries);
   } catch (err) {
     historyListEl.textContent = "Не удалось загрузить историю";
@@ -608,6 +980,128 @@ async function loadHistoryEntries() {
   }
 }
 
+[historyFilterInput, historyTagInput].forEach((input) => {
+  if (!input) return;
+  input.addEventListener("keydown", (e) => {
+    if (e.key === "Enter") loadHistoryEntries();
+  });
+});
+if (historyPinnedInput) historyPinnedInput.addEventListener("change", () => loadHistoryEntries());
+if (historyMoreBtn) historyMoreBtn.addEventListener("click", () => loadHistoryEntries(true));
+
+// patchHistoryEntry renames, pins or re-tags an entry and refreshes the views.
+async function patchHistoryEntry(entryId, patch) {
+  const res = await fetch(`/api/history/${entryId}`, {
+    method: "PATCH",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(patch),
+  });
+  const data = await res.json();
+  if (!res.ok) {
+    alert(`Ошибка: ${data.error || res.status}`);
+    return;
+  }
+  renderHistoryEntryDetail(data);
+  await loadHistoryEntries();
+}
+
+async function deleteHistoryEntry(entryId) {
+  if (!confirm("Удалить запись из истории?")) return;
+  const res = await fetch(`/api/history/${entryId}`, { method: "DELETE" });
+  if (!res.ok) {
+    alert(`Ошибка ${res.status}`);
+    return;
+  }
+  if (currentHistoryId === entryId) setCurrentHistoryId("");
+  renderHistoryEntryDetail(null);
+  await loadHistoryEntries();
+}
+
+// rerunHistoryEntry runs the entry's JQL again and opens the new entry with
+// the diff against the stored snapshot.
+async function rerunHistoryEntry(entryId, button) {
+  button.disabled = true;
+  try {
+    const res = await fetch(`/api/history/${entryId}/rerun`, { method: "POST" });
+    const data = await res.json();
+    if (!res.ok) {
+      alert(`Ошибка: ${data.error || res.status}`);
+      return;
+    }
+    await loadHistoryEntries();
+    await loadHistoryEntry(data.entry.id);
+  } catch (err) {
+    alert(`Ошибка: ${err.message}`);
+  } finally {
+    button.disabled = false;
+  }
+}
+
+function historyEntryTitle(entry) {
+  return `${entry.pinned ? "★ " : ""}${entry.title || entry.query || "Без запроса"}`;
+}
+
+// semanticHistorySearch finds entries by meaning across queries, analyses,
+// follow-ups and issue texts, and lists them with the best match.
+async function semanticHistorySearch() {
+  if (!historyListEl || !historySemanticInput) return;
+  const q = historySemanticInput.value.trim();
+  if (!q) {
+    renderHistoryList(historyEntries);
+    return;
+  }
+  try {
+    const res = await fetch(`/api/history/search?q=${encodeURIComponent(q)}`);
+    const data = await res.json();
+    if (!res.ok) {
+      historyListEl.textContent = `Ошибка: ${data.error || res.status}`;
+      return;
+    }
+    historyListEl.innerHTML = "";
+    if (data.warning) {
+      const warn = document.createElement("div");
+      warn.className = "detail-row";
+      warn.textContent = data.warning;
+      historyListEl.appendChild(warn);
+    }
+    if (!data.hits.length) {
+      historyListEl.append("Ничего не найдено");
+      return;
+    }
+    data.hits.forEach((hit) => {
+      const item = document.createElement("div");
+      item.className = "history-item";
+      const text = document.createElement("div");
+      const title = document.createElement("strong");
+      title.textContent = hit.title || hit.query || "Без запроса";
+      const match = hit.matches[0];
+      const small = document.createElement("small");
+      small.textContent = `${formatDate(hit.createdAt)} · ${hit.score.toFixed(2)} · ${match.issueKey || match.kind}: ${match.text}`;
+      text.append(title, document.createElement("br"), small);
+      const btn = document.createElement("button");
+      btn.textContent = "Открыть";
+      btn.addEventListener("click", () => loadHistoryEntry(hit.entryId));
+      item.append(text, btn);
+      historyListEl.appendChild(item);
+    });
+  } catch (err) {
+    historyListEl.textContent = `Ошибка: ${err.message}`;
+  }
+}
+
+if (historySemanticBtn) historySemanticBtn.addEventListener("click", semanticHistorySearch);
+if (historySemanticInput) {
+  historySemanticInput.addEventListener("keydown", (e) => {
+    if (e.key === "Enter") semanticHistorySearch();
+  });
+}
+if (historySemanticReset) {
+  historySemanticReset.addEventListener("click", () => {
+    historySemanticInput.value = "";
+    renderHistoryList(historyEntries);
+  });
+}
+
 function renderHistoryList(entries) {
   if (!historyListEl) return;
   historyListEl.innerHTML = "";
@@ -619,7 +1113,12 @@ function renderHistoryList(entries) {
     const item = document.createElement("div");
     item.className = "history-item";
     const text = document.createElement("div");
-    text.innerHTML = `<strong>${entry.query || "Без запроса"}</strong><br/><small>${formatDate(entry.createdAt)}</small>`;
+    const title = document.createElement("strong");
+    title.textContent = historyEntryTitle(entry);
+    const small = document.createElement("small");
+    const tags = (entry.tags || []).map((t) => `#${t}`).join(" ");
+    small.textContent = tags ? `${formatDate(entry.createdAt)} · ${tags}` : formatDate(entry.createdAt);
+    text.append(title, document.createElement("br"), small);
     const btn = document.createElement("button");
     btn.textContent = "Открыть";
     btn.addEventListener("click", async () => {
@@ -645,9 +1144,7 @@ async function loadHistoryEntry(entryId, options = {}) {
       populateOutputFromEntry(entry);
     }
     setCurrentHistoryId(entry.id);
-    if (commandOutput) {
-      commandOutput.innerHTML = "";
-    }
+    renderThread(entry.thread);
   } catch (err) {
     historyDetailEl.textContent = "Не удалось загрузить запись";
     console.error("loadHistoryEntry", err);
@@ -662,7 +1159,33 @@ function renderHistoryEntryDetail(entry) {
     return;
   }
   const title = document.createElement("h3");
-  title.textContent = entry.query || "Без запроса";
+  title.textContent = historyEntryTitle(entry);
+  const manage = document.createElement("div");
+  manage.className = "history-actions";
+  const pinBtn = document.createElement("button");
+  pinBtn.textContent = entry.pinned ? "Убрать из избранного" : "В избранное";
+  pinBtn.addEventListener("click", () => patchHistoryEntry(entry.id, { pinned: !entry.pinned }));
+  const renameBtn = document.createElement("button");
+  renameBtn.textContent = "Переименовать";
+  renameBtn.addEventListener("click", () => {
+    const name = prompt("Название записи (пусто — показывать запрос)", entry.title || entry.query || "");
+    if (name !== null) patchHistoryEntry(entry.id, { title: name });
+  });
+  const tagsInput = document.createElement("input");
+  tagsInput.type = "text";
+  tagsInput.placeholder = "Теги через запятую: анализ готов, есть баги";
+  tagsInput.value = (entry.tags || []).join(", ");
+  const tagsBtn = document.createElement("button");
+  tagsBtn.textContent = "Сохранить теги";
+  tagsBtn.addEventListener("click", () => patchHistoryEntry(entry.id, { tags: tagsInput.value.split(",") }));
+  const deleteBtn = document.createElement("button");
+  deleteBtn.textContent = "Удалить";
+  deleteBtn.addEventListener("click", () => deleteHistoryEntry(entry.id));
+  const rerunBtn = document.createElement("button");
+  rerunBtn.textContent = "Повторить и сравнить";
+  rerunBtn.disabled = !entry.jql;
+  rerunBtn.addEventListener("click", () => rerunHistoryEntry(entry.id, rerunBtn));
+  manage.append(pinBtn, renameBtn, tagsInput, tagsBtn, rerunBtn, deleteBtn);
   const meta = document.createElement("div");
   meta.className = "detail-row";
   meta.textContent = `JQL: ${entry.jql}`;
@@ -691,8 +1214,30 @@ function renderHistoryEntryDetail(entry) {
   actions.appendChild(searchInput);
   actions.appendChild(searchBtn);
   historyDetailEl.appendChild(title);
+  if (entry.title && entry.query) {
+    const queryRow = document.createElement("div");
+    queryRow.className = "detail-row";
+    queryRow.textContent = `Запрос: ${entry.query}`;
+    historyDetailEl.appendChild(queryRow);
+  }
+  historyDetailEl.appendChild(manage);
   historyDetailEl.appendChild(meta);
   historyDetailEl.appendChild(issuesRow);
+  const parentId = entry.parentId || entry.rerunOf || entry.forkedFrom;
+  if (parentId) {
+    const parentRow = document.createElement("div");
+    parentRow.className = "detail-row";
+    parentRow.append(entry.parentId ? "Уточнение записи " : entry.rerunOf ? "Повтор записи " : "Ветка диалога записи ");
+    const parentLink = document.createElement("a");
+    parentLink.href = "#";
+    parentLink.textContent = parentId;
+    parentLink.addEventListener("click", (e) => {
+      e.preventDefault();
+      loadHistoryEntry(parentId);
+    });
+    parentRow.appendChild(parentLink);
+    historyDetailEl.appendChild(parentRow);
+  }
   historyDetailEl.appendChild(actions);
   historyDetailEl.appendChild(matchesEl);
   if (entry.steps && entry.steps.length) {
@@ -749,7 +1294,7 @@ function populateOutputFromEntry(entry) {
   const analysisBlock = entry.analysis ? `Analysis:\n${entry.analysis}\n\n` : "";
   const issuesBlock = formatIssuesList(entry.issues);
   outputEl.textContent = `JQL: ${entry.jql}\n\n${analysisBlock}${issuesBlock}`;
-  renderSteps(entry.steps || []);
+  renderSteps(entry.steps || [], entry.id);
   setCurrentHistoryId(entry.id);
 }
 
@@ -759,13 +1304,138 @@ function formatIssuesList(issues) {
   return `Issues:\n${lines.join("\n")}\n\n`;
 }
 
-function renderSteps(steps) {
+// postEventStream POSTs payload and feeds each Server-Sent Event to onEvent(name, data).
+async function postEventStream(url, payload, onEvent) {
+  const res = await fetch(url, {
+    method: "POST",
+    headers: { "Content-Type": "application/json", Accept: "text/event-stream" },
+    body: JSON.stringify(payload),
+  });
+  if (!res.ok) {
+    const data = await res.json().catch(() => ({}));
+    throw new Error(data.error || res.statusText);
+  }
+  const reader = res.body.getReader();
+  const decoder = new TextDecoder();
+  let buffer = "";
+  for (;;) {
+    const { value, done } = await reader.read();
+    if (done) break;
+    buffer += decoder.decode(value, { stream: true });
+    let idx;
+    while ((idx = buffer.indexOf("\n\n")) >= 0) {
+      const block = buffer.slice(0, idx);
+      buffer = buffer.slice(idx + 2);
+      let event = "message";
+      let data = "";
+      block.split("\n").forEach((line) => {
+        if (line.startsWith("event: ")) event = line.slice(7);
+        else if (line.startsWith("data: ")) data += line.slice(6);
+      });
+      if (data) onEvent(event, JSON.parse(data));
+    }
+  }
+}
+
+// streamSearch runs /api/search/stream, filling step cards as events arrive,
+// and resolves with the final search response.
+async function streamSearch(payload) {
+  return streamSteps("/api/search/stream", payload, []);
+}
+
+// streamSteps POSTs to an SSE endpoint, updating the step cards (matched by id,
+// else by name) as events arrive, and resolves with the "result" payload.
+async function streamSteps(url, payload, initial, entryId = null) {
+  const live = initial.map((s) => ({ ...s }));
+  const keyOf = (s) => s.id || s.name;
+  let result = null;
+  let failure = null;
+  renderSteps(live, entryId);
+  await postEventStream(url, payload, (event, data) => {
+    if (event === "step") {
+      const idx = live.findIndex((s) => keyOf(s) === keyOf(data));
+      if (idx >= 0) {
+        live[idx] = { ...data, liveText: data.status === "running" ? "" : live[idx].liveText };
+      } else {
+        live.push(data);
+      }
+      statusEl.textContent = `${data.name}: ${data.status}`;
+      renderSteps(live, entryId);
+    } else if (event === "token") {
+      const step = live.find((s) => s.name === data.step);
+      if (step) {
+        step.liveText = (step.liveText || "") + data.delta;
+        renderSteps(live, entryId);
+      }
+    } else if (event === "result") {
+      result = data;
+    } else if (event === "error") {
+      failure = data.error;
+    }
+  });
+  if (failure) throw new Error(failure);
+  if (!result) throw new Error("stream closed without result");
+  return result;
+}
+
+// previewPlan asks the server to split the query into steps without running them.
+async function previewPlan() {
+  const query = getQueryValue();
+  if (!query) return;
+  statusEl.textContent = "Planning...";
+  try {
+    const res = await fetch("/api/plan", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ query, jql: jqlInput.value.trim(), ...llmSelection() }),
+    });
+    const data = await res.json();
+    if (!res.ok) throw new Error(data.error || res.statusText);
+    const source = data.source === "llm" ? "LLM" : "эвристика";
+    statusEl.textContent = `План готов (${source}) — проверь шаги и нажми «Run plan»`;
+    setCurrentHistoryId(data.entry.id);
+    renderSteps(data.entry.steps, data.entry.id);
+    await loadHistoryEntries();
+  } catch (err) {
+    statusEl.textContent = `Error: ${err.message}`;
+  }
+}
+
+// runPlan executes all pending steps, or only stepId when given.
+async function runPlan(entryId, steps, stepId = null) {
+  const url = stepId
+    ? `/api/history/${entryId}/steps/${stepId}/run/stream`
+    : `/api/history/${entryId}/run/stream`;
+  try {
+    const data = await streamSteps(url, llmSelection(), steps, entryId);
+    const entry = data.entry;
+    renderSteps(entry.steps, entry.id);
+    if (entry.jql) jqlInput.value = entry.jql;
+    statusEl.textContent = data.error ? `Error: ${data.error}` : "Plan executed";
+    await loadHistoryEntry(entry.id, { focusOutput: false });
+    await loadHistoryEntries();
+  } catch (err) {
+    statusEl.textContent = `Error: ${err.message}`;
+  }
+}
+
+// renderSteps draws step cards. With entryId, planned steps (those with a
+// kind) get run controls.
+function renderSteps(steps, entryId = null) {
   if (!stepsPanel) return;
   stepsPanel.innerHTML = "";
   if (!steps || !steps.length) {
     stepsPanel.innerHTML = `<div class="step-card">Шаги будут показаны здесь после выполнения запроса.</div>`;
     return;
   }
+  const planned = entryId && steps.some((s) => s.kind);
+  if (planned && steps.some((s) => s.kind && s.status !== "completed")) {
+    const runAll = document.createElement("button");
+    runAll.type = "button";
+    runAll.textContent = "Run plan";
+    runAll.addEventListener("click", () => runPlan(entryId, steps));
+    stepsPanel.appendChild(runAll);
+  }
   steps.forEach((step) => {
     const card = document.createElement("div");
     card.className = "step-card";
@@ -778,13 +1448,37 @@ function renderSteps(steps) {
     status.textContent = step.status || "pending";
     header.appendChild(stepName);
     header.appendChild(status);
+    if (planned && step.kind && step.id && step.status !== "running") {
+      const rerun = document.createElement("button");
+      rerun.type = "button";
+      rerun.className = "step-rerun";
+      rerun.title = "Перезапустить шаг";
+      rerun.textContent = "↻";
+      rerun.addEventListener("click", () => runPlan(entryId, steps, step.id));
+      header.appendChild(rerun);
+    }
     card.appendChild(header);
+    if (step.error) {
+      const err = document.createElement("div");
+      err.className = "step-error";
+      err.textContent = step.error;
+      card.appendChild(err);
+    }
     if (step.description) {
       const desc = document.createElement("div");
       desc.textContent = step.description;
       card.appendChild(desc);
     }
-    const resultText = step.result ? formatStepResult(step.result) : "";
+    if (step.usage) {
+      const usage = document.createElement("div");
+      usage.className = "step-usage";
+      usage.textContent = formatUsage(step.usage);
+      card.appendChild(usage);
+    }
+    if (entryId && step.kind === "test_cases" && step.status === "completed") {
+      card.appendChild(testCaseExportLinks(entryId, step.id));
+    }
+    const resultText = step.result ? formatStepResult(step.result) : step.liveText || "";
     if (resultText) {
       const pre = document.createElement("pre");
       pre.textContent = resultText;
@@ -794,6 +1488,14 @@ function renderSteps(steps) {
   });
 }
 
+function formatUsage(usage) {
+  const tokens = (usage.promptTokens || 0) + (usage.completionTokens || 0);
+  const approx = usage.estimated ? "~" : "";
+  const cost = usage.costUsd ? `, $${usage.costUsd.toFixed(4)}` : "";
+  const model = usage.model ? `${usage.model}: ` : "";
+  return `${model}${approx}${tokens} tokens (${usage.promptTokens || 0} in / ${usage.completionTokens || 0} out)${cost}`;
+}
+
 function formatStepResult(raw) {
   try {
     const parsed = typeof raw === "string" ? JSON.parse(raw) : raw;
@@ -825,20 +1527,40 @@ async function executeCommand() {
   commandRunBtn.disabled = true;
   commandInput.disabled = true;
   appendCommandEntry(`> ${command}`);
+  const answerRow = appendCommandEntry("…");
+  let streamed = "";
   try {
-    const res = await fetch(`/api/history/${currentHistoryId}/action`, {
-      method: "POST",
-      headers: { "Content-Type": "application/json" },
-      body: JSON.stringify({ command }),
+    let result = null;
+    let failure = null;
+    const mode = commandModeSelect ? commandModeSelect.value : "";
+    await postEventStream(`/api/history/${currentHistoryId}/action/stream`, { command, mode, ...llmSelection() }, (event, data) => {
+      if (event === "token") {
+        streamed += data.delta;
+        answerRow.textContent = streamed;
+        commandOutput.scrollTop = commandOutput.scrollHeight;
+      } else if (event === "result") {
+        result = data;
+      } else if (event === "error") {
+        failure = data.error;
+      }
     });
-    if (!res.ok) {
-      const data = await res.json().catch(() => ({}));
-      const message = data.error || res.statusText;
-      appendCommandEntry(`Ошибка: ${message}`);
+    if (failure) {
+      answerRow.textContent = `Ошибка: ${failure}`;
       return;
     }
-    const data = await res.json();
-    appendCommandEntry(data.result || "Пустой ответ.");
+    answerRow.textContent = (result && result.result) || streamed || "Пустой ответ.";
+    if (result && result.child) {
+      const child = result.child;
+      const open = document.createElement("button");
+      open.type = "button";
+      open.textContent = "Открыть уточнённый результат";
+      open.addEventListener("click", async () => {
+        await loadHistoryEntries();
+        await loadHistoryEntry(child.id);
+      });
+      answerRow.appendChild(document.createElement("br"));
+      answerRow.appendChild(open);
+    }
   } catch (err) {
     appendCommandEntry(`Ошибка выполнения: ${err.message}`);
   } finally {
@@ -847,6 +1569,105 @@ async function executeCommand() {
   }
 }
 
+// generateTestCases writes structured test cases for the issues of the
+// current history entry; the command text, if any, refines the request.
+async function generateTestCases() {
+  if (!currentHistoryId) {
+    appendCommandEntry("Нет истории для тест-кейсов.");
+    return;
+  }
+  const attach = testCasesAttach && testCasesAttach.checked;
+  testCasesBtn.disabled = true;
+  appendCommandEntry("> тест-кейсы" + (attach ? " (с комментарием в Jira)" : ""));
+  const row = appendCommandEntry("…");
+  try {
+    const res = await fetch("/api/testcases", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({
+        historyId: currentHistoryId,
+        instruction: commandInput ? commandInput.value.trim() : "",
+        attach,
+        ...llmSelection(),
+      }),
+    });
+    const data = await res.json();
+    if (!res.ok) {
+      row.textContent = `Ошибка: ${data.error || res.status}`;
+      return;
+    }
+    let text = data.markdown || "";
+    if (data.failed) {
+      text += "\n" + Object.entries(data.failed).map(([k, e]) => `⚠ ${k}: ${e}`).join("\n");
+    }
+    if (data.attached) {
+      text += "\nКомментарии: " + Object.entries(data.attached).map(([k, s]) => `${k} — ${s}`).join(", ");
+    }
+    row.textContent = text;
+    const step = data.entry.steps[data.entry.steps.length - 1];
+    row.appendChild(testCaseExportLinks(data.entry.id, step.id));
+    renderSteps(data.entry.steps, data.entry.id);
+  } catch (err) {
+    row.textContent = `Ошибка: ${err.message}`;
+  } finally {
+    testCasesBtn.disabled = false;
+  }
+}
+
+function testCaseExportLinks(entryId, stepId) {
+  const box = document.createElement("div");
+  box.className = "export-links";
+  box.append("Экспорт: ");
+  [
+    ["md", "Markdown"],
+    ["csv", "CSV"],
+    ["xray", "Xray JSON"],
+    ["zephyr", "Zephyr JSON"],
+  ].forEach(([format, label]) => {
+    const a = document.createElement("a");
+    a.href = `/api/history/${entryId}/testcases?format=${format}&step=${encodeURIComponent(stepId)}`;
+    a.textContent = label;
+    box.appendChild(a);
+  });
+  return box;
+}
+
+// renderThread shows the stored follow-up conversation of the current entry.
+function renderThread(thread) {
+  if (!commandOutput) return;
+  commandOutput.innerHTML = "";
+  if (!thread) return;
+  if (thread.summary) {
+    appendCommandEntry(`(резюме ранних реплик) ${thread.summary}`);
+  }
+  (thread.turns || []).slice(thread.summarized || 0).forEach((turn) => {
+    appendCommandEntry(turn.role === "user" ? `> ${turn.content}` : turn.content);
+  });
+}
+
+async function clearThread() {
+  if (!currentHistoryId) return;
+  const res = await fetch(`/api/history/${currentHistoryId}/thread`, { method: "DELETE" });
+  if (res.ok) {
+    renderThread(null);
+  } else {
+    appendCommandEntry(`Ошибка ${res.status}`);
+  }
+}
+
+async function forkThread() {
+  if (!currentHistoryId) return;
+  const res = await fetch(`/api/history/${currentHistoryId}/thread/fork`, { method: "POST" });
+  if (!res.ok) {
+    appendCommandEntry(`Ошибка ${res.status}`);
+    return;
+  }
+  const fork = await res.json();
+  await loadHistoryEntries();
+  await loadHistoryEntry(fork.id, { focusOutput: false });
+  appendCommandEntry(`Новая ветка диалога: ${fork.id}`);
+}
+
 function appendCommandEntry(text) {
   if (!commandOutput) return;
   const row = document.createElement("div");
@@ -854,5 +1675,6 @@ function appendCommandEntry(text) {
   row.textContent = text;
   commandOutput.appendChild(row);
   commandOutput.scrollTop = commandOutput.scrollHeight;
+  return row;
 }
 